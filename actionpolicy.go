@@ -0,0 +1,156 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"fmt"
+	"path"
+)
+
+// ActionRule matches requests by action and domain. Domains are path.Match
+// patterns such as "analytics_*". Empty lists match everything, the domain
+// of ListDomains is empty.
+type ActionRule struct {
+	Actions []string
+	Domains []string
+}
+
+func (r ActionRule) matches(action string, domain string) bool {
+	return matchAny(r.Actions, action, false) && matchAny(r.Domains, domain, true)
+}
+
+func matchAny(patterns []string, s string, glob bool) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok && glob || p == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ActionPolicy decides which requests a client may send. A request matching
+// a Deny rule is refused, otherwise it is allowed if there are no Allow
+// rules or one of them matches.
+type ActionPolicy struct {
+	Allow []ActionRule
+	Deny  []ActionRule
+}
+
+func (p ActionPolicy) allows(action string, domain string) bool {
+	for _, r := range p.Deny {
+		if r.matches(action, domain) {
+			return false
+		}
+	}
+	if len(p.Allow) == 0 {
+		return true
+	}
+	for _, r := range p.Allow {
+		if r.matches(action, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadOnlyActions denies every action that changes domains or items.
+var ReadOnlyActions = ActionPolicy{Deny: []ActionRule{{Actions: []string{
+	"CreateDomain", "DeleteDomain",
+	"PutAttributes", "BatchPutAttributes",
+	"DeleteAttributes", "BatchDeleteAttributes",
+}}}}
+
+// ActionError is returned for requests the ActionPolicy of the client
+// refuses. The request is not sent.
+type ActionError struct {
+	Action string
+	Domain string
+}
+
+func (e ActionError) Error() string {
+	if e.Domain == "" {
+		return fmt.Sprintf("%s refused by the client's action policy", e.Action)
+	}
+	return fmt.Sprintf("%s on %s refused by the client's action policy", e.Action, e.Domain)
+}
+
+// ReadOnlyError is the ActionError of clients made with WithReadOnly.
+type ReadOnlyError = ActionError
+
+// WithActionPolicy returns a copy of the client that also enforces p.
+// Policies add up, a request must be allowed by every one, so a copy can
+// not be given more rights than the client it was made from.
+func (sdb SimpleDB) WithActionPolicy(p ActionPolicy) SimpleDB {
+	sdb.actions = append(sdb.actions[:len(sdb.actions):len(sdb.actions)], p)
+	return sdb
+}
+
+// WithReadOnly returns a copy of the client that refuses every mutating
+// action, for tools that must not write. Copies made from it stay
+// read-only.
+func (sdb SimpleDB) WithReadOnly() SimpleDB {
+	return sdb.WithActionPolicy(ReadOnlyActions)
+}
+
+// checkAction refuses the request being built if a policy of the client
+// does not allow it.
+func (sdb *SimpleDB) checkAction() error {
+	if a := sdb.p.Get("Action"); a == "Select" {
+		return sdb.allowsSelect(sdb.p.Get("SelectExpression"))
+	}
+	return sdb.allowsAction(sdb.p.Get("Action"), sdb.requestDomain())
+}
+
+// allowsSelect refuses q if a policy of the client does not allow a Select
+// of its domain. The domain is taken from the parsed expression, so an
+// expression that does not parse is refused.
+func (sdb *SimpleDB) allowsSelect(q string) error {
+	if len(sdb.actions) == 0 {
+		return nil
+	}
+	s, err := ParseSelect(q)
+	if err != nil {
+		return ActionError{Action: "Select"}
+	}
+	return sdb.allowsAction("Select", s.Domain)
+}
+
+// allowsAction refuses action on domain if a policy of the client does not
+// allow it. Reads served from a cache check it before the lookup.
+func (sdb *SimpleDB) allowsAction(action, domain string) error {
+	for _, p := range sdb.actions {
+		if !p.allows(action, domain) {
+			return ActionError{Action: action, Domain: domain}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package sdb
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestReadOnly(t *testing.T) {
+	pt := &policyTransport{}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: pt}
+	ro := c.WithReadOnly()
+
+	var re ReadOnlyError
+	for _, err := range []error{
+		func() error {
+			_, err := ro.PutAttributes("users", &Item{Name: "u1", Attributes: []Attribute{{Name: "a", Value: "b"}}})
+			return err
+		}(),
+		func() error { _, err := ro.BatchDeleteAttributes("users", []*Item{{Name: "u1"}}); return err }(),
+		func() error { _, err := ro.DeleteItem("users", "u1"); return err }(),
+		func() error { _, err := ro.CreateDomain("users"); return err }(),
+	} {
+		if !errors.As(err, &re) {
+			t.Errorf("expected a ReadOnlyError, got %v", err)
+		}
+	}
+	if pt.calls != 0 {
+		t.Errorf("refused actions made %d requests", pt.calls)
+	}
+	if re.Domain != "users" || re.Action != "CreateDomain" {
+		t.Errorf("unexpected error %+v", re)
+	}
+	if _, err := ro.GetAttributes("users", "u1"); err != nil || pt.calls != 1 {
+		t.Errorf("GetAttributes = %v after %d calls", err, pt.calls)
+	}
+	if _, err := c.DeleteItem("users", "u1"); err != nil {
+		t.Errorf("original client refused a write: %v", err)
+	}
+}
+
+func TestActionPolicy(t *testing.T) {
+	pt := &policyTransport{}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: pt}
+	c = c.WithActionPolicy(ActionPolicy{
+		Allow: []ActionRule{{Actions: []string{"GetAttributes", "Select", "PutAttributes"}, Domains: []string{"app_*"}}},
+		Deny:  []ActionRule{{Actions: []string{"PutAttributes"}, Domains: []string{"app_audit"}}},
+	})
+	put := func(db SimpleDB, domain string) error {
+		_, err := db.PutAttributes(domain, &Item{Name: "u1", Attributes: []Attribute{{Name: "a", Value: "b"}}})
+		return err
+	}
+
+	var ae ActionError
+	for _, err := range []error{
+		put(c, "app_audit"),
+		put(c, "billing"),
+		func() error { _, err := c.Select("select * from billing"); return err }(),
+		func() error { _, err := c.Select("select `from app_x`, ssn from secret"); return err }(),
+		func() error { _, err := c.Select("select * from app_users where"); return err }(),
+		func() error { _, err := c.DeleteItem("app_users", "u1"); return err }(),
+		func() error { _, err := c.ListDomains(); return err }(),
+		put(c.WithReadOnly(), "app_users"),
+		put(c.WithActionPolicy(ActionPolicy{}).WithActionPolicy(ActionPolicy{Deny: []ActionRule{{Domains: []string{"app_users"}}}}), "app_users"),
+	} {
+		if !errors.As(err, &ae) {
+			t.Errorf("expected an ActionError, got %v", err)
+		}
+	}
+	if pt.calls != 0 {
+		t.Errorf("refused actions made %d requests", pt.calls)
+	}
+	for _, err := range []error{
+		put(c, "app_users"),
+		func() error { _, err := c.Select("select * from app_users"); return err }(),
+		func() error { _, err := c.GetAttributes("app_audit", "u1"); return err }(),
+	} {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
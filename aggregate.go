@@ -0,0 +1,140 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// MaxGroups is the number of groups SelectGroupBy keeps before giving up
+// with ErrTooManyGroups, so memory stays bounded whatever the domain size.
+var MaxGroups = 10000
+
+var ErrTooManyGroups = errors.New("sdb: too many groups")
+
+// Stats summarizes an attribute over the items of a Select. Count is the
+// number of items, Values the number of values of the attribute that Sum,
+// Min and Max cover.
+type Stats struct {
+	Count    int64
+	Values   int64
+	Sum      float64
+	Min, Max float64
+}
+
+// Mean is the average of the values, 0 without values.
+func (s Stats) Mean() float64 {
+	if s.Values == 0 {
+		return 0
+	}
+	return s.Sum / float64(s.Values)
+}
+
+func (s *Stats) add(i Item, attr string, parse func(string) (float64, error)) error {
+	s.Count++
+	for _, a := range i.Attributes {
+		if a.Name != attr {
+			continue
+		}
+		v, err := parse(a.Value)
+		if err != nil {
+			return fmt.Errorf("attribute %s of %s: %w", attr, i.Name, err)
+		}
+		if s.Values == 0 || v < s.Min {
+			s.Min = v
+		}
+		if s.Values == 0 || v > s.Max {
+			s.Max = v
+		}
+		s.Values++
+		s.Sum += v
+	}
+	return nil
+}
+
+// SelectStats streams the items matching q with SelectStream and sums up
+// the values of attr, which parse converts to numbers. A nil parse parses
+// plain decimals, use DecodeFloat for values written with EncodeFloat. With
+// an empty attr only the items are counted.
+func (sdb *SimpleDB) SelectStats(ctx context.Context, q string, attr string, parse func(string) (float64, error)) (s Stats, err error) {
+	if parse == nil {
+		parse = parseFloat
+	}
+	err = sdb.SelectStream(ctx, q, func(i Item) error {
+		return s.add(i, attr, parse)
+	})
+	return
+}
+
+// SelectGroupBy is SelectStats for every value of the attribute key. Items
+// without key are grouped under the empty string and items with several
+// values are counted in each of their groups. Only the groups are kept in
+// memory, up to MaxGroups.
+func (sdb *SimpleDB) SelectGroupBy(ctx context.Context, q string, key string, attr string, parse func(string) (float64, error)) (groups map[string]*Stats, err error) {
+	if parse == nil {
+		parse = parseFloat
+	}
+	groups = make(map[string]*Stats)
+	err = sdb.SelectStream(ctx, q, func(i Item) error {
+		var values []string
+		for _, a := range i.Attributes {
+			if a.Name == key {
+				values = append(values, a.Value)
+			}
+		}
+		if len(values) == 0 {
+			values = []string{""}
+		}
+		for _, v := range values {
+			s, ok := groups[v]
+			if !ok {
+				if len(groups) >= MaxGroups {
+					return fmt.Errorf("%w: more than %d values of %s", ErrTooManyGroups, MaxGroups, key)
+				}
+				s = &Stats{}
+				groups[v] = s
+			}
+			if err := s.add(i, attr, parse); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func parseFloat(s string) (float64, error) {
+	return strconv.ParseFloat(s, 64)
+}
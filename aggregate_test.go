@@ -0,0 +1,43 @@
+package sdb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+const aggregatePage = `<SelectResponse><SelectResult>
+<Item><Name>o1</Name><Attribute><Name>customer</Name><Value>c1</Value></Attribute><Attribute><Name>total</Name><Value>10</Value></Attribute></Item>
+<Item><Name>o2</Name><Attribute><Name>customer</Name><Value>c2</Value></Attribute><Attribute><Name>total</Name><Value>2.5</Value></Attribute></Item>
+<Item><Name>o3</Name><Attribute><Name>customer</Name><Value>c1</Value></Attribute><Attribute><Name>total</Name><Value>-4</Value></Attribute></Item>
+<Item><Name>o4</Name></Item>
+</SelectResult></SelectResponse>`
+
+func TestSelectStats(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: &pagesTransport{pages: []string{aggregatePage}}}
+	s, err := c.SelectStats(context.Background(), "select * from orders", "total", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Count != 4 || s.Values != 3 || s.Sum != 8.5 || s.Min != -4 || s.Max != 10 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	c.HTTPClient = &http.Client{Transport: &pagesTransport{pages: []string{aggregatePage}}}
+	g, err := c.SelectGroupBy(context.Background(), "select * from orders", "customer", "total", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g) != 3 || g["c1"].Count != 2 || g["c1"].Sum != 6 || g["c1"].Mean() != 3 || g["c2"].Max != 2.5 || g[""].Count != 1 {
+		t.Errorf("unexpected groups %v", g)
+	}
+
+	defer func(n int) { MaxGroups = n }(MaxGroups)
+	MaxGroups = 1
+	c.HTTPClient = &http.Client{Transport: &pagesTransport{pages: []string{aggregatePage}}}
+	if _, err := c.SelectGroupBy(context.Background(), "select * from orders", "customer", "", nil); !errors.Is(err, ErrTooManyGroups) {
+		t.Errorf("expected ErrTooManyGroups, got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// Backoff chooses the delay before a retry. attempt is the number of the
+// failed attempt, starting at 1, and last the delay chosen before the
+// previous retry, 0 before the first.
+type Backoff interface {
+	Delay(attempt int, last time.Duration) time.Duration
+}
+
+// ExponentialBackoff doubles Base with every attempt, up to Max when set,
+// and waits a random time between half and all of it.
+type ExponentialBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+func (b ExponentialBackoff) Delay(attempt int, last time.Duration) time.Duration {
+	d := capDelay(b.Base<<uint(attempt-1), b.Max)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// DecorrelatedJitter waits a random time between Base and three times the
+// previous delay, up to Max when set, spreading out clients that failed
+// together more than ExponentialBackoff.
+type DecorrelatedJitter struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+func (b DecorrelatedJitter) Delay(attempt int, last time.Duration) time.Duration {
+	last = max(last, b.Base)
+	return capDelay(b.Base+time.Duration(rand.Int63n(int64(3*last-b.Base)+1)), b.Max)
+}
+
+// FixedBackoff waits the same time before every retry.
+type FixedBackoff time.Duration
+
+func (b FixedBackoff) Delay(attempt int, last time.Duration) time.Duration {
+	return time.Duration(b)
+}
+
+// FibonacciBackoff grows the delay along the Fibonacci sequence, Base, Base,
+// 2*Base, 3*Base, 5*Base and so on, up to Max when set. It grows slower than
+// ExponentialBackoff.
+type FibonacciBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+func (b FibonacciBackoff) Delay(attempt int, last time.Duration) time.Duration {
+	x, y := time.Duration(0), b.Base
+	for j := 1; j < attempt; j++ {
+		x, y = y, x+y
+		if b.Max > 0 && y >= b.Max || y < x {
+			return capDelay(y, b.Max)
+		}
+	}
+	return capDelay(y, b.Max)
+}
+
+// capDelay limits d to max, when max is set, and guards against overflow.
+func capDelay(d, max time.Duration) time.Duration {
+	if d < 0 || max > 0 && d > max {
+		if max > 0 {
+			return max
+		}
+		return time.Duration(1<<63 - 1)
+	}
+	return d
+}
+
+// backoff returns the strategy for retrying after err: the BackoffByCode
+// entry for its error code or, failing that, its HTTP status, then Backoff
+// and last the jittered doubling of RetryBaseDelay.
+func (sdb *SimpleDB) backoff(err error) Backoff {
+	if len(sdb.BackoffByCode) > 0 {
+		var keys []string
+		switch e := err.(type) {
+		case SimpleDBError:
+			keys = []string{e.Code, strconv.Itoa(e.StatusCode)}
+		case *RequestError:
+			keys = []string{strconv.Itoa(e.StatusCode)}
+		}
+		for _, k := range keys {
+			if b, ok := sdb.BackoffByCode[k]; ok {
+				return b
+			}
+		}
+	}
+	if sdb.Backoff != nil {
+		return sdb.Backoff
+	}
+	return ExponentialBackoff{Base: RetryBaseDelay}
+}
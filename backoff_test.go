@@ -0,0 +1,51 @@
+package sdb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoffStrategies(t *testing.T) {
+	fib := FibonacciBackoff{Base: time.Second, Max: 6 * time.Second}
+	for attempt, expected := range []time.Duration{0, 1, 1, 2, 3, 5, 6, 6} {
+		if attempt == 0 {
+			continue
+		}
+		if d := fib.Delay(attempt, 0); d != expected*time.Second {
+			t.Errorf("Fibonacci attempt %d: expected %v, got %v", attempt, expected*time.Second, d)
+		}
+	}
+	if d := (FixedBackoff(time.Second)).Delay(5, time.Minute); d != time.Second {
+		t.Errorf("Expected fixed delay, got %v", d)
+	}
+	for j := 0; j < 100; j++ {
+		if d := (ExponentialBackoff{Base: time.Second, Max: 4 * time.Second}).Delay(4, 0); d < 2*time.Second || d > 4*time.Second {
+			t.Errorf("Exponential delay %v out of range", d)
+		}
+		if d := (DecorrelatedJitter{Base: time.Second, Max: 5 * time.Second}).Delay(2, 2*time.Second); d < time.Second || d > 5*time.Second {
+			t.Errorf("Decorrelated delay %v out of range", d)
+		}
+	}
+}
+
+func TestBackoffByCode(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.Backoff = FixedBackoff(time.Second)
+	c.BackoffByCode = map[string]Backoff{"RequestThrottled": FixedBackoff(time.Minute), "500": FixedBackoff(time.Millisecond)}
+
+	cases := []struct {
+		err      error
+		expected time.Duration
+	}{
+		{SimpleDBError{Code: "RequestThrottled", StatusCode: 503}, time.Minute},
+		{SimpleDBError{Code: "InternalError", StatusCode: 500}, time.Millisecond},
+		{&RequestError{Err: errors.New("500"), StatusCode: 500}, time.Millisecond},
+		{&RequestError{Err: errors.New("reset")}, time.Second},
+	}
+	for _, tc := range cases {
+		if d := c.backoff(tc.err).Delay(1, 0); d != tc.expected {
+			t.Errorf("%v: expected %v, got %v", tc.err, tc.expected, d)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PartialError is returned by bulk operations that stopped part way.
+//
+// Writes stop before all batches are written, because a batch failed or the
+// context's deadline left too little time for the next one. Done lists the
+// items completely written and Remaining those to write again, in order.
+//
+// Reads return the items of the pages read before a page failed or the
+// context ended, when partial results are asked for, see the PartialResults
+// option of SimpleDB. Reading can resume from NextToken.
+type PartialError struct {
+	Op        string
+	Done      []string
+	Remaining []string
+	Pages     int
+	Items     int
+	NextToken string
+	Err       error
+}
+
+func (e *PartialError) Error() string {
+	if len(e.Remaining) == 0 {
+		return fmt.Sprintf("read %d items in %d pages before: %v", e.Items, e.Pages, e.Err)
+	}
+	return fmt.Sprintf("%s stopped after %d of %d items: %v", e.Op, len(e.Done), len(e.Done)+len(e.Remaining), e.Err)
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// maxBatchItems is the most items a batch request takes.
+const maxBatchItems = 25
+
+// batches splits items into groups of at most maxBatchItems.
+func batches(items []*Item) (b [][]*Item) {
+	for len(items) > 0 {
+		n := len(items)
+		if n > maxBatchItems {
+			n = maxBatchItems
+		}
+		b = append(b, items[:n])
+		items = items[n:]
+	}
+	return
+}
+
+// runBatches calls fn for every batch in turn. When ctx has a deadline each
+// batch gets an equal share of the time left, or the average time batches
+// took so far if that is more, and no batch is started once that average is
+// more than the time left. The run then stops with a *PartialError wrapping
+// context.DeadlineExceeded instead of being cut off mid batch, a failing
+// batch stops it with a *PartialError wrapping the batch's error.
+func runBatches(ctx context.Context, op string, b [][]*Item, fn func(ctx context.Context, k int, batch []*Item) error) error {
+	var took time.Duration
+	for k, batch := range b {
+		bctx, cancel := ctx, context.CancelFunc(func() {})
+		if deadline, ok := ctx.Deadline(); ok {
+			left := time.Until(deadline)
+			var avg time.Duration
+			if k > 0 {
+				avg = took / time.Duration(k)
+			}
+			if left <= 0 || avg > left {
+				return partialError(op, b, k, context.DeadlineExceeded)
+			}
+			bctx, cancel = context.WithTimeout(ctx, min(max(left/time.Duration(len(b)-k), avg), left))
+		}
+		start := time.Now()
+		err := fn(bctx, k, batch)
+		cancel()
+		took += time.Since(start)
+		if err != nil {
+			return partialError(op, b, k, err)
+		}
+	}
+	return nil
+}
+
+// partialError reports the batches before k as done.
+func partialError(op string, b [][]*Item, k int, err error) *PartialError {
+	e := &PartialError{Op: op, Err: err}
+	remaining := make(map[string]bool)
+	for _, batch := range b[k:] {
+		for _, i := range batch {
+			if !remaining[i.Name] {
+				remaining[i.Name] = true
+				e.Remaining = append(e.Remaining, i.Name)
+			}
+		}
+	}
+	done := make(map[string]bool)
+	for _, batch := range b[:k] {
+		for _, i := range batch {
+			if !remaining[i.Name] && !done[i.Name] {
+				done[i.Name] = true
+				e.Done = append(e.Done, i.Name)
+			}
+		}
+	}
+	return e
+}
@@ -0,0 +1,57 @@
+package sdb
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func testBatches(n int) [][]*Item {
+	var items []*Item
+	for j := 0; j < n; j++ {
+		items = append(items, NewItem("i"+strconv.Itoa(j)))
+	}
+	return batches(items)
+}
+
+func TestRunBatchesDeadline(t *testing.T) {
+	b := testBatches(2 * maxBatchItems)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := runBatches(ctx, "Put", b, func(bctx context.Context, k int, batch []*Item) error {
+		if d, ok := bctx.Deadline(); !ok || !d.Before(time.Now().Add(150*time.Millisecond)) {
+			t.Errorf("Expected half of the time left as the batch deadline, got %v", d)
+		}
+		// the first batch takes longer than the time left after it, so
+		// the second is not started whatever the timing
+		time.Sleep(120 * time.Millisecond)
+		return nil
+	})
+	var pe *PartialError
+	if !errors.As(err, &pe) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected partial deadline error, got %v", err)
+	}
+	if len(pe.Done) != maxBatchItems || len(pe.Remaining) != maxBatchItems || pe.Remaining[0] != "i25" {
+		t.Errorf("Unexpected report %d done, %d remaining", len(pe.Done), len(pe.Remaining))
+	}
+}
+
+func TestRunBatchesError(t *testing.T) {
+	b := testBatches(60)
+	failed := errors.New("failed")
+	err := runBatches(context.Background(), "Put", b, func(ctx context.Context, k int, batch []*Item) error {
+		if k == 1 {
+			return failed
+		}
+		return nil
+	})
+	var pe *PartialError
+	if !errors.As(err, &pe) || !errors.Is(err, failed) || len(pe.Done) != 25 || len(pe.Remaining) != 35 || pe.Remaining[0] != "i25" {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err = runBatches(context.Background(), "Put", b, func(context.Context, int, []*Item) error { return nil }); err != nil {
+		t.Error(err)
+	}
+}
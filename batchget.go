@@ -0,0 +1,88 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+// MaxInValues is the number of item names GetByNames puts in one
+// itemName() in (...) predicate.
+const MaxInValues = 20
+
+// GetByNames fetches the named items with one Select per MaxInValues names
+// instead of one GetAttributes call each. Items are returned in the order of
+// names, names without an item are left out. Duplicate names are fetched once.
+// With PartialResults the items found before a failing Select are returned
+// with a *PartialError.
+func (sdb *SimpleDB) GetByNames(domain string, names []string) (items []Item, err error) {
+	found := make(map[string]Item, len(names))
+	var unique []string
+	seen := make(map[string]bool, len(names))
+	for _, n := range names {
+		if !seen[n] {
+			seen[n] = true
+			unique = append(unique, n)
+		}
+	}
+
+	pages := 0
+	for len(unique) > 0 && err == nil {
+		chunk := unique
+		if len(chunk) > MaxInValues {
+			chunk = chunk[:MaxInValues]
+		}
+		unique = unique[len(chunk):]
+
+		q := NewQuery(domain).WhereIn("itemName()", chunk...).String()
+		token := ""
+		for {
+			var r SelectResponse
+			if r, err = sdb.SelectWithToken(q, token); err != nil {
+				if !sdb.PartialResults {
+					return nil, err
+				}
+				err = &PartialError{Op: "GetByNames", Pages: pages, Items: len(found), Err: err}
+				break
+			}
+			pages++
+			for _, i := range r.Items {
+				found[i.Name] = i
+			}
+			if r.NextToken == "" {
+				break
+			}
+			token = r.NextToken
+		}
+	}
+
+	for _, n := range names {
+		if i, ok := found[n]; ok {
+			items = append(items, i)
+			delete(found, n)
+		}
+	}
+	return
+}
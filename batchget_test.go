@@ -0,0 +1,29 @@
+package sdb
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGetByNames(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.Cache = NewSelectCache(time.Minute, 10)
+	var names []string
+	for j := 0; j < 25; j++ {
+		names = append(names, strconv.Itoa(j))
+	}
+	q1 := NewQuery("d").WhereIn("itemName()", names[:20]...).String()
+	q2 := NewQuery("d").WhereIn("itemName()", names[20:]...).String()
+	c.Cache.put(selectCacheKey(q1, "", false), q1, SelectResponse{Items: []Item{{Name: "3"}}, NextToken: "t"})
+	c.Cache.put(selectCacheKey(q1, "t", false), q1, SelectResponse{Items: []Item{{Name: "1"}}})
+	c.Cache.put(selectCacheKey(q2, "", false), q2, SelectResponse{Items: []Item{{Name: "24"}}})
+
+	items, err := c.GetByNames("d", append(names, "3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 || items[0].Name != "1" || items[1].Name != "3" || items[2].Name != "24" {
+		t.Error(items)
+	}
+}
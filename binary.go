@@ -0,0 +1,98 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io/ioutil"
+)
+
+// SetBinary stores data base64 encoded and chunked as with SetChunked. With
+// compress set the data is gzipped first and name.encoding records it.
+func (i *Item) SetBinary(name string, data []byte, compress bool) error {
+	if compress {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+		i.ReplaceAttribute(name+".encoding", "gzip")
+	}
+	return i.SetChunked(name, base64.StdEncoding.EncodeToString(data))
+}
+
+// Binary returns data stored with SetBinary, ok is false if the item has no
+// such value.
+func (i Item) Binary(name string) (data []byte, ok bool, err error) {
+	s, ok, err := i.Chunked(name)
+	if !ok || err != nil {
+		return
+	}
+	if data, err = base64.StdEncoding.DecodeString(s); err != nil {
+		return
+	}
+	if i.Value(name+".encoding") == "gzip" {
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(data)); err != nil {
+			return
+		}
+		data, err = ioutil.ReadAll(r)
+	}
+	return
+}
+
+// PutBinary stores data in the attribute name of the item, replacing any
+// previous value.
+func (sdb *SimpleDB) PutBinary(domain string, itemName string, name string, data []byte, compress bool) (err error) {
+	i := NewItem(itemName)
+	if err = i.SetBinary(name, data, compress); err != nil {
+		return
+	}
+	if !compress {
+		i.ReplaceAttribute(name+".encoding", "raw")
+	}
+	_, err = sdb.PutAttributes(domain, i)
+	return
+}
+
+// GetBinary returns the data stored with PutBinary or nil if there is none.
+func (sdb *SimpleDB) GetBinary(domain string, itemName string, name string) (data []byte, err error) {
+	r, err := sdb.GetAttributes(domain, itemName)
+	if err != nil {
+		return
+	}
+	data, _, err = Item{Name: itemName, Attributes: r.Attributes}.Binary(name)
+	return
+}
@@ -0,0 +1,52 @@
+package sdb_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+type document struct {
+	ID    string `sdb:",itemname"`
+	Title string `sdb:"title"`
+	Body  []byte `sdb:"body"`
+}
+
+func TestBinaryValues(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	db.ConsistentRead = true
+	if _, err := db.CreateDomain("files"); err != nil {
+		t.Fatal(err)
+	}
+	random := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(random)
+	repeated := bytes.Repeat([]byte("simpledb "), 1000)
+
+	for _, c := range []struct {
+		data     []byte
+		compress bool
+	}{{random, false}, {repeated, true}, {[]byte{0, 1, 2}, false}} {
+		if err := db.PutBinary("files", "f", "data", c.data, c.compress); err != nil {
+			t.Fatal(err)
+		}
+		got, err := db.GetBinary("files", "f", "data")
+		if err != nil || !bytes.Equal(got, c.data) {
+			t.Fatalf("GetBinary returned %d bytes, %v, want %d bytes", len(got), err, len(c.data))
+		}
+	}
+
+	d := document{ID: "d", Title: "notes", Body: random}
+	if err := db.PutStruct("files", &d); err != nil {
+		t.Fatal(err)
+	}
+	var got document
+	if found, err := db.GetStruct("files", "d", &got); err != nil || !found {
+		t.Fatalf("GetStruct = %v, %v", found, err)
+	}
+	if got.ID != d.ID || got.Title != d.Title || !bytes.Equal(got.Body, d.Body) {
+		t.Fatalf("GetStruct returned %q with %d body bytes", got.Title, len(got.Body))
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// ErrNoIndexKey is returned for blind indexes of an Encryptor without
+// IndexKey, an unkeyed hash could be reversed by hashing guessed values.
+var ErrNoIndexKey = errors.New("sdb: blind index without IndexKey")
+
+// Index returns the blind index of value v of attr, a keyed hash that is
+// the same for equal values. It makes encrypted attributes queryable by
+// equality: for every value written to an attribute listed in Indexes the
+// client also writes the index attribute with its blind index.
+//
+//	e.Indexes = map[string]string{"email": "email_idx"}
+//	t, _ := sdb.ParseQueryTemplate("select * from users where email_idx = :v")
+//	idx, err := e.Index("email", email)
+//	q, _ := t.Expand(map[string]interface{}{"v": idx})
+//
+// The tradeoff: anyone reading the domain can see which items share a
+// value and how often values occur, and guess common values if IndexKey
+// leaks. Only equality and "in" work, not ranges, prefixes or like.
+// IndexKey must not change once indexes are written, and is separate from
+// the encryption keys so it survives their rotation. Index fails with
+// ErrNoIndexKey if IndexKey is empty.
+func (e *Encryptor) Index(attr string, v string) (string, error) {
+	if len(e.IndexKey) == 0 {
+		return "", ErrNoIndexKey
+	}
+	mac := hmac.New(sha256.New, e.IndexKey)
+	mac.Write([]byte(attr))
+	mac.Write([]byte{0})
+	mac.Write([]byte(v))
+	return hex.EncodeToString(mac.Sum(nil)[:16]), nil
+}
+
+// indexItem returns i with the index attributes of its indexed attributes
+// added, or i itself if there are none. Empty values, which delete every
+// value of an attribute, are passed on to the index.
+func (e *Encryptor) indexItem(i *Item) (*Item, error) {
+	if e == nil || len(e.Indexes) == 0 {
+		return i, nil
+	}
+	var index []Attribute
+	for _, a := range i.Attributes {
+		name, ok := e.Indexes[a.Name]
+		if !ok {
+			continue
+		}
+		ia := Attribute{Name: name, Replace: a.Replace}
+		if a.Value != "" {
+			var err error
+			if ia.Value, err = e.Index(a.Name, a.Value); err != nil {
+				return nil, err
+			}
+		}
+		index = append(index, ia)
+	}
+	if len(index) == 0 {
+		return i, nil
+	}
+	return &Item{Name: i.Name, Attributes: append(append([]Attribute(nil), i.Attributes...), index...)}, nil
+}
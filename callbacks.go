@@ -0,0 +1,59 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+// BeforePutter is implemented by structs that prepare themselves for
+// storage, such as normalizing or validating fields. BeforePut is called on
+// the value passed to MarshalItem or PutStruct before it is marshaled, an
+// error stops the marshaling and is returned.
+type BeforePutter interface {
+	BeforePut() error
+}
+
+// AfterGetter is implemented by structs that finish themselves after being
+// read, such as decrypting fields or filling in defaults. AfterGet is called
+// by UnmarshalItem, and so by GetStruct and SelectInto, after the attributes
+// are decoded, an error is returned as the read error.
+type AfterGetter interface {
+	AfterGet() error
+}
+
+func beforePut(v interface{}) error {
+	if h, ok := v.(BeforePutter); ok {
+		return h.BeforePut()
+	}
+	return nil
+}
+
+func afterGet(v interface{}) error {
+	if h, ok := v.(AfterGetter); ok {
+		return h.AfterGet()
+	}
+	return nil
+}
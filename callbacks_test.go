@@ -0,0 +1,45 @@
+package sdb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type callbackUser struct {
+	ID    string `sdb:",itemname"`
+	Email string `sdb:"email"`
+	Name  string `sdb:"-"`
+}
+
+func (u *callbackUser) BeforePut() error {
+	if u.Email == "" {
+		return errors.New("email is required")
+	}
+	u.Email = strings.ToLower(u.Email)
+	return nil
+}
+
+func (u *callbackUser) AfterGet() error {
+	u.Name = strings.Split(u.Email, "@")[0]
+	return nil
+}
+
+func TestCallbacks(t *testing.T) {
+	u := callbackUser{ID: "u1", Email: "Ann@Example.com"}
+	i, err := MarshalItem(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Value("email") != "ann@example.com" {
+		t.Errorf("Unexpected item %v", i)
+	}
+	if _, err = MarshalItem(&callbackUser{ID: "u2"}); err == nil {
+		t.Error("Expected BeforePut error")
+	}
+
+	var out callbackUser
+	if err = UnmarshalItem(*i, &out); err != nil || out.Name != "ann" {
+		t.Errorf("Unexpected %+v %v", out, err)
+	}
+}
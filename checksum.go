@@ -0,0 +1,164 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrNoChecksumKey is returned by writes and reads of a client with a
+// Checksum but no ChecksumKey. An unkeyed hash could be recomputed by
+// anyone able to write the item.
+var ErrNoChecksumKey = errors.New("sdb: Checksum without ChecksumKey")
+
+// IntegrityError is returned by reads of an item whose attributes do not
+// match the HMAC in its Checksum attribute, because the item was modified
+// without the key or corrupted.
+type IntegrityError struct {
+	Item     string
+	Stored   string
+	Computed string
+}
+
+func (e IntegrityError) Error() string {
+	return fmt.Sprintf("item %s fails its checksum: stored %s, computed %s", e.Item, e.Stored, e.Computed)
+}
+
+// ItemChecksum returns the HMAC-SHA256 under key of the attributes of an
+// item, except the one named exclude, independent of their order.
+func ItemChecksum(key []byte, attrs []Attribute, exclude string) string {
+	pairs := make([]string, 0, len(attrs))
+	for _, a := range attrs {
+		if a.Name != exclude {
+			pairs = append(pairs, a.Name+"\x00"+a.Value)
+		}
+	}
+	sort.Strings(pairs)
+	h := hmac.New(sha256.New, key)
+	for _, p := range pairs {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return base64.RawStdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// addChecksum returns i with the Checksum attribute set to the HMAC of its
+// normalized values. Partial puts are left alone, the delete following them
+// recomputes the checksum.
+func (sdb *SimpleDB) addChecksum(i *Item) (*Item, error) {
+	if sdb.Checksum == "" || sdb.partialPut {
+		return i, nil
+	}
+	if len(sdb.ChecksumKey) == 0 {
+		return nil, ErrNoChecksumKey
+	}
+	attrs := make([]Attribute, 0, len(i.Attributes)+1)
+	for _, a := range i.Attributes {
+		if a.Name == sdb.Checksum {
+			continue
+		}
+		if sdb.NormalizeValue != nil {
+			a.Value = sdb.NormalizeValue(a.Value)
+		}
+		attrs = append(attrs, a)
+	}
+	attrs = append(attrs, Attribute{Name: sdb.Checksum, Value: ItemChecksum(sdb.ChecksumKey, attrs, sdb.Checksum), Replace: true})
+	return &Item{Name: i.Name, Attributes: attrs}, nil
+}
+
+// dropChecksum returns i with the Checksum attribute added to the
+// attributes it deletes, so the stale checksum goes with them, and whether
+// the checksum must then be recomputed with resealChecksum. Deletes of
+// whole items are left alone.
+func (sdb *SimpleDB) dropChecksum(i *Item) (*Item, bool) {
+	if sdb.Checksum == "" || len(i.Attributes) == 0 {
+		return i, false
+	}
+	for _, a := range i.Attributes {
+		if a.Name == sdb.Checksum && a.Value == "" {
+			return i, true
+		}
+	}
+	attrs := append(append([]Attribute(nil), i.Attributes...), Attribute{Name: sdb.Checksum})
+	return &Item{Name: i.Name, Attributes: attrs}, true
+}
+
+// resealChecksum writes the Checksum of the named item after a partial
+// write removed it, from a consistent read. The write is skipped if a
+// checksum was written meanwhile.
+func (sdb *SimpleDB) resealChecksum(domain string, itemName string) error {
+	if len(sdb.ChecksumKey) == 0 {
+		return ErrNoChecksumKey
+	}
+	db := *sdb
+	db.ConsistentRead = true
+	db.Checksum, db.Policy, db.Masks, db.Repair = "", nil, nil, nil
+	r, err := db.GetAttributes(domain, itemName)
+	if err != nil || len(r.Attributes) == 0 {
+		return err
+	}
+	for _, a := range r.Attributes {
+		if a.Name == sdb.Checksum {
+			return nil
+		}
+	}
+	sum := NewItem(itemName)
+	sum.ReplaceAttribute(sdb.Checksum, ItemChecksum(sdb.ChecksumKey, r.Attributes, sdb.Checksum))
+	_, err = db.putAttributes(domain, sum, &Condition{Name: sdb.Checksum})
+	if IsConditionalCheckFailed(err) {
+		err = nil
+	}
+	return err
+}
+
+// verifyChecksum checks items read with their Checksum attribute; items
+// without it, such as those from Selects of named attributes, are not
+// checked.
+func (sdb *SimpleDB) verifyChecksum(item string, attrs []Attribute) error {
+	if sdb.Checksum == "" {
+		return nil
+	}
+	for _, a := range attrs {
+		if a.Name == sdb.Checksum {
+			if len(sdb.ChecksumKey) == 0 {
+				return ErrNoChecksumKey
+			}
+			if sum := ItemChecksum(sdb.ChecksumKey, attrs, sdb.Checksum); sum != a.Value {
+				return IntegrityError{Item: item, Stored: a.Value, Computed: sum}
+			}
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package sdb
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	it := &itemTransport{}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: it}
+	c.Checksum = "_sum"
+	if _, err := c.PutAttributes("users", &Item{Name: "u1", Attributes: []Attribute{{Name: "name", Value: "Ann", Replace: true}}}); err != ErrNoChecksumKey {
+		t.Fatalf("put without ChecksumKey = %v", err)
+	}
+	c.ChecksumKey = []byte("checksum key")
+
+	if _, err := c.PutAttributes("users", &Item{Name: "u1", Attributes: []Attribute{{Name: "name", Value: "Ann", Replace: true}, {Name: "age", Value: "42", Replace: true}}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(it.attrs) != 3 || it.attrs[2].Name != "_sum" {
+		t.Fatalf("stored %+v", it.attrs)
+	}
+	if _, err := c.GetAttributes("users", "u1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a checksum made without the key does not verify
+	stored := it.attrs[2].Value
+	it.attrs[2].Value = ItemChecksum(nil, it.attrs, "_sum")
+	if _, err := c.GetAttributes("users", "u1"); err == nil {
+		t.Error("checksum without the key accepted")
+	}
+	it.attrs[2].Value = stored
+
+	it.attrs[1].Value = "43"
+	_, err := c.Select("select * from users")
+	var ie IntegrityError
+	if !errors.As(err, &ie) || ie.Item != "u1" {
+		t.Errorf("expected an IntegrityError, got %v", err)
+	}
+
+	// items read without the checksum attribute are not checked
+	it.attrs = it.attrs[:2]
+	if _, err := c.GetAttributes("users", "u1"); err != nil {
+		t.Error(err)
+	}
+}
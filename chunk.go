@@ -0,0 +1,108 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MaxAttributeValueLength = 1024
+	MaxItemAttributes       = 256
+)
+
+var ErrValueTooLarge = errors.New("value does not fit in the item attribute limit")
+
+// SetChunked stores value split over the attributes name.0 to name.N, each at
+// most MaxAttributeValueLength bytes, and records the count in name.chunks.
+// Chunks are cut at rune boundaries so each one is valid UTF-8. All
+// attributes are marked for replace so a shorter value can overwrite a
+// longer one.
+func (i *Item) SetChunked(name string, value string) error {
+	var chunks []string
+	for rest := value; rest != ""; {
+		end := len(rest)
+		if end > MaxAttributeValueLength {
+			end = MaxAttributeValueLength
+			for end > 0 && !utf8.RuneStart(rest[end]) {
+				end--
+			}
+			if end == 0 {
+				end = MaxAttributeValueLength
+			}
+		}
+		chunks = append(chunks, rest[:end])
+		rest = rest[end:]
+	}
+	if len(i.Attributes)+len(chunks)+1 > MaxItemAttributes {
+		return ErrValueTooLarge
+	}
+	for j, c := range chunks {
+		i.AddAttribute(name+"."+strconv.Itoa(j), c)
+	}
+	i.AddAttribute(name+".chunks", strconv.Itoa(len(chunks)))
+	for j := range i.Attributes {
+		if strings.HasPrefix(i.Attributes[j].Name, name+".") {
+			i.Attributes[j].Replace = true
+		}
+	}
+	return nil
+}
+
+// Chunked reassembles a value stored with SetChunked, ok is false when the
+// item has no such value.
+func (i Item) Chunked(name string) (value string, ok bool, err error) {
+	attrs := make(map[string]string)
+	for _, a := range i.Attributes {
+		if strings.HasPrefix(a.Name, name+".") {
+			attrs[a.Name] = a.Value
+		}
+	}
+	c, ok := attrs[name+".chunks"]
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(c)
+	if err != nil {
+		return
+	}
+	parts := make([]string, n)
+	for j := range parts {
+		parts[j], ok = attrs[name+"."+strconv.Itoa(j)]
+		if !ok {
+			err = errors.New("missing chunk " + strconv.Itoa(j) + " of " + name)
+			return
+		}
+	}
+	value = strings.Join(parts, "")
+	return
+}
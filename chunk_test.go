@@ -0,0 +1,43 @@
+package sdb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChunked(t *testing.T) {
+	value := strings.Repeat("x", MaxAttributeValueLength*2+10)
+	i := NewItem("chunked")
+	if err := i.SetChunked("data", value); err != nil {
+		t.Fatal(err)
+	}
+	if len(i.Attributes) != 4 {
+		t.Errorf("Expected 3 chunks and a count, got %d attributes", len(i.Attributes))
+	}
+	v, ok, err := i.Chunked("data")
+	if err != nil || !ok || v != value {
+		t.Errorf("Chunked value did not round trip, ok=%v err=%v", ok, err)
+	}
+	if _, ok, _ = i.Chunked("other"); ok {
+		t.Error("Expected missing value")
+	}
+}
+
+func TestChunkedMultibyte(t *testing.T) {
+	// each offset moves a rune across the chunk boundary
+	for offset := 0; offset < 4; offset++ {
+		value := strings.Repeat("x", offset) + strings.Repeat("é€😀", MaxAttributeValueLength/4)
+		i := NewItem("chunked")
+		if err := i.SetChunked("data", value); err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range i.Attributes {
+			if err := ValidateValue(a.Value); err != nil {
+				t.Errorf("offset %d: chunk %s: %v", offset, a.Name, err)
+			}
+		}
+		if v, ok, err := i.Chunked("data"); err != nil || !ok || v != value {
+			t.Errorf("offset %d: chunked value did not round trip, ok=%v err=%v", offset, ok, err)
+		}
+	}
+}
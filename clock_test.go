@@ -0,0 +1,22 @@
+package sdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockSignature(t *testing.T) {
+	c := NewSimpleDB("AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", SDBRegionEUWest1)
+	c.Clock = ClockFunc(func() time.Time {
+		return time.Date(2014, 1, 2, 4, 4, 5, 0, time.FixedZone("CET", 3600))
+	})
+	c.resetParameters()
+	c.p.Add("Action", "ListDomains")
+
+	if ts := c.p.Get("Timestamp"); ts != "2014-01-02T03:04:05+00:00" {
+		t.Errorf("Timestamp = %s", ts)
+	}
+	if s := c.sign(canonicalString(c.endpoint(), c.p)); s != "yglYDglRsRT3tRSGgIP20xQf+IYlikWe88Ed5A5sNkg=" {
+		t.Errorf("Signature = %s", s)
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+// Command sdb-proxy exposes SimpleDB domains as a JSON over HTTP API for
+// services that can not sign SimpleDB requests themselves.
+//
+//	GET    /domains                     list domains
+//	GET    /domains/{d}/items/{i}       get item attributes
+//	PUT    /domains/{d}/items/{i}       put item attributes
+//	DELETE /domains/{d}/items/{i}       delete item
+//	POST   /domains/{d}/select          run a select expression
+//
+// Items are encoded as {"name": "...", "attributes": {"attr": ["value", ...]}}.
+// A PUT replaces the stored values of the attributes it names.
+// The select body is {"expression": "...", "nextToken": "..."}, an empty
+// expression selects every item in the domain. Expressions must select from
+// the domain of the path.
+//
+// By default requests are signed with the credentials in AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY. With -passthrough the caller supplies credentials in
+// the X-Aws-Access-Key-Id and X-Aws-Secret-Access-Key headers instead. With
+// -token every request must carry "Authorization: Bearer <token>".
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/coopernurse/sdb"
+)
+
+type item struct {
+	Name       string              `json:"name"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+type selectRequest struct {
+	Expression string `json:"expression"`
+	NextToken  string `json:"nextToken"`
+}
+
+type selectResponse struct {
+	Items     []item `json:"items"`
+	NextToken string `json:"nextToken,omitempty"`
+}
+
+type errorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type proxy struct {
+	region      string
+	accessKey   string
+	secretKey   string
+	passthrough bool
+	token       string
+	// httpClient sends the SimpleDB requests, http.DefaultClient if nil.
+	httpClient *http.Client
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	region := flag.String("region", sdb.SDBRegionEUWest1, "SimpleDB endpoint")
+	passthrough := flag.Bool("passthrough", false, "take AWS credentials from request headers")
+	token := flag.String("token", "", "require this bearer token on every request")
+	flag.Parse()
+
+	p := &proxy{
+		region:      *region,
+		accessKey:   os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:   os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		passthrough: *passthrough,
+		token:       *token,
+	}
+	if !p.passthrough && (p.accessKey == "" || p.secretKey == "") {
+		log.Fatal("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set unless -passthrough is used")
+	}
+
+	log.Fatal(http.ListenAndServe(*addr, p))
+}
+
+func (p *proxy) client(r *http.Request) (db sdb.SimpleDB, ok bool) {
+	if p.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+p.token)) != 1 {
+		return
+	}
+	a, s := p.accessKey, p.secretKey
+	if p.passthrough {
+		a, s = r.Header.Get("X-Aws-Access-Key-Id"), r.Header.Get("X-Aws-Secret-Access-Key")
+		if a == "" || s == "" {
+			return
+		}
+	}
+	db = sdb.NewSimpleDB(a, s, p.region)
+	db.HTTPClient = p.httpClient
+	return db, true
+}
+
+// ServeHTTP routes /domains/... requests. A new client is created per request
+// since SimpleDB values keep per-request state.
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	db, ok := p.client(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized", "missing or invalid credentials")
+		return
+	}
+
+	// split before unescaping so a name may contain an escaped /
+	path := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	for j, seg := range path {
+		var err error
+		if path[j], err = url.PathUnescape(seg); err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidPath", err.Error())
+			return
+		}
+	}
+	switch {
+	case len(path) == 1 && path[0] == "domains" && r.Method == "GET":
+		p.listDomains(w, &db)
+	case len(path) == 4 && path[0] == "domains" && path[2] == "items":
+		switch r.Method {
+		case "GET":
+			p.getItem(w, &db, path[1], path[3])
+		case "PUT":
+			p.putItem(w, r, &db, path[1], path[3])
+		case "DELETE":
+			p.deleteItem(w, &db, path[1], path[3])
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method+" is not supported")
+		}
+	case len(path) == 3 && path[0] == "domains" && path[2] == "select" && r.Method == "POST":
+		p.selectItems(w, r, &db, path[1])
+	default:
+		writeError(w, http.StatusNotFound, "NotFound", r.URL.Path)
+	}
+}
+
+func (p *proxy) listDomains(w http.ResponseWriter, db *sdb.SimpleDB) {
+	resp, err := db.ListDomains()
+	if err != nil {
+		writeSimpleDBError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp.DomainNames)
+}
+
+func (p *proxy) getItem(w http.ResponseWriter, db *sdb.SimpleDB, domain, name string) {
+	resp, err := db.GetAttributes(domain, name)
+	if err != nil {
+		writeSimpleDBError(w, err)
+		return
+	}
+	if len(resp.Attributes) == 0 {
+		writeError(w, http.StatusNotFound, "NoSuchItem", name)
+		return
+	}
+	writeJSON(w, http.StatusOK, toJSON(sdb.Item{Name: name, Attributes: resp.Attributes}))
+}
+
+func (p *proxy) putItem(w http.ResponseWriter, r *http.Request, db *sdb.SimpleDB, domain, name string) {
+	var in item
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidJSON", err.Error())
+		return
+	}
+	i := sdb.NewItem(name)
+	for attr, values := range in.Attributes {
+		for _, v := range values {
+			i.Attributes = append(i.Attributes, sdb.Attribute{Name: attr, Value: v, Replace: true})
+		}
+	}
+	if _, err := db.PutAttributes(domain, i); err != nil {
+		writeSimpleDBError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *proxy) deleteItem(w http.ResponseWriter, db *sdb.SimpleDB, domain, name string) {
+	if _, err := db.DeleteItem(domain, name); err != nil {
+		writeSimpleDBError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *proxy) selectItems(w http.ResponseWriter, r *http.Request, db *sdb.SimpleDB, domain string) {
+	var in selectRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidJSON", err.Error())
+		return
+	}
+	if in.Expression == "" {
+		in.Expression = "select * from " + sdb.QuoteName(domain)
+	}
+	s, err := sdb.ParseSelect(in.Expression)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidQueryExpression", err.Error())
+		return
+	}
+	if s.Domain != domain {
+		writeError(w, http.StatusBadRequest, "InvalidQueryExpression", "expression must select from "+domain)
+		return
+	}
+	resp, err := db.SelectWithToken(in.Expression, in.NextToken)
+	if err != nil {
+		writeSimpleDBError(w, err)
+		return
+	}
+	out := selectResponse{Items: []item{}, NextToken: resp.NextToken}
+	for _, i := range resp.Items {
+		out.Items = append(out.Items, toJSON(i))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func toJSON(i sdb.Item) item {
+	out := item{Name: i.Name, Attributes: make(map[string][]string)}
+	for _, a := range i.Attributes {
+		out.Attributes[a.Name] = append(out.Attributes[a.Name], a.Value)
+	}
+	return out
+}
+
+func writeSimpleDBError(w http.ResponseWriter, err error) {
+	e, ok := err.(sdb.SimpleDBError)
+	if !ok {
+		writeError(w, http.StatusBadGateway, "InternalError", err.Error())
+		return
+	}
+	status := http.StatusBadRequest
+	switch e.Code {
+	case "NoSuchDomain":
+		status = http.StatusNotFound
+	case "AuthFailure", "InvalidClientTokenId", "SignatureDoesNotMatch", "OptInRequired":
+		status = http.StatusForbidden
+	case "ServiceUnavailable", "RequestThrottled":
+		status = http.StatusServiceUnavailable
+	case "InternalError":
+		status = http.StatusBadGateway
+	}
+	writeError(w, status, e.Code, e.Message)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, errorResponse{Code: code, Message: message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestProxy(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	if _, err := db.CreateDomain("users"); err != nil {
+		t.Fatal(err)
+	}
+	p := &proxy{region: "sdb.fake", accessKey: "a", secretKey: "s", token: "secret", httpClient: &http.Client{Transport: f}}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	do := func(method, path, token, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := do("GET", "/domains", "wrong", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong token got %s", resp.Status)
+	}
+	for _, body := range []string{`{"attributes": {"role": ["a", "b"]}}`, `{"attributes": {"role": ["c"]}}`} {
+		if resp := do("PUT", "/domains/users/items/u1", "secret", body); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("PUT got %s", resp.Status)
+		}
+	}
+	resp := do("GET", "/domains/users/items/u1", "secret", "")
+	var got item
+	json.NewDecoder(resp.Body).Decode(&got)
+	if resp.StatusCode != http.StatusOK || len(got.Attributes["role"]) != 1 || got.Attributes["role"][0] != "c" {
+		t.Errorf("GET = %s %+v, expected the PUT to replace role", resp.Status, got)
+	}
+
+	resp = do("POST", "/domains/users/select", "secret", `{}`)
+	var sel selectResponse
+	json.NewDecoder(resp.Body).Decode(&sel)
+	if resp.StatusCode != http.StatusOK || len(sel.Items) != 1 || sel.Items[0].Name != "u1" {
+		t.Errorf("select = %s %+v", resp.Status, sel)
+	}
+	if resp := do("POST", "/domains/users/select", "secret", `{"expression": "select * from other"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("select from another domain got %s", resp.Status)
+	}
+
+	if resp := do("PUT", "/domains/users/items/a%2Fb", "secret", `{"attributes": {"role": ["d"]}}`); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT of a name with a slash got %s", resp.Status)
+	}
+	resp = do("GET", "/domains/users/items/a%2Fb", "secret", "")
+	got = item{}
+	json.NewDecoder(resp.Body).Decode(&got)
+	if resp.StatusCode != http.StatusOK || got.Name != "a/b" || got.Attributes["role"][0] != "d" {
+		t.Errorf("GET of a name with a slash = %s %+v", resp.Status, got)
+	}
+	if resp := do("DELETE", "/domains/users/items/a%2Fb", "secret", ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE of a name with a slash got %s", resp.Status)
+	}
+
+	if resp := do("DELETE", "/domains/users/items/u1", "secret", ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE got %s", resp.Status)
+	}
+	if resp := do("GET", "/domains/users/items/u1", "secret", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET after DELETE got %s", resp.Status)
+	}
+	if resp := do("GET", "/domains/missing/items/u1", "secret", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET from a missing domain got %s", resp.Status)
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The types in this file are conflict free replicated data types kept in a
+// single item. Writers never replace each other's values, so concurrent
+// updates from several processes merge without conditional puts. Every value
+// counts against the 256 attribute values per item limit.
+
+// GSet is a grow-only set stored as the values of one multi-valued attribute.
+type GSet struct {
+	Domain    string
+	Item      string
+	Attribute string
+	db        SimpleDB
+}
+
+// ORSet is an observed-remove set. Every add is tagged with a unique id and a
+// remove records the tags it has observed, so an add concurrent with a remove
+// wins.
+type ORSet struct {
+	Domain    string
+	Item      string
+	Attribute string
+	db        SimpleDB
+}
+
+// PNCounter is a counter where each replica owns one increment and one
+// decrement attribute. Only the owning replica writes them, which is what
+// makes replacing the value safe. Replica ids must be unique per process.
+type PNCounter struct {
+	Domain  string
+	Item    string
+	Name    string
+	Replica string
+	db      SimpleDB
+	mu      sync.Mutex
+	p       int64
+	n       int64
+	loaded  bool
+}
+
+func NewGSet(db SimpleDB, domain string, item string, attribute string) *GSet {
+	db.ConsistentRead = true
+	return &GSet{Domain: domain, Item: item, Attribute: attribute, db: db}
+}
+
+func (s *GSet) Add(values ...string) error {
+	i := NewItem(s.Item)
+	for _, v := range values {
+		i.AddAttribute(s.Attribute, v)
+	}
+	db := s.db
+	_, err := db.PutAttributes(s.Domain, i)
+	return err
+}
+
+func (s *GSet) Members() (values []string, err error) {
+	db := s.db
+	r, err := db.GetAttributes(s.Domain, s.Item)
+	if err != nil {
+		return
+	}
+	for _, a := range r.Attributes {
+		if a.Name == s.Attribute {
+			values = append(values, a.Value)
+		}
+	}
+	return
+}
+
+func NewORSet(db SimpleDB, domain string, item string, attribute string) *ORSet {
+	db.ConsistentRead = true
+	return &ORSet{Domain: domain, Item: item, Attribute: attribute, db: db}
+}
+
+func (s *ORSet) Add(value string) error {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	i := NewItem(s.Item)
+	i.AddAttribute(s.Attribute+".add", hex.EncodeToString(b)+":"+value)
+	db := s.db
+	_, err := db.PutAttributes(s.Domain, i)
+	return err
+}
+
+// Remove removes every add of value observed by this read.
+func (s *ORSet) Remove(value string) error {
+	adds, _, err := s.read()
+	if err != nil {
+		return err
+	}
+	i := NewItem(s.Item)
+	for tag, v := range adds {
+		if v == value {
+			i.AddAttribute(s.Attribute+".rm", tag)
+		}
+	}
+	if len(i.Attributes) == 0 {
+		return nil
+	}
+	db := s.db
+	_, err = db.PutAttributes(s.Domain, i)
+	return err
+}
+
+func (s *ORSet) Members() (values []string, err error) {
+	adds, removed, err := s.read()
+	if err != nil {
+		return
+	}
+	seen := make(map[string]bool)
+	for tag, v := range adds {
+		if !removed[tag] && !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	return
+}
+
+func (s *ORSet) read() (adds map[string]string, removed map[string]bool, err error) {
+	db := s.db
+	r, err := db.GetAttributes(s.Domain, s.Item)
+	if err != nil {
+		return
+	}
+	adds = make(map[string]string)
+	removed = make(map[string]bool)
+	for _, a := range r.Attributes {
+		switch a.Name {
+		case s.Attribute + ".add":
+			if p := strings.SplitN(a.Value, ":", 2); len(p) == 2 {
+				adds[p[0]] = p[1]
+			}
+		case s.Attribute + ".rm":
+			removed[a.Value] = true
+		}
+	}
+	return
+}
+
+func NewPNCounter(db SimpleDB, domain string, item string, name string, replica string) *PNCounter {
+	db.ConsistentRead = true
+	return &PNCounter{Domain: domain, Item: item, Name: name, Replica: replica, db: db}
+}
+
+// Add changes the counter by delta, which may be negative.
+func (c *PNCounter) Add(delta int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.loaded {
+		if _, err := c.value(); err != nil {
+			return err
+		}
+	}
+	i := NewItem(c.Item)
+	if delta >= 0 {
+		i.ReplaceAttribute(c.Name+".p."+c.Replica, strconv.FormatInt(c.p+delta, 10))
+	} else {
+		i.ReplaceAttribute(c.Name+".n."+c.Replica, strconv.FormatInt(c.n-delta, 10))
+	}
+	db := c.db
+	if _, err := db.PutAttributes(c.Domain, i); err != nil {
+		return err
+	}
+	if delta >= 0 {
+		c.p += delta
+	} else {
+		c.n -= delta
+	}
+	return nil
+}
+
+// Value returns the sum over all replicas.
+func (c *PNCounter) Value() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value()
+}
+
+func (c *PNCounter) value() (total int64, err error) {
+	db := c.db
+	r, err := db.GetAttributes(c.Domain, c.Item)
+	if err != nil {
+		return
+	}
+	for _, a := range r.Attributes {
+		var sign int64
+		var replica string
+		switch {
+		case strings.HasPrefix(a.Name, c.Name+".p."):
+			sign, replica = 1, a.Name[len(c.Name)+3:]
+		case strings.HasPrefix(a.Name, c.Name+".n."):
+			sign, replica = -1, a.Name[len(c.Name)+3:]
+		default:
+			continue
+		}
+		v, err := strconv.ParseInt(a.Value, 10, 64)
+		if err != nil {
+			return 0, errors.New("invalid counter value " + a.Name + "=" + a.Value)
+		}
+		total += sign * v
+		if replica == c.Replica {
+			if sign > 0 {
+				c.p = v
+			} else {
+				c.n = v
+			}
+		}
+	}
+	c.loaded = true
+	return
+}
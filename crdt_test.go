@@ -0,0 +1,103 @@
+package sdb_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func members(t *testing.T, f func() ([]string, error)) string {
+	t.Helper()
+	values, err := f()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+func TestGSet(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	if _, err := db.CreateDomain("crdt"); err != nil {
+		t.Fatal(err)
+	}
+	a := sdb.NewGSet(db, "crdt", "set", "tags")
+	b := sdb.NewGSet(db, "crdt", "set", "tags")
+	if err := a.Add("x", "y"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Add("y", "z"); err != nil {
+		t.Fatal(err)
+	}
+	if got := members(t, a.Members); got != "x,y,z" {
+		t.Fatalf("Members = %s", got)
+	}
+}
+
+func TestORSet(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	if _, err := db.CreateDomain("crdt"); err != nil {
+		t.Fatal(err)
+	}
+	a := sdb.NewORSet(db, "crdt", "set", "tags")
+	b := sdb.NewORSet(db, "crdt", "set", "tags")
+	for _, v := range []string{"x", "y", "x"} {
+		if err := a.Add(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := members(t, b.Members); got != "x,y" {
+		t.Fatalf("Members = %s", got)
+	}
+	// The remove covers both adds of x seen by b.
+	if err := b.Remove("x"); err != nil {
+		t.Fatal(err)
+	}
+	if got := members(t, a.Members); got != "y" {
+		t.Fatalf("Members after Remove = %s", got)
+	}
+	// A later add is not covered by the earlier remove.
+	if err := a.Add("x"); err != nil {
+		t.Fatal(err)
+	}
+	if got := members(t, b.Members); got != "x,y" {
+		t.Fatalf("Members after re-adding = %s", got)
+	}
+	if err := b.Remove("missing"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPNCounter(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	if _, err := db.CreateDomain("crdt"); err != nil {
+		t.Fatal(err)
+	}
+	a := sdb.NewPNCounter(db, "crdt", "counters", "hits", "a")
+	b := sdb.NewPNCounter(db, "crdt", "counters", "hits", "b")
+	for _, d := range []int64{5, -2, 3} {
+		if err := a.Add(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Add(-4); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := b.Value(); err != nil || v != 2 {
+		t.Fatalf("Value = %d, %v", v, err)
+	}
+	// A new counter for replica a continues from the stored totals.
+	a2 := sdb.NewPNCounter(db, "crdt", "counters", "hits", "a")
+	if err := a2.Add(1); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := a.Value(); err != nil || v != 3 {
+		t.Fatalf("Value after restart = %d, %v", v, err)
+	}
+}
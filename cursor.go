@@ -0,0 +1,90 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+)
+
+// Cursor reads the items of a paginated operation one at a time:
+//
+//	c := db.SelectCursor(q)
+//	for c.Next(ctx) {
+//		item := c.Item()
+//		...
+//	}
+//	if err := c.Err(); err != nil {
+//		...
+//	}
+type Cursor[T any] struct {
+	pager *Pager[T]
+	items []T
+	item  T
+	err   error
+}
+
+func NewCursor[T any](p *Pager[T]) *Cursor[T] {
+	return &Cursor[T]{pager: p}
+}
+
+// Next advances to the next item, fetching pages as needed. It returns false
+// when the items are exhausted, a fetch fails or ctx is done, Err tells which.
+func (c *Cursor[T]) Next(ctx context.Context) bool {
+	if c.err != nil {
+		return false
+	}
+	if c.err = ctx.Err(); c.err != nil {
+		return false
+	}
+	for len(c.items) == 0 {
+		if c.pager.Done() {
+			return false
+		}
+		var page Page[T]
+		if page, c.err = c.pager.Next(ctx); c.err != nil {
+			return false
+		}
+		c.items = page.Items
+	}
+	c.item, c.items = c.items[0], c.items[1:]
+	return true
+}
+
+// Item returns the item Next advanced to.
+func (c *Cursor[T]) Item() T {
+	return c.item
+}
+
+func (c *Cursor[T]) Err() error {
+	return c.err
+}
+
+func (sdb *SimpleDB) SelectCursor(q string) *Cursor[Item] {
+	return NewCursor(sdb.SelectPager(q))
+}
@@ -0,0 +1,48 @@
+package sdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	pages := map[string]Page[int]{
+		"":  {Items: []int{1, 2}, NextToken: "a"},
+		"a": {NextToken: "b"},
+		"b": {Items: []int{3}, NextToken: "c"},
+		"c": {Items: []int{4}},
+	}
+	c := NewCursor(NewPager(func(ctx context.Context, token string) (Page[int], error) {
+		return pages[token], nil
+	}))
+	ctx := context.Background()
+	var got []int
+	for c.Next(ctx) {
+		got = append(got, c.Item())
+	}
+	if c.Err() != nil || len(got) != 4 || got[3] != 4 {
+		t.Error(got, c.Err())
+	}
+
+	fail := errors.New("fail")
+	c = NewCursor(NewPager(func(ctx context.Context, token string) (Page[int], error) {
+		if token != "" {
+			return Page[int]{}, fail
+		}
+		return Page[int]{Items: []int{1}, NextToken: "x"}, nil
+	}))
+	if !c.Next(ctx) || c.Next(ctx) || c.Err() != fail {
+		t.Error("Expected fetch error after first item", c.Err())
+	}
+
+	c = NewCursor(NewPager(func(ctx context.Context, token string) (Page[int], error) {
+		return pages[token], nil
+	}))
+	cctx, cancel := context.WithCancel(ctx)
+	c.Next(cctx)
+	cancel()
+	if c.Next(cctx) || c.Err() != context.Canceled {
+		t.Error("Expected cursor to stop on cancellation", c.Err())
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const redacted = "REDACTED"
+
+// DebugDump describes the last request made by sdb for a support ticket. v
+// is the error or response that request returned and supplies the RequestId.
+// The access key and signature are redacted, so unlike RawRequest the dump is
+// safe to share.
+func (sdb *SimpleDB) DebugDump(v interface{}) string {
+	p, _ := url.ParseQuery(sdb.RawRequest)
+	p.Del("Signature")
+	if p.Get("AWSAccessKeyId") != "" {
+		p.Set("AWSAccessKeyId", redacted)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "RequestId: %s\n", RequestId(v))
+	fmt.Fprintf(&b, "Endpoint: %s\n", sdb.endpoint().URL())
+	fmt.Fprintf(&b, "Attempts: %d\n", sdb.attempts)
+	fmt.Fprintf(&b, "Elapsed: %v\n", sdb.elapsed)
+	if err, ok := v.(error); ok {
+		fmt.Fprintf(&b, "Error: %v\n", err)
+	}
+	fmt.Fprintf(&b, "\nCanonical string:\n%s\n", canonicalString(sdb.endpoint(), p))
+
+	b.WriteString("\nParameters:\n")
+	if len(p) > 0 {
+		p.Set("Signature", redacted)
+	}
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, s := range p[k] {
+			fmt.Fprintf(&b, "  %s=%s\n", k, s)
+		}
+	}
+
+	fmt.Fprintf(&b, "\nResponse:\n%s\n", sdb.RawResponse)
+	return b.String()
+}
+
+var stringToSign = regexp.MustCompile(`String-to-Sign should have been '([^']*)'`)
+
+// SignatureMismatch compares the string the client signed with the one AWS
+// expected. Remote is empty when the error message did not include it and
+// Offset is the byte index of the first difference, -1 if there is none.
+type SignatureMismatch struct {
+	Local  string
+	Remote string
+	Offset int
+}
+
+// DiagnoseSignature recomputes the canonical string of the last request
+// when err is a SignatureDoesNotMatch error and compares it with the
+// string-to-sign AWS echoes in the error message, if any.
+func (sdb *SimpleDB) DiagnoseSignature(err error) (m SignatureMismatch, ok bool) {
+	e, ok := err.(SimpleDBError)
+	if !ok || e.Code != "SignatureDoesNotMatch" {
+		return m, false
+	}
+	p, _ := url.ParseQuery(sdb.RawRequest)
+	p.Del("Signature")
+	m = SignatureMismatch{Local: canonicalString(sdb.endpoint(), p), Offset: -1}
+	if s := stringToSign.FindStringSubmatch(e.Message); s != nil {
+		m.Remote = s[1]
+		m.Offset = firstDifference(m.Local, m.Remote)
+	}
+	return m, true
+}
+
+func firstDifference(a, b string) int {
+	n := min(len(a), len(b))
+	for j := 0; j < n; j++ {
+		if a[j] != b[j] {
+			return j
+		}
+	}
+	if len(a) != len(b) {
+		return n
+	}
+	return -1
+}
+
+// String shows both strings line by line with a caret under the first
+// difference.
+func (m SignatureMismatch) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Local string to sign:\n%s\n", m.Local)
+	if m.Remote == "" {
+		b.WriteString("\nAWS did not return its string to sign, check the secret key and clock\n")
+		return b.String()
+	}
+	if m.Offset < 0 {
+		b.WriteString("\nStrings to sign match, the secret key is wrong\n")
+		return b.String()
+	}
+	line := strings.Count(m.Local[:min(m.Offset, len(m.Local))], "\n")
+	col := m.Offset - strings.LastIndex(m.Local[:min(m.Offset, len(m.Local))], "\n") - 1
+	local, remote := strings.Split(m.Local, "\n"), strings.Split(m.Remote, "\n")
+	fmt.Fprintf(&b, "\nFirst difference on line %d, column %d:\n", line+1, col+1)
+	if line < len(local) {
+		fmt.Fprintf(&b, "  local:  %s\n", local[line])
+	}
+	if line < len(remote) {
+		fmt.Fprintf(&b, "  remote: %s\n", remote[line])
+	}
+	fmt.Fprintf(&b, "          %s^\n", strings.Repeat(" ", col))
+	return b.String()
+}
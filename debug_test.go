@@ -0,0 +1,57 @@
+package sdb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDebugDump(t *testing.T) {
+	c := NewSimpleDB("AKIDSECRETKEYID", "secret", SDBRegionEUWest1)
+	c.RawRequest = "AWSAccessKeyId=AKIDSECRETKEYID&Action=Select&SelectExpression=select%20%2A%20from%20d&Signature=c2lnbmF0dXJl"
+	c.RawResponse = "<SelectResponse/>"
+
+	d := c.DebugDump(SelectResponse{ResponseMetadata: ResponseMetadata{RequestId: "req-1"}})
+	for _, s := range []string{"AKIDSECRETKEYID", "c2lnbmF0dXJl"} {
+		if strings.Contains(d, s) {
+			t.Errorf("Dump leaks %s:\n%s", s, d)
+		}
+	}
+	for _, s := range []string{"RequestId: req-1", "AWSAccessKeyId=REDACTED&Action=Select&SelectExpression=select%20%2A%20from%20d\n", "SelectExpression=select * from d", "<SelectResponse/>"} {
+		if !strings.Contains(d, s) {
+			t.Errorf("Dump is missing %q:\n%s", s, d)
+		}
+	}
+
+	d = c.DebugDump(SimpleDBError{Code: "AuthFailure", RequestId: "req-2"})
+	if !strings.Contains(d, "RequestId: req-2") || !strings.Contains(d, "Error: AuthFailure") {
+		t.Error(d)
+	}
+}
+
+func TestDiagnoseSignature(t *testing.T) {
+	c := NewSimpleDB("AKID", "secret", SDBRegionEUWest1)
+	c.RawRequest = "AWSAccessKeyId=AKID&Action=Select&SelectExpression=select%20%2A%20from%20d&Signature=c2ln"
+	local := "POST\n" + SDBRegionEUWest1 + "\n/\nAWSAccessKeyId=AKID&Action=Select&SelectExpression=select%20%2A%20from%20d"
+	remote := strings.Replace(local, "%2A", "*", 1)
+	err := SimpleDBError{Code: "SignatureDoesNotMatch", Message: "The request signature we calculated does not match. The String-to-Sign should have been '" + remote + "'"}
+
+	m, ok := c.DiagnoseSignature(err)
+	if !ok || m.Local != local || m.Remote != remote {
+		t.Fatalf("%v %+v", ok, m)
+	}
+	if m.Offset != strings.Index(local, "%2A") {
+		t.Errorf("Offset = %d", m.Offset)
+	}
+	s := m.String()
+	if !strings.Contains(s, "line 4, column 61") || !strings.Contains(s, "remote: AWSAccessKeyId=AKID&Action=Select&SelectExpression=select%20*%20from%20d") {
+		t.Error(s)
+	}
+
+	if _, ok := c.DiagnoseSignature(SimpleDBError{Code: "AuthFailure"}); ok {
+		t.Error("AuthFailure diagnosed as a signature mismatch")
+	}
+	m, _ = c.DiagnoseSignature(SimpleDBError{Code: "SignatureDoesNotMatch"})
+	if m.Remote != "" || m.Offset != -1 {
+		t.Errorf("%+v", m)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// DeriveFunc computes the values of a derived attribute from an item
+// marshaled from a struct. Values are as stored, so numbers and times are in
+// their EncodeInt, EncodeFloat and EncodeTime forms. Returning no values
+// leaves the attribute unset.
+type DeriveFunc func(i Item) []string
+
+type derivedAttribute struct {
+	name string
+	fn   DeriveFunc
+}
+
+var (
+	derivedMu sync.RWMutex
+	derived   = make(map[reflect.Type][]derivedAttribute)
+)
+
+// RegisterDerived adds the attribute name, computed by fn, to the items
+// marshaled from structs of the type of v, a struct or a pointer to one.
+// Derived attributes are written by MarshalItem and PutStruct, deleted by
+// PutStruct when fn returns no values and ignored by UnmarshalItem, so
+// attributes that only feed queries stay consistent with the struct.
+// Registering name again for the type replaces its fn.
+func RegisterDerived(v interface{}, name string, fn DeriveFunc) {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	derivedMu.Lock()
+	defer derivedMu.Unlock()
+	// copy so slices returned by derivedAttributes are never changed
+	ds := append([]derivedAttribute(nil), derived[t]...)
+	for j, d := range ds {
+		if d.name == name {
+			ds[j].fn = fn
+			derived[t] = ds
+			return
+		}
+	}
+	derived[t] = append(ds, derivedAttribute{name, fn})
+}
+
+func derivedAttributes(t reflect.Type) []derivedAttribute {
+	derivedMu.RLock()
+	defer derivedMu.RUnlock()
+	return derived[t]
+}
+
+// derive adds the derived attributes of t to i and returns the names of
+// those without values.
+func derive(t reflect.Type, i *Item) (unset []string) {
+	for _, d := range derivedAttributes(t) {
+		values := d.fn(*i)
+		if len(values) == 0 {
+			unset = append(unset, d.name)
+		}
+		for _, v := range values {
+			i.ReplaceAttribute(d.name, v)
+		}
+	}
+	return
+}
+
+// isDerived reports whether name is a derived attribute of t.
+func isDerived(t reflect.Type, name string) bool {
+	for _, d := range derivedAttributes(t) {
+		if d.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Lower derives the lower-cased values of attr, for case insensitive
+// equality and prefix queries.
+func Lower(attr string) DeriveFunc {
+	return func(i Item) (values []string) {
+		for _, a := range i.Attributes {
+			if a.Name == attr {
+				values = append(values, strings.ToLower(a.Value))
+			}
+		}
+		return
+	}
+}
+
+// TimeBucket derives the time in attr, stored with EncodeTime, formatted
+// with layout, "2006-01" buckets by month. Values that are not times are
+// skipped.
+func TimeBucket(attr string, layout string) DeriveFunc {
+	return func(i Item) (values []string) {
+		for _, a := range i.Attributes {
+			if a.Name != attr {
+				continue
+			}
+			if t, err := DecodeTime(a.Value); err == nil {
+				values = append(values, t.UTC().Format(layout))
+			}
+		}
+		return
+	}
+}
@@ -0,0 +1,56 @@
+package sdb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type deriveUser struct {
+	ID      string    `sdb:",itemname"`
+	Name    string    `sdb:"name,omitempty"`
+	Created time.Time `sdb:"created"`
+}
+
+// resetDerived removes the derived attributes registered for the type of v
+// when the test ends.
+func resetDerived(t *testing.T, v interface{}) {
+	t.Cleanup(func() {
+		derivedMu.Lock()
+		delete(derived, reflect.TypeOf(v).Elem())
+		derivedMu.Unlock()
+	})
+}
+
+func TestRegisterDerived(t *testing.T) {
+	resetDerived(t, &deriveUser{})
+	RegisterDerived(&deriveUser{}, "name_lc", Lower("nick"))
+	RegisterDerived(&deriveUser{}, "name_lc", Lower("name"))
+	RegisterDerived(deriveUser{}, "created_month", TimeBucket("created", "2006-01"))
+	if n := len(derivedAttributes(reflect.TypeOf(deriveUser{}))); n != 2 {
+		t.Fatalf("Expected re-registration to replace name_lc, got %d attributes", n)
+	}
+
+	in := deriveUser{ID: "u1", Name: "Ann", Created: time.Date(2014, 3, 4, 5, 6, 7, 0, time.UTC)}
+	i, err := MarshalItem(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Value("name_lc") != "ann" || i.Value("created_month") != "2014-03" {
+		t.Errorf("Unexpected item %v", i)
+	}
+
+	i.Attributes = append(i.Attributes, Attribute{Name: "name_lc", Value: "stale"})
+	var out deriveUser
+	if err = UnmarshalItem(*i, &out); err != nil || !reflect.DeepEqual(in, out) {
+		t.Errorf("Expected %v, got %v %v", in, out, err)
+	}
+
+	del, err := MarshalDeletes(&deriveUser{ID: "u1", Created: in.Created})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(del.Attributes) != 2 || del.Attributes[1].Name != "name_lc" {
+		t.Errorf("Expected name and name_lc to be deleted, got %v", del.Attributes)
+	}
+}
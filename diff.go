@@ -0,0 +1,142 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"sort"
+	"strings"
+)
+
+// AttributeDiff describes how the values of one attribute differ. Values holds
+// all values of the attribute in the new item.
+type AttributeDiff struct {
+	Name    string
+	Added   []string
+	Removed []string
+	Values  []string
+}
+
+// ItemDiff lists the attributes only present in the new item (Added), only
+// present in the old item (Removed) and present in both with different values
+// (Changed), each sorted by name.
+type ItemDiff struct {
+	Added   []AttributeDiff
+	Removed []AttributeDiff
+	Changed []AttributeDiff
+}
+
+func attributeValues(i Item) map[string]map[string]bool {
+	values := make(map[string]map[string]bool)
+	for _, a := range i.Attributes {
+		if values[a.Name] == nil {
+			values[a.Name] = make(map[string]bool)
+		}
+		values[a.Name][a.Value] = true
+	}
+	return values
+}
+
+func sortedKeys(m map[string]bool) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// DiffItems compares the attributes of a and b, item names are not compared.
+func DiffItems(a Item, b Item) (d ItemDiff) {
+	old := attributeValues(a)
+	new := attributeValues(b)
+
+	names := make(map[string]bool)
+	for name := range old {
+		names[name] = true
+	}
+	for name := range new {
+		names[name] = true
+	}
+
+	for _, name := range sortedKeys(names) {
+		ad := AttributeDiff{Name: name, Values: sortedKeys(new[name])}
+		for _, v := range ad.Values {
+			if !old[name][v] {
+				ad.Added = append(ad.Added, v)
+			}
+		}
+		for _, v := range sortedKeys(old[name]) {
+			if !new[name][v] {
+				ad.Removed = append(ad.Removed, v)
+			}
+		}
+		switch {
+		case old[name] == nil:
+			d.Added = append(d.Added, ad)
+		case new[name] == nil:
+			d.Removed = append(d.Removed, ad)
+		case len(ad.Added) > 0 || len(ad.Removed) > 0:
+			d.Changed = append(d.Changed, ad)
+		}
+	}
+	return
+}
+
+func (d ItemDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Changes returns the diff in the form taken by PatchAttributes.
+func (d ItemDiff) Changes() map[string][]string {
+	changes := make(map[string][]string)
+	for _, ad := range d.Added {
+		changes[ad.Name] = ad.Values
+	}
+	for _, ad := range d.Changed {
+		changes[ad.Name] = ad.Values
+	}
+	for _, ad := range d.Removed {
+		changes[ad.Name] = nil
+	}
+	return changes
+}
+
+// String formats the diff for audit logs, one attribute per line.
+func (d ItemDiff) String() string {
+	var lines []string
+	for _, ad := range d.Added {
+		lines = append(lines, "+ "+ad.Name+" "+strings.Join(ad.Values, ", "))
+	}
+	for _, ad := range d.Removed {
+		lines = append(lines, "- "+ad.Name+" "+strings.Join(ad.Removed, ", "))
+	}
+	for _, ad := range d.Changed {
+		lines = append(lines, "~ "+ad.Name+" +["+strings.Join(ad.Added, ", ")+"] -["+strings.Join(ad.Removed, ", ")+"]")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,36 @@
+package sdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffItems(t *testing.T) {
+	a := NewItem("a")
+	a.AddAttribute("name", "Roland")
+	a.AddAttribute("tag", "x")
+	a.AddAttribute("tag", "y")
+	a.AddAttribute("old", "1")
+	b := NewItem("b")
+	b.AddAttribute("name", "Roland")
+	b.AddAttribute("tag", "y")
+	b.AddAttribute("tag", "z")
+	b.AddAttribute("new", "2")
+
+	d := DiffItems(*a, *b)
+	expected := ItemDiff{
+		Added:   []AttributeDiff{{Name: "new", Added: []string{"2"}, Values: []string{"2"}}},
+		Removed: []AttributeDiff{{Name: "old", Removed: []string{"1"}}},
+		Changed: []AttributeDiff{{Name: "tag", Added: []string{"z"}, Removed: []string{"x"}, Values: []string{"y", "z"}}},
+	}
+	if !reflect.DeepEqual(d, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, d)
+	}
+	changes := map[string][]string{"new": {"2"}, "old": nil, "tag": {"y", "z"}}
+	if !reflect.DeepEqual(d.Changes(), changes) {
+		t.Errorf("Expected %v, got %v", changes, d.Changes())
+	}
+	if !DiffItems(*a, *a).Empty() {
+		t.Error("Expected empty diff")
+	}
+}
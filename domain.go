@@ -0,0 +1,106 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"sync"
+	"time"
+)
+
+// DomainSettings overrides client settings for requests on one domain. Nil
+// fields keep the client's setting.
+type DomainSettings struct {
+	ConsistentRead *bool
+	MaxRetries     *int
+	// RateLimit is the maximum number of requests per second sent to the
+	// domain by the client and its copies, 0 means no limit.
+	RateLimit float64
+	// Codec encodes struct fields without a native encoding or codec option
+	// in PutStruct and GetStruct.
+	Codec Codec
+	// Rules are checked before every put to the domain.
+	Rules []Rule
+}
+
+type domainDefaults struct {
+	DomainSettings
+	// schema is the Rule set by UseSchemas, checked after Rules.
+	schema Rule
+	mu     sync.Mutex
+	next   time.Time
+}
+
+// SetDomainDefaults registers settings for requests on domain. The settings
+// are shared by copies of the client made afterwards, register them before
+// the client is used concurrently.
+func (sdb *SimpleDB) SetDomainDefaults(domain string, s DomainSettings) {
+	if sdb.domains == nil {
+		sdb.domains = make(map[string]*domainDefaults)
+	}
+	sdb.domains[domain] = &domainDefaults{DomainSettings: s}
+}
+
+// requestDomain returns the domain of the request being built.
+func (sdb *SimpleDB) requestDomain() string {
+	if d := sdb.p.Get("DomainName"); d != "" {
+		return d
+	}
+	return selectDomain(sdb.p.Get("SelectExpression"))
+}
+
+func (sdb *SimpleDB) domainDefaults() *domainDefaults {
+	if sdb.domains == nil {
+		return nil
+	}
+	return sdb.domains[sdb.requestDomain()]
+}
+
+func (sdb *SimpleDB) domainCodec(domain string) Codec {
+	if d := sdb.domains[domain]; d != nil {
+		return d.Codec
+	}
+	return nil
+}
+
+// reserve returns how long to wait before sending a request to stay within
+// the rate limit.
+func (d *domainDefaults) reserve() time.Duration {
+	if d.RateLimit <= 0 {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if d.next.Before(now) {
+		d.next = now
+	}
+	wait := d.next.Sub(now)
+	d.next = d.next.Add(time.Duration(float64(time.Second) / d.RateLimit))
+	return wait
+}
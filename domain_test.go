@@ -0,0 +1,55 @@
+package sdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDomainDefaults(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	yes := true
+	c.SetDomainDefaults("hot", DomainSettings{ConsistentRead: &yes, Codec: JSONCodec})
+
+	c.resetParameters()
+	c.p.Add("Action", "Select")
+	c.p.Add("SelectExpression", "select * from `hot` where a = '1'")
+	c.addConsistentRead()
+	if c.p.Get("ConsistentRead") != "true" {
+		t.Error("Expected consistent read for hot domain")
+	}
+	c.resetParameters()
+	c.p.Add("Action", "GetAttributes")
+	c.p.Add("DomainName", "bulk")
+	c.addConsistentRead()
+	if c.p.Get("ConsistentRead") != "" {
+		t.Error("Expected eventual read for bulk domain")
+	}
+
+	type address struct{ City string }
+	type user struct {
+		Name string  `sdb:",itemname"`
+		Addr address `sdb:"addr"`
+	}
+	i, err := marshalItem(&user{"u1", address{"Paris"}}, c.domainCodec("hot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var u user
+	if err = unmarshalItem(*i, &u, c.domainCodec("hot")); err != nil || u.Addr.City != "Paris" {
+		t.Error(u, err)
+	}
+	if i, err = marshalItem(&user{"u1", address{"Paris"}}, c.domainCodec("bulk")); err != nil || i.Value("addr.City") != "Paris" {
+		t.Error("Expected flattened struct without a domain codec", i, err)
+	}
+}
+
+func TestDomainRateLimit(t *testing.T) {
+	d := &domainDefaults{DomainSettings: DomainSettings{RateLimit: 10}}
+	var total time.Duration
+	for j := 0; j < 3; j++ {
+		total = d.reserve()
+	}
+	if total < 190*time.Millisecond || total > 200*time.Millisecond {
+		t.Errorf("Third request waits %v, want about 200ms", total)
+	}
+}
@@ -0,0 +1,83 @@
+package sdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestDomainPool(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	domains := func() map[string]bool {
+		t.Helper()
+		names, err := db.ListDomainsPager().All(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := make(map[string]bool)
+		for _, n := range names {
+			m[n] = true
+		}
+		return m
+	}
+	// A domain of the pool created long ago by another process.
+	old := "test-kz0.00000000"
+	if _, err := db.CreateDomain(old); err != nil {
+		t.Fatal(err)
+	}
+	p := sdb.NewDomainPool(db, "test-", time.Hour)
+	p.Limit = 2
+
+	d1, err := p.Acquire()
+	if err != nil || !domains()[d1] {
+		t.Fatalf("Acquire = %s, %v", d1, err)
+	}
+	i := sdb.NewItem("i")
+	i.AddAttribute("a", "1")
+	if _, err = db.PutAttributes(d1, i); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Release(d1); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := db.Select("select * from " + sdb.QuoteName(d1)); err != nil || len(r.Items) != 0 {
+		t.Fatalf("Release left %v, %v", r.Items, err)
+	}
+	if d, err := p.Acquire(); err != nil || d != d1 {
+		t.Fatalf("Acquire after Release = %s, %v, want %s", d, err, d1)
+	}
+
+	// At the limit the expired domain is collected to make room.
+	d2, err := p.Acquire()
+	if err != nil || d2 == d1 {
+		t.Fatalf("Acquire at the limit = %s, %v", d2, err)
+	}
+	if domains()[old] {
+		t.Fatal("expired domain was not collected")
+	}
+	if _, err = p.Acquire(); err != sdb.ErrDomainLimit {
+		t.Fatalf("Acquire over the limit returned %v", err)
+	}
+
+	// Released domains that expired are deleted rather than reused.
+	if err = p.Release(d1); err != nil {
+		t.Fatal(err)
+	}
+	p.MaxAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	d3, err := p.Acquire()
+	if err != nil || d3 == d1 || domains()[d1] {
+		t.Fatalf("Acquire with an expired released domain = %s, %v", d3, err)
+	}
+	deleted, err := p.Collect()
+	if err != nil || len(deleted) != 2 {
+		t.Fatalf("Collect = %v, %v", deleted, err)
+	}
+	if left := domains(); len(left) != 0 {
+		t.Fatalf("domains left after Collect: %v", left)
+	}
+}
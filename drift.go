@@ -0,0 +1,151 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"reflect"
+	"strings"
+)
+
+// SchemaDrift describes an item read into a struct whose attributes do not
+// match the struct's fields. Unknown lists attributes no field reads,
+// whose values are dropped, and Missing lists attributes of fields that are
+// always written but were not found, such as renamed attributes.
+type SchemaDrift struct {
+	Domain  string
+	Item    string
+	Type    string
+	Unknown []string
+	Missing []string
+}
+
+// structAttributes describes the attributes the fields of a struct type read.
+type structAttributes struct {
+	exact    map[string]bool
+	prefixes []string
+	required []string
+}
+
+func newStructAttributes(t reflect.Type, def Codec) *structAttributes {
+	s := &structAttributes{exact: make(map[string]bool)}
+	s.add(t, "", def, true)
+	return s
+}
+
+func (s *structAttributes) add(t reflect.Type, prefix string, def Codec, required bool) {
+	for _, f := range structFields(t) {
+		if f.itemName {
+			continue
+		}
+		name := prefix + f.name
+		ft := t.FieldByIndex(f.index).Type
+		req := required && !f.omit && !nullable(ft)
+		et := ft
+		if et.Kind() == reflect.Ptr {
+			et = et.Elem()
+		}
+		switch {
+		case flattened(f, et, def) && et.Kind() == reflect.Struct:
+			s.add(et, name+".", def, req)
+		case f.json, flattened(f, et, def), f.codec != "" || def != nil && !nativeType(et),
+			et.Kind() == reflect.Slice && et.Elem().Kind() == reflect.Uint8:
+			s.prefixes = append(s.prefixes, name+".")
+			if req {
+				s.required = append(s.required, name+".chunks")
+			}
+		default:
+			s.exact[name] = true
+			if req {
+				s.required = append(s.required, name)
+			}
+		}
+	}
+}
+
+// nullable reports whether values of t can be nil, and so are not always
+// written.
+func nullable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+func (s *structAttributes) known(name string) bool {
+	if s.exact[name] {
+		return true
+	}
+	for _, p := range s.prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDrift reports the differences between i and the struct v points to
+// to OnDrift. Attributes the client adds itself, checksums, blind indexes and
+// derived attributes, are not unknown.
+func (sdb *SimpleDB) checkDrift(domain string, i Item, v interface{}) {
+	if sdb.OnDrift == nil {
+		return
+	}
+	rv, err := structValue(v)
+	if err != nil {
+		return
+	}
+	t := rv.Type()
+	s := newStructAttributes(t, sdb.domainCodec(domain))
+	internal := map[string]bool{sdb.Checksum: true, IDAttribute: true}
+	if sdb.Encryption != nil {
+		for _, name := range sdb.Encryption.Indexes {
+			internal[name] = true
+		}
+	}
+	d := SchemaDrift{Domain: domain, Item: i.Name, Type: t.String()}
+	present := make(map[string]bool)
+	for _, a := range i.Attributes {
+		if present[a.Name] {
+			continue
+		}
+		present[a.Name] = true
+		if !s.known(a.Name) && !internal[a.Name] && !isDerived(t, a.Name) {
+			d.Unknown = append(d.Unknown, a.Name)
+		}
+	}
+	for _, name := range s.required {
+		if !present[name] {
+			d.Missing = append(d.Missing, name)
+		}
+	}
+	if len(d.Unknown) > 0 || len(d.Missing) > 0 {
+		sdb.OnDrift(d)
+	}
+}
@@ -0,0 +1,38 @@
+package sdb
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaDrift(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: &policyTransport{}}
+	var drift []SchemaDrift
+	c.OnDrift = func(d SchemaDrift) { drift = append(drift, d) }
+
+	type user struct {
+		ID    string  `sdb:",itemname"`
+		Name  string  `sdb:"name"`
+		Email string  `sdb:"email"`
+		Nick  *string `sdb:"nick"`
+	}
+	var u user
+	if found, err := c.GetStruct("users", "u1", &u); !found || err != nil {
+		t.Fatal(found, err)
+	}
+	expected := []SchemaDrift{{Domain: "users", Item: "u1", Type: "sdb.user", Unknown: []string{"ssn"}, Missing: []string{"email"}}}
+	if !reflect.DeepEqual(drift, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, drift)
+	}
+
+	drift = nil
+	type full struct {
+		Name string `sdb:"name"`
+		SSN  string `sdb:"ssn"`
+	}
+	if _, err := c.GetStruct("users", "u1", &full{}); err != nil || drift != nil {
+		t.Errorf("Expected no drift, got %+v %v", drift, err)
+	}
+}
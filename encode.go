@@ -0,0 +1,88 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// SimpleDB compares all values as strings. The encodings below produce
+// strings whose lexicographic order matches the natural order of the value,
+// so they can be used in range predicates and order by.
+
+const sortableTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// EncodeInt encodes n as 20 zero padded digits, offset so that negative
+// numbers sort before positive ones.
+func EncodeInt(n int64) string {
+	return fmt.Sprintf("%020d", uint64(n)^(1<<63))
+}
+
+func DecodeInt(s string) (int64, error) {
+	u, err := strconv.ParseUint(s, 10, 64)
+	return int64(u ^ (1 << 63)), err
+}
+
+// EncodeTime encodes t as a fixed width UTC timestamp with nanoseconds.
+func EncodeTime(t time.Time) string {
+	return t.UTC().Format(sortableTimeFormat)
+}
+
+func DecodeTime(s string) (time.Time, error) {
+	return time.Parse(sortableTimeFormat, s)
+}
+
+// EncodeFloat encodes f so that the order of the encoded strings matches the
+// numeric order, including negative numbers and infinities. NaN is not
+// supported.
+func EncodeFloat(f float64) string {
+	b := math.Float64bits(f)
+	if b&(1<<63) != 0 {
+		b = ^b
+	} else {
+		b |= 1 << 63
+	}
+	return fmt.Sprintf("%020d", b)
+}
+
+func DecodeFloat(s string) (float64, error) {
+	b, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if b&(1<<63) != 0 {
+		b &^= 1 << 63
+	} else {
+		b = ^b
+	}
+	return math.Float64frombits(b), nil
+}
@@ -0,0 +1,49 @@
+package sdb
+
+import (
+	"math"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestEncodeIntOrder(t *testing.T) {
+	numbers := []int64{-9223372036854775808, -1000, -1, 0, 1, 42, 1000, 9223372036854775807}
+	var encoded []string
+	for _, n := range numbers {
+		s := EncodeInt(n)
+		if d, err := DecodeInt(s); err != nil || d != n {
+			t.Errorf("%d did not round trip, got %d %v", n, d, err)
+		}
+		encoded = append(encoded, s)
+	}
+	if !sort.StringsAreSorted(encoded) {
+		t.Errorf("Encoded values are not sorted: %v", encoded)
+	}
+}
+
+func TestEncodeTime(t *testing.T) {
+	tm := time.Date(2014, 6, 1, 12, 30, 0, 5, time.FixedZone("CET", 3600))
+	s := EncodeTime(tm)
+	if s != "2014-06-01T11:30:00.000000005Z" {
+		t.Error(s)
+	}
+	if d, err := DecodeTime(s); err != nil || !d.Equal(tm) {
+		t.Errorf("%v did not round trip, got %v %v", tm, d, err)
+	}
+}
+
+func TestEncodeFloatOrder(t *testing.T) {
+	numbers := []float64{math.Inf(-1), -1e300, -2.5, -1e-300, 0, 1e-300, 1, 2.5, 1e300, math.Inf(1)}
+	var encoded []string
+	for _, n := range numbers {
+		s := EncodeFloat(n)
+		if d, err := DecodeFloat(s); err != nil || d != n {
+			t.Errorf("%g did not round trip, got %g %v", n, d, err)
+		}
+		encoded = append(encoded, s)
+	}
+	if !sort.StringsAreSorted(encoded) {
+		t.Errorf("Encoded values are not sorted: %v", encoded)
+	}
+}
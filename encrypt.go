@@ -0,0 +1,367 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// encryptedPrefix starts every value written by an Encryptor, followed by
+// the key ID, the encrypted data key and the sealed value, each in
+// unpadded base64url and separated by dots.
+const encryptedPrefix = "enc1."
+
+// ErrUnknownKey is returned when a value was encrypted under a master key
+// the KeyProvider does not have.
+var ErrUnknownKey = errors.New("sdb: unknown encryption key")
+
+// DataKey is a key for encrypting values, in plaintext and encrypted under
+// the master key KeyID.
+type DataKey struct {
+	KeyID     string
+	Plaintext []byte
+	Encrypted []byte
+}
+
+// KeyProvider manages the master keys of envelope encryption: values are
+// encrypted with data keys, and only the data keys with the master key.
+// StaticKeys keeps master keys in memory, package sdbkms uses AWS KMS.
+type KeyProvider interface {
+	// KeyID returns the ID of the master key new data keys are made with.
+	KeyID() string
+	// GenerateKey returns a new 256-bit data key under the current master
+	// key.
+	GenerateKey(ctx context.Context) (DataKey, error)
+	// DecryptKey returns the plaintext of a data key encrypted under keyID.
+	DecryptKey(ctx context.Context, keyID string, encrypted []byte) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider over 256-bit master keys held in memory by
+// ID. Current names the key for new data keys, the others are kept to
+// decrypt values written before a rotation.
+type StaticKeys struct {
+	Keys    map[string][]byte
+	Current string
+}
+
+func (s StaticKeys) KeyID() string {
+	return s.Current
+}
+
+func (s StaticKeys) GenerateKey(ctx context.Context) (k DataKey, err error) {
+	k = DataKey{KeyID: s.Current, Plaintext: make([]byte, 32)}
+	if _, err = rand.Read(k.Plaintext); err != nil {
+		return
+	}
+	master, ok := s.Keys[s.Current]
+	if !ok {
+		return k, ErrUnknownKey
+	}
+	k.Encrypted, err = seal(master, k.Plaintext, []byte(s.Current))
+	return
+}
+
+func (s StaticKeys) DecryptKey(ctx context.Context, keyID string, encrypted []byte) ([]byte, error) {
+	master, ok := s.Keys[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return open(master, encrypted, []byte(keyID))
+}
+
+// seal encrypts plaintext with AES-GCM, prefixing the random nonce.
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sdb: encrypted value too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encryptor encrypts the values of Attributes as they are written and
+// decrypts them as they are read. A data key is used for DataKeyMaxAge, an
+// hour if it is 0, before a new one is generated, and decrypted data keys
+// are cached, so
+// the KeyProvider is not called for every value. The attribute name is
+// bound to the ciphertext, so values can not be moved between attributes.
+//
+// Encrypted values are random, so they can not be compared in Select
+// expressions or Conditions or deleted by value, and they are about 100 bytes longer than the
+// plaintext plus the key ID, counting against the 1024 byte value limit.
+type Encryptor struct {
+	Keys          KeyProvider
+	Attributes    map[string]bool
+	DataKeyMaxAge time.Duration
+	// Indexes maps attributes to the attribute holding their blind index,
+	// see Index.
+	Indexes  map[string]string
+	IndexKey []byte
+	mu       sync.Mutex
+	current  DataKey
+	created  time.Time
+	keys     map[string][]byte
+}
+
+// maxCachedKeys bounds the decrypted data keys an Encryptor keeps.
+const maxCachedKeys = 1024
+
+// defaultDataKeyMaxAge is the DataKeyMaxAge of an Encryptor without one.
+const defaultDataKeyMaxAge = time.Hour
+
+// NewEncryptor returns an Encryptor of attrs under keys, with data keys used
+// for an hour.
+func NewEncryptor(keys KeyProvider, attrs ...string) *Encryptor {
+	e := &Encryptor{Keys: keys, Attributes: make(map[string]bool), DataKeyMaxAge: defaultDataKeyMaxAge}
+	for _, a := range attrs {
+		e.Attributes[a] = true
+	}
+	return e
+}
+
+func (e *Encryptor) dataKey(ctx context.Context) (k DataKey, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	maxAge := e.DataKeyMaxAge
+	if maxAge == 0 {
+		maxAge = defaultDataKeyMaxAge
+	}
+	if e.current.Plaintext != nil && time.Since(e.created) < maxAge && e.current.KeyID == e.Keys.KeyID() {
+		return e.current, nil
+	}
+	if k, err = e.Keys.GenerateKey(ctx); err != nil {
+		return
+	}
+	e.current, e.created = k, time.Now()
+	e.cacheKey(k.Encrypted, k.Plaintext)
+	return
+}
+
+// cacheKey keeps the plaintext of a data key, evicting an arbitrary key when
+// the cache is full. The caller holds mu.
+func (e *Encryptor) cacheKey(encrypted []byte, plaintext []byte) {
+	if e.keys == nil {
+		e.keys = make(map[string][]byte)
+	}
+	if len(e.keys) >= maxCachedKeys {
+		for k := range e.keys {
+			delete(e.keys, k)
+			break
+		}
+	}
+	e.keys[string(encrypted)] = plaintext
+}
+
+// Encrypt returns v encrypted for attr.
+func (e *Encryptor) Encrypt(ctx context.Context, attr string, v string) (string, error) {
+	k, err := e.dataKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(k.Plaintext, []byte(v), []byte(attr))
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	return encryptedPrefix + enc.EncodeToString([]byte(k.KeyID)) + "." + enc.EncodeToString(k.Encrypted) + "." + enc.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of a value Encrypt returned for attr.
+// Values that are not encrypted are returned unchanged, so attributes can
+// be encrypted gradually.
+func (e *Encryptor) Decrypt(ctx context.Context, attr string, v string) (string, error) {
+	keyID, encKey, sealed, ok := parseEncrypted(v)
+	if !ok {
+		return v, nil
+	}
+	e.mu.Lock()
+	key, cached := e.keys[string(encKey)]
+	e.mu.Unlock()
+	if !cached {
+		var err error
+		if key, err = e.Keys.DecryptKey(ctx, keyID, encKey); err != nil {
+			return "", fmt.Errorf("decrypting data key of %s: %w", attr, err)
+		}
+		e.mu.Lock()
+		e.cacheKey(encKey, key)
+		e.mu.Unlock()
+	}
+	b, err := open(key, sealed, []byte(attr))
+	if err != nil {
+		return "", fmt.Errorf("decrypting %s: %w", attr, err)
+	}
+	return string(b), nil
+}
+
+// EncryptedKeyID returns the ID of the master key v was encrypted under,
+// ok is false if v is not encrypted.
+func EncryptedKeyID(v string) (keyID string, ok bool) {
+	keyID, _, _, ok = parseEncrypted(v)
+	return
+}
+
+func parseEncrypted(v string) (keyID string, encKey, sealed []byte, ok bool) {
+	if !strings.HasPrefix(v, encryptedPrefix) {
+		return
+	}
+	parts := strings.Split(v[len(encryptedPrefix):], ".")
+	if len(parts) != 3 {
+		return
+	}
+	enc := base64.RawURLEncoding
+	id, err1 := enc.DecodeString(parts[0])
+	encKey, err2 := enc.DecodeString(parts[1])
+	sealed, err3 := enc.DecodeString(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return
+	}
+	return string(id), encKey, sealed, true
+}
+
+// decryptAttributes returns attrs with encrypted values decrypted.
+func (e *Encryptor) decryptAttributes(ctx context.Context, attrs []Attribute) ([]Attribute, error) {
+	if e == nil {
+		return attrs, nil
+	}
+	out := make([]Attribute, len(attrs))
+	for j, a := range attrs {
+		if e.Attributes[a.Name] {
+			v, err := e.Decrypt(ctx, a.Name, a.Value)
+			if err != nil {
+				return nil, err
+			}
+			a.Value = v
+		}
+		out[j] = a
+	}
+	return out, nil
+}
+
+func (sdb *SimpleDB) context() context.Context {
+	if sdb.ctx == nil {
+		return context.Background()
+	}
+	return sdb.ctx
+}
+
+// RotateKeys re-encrypts the values in domain that are not under the
+// KeyProvider's current master key, returning the number of items
+// rewritten. Run it after changing the current key; the old key must stay
+// available until it returns. All values of an attribute are rewritten
+// together. A single-valued attribute is only rewritten if it still holds
+// the ciphertext read, so concurrent updates are kept. SimpleDB can not
+// condition a write on a multi-valued attribute, concurrent updates of one
+// may be lost.
+func (sdb *SimpleDB) RotateKeys(ctx context.Context, domain string) (n int, err error) {
+	e := sdb.Encryption
+	if e == nil {
+		return 0, errors.New("sdb: RotateKeys without Encryption")
+	}
+	// the plaintext is unchanged, so is the Checksum
+	raw := sdb.WithContext(ctx)
+	raw.Encryption, raw.Policy, raw.Masks, raw.Checksum = nil, nil, nil, ""
+	current := e.Keys.KeyID()
+	err = raw.SelectStream(ctx, "select * from "+QuoteName(domain), func(i Item) error {
+		values := make(map[string][]string)
+		isStale := make(map[string]bool)
+		var stale []string
+		for _, a := range i.Attributes {
+			if !e.Attributes[a.Name] {
+				continue
+			}
+			if id, ok := EncryptedKeyID(a.Value); ok && id != current && !isStale[a.Name] {
+				isStale[a.Name] = true
+				stale = append(stale, a.Name)
+			}
+			values[a.Name] = append(values[a.Name], a.Value)
+		}
+		rewritten := false
+		for _, name := range stale {
+			put := NewItem(i.Name)
+			for _, old := range values[name] {
+				v, err := e.Decrypt(ctx, name, old)
+				if err != nil {
+					return err
+				}
+				if v, err = e.Encrypt(ctx, name, v); err != nil {
+					return err
+				}
+				put.ReplaceAttribute(name, v)
+			}
+			var c *Condition
+			if len(values[name]) == 1 {
+				c = &Condition{Name: name, Value: values[name][0], Exists: true}
+			}
+			_, err := raw.putAttributes(domain, put, c)
+			if IsConditionalCheckFailed(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			rewritten = true
+		}
+		if rewritten {
+			n++
+		}
+		return nil
+	})
+	return
+}
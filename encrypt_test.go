@@ -0,0 +1,142 @@
+package sdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// itemTransport stores the attributes of a single item.
+type itemTransport struct {
+	attrs []Attribute
+}
+
+func (it *itemTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b, _ := io.ReadAll(req.Body)
+	p, _ := url.ParseQuery(string(b))
+	var v interface{} = Response{}
+	switch p.Get("Action") {
+	case "PutAttributes":
+		for n := 1; p.Get("Attribute."+strconv.Itoa(n)+".Name") != ""; n++ {
+			name := p.Get("Attribute." + strconv.Itoa(n) + ".Name")
+			if p.Get("Attribute."+strconv.Itoa(n)+".Replace") == "true" {
+				kept := it.attrs[:0]
+				for _, a := range it.attrs {
+					if a.Name != name {
+						kept = append(kept, a)
+					}
+				}
+				it.attrs = kept
+			}
+			it.attrs = append(it.attrs, Attribute{Name: name, Value: p.Get("Attribute." + strconv.Itoa(n) + ".Value")})
+		}
+	case "GetAttributes":
+		v = GetAttributesResponse{Attributes: it.attrs}
+	case "Select":
+		v = SelectResponse{Items: []Item{{Name: "u1", Attributes: it.attrs}}}
+	}
+	out, _ := xml.Marshal(v)
+	return &http.Response{StatusCode: 200, Status: "200 OK", Body: io.NopCloser(bytes.NewReader(out)), Request: req}, nil
+}
+
+func TestEncryption(t *testing.T) {
+	it := &itemTransport{}
+	keys := StaticKeys{Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, Current: "k1"}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: it}
+	c.Encryption = NewEncryptor(keys, "ssn")
+
+	if _, err := c.PutAttributes("users", &Item{Name: "u1", Attributes: []Attribute{{Name: "name", Value: "Ann"}, {Name: "ssn", Value: "123-45"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := EncryptedKeyID(it.attrs[1].Value); !ok || id != "k1" || strings.Contains(it.attrs[1].Value, "123") || it.attrs[0].Value != "Ann" {
+		t.Fatalf("stored %+v", it.attrs)
+	}
+	r, err := c.GetAttributes("users", "u1")
+	if err != nil || r.Attributes[1].Value != "123-45" {
+		t.Fatalf("GetAttributes = %+v, %v", r.Attributes, err)
+	}
+
+	// a value moved to another encrypted attribute does not decrypt
+	c.Encryption.Attributes["card"] = true
+	it.attrs = append(it.attrs, Attribute{Name: "card", Value: it.attrs[1].Value})
+	if _, err = c.GetAttributes("users", "u1"); err == nil {
+		t.Error("value decrypted under another attribute name")
+	}
+	it.attrs = it.attrs[:2]
+
+	keys.Keys["k2"] = bytes.Repeat([]byte{2}, 32)
+	keys.Current = "k2"
+	c.Encryption.Keys = keys
+	if n, err := c.RotateKeys(context.Background(), "users"); err != nil || n != 1 {
+		t.Fatalf("RotateKeys = %d, %v", n, err)
+	}
+	if id, _ := EncryptedKeyID(it.attrs[1].Value); id != "k2" {
+		t.Errorf("value still under %s", id)
+	}
+	delete(keys.Keys, "k1")
+	c.Encryption = &Encryptor{Keys: keys, Attributes: map[string]bool{"ssn": true}}
+	if s, err := c.Select("select * from users"); err != nil || s.Items[0].Attributes[1].Value != "123-45" {
+		t.Errorf("Select after rotation = %+v, %v", s.Items, err)
+	}
+}
+
+func TestEncryptorLiteral(t *testing.T) {
+	ctx := context.Background()
+	e := &Encryptor{Keys: StaticKeys{Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, Current: "k1"}, Attributes: map[string]bool{"ssn": true}}
+	v1, err := e.Encrypt(ctx, "ssn", "123-45")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := e.Encrypt(ctx, "ssn", "678-90")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, k1, _, _ := parseEncrypted(v1)
+	_, k2, _, _ := parseEncrypted(v2)
+	if !bytes.Equal(k1, k2) {
+		t.Error("Expected the data key to be reused without a DataKeyMaxAge")
+	}
+	if v, err := e.Decrypt(ctx, "ssn", v2); err != nil || v != "678-90" {
+		t.Errorf("Decrypt = %q, %v", v, err)
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	it := &itemTransport{}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: it}
+	c.Encryption = NewEncryptor(StaticKeys{Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, Current: "k1"}, "email")
+	c.Encryption.Indexes = map[string]string{"email": "email_idx"}
+	c.Encryption.IndexKey = []byte("index key")
+
+	if _, err := c.PutAttributes("users", &Item{Name: "u1", Attributes: []Attribute{{Name: "email", Value: "ann@example.com", Replace: true}}}); err != nil {
+		t.Fatal(err)
+	}
+	idx, _ := c.Encryption.Index("email", "ann@example.com")
+	if len(it.attrs) != 2 || it.attrs[1].Name != "email_idx" || it.attrs[1].Value != idx {
+		t.Fatalf("stored %+v", it.attrs)
+	}
+	bob, _ := c.Encryption.Index("email", "bob@example.com")
+	other, _ := c.Encryption.Index("other", "ann@example.com")
+	if idx == bob || idx == other {
+		t.Error("blind index collides")
+	}
+
+	tmpl, _ := ParseQueryTemplate("select * from users where email_idx = :v")
+	q, err := tmpl.Expand(map[string]interface{}{"v": idx})
+	if err != nil || q != "select * from users where email_idx = '"+idx+"'" {
+		t.Errorf("Expand = %q, %v", q, err)
+	}
+
+	c.Encryption.IndexKey = nil
+	if _, err = c.PutAttributes("users", &Item{Name: "u2", Attributes: []Attribute{{Name: "email", Value: "bob@example.com"}}}); err != ErrNoIndexKey {
+		t.Errorf("put without IndexKey = %v", err)
+	}
+}
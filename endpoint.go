@@ -0,0 +1,112 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"net"
+	"strings"
+)
+
+// Endpoint describes where requests are sent and how the string to sign is
+// built, so the client can talk to SimpleDB-compatible servers and local
+// emulators. Empty fields take the AWS behaviour.
+type Endpoint struct {
+	// Scheme is "https" if empty.
+	Scheme string
+	// Host is the server's host, with the port if it is not the scheme's
+	// default.
+	Host string
+	// Path is the request path, "/" if empty.
+	Path string
+	// SignHost replaces Host in the string to sign, for servers that sign
+	// without the port or sit behind a proxy that rewrites the Host header.
+	SignHost string
+}
+
+// Endpoint presets for servers commonly used in development. They serve
+// plain HTTP on the loopback interface and do not check signatures.
+var (
+	// FakeSDBEndpoint is the fakesdb gem on its default port.
+	FakeSDBEndpoint = Endpoint{Scheme: "http", Host: "localhost:8080"}
+	// MotoEndpoint is moto in server mode.
+	MotoEndpoint = Endpoint{Scheme: "http", Host: "localhost:5000"}
+)
+
+// AWSEndpoint returns the endpoint of an AWS region such as
+// SDBRegionEUWest1.
+func AWSEndpoint(region string) Endpoint {
+	return Endpoint{Host: region}
+}
+
+func (e Endpoint) URL() string {
+	scheme := e.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	return scheme + "://" + e.Host + e.path()
+}
+
+func (e Endpoint) path() string {
+	if e.Path == "" {
+		return "/"
+	}
+	if !strings.HasPrefix(e.Path, "/") {
+		return "/" + e.Path
+	}
+	return e.Path
+}
+
+func (e Endpoint) signHost() string {
+	if e.SignHost != "" {
+		return e.SignHost
+	}
+	return strings.ToLower(e.Host)
+}
+
+// hostname is Host without the port.
+func (e Endpoint) hostname() string {
+	if h, _, err := net.SplitHostPort(e.Host); err == nil {
+		return h
+	}
+	return e.Host
+}
+
+// NewSimpleDBEndpoint returns a client for the server at e.
+func NewSimpleDBEndpoint(a string, s string, e Endpoint) SimpleDB {
+	db := NewSimpleDB(a, s, e.Host)
+	db.Endpoint = &e
+	return db
+}
+
+func (sdb *SimpleDB) endpoint() Endpoint {
+	if sdb.Endpoint != nil {
+		return *sdb.Endpoint
+	}
+	return AWSEndpoint(sdb.region)
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Enum is implemented, with a value receiver, by string types that only
+// take a fixed set of values, such as a status:
+//
+//	type Status string
+//
+//	func (Status) EnumValues() []string { return []string{"open", "paid"} }
+//
+// The struct marshaler refuses other values when encoding and decoding
+// fields of the type, including the empty zero value unless it is listed,
+// so such fields must be set. Plain string fields can be restricted with the enum
+// tag option instead, `sdb:"status,enum=open|paid"`.
+type Enum interface {
+	EnumValues() []string
+}
+
+// EnumError is returned for a value outside the values of an Enum or enum
+// option.
+type EnumError struct {
+	Value   string
+	Allowed []string
+}
+
+func (e EnumError) Error() string {
+	if e.Value == "" {
+		return fmt.Sprintf("value is not set, it must be one of %s", strings.Join(e.Allowed, ", "))
+	}
+	return fmt.Sprintf("value %q is not one of %s", e.Value, strings.Join(e.Allowed, ", "))
+}
+
+var enumType = reflect.TypeOf((*Enum)(nil)).Elem()
+
+// enumValues returns the values allowed for a field value of type t, nil if
+// any value is.
+func enumValues(f field, t reflect.Type) []string {
+	if len(f.enum) > 0 {
+		return f.enum
+	}
+	if t.Kind() == reflect.String && t.Implements(enumType) {
+		return reflect.Zero(t).Interface().(Enum).EnumValues()
+	}
+	return nil
+}
+
+func checkEnum(allowed []string, s string) error {
+	if allowed == nil {
+		return nil
+	}
+	for _, a := range allowed {
+		if s == a {
+			return nil
+		}
+	}
+	return EnumError{Value: s, Allowed: allowed}
+}
@@ -0,0 +1,50 @@
+package sdb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type orderStatus string
+
+func (orderStatus) EnumValues() []string { return []string{"open", "paid"} }
+
+type enumOrder struct {
+	ID      string        `sdb:",itemname"`
+	Status  orderStatus   `sdb:"status"`
+	History []orderStatus `sdb:"history"`
+	Kind    string        `sdb:"kind,enum=retail|wholesale"`
+}
+
+func TestEnum(t *testing.T) {
+	o := enumOrder{ID: "o1", Status: "paid", History: []orderStatus{"open", "paid"}, Kind: "retail"}
+	i, err := MarshalItem(&o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back enumOrder
+	if err = UnmarshalItem(*i, &back); err != nil || back.Status != "paid" || len(back.History) != 2 || back.Kind != "retail" {
+		t.Fatalf("%+v %v", back, err)
+	}
+
+	o.Status = "lost"
+	var ee EnumError
+	if _, err = MarshalItem(&o); !errors.As(err, &ee) || ee.Value != "lost" {
+		t.Errorf("expected an EnumError, got %v", err)
+	}
+	o.Status = ""
+	if _, err = MarshalItem(&o); !errors.As(err, &ee) || !strings.Contains(err.Error(), "not set") {
+		t.Errorf("expected an EnumError for the zero value, got %v", err)
+	}
+	o.Status, o.Kind = "open", "gift"
+	if _, err = MarshalItem(&o); !errors.As(err, &ee) || ee.Value != "gift" {
+		t.Errorf("expected an EnumError, got %v", err)
+	}
+
+	i = &Item{Name: "o2", Attributes: []Attribute{{Name: "history", Value: "open"}, {Name: "history", Value: "shipped"}}}
+	err = UnmarshalItem(*i, &back)
+	if !errors.As(err, &ee) || !strings.Contains(err.Error(), `item o2 field history: value "shipped" is not one of open, paid`) {
+		t.Errorf("decode error %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Quote returns value as a Select string literal.
+func Quote(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
+
+// QuoteName returns a domain or attribute name quoted with backticks for use
+// in a Select expression.
+func QuoteName(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// quoteAttribute quotes name unless it is itemName(), so a name taken from
+// user input can never be read as a function or expression.
+func quoteAttribute(name string) string {
+	if name == "itemName()" {
+		return name
+	}
+	return QuoteName(name)
+}
+
+// EscapeLike escapes the % wildcard and the \ escape character so s matches
+// literally in a like pattern.
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`).Replace(s)
+}
+
+// likePrefix returns a like pattern matching values starting with prefix.
+func likePrefix(prefix string) string {
+	return EscapeLike(prefix) + "%"
+}
+
+// Unquote returns the value of a string literal or backtick quoted name, the
+// inverse of Quote and QuoteName.
+func Unquote(s string) (string, error) {
+	toks, err := lexSelect(s)
+	if err != nil {
+		return "", err
+	}
+	if len(toks) != 2 || toks[0].kind != tokString && toks[0].kind != tokName || toks[0].offset != 0 {
+		return "", SelectSyntaxError{0, fmt.Sprintf("%q is not a single quoted value", s)}
+	}
+	return toks[0].text, nil
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ItemErrors is returned by ForEachCollect and maps item names to the error
+// fn returned for them.
+type ItemErrors map[string]error
+
+func (e ItemErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for n := range e {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for j, n := range names {
+		msgs[j] = fmt.Sprintf("%s: %v", n, e[n])
+	}
+	return fmt.Sprintf("%d items failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// ForEach runs q and calls fn for every item from concurrency goroutines.
+// Pages are fetched as the workers need them and requests are subject to the
+// domain's rate limit. The first error from fn or from Select stops the
+// iteration and is returned.
+func (sdb *SimpleDB) ForEach(ctx context.Context, q string, concurrency int, fn func(Item) error) error {
+	return sdb.forEach(ctx, q, concurrency, fn, nil)
+}
+
+// ForEachCollect is like ForEach but keeps going when fn fails, returning the
+// failures as ItemErrors. A Select error still stops the iteration.
+func (sdb *SimpleDB) ForEachCollect(ctx context.Context, q string, concurrency int, fn func(Item) error) error {
+	errs := make(ItemErrors)
+	if err := sdb.forEach(ctx, q, concurrency, fn, errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (sdb *SimpleDB) forEach(ctx context.Context, q string, concurrency int, fn func(Item) error, errs ItemErrors) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	items := make(chan Item)
+	for j := 0; j < concurrency; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range items {
+				err := fn(i)
+				if err == nil {
+					continue
+				}
+				mu.Lock()
+				if errs != nil {
+					errs[i.Name] = err
+				} else if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	c := sdb.SelectCursor(q)
+	for c.Next(ctx) {
+		select {
+		case items <- c.Item():
+		case <-ctx.Done():
+		}
+	}
+	close(items)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return c.Err()
+}
@@ -0,0 +1,60 @@
+package sdb
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEach(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.Cache = NewSelectCache(time.Minute, 10)
+	q := "select * from jobs"
+	for p := 0; p < 3; p++ {
+		r := SelectResponse{}
+		if p < 2 {
+			r.NextToken = strconv.Itoa(p + 1)
+		}
+		for j := 0; j < 10; j++ {
+			r.Items = append(r.Items, Item{Name: strconv.Itoa(p*10 + j)})
+		}
+		token := ""
+		if p > 0 {
+			token = strconv.Itoa(p)
+		}
+		c.Cache.put(selectCacheKey(q, token, false), q, r)
+	}
+
+	var n int32
+	err := c.ForEach(context.Background(), q, 4, func(i Item) error {
+		atomic.AddInt32(&n, 1)
+		return nil
+	})
+	if err != nil || n != 30 {
+		t.Error(n, err)
+	}
+
+	fail := errors.New("fail")
+	err = c.ForEach(context.Background(), q, 4, func(i Item) error {
+		if i.Name == "5" {
+			return fail
+		}
+		return nil
+	})
+	if err != fail {
+		t.Error("Expected first error, got", err)
+	}
+
+	err = c.ForEachCollect(context.Background(), q, 4, func(i Item) error {
+		if i.Name == "5" || i.Name == "25" {
+			return fail
+		}
+		return nil
+	})
+	if e, ok := err.(ItemErrors); !ok || len(e) != 2 || e["25"] != fail {
+		t.Error("Expected collected errors, got", err)
+	}
+}
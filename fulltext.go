@@ -0,0 +1,80 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize splits text into lower-cased words, each returned once in order of
+// first appearance.
+func Tokenize(text string) (tokens []string) {
+	seen := make(map[string]bool)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if len(w) > MaxAttributeValueLength {
+			w = w[:MaxAttributeValueLength]
+		}
+		if !seen[w] {
+			seen[w] = true
+			tokens = append(tokens, w)
+		}
+	}
+	return
+}
+
+// IndexText stores the tokens of text as values of the multi-valued attribute
+// attr, replacing the tokens stored for a previous version of the text.
+func (i *Item) IndexText(attr string, text ...string) error {
+	tokens := Tokenize(strings.Join(text, " "))
+	if len(i.Attributes)+len(tokens) > MaxItemAttributes {
+		return ErrValueTooLarge
+	}
+	for _, t := range tokens {
+		i.ReplaceAttribute(attr, t)
+	}
+	return nil
+}
+
+// SearchQuery returns a query for items whose attr tokens contain the words
+// of text. With all set every word must match, otherwise any word matches.
+func SearchQuery(domain string, attr string, text string, all bool) *Query {
+	q := NewQuery(domain)
+	tokens := Tokenize(text)
+	if len(tokens) == 0 {
+		return q
+	}
+	if all {
+		return q.WhereAll(attr, tokens...)
+	}
+	return q.WhereIn(attr, tokens...)
+}
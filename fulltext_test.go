@@ -0,0 +1,22 @@
+package sdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize("Go library for Amazon SimpleDB, simpledb in GO!")
+	expected := []string{"go", "library", "for", "amazon", "simpledb", "in"}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("Expected %v, got %v", expected, tokens)
+	}
+}
+
+func TestSearchQuery(t *testing.T) {
+	s := SearchQuery("docs", "tokens", "Simple DB", true).String()
+	expected := "select * from `docs` where (`tokens` = 'simple' intersection `tokens` = 'db')"
+	if s != expected {
+		t.Errorf("Expected %s, got %s", expected, s)
+	}
+}
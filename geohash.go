@@ -0,0 +1,191 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	geohashAlphabet   = "0123456789bcdefghjkmnpqrstuvwxyz"
+	earthRadiusMeters = 6371000
+	maxGeohashCells   = 9
+)
+
+var ErrInvalidGeohash = errors.New("invalid geohash")
+
+// GeohashEncode returns the geohash of the position with precision characters.
+func GeohashEncode(lat float64, lon float64, precision int) string {
+	lon = math.Mod(lon+540, 360) - 180
+	minLat, maxLat := -90.0, 90.0
+	minLon, maxLon := -180.0, 180.0
+	var hash []byte
+	bit, ch, even := 0, 0, true
+	for len(hash) < precision {
+		if even {
+			mid := (minLon + maxLon) / 2
+			if lon >= mid {
+				ch |= 16 >> uint(bit)
+				minLon = mid
+			} else {
+				maxLon = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if lat >= mid {
+				ch |= 16 >> uint(bit)
+				minLat = mid
+			} else {
+				maxLat = mid
+			}
+		}
+		even = !even
+		if bit < 4 {
+			bit++
+		} else {
+			hash = append(hash, geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
+
+// GeohashBounds returns the cell covered by hash.
+func GeohashBounds(hash string) (minLat, minLon, maxLat, maxLon float64, err error) {
+	minLat, maxLat = -90, 90
+	minLon, maxLon = -180, 180
+	even := true
+	for _, c := range strings.ToLower(hash) {
+		v := strings.IndexRune(geohashAlphabet, c)
+		if v < 0 {
+			err = ErrInvalidGeohash
+			return
+		}
+		for mask := 16; mask > 0; mask >>= 1 {
+			if even {
+				mid := (minLon + maxLon) / 2
+				if v&mask != 0 {
+					minLon = mid
+				} else {
+					maxLon = mid
+				}
+			} else {
+				mid := (minLat + maxLat) / 2
+				if v&mask != 0 {
+					minLat = mid
+				} else {
+					maxLat = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return
+}
+
+// GeohashDecode returns the center of the cell covered by hash.
+func GeohashDecode(hash string) (lat float64, lon float64, err error) {
+	minLat, minLon, maxLat, maxLon, err := GeohashBounds(hash)
+	return (minLat + maxLat) / 2, (minLon + maxLon) / 2, err
+}
+
+// Distance returns the great circle distance in meters between two positions.
+func Distance(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
+
+// GeohashPrefixes returns the geohash cells covering the circle around the
+// position. The longest precision that covers the circle with at most nine
+// cells is used, so results must still be filtered by Distance.
+func GeohashPrefixes(lat float64, lon float64, radiusMeters float64) []string {
+	dLat := radiusMeters / earthRadiusMeters * 180 / math.Pi
+	dLon := 180.0
+	if c := math.Cos(lat * math.Pi / 180); c > 1e-9 {
+		dLon = math.Min(dLat/c, 180)
+	}
+	minLat, maxLat := math.Max(lat-dLat, -90), math.Min(lat+dLat, 90)
+
+	for precision := 12; precision > 1; precision-- {
+		if cells, ok := geohashCells(minLat, lon-dLon, maxLat, lon+dLon, precision); ok {
+			return cells
+		}
+	}
+	cells, _ := geohashCells(minLat, lon-dLon, maxLat, lon+dLon, 1)
+	return cells
+}
+
+// geohashCells returns the cells of the given precision covering the box, ok
+// is false if more than maxGeohashCells cells are needed.
+func geohashCells(minLat float64, minLon float64, maxLat float64, maxLon float64, precision int) (cells []string, ok bool) {
+	lonBits := uint((precision*5 + 1) / 2)
+	latBits := uint(precision * 5 / 2)
+	w := 360 / float64(uint64(1)<<lonBits)
+	h := 180 / float64(uint64(1)<<latBits)
+	if (maxLat-minLat)/h*(maxLon-minLon)/w > maxGeohashCells*4 {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for lat := minLat; ; lat += h {
+		lat = math.Min(lat, maxLat)
+		for lon := minLon; ; lon += w {
+			lon = math.Min(lon, maxLon)
+			if hash := GeohashEncode(lat, lon, precision); !seen[hash] {
+				seen[hash] = true
+				cells = append(cells, hash)
+			}
+			if lon >= maxLon {
+				break
+			}
+		}
+		if lat >= maxLat {
+			break
+		}
+	}
+	sort.Strings(cells)
+	return cells, len(cells) <= maxGeohashCells
+}
+
+// ProximityQuery returns a query for items within radiusMeters of the
+// position, where attr holds the geohash of each item. attr may be
+// itemName() when item names start with the geohash.
+func ProximityQuery(domain string, attr string, lat float64, lon float64, radiusMeters float64) *Query {
+	var preds []string
+	for _, p := range GeohashPrefixes(lat, lon, radiusMeters) {
+		preds = append(preds, quoteAttribute(attr)+" like "+Quote(p+"%"))
+	}
+	return NewQuery(domain).WhereExpr("(" + strings.Join(preds, " or ") + ")")
+}
@@ -0,0 +1,35 @@
+package sdb
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestGeohashEncode(t *testing.T) {
+	if h := GeohashEncode(57.64911, 10.40744, 11); h != "u4pruydqqvj" {
+		t.Error(h)
+	}
+	lat, lon, err := GeohashDecode("u4pruydqqvj")
+	if err != nil || math.Abs(lat-57.64911) > 1e-5 || math.Abs(lon-10.40744) > 1e-5 {
+		t.Errorf("Unexpected decode %f %f %v", lat, lon, err)
+	}
+	if _, _, err = GeohashDecode("u4a"); err != ErrInvalidGeohash {
+		t.Error("Expected invalid geohash error")
+	}
+}
+
+func TestGeohashPrefixes(t *testing.T) {
+	center := GeohashEncode(59.3293, 18.0686, 12)
+	prefixes := GeohashPrefixes(59.3293, 18.0686, 1000)
+	if len(prefixes) == 0 || len(prefixes) > maxGeohashCells {
+		t.Fatalf("Unexpected number of prefixes %v", prefixes)
+	}
+	found := false
+	for _, p := range prefixes {
+		found = found || strings.HasPrefix(center, p)
+	}
+	if !found {
+		t.Errorf("Center %s not covered by %v", center, prefixes)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MetadataSample is the DomainMetadata of a domain as of Time.
+type MetadataSample struct {
+	Domain   string
+	Time     time.Time
+	Metadata DomainMetadataResponse
+}
+
+// MetadataStore keeps the samples GrowthMonitor measures growth from.
+// Implement it over a database or file to keep history across restarts.
+type MetadataStore interface {
+	Add(s MetadataSample) error
+	// Samples returns the samples of domain taken at or after since, oldest
+	// first.
+	Samples(domain string, since time.Time) ([]MetadataSample, error)
+}
+
+// MemoryMetadataStore is a MetadataStore that keeps samples for Retention.
+type MemoryMetadataStore struct {
+	Retention time.Duration
+	mu        sync.Mutex
+	samples   map[string][]MetadataSample
+}
+
+func NewMemoryMetadataStore(retention time.Duration) *MemoryMetadataStore {
+	return &MemoryMetadataStore{Retention: retention, samples: make(map[string][]MetadataSample)}
+}
+
+func (s *MemoryMetadataStore) Add(m MetadataSample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	samples := append(s.samples[m.Domain], m)
+	cut := 0
+	for cut < len(samples) && m.Time.Sub(samples[cut].Time) > s.Retention {
+		cut++
+	}
+	s.samples[m.Domain] = samples[cut:]
+	return nil
+}
+
+func (s *MemoryMetadataStore) Samples(domain string, since time.Time) (samples []MetadataSample, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.samples[domain] {
+		if !m.Time.Before(since) {
+			samples = append(samples, m)
+		}
+	}
+	return
+}
+
+// GrowthAlert is a LimitWarning with the growth of the limit's usage over
+// the monitor's Window. Remaining is the projected time until the limit is
+// reached, 0 if usage is not growing.
+type GrowthAlert struct {
+	LimitWarning
+	PerDay    float64
+	Remaining time.Duration
+}
+
+// GrowthMonitor samples DomainMetadata into Store and calls OnAlert when a
+// domain limit is used past WarnAt, or growth over Window projects it to be
+// reached within WarnWithin. An alert fires when the condition starts to
+// hold and again only after it cleared.
+type GrowthMonitor struct {
+	// Domains are the domains to watch, all domains if empty.
+	Domains    []string
+	Window     time.Duration
+	WarnAt     float64
+	WarnWithin time.Duration
+	OnAlert    func(GrowthAlert)
+	Store      MetadataStore
+	db         SimpleDB
+	mu         sync.Mutex
+	alerting   map[string]bool
+	stop       chan struct{}
+}
+
+// NewGrowthMonitor warns at 80% of a limit or when it is projected to be
+// reached within a week, measuring growth over the last day.
+func NewGrowthMonitor(db SimpleDB, store MetadataStore) *GrowthMonitor {
+	return &GrowthMonitor{Window: 24 * time.Hour, WarnAt: 0.8, WarnWithin: 7 * 24 * time.Hour, Store: store, db: db, alerting: make(map[string]bool)}
+}
+
+// Check samples every watched domain once and returns the alerts that hold,
+// calling OnAlert for those that did not hold on the previous check.
+func (m *GrowthMonitor) Check(ctx context.Context) (alerts []GrowthAlert, err error) {
+	db := m.db.WithContext(ctx)
+	domains := m.Domains
+	if len(domains) == 0 {
+		if domains, err = db.ListDomainsPager().All(ctx); err != nil {
+			return
+		}
+	}
+	for _, domain := range domains {
+		var r DomainMetadataResponse
+		if r, err = db.DomainMetadata(domain); err != nil {
+			return
+		}
+		s := MetadataSample{Domain: domain, Time: time.Now(), Metadata: r}
+		if r.Timestamp > 0 {
+			s.Time = time.Unix(r.Timestamp, 0)
+		}
+		if err = m.Store.Add(s); err != nil {
+			return
+		}
+		var history []MetadataSample
+		if history, err = m.Store.Samples(domain, s.Time.Add(-m.Window)); err != nil {
+			return
+		}
+		alerts = append(alerts, m.growth(s, history)...)
+	}
+	return
+}
+
+// growth compares s with the oldest sample in history and fires the alerts
+// that start to hold.
+func (m *GrowthMonitor) growth(s MetadataSample, history []MetadataSample) (alerts []GrowthAlert) {
+	now := domainLimits(s.Domain, s.Metadata)
+	var then []LimitWarning
+	var elapsed time.Duration
+	if len(history) > 0 {
+		then, elapsed = domainLimits(s.Domain, history[0].Metadata), s.Time.Sub(history[0].Time)
+	}
+
+	var fire []GrowthAlert
+	m.mu.Lock()
+	for j, w := range now {
+		a := GrowthAlert{LimitWarning: w}
+		if elapsed > 0 && w.Used > then[j].Used {
+			a.PerDay = float64(w.Used-then[j].Used) / elapsed.Hours() * 24
+			a.Remaining = time.Duration(float64(w.Max-w.Used) / a.PerDay * float64(24*time.Hour))
+		}
+		key := s.Domain + "\x00" + w.Limit
+		hold := m.WarnAt > 0 && w.Ratio() >= m.WarnAt || a.Remaining > 0 && a.Remaining <= m.WarnWithin
+		if hold {
+			alerts = append(alerts, a)
+			if !m.alerting[key] {
+				fire = append(fire, a)
+			}
+		}
+		m.alerting[key] = hold
+	}
+	m.mu.Unlock()
+	// outside mu, so a handler can call Stop
+	if m.OnAlert != nil {
+		for _, a := range fire {
+			m.OnAlert(a)
+		}
+	}
+	return
+}
+
+// Start checks every interval until Stop is called. Check errors are
+// ignored and retried on the next tick. It fails if interval is not
+// positive.
+func (m *GrowthMonitor) Start(interval time.Duration) error {
+	if err := checkInterval(interval); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return nil
+	}
+	stop := make(chan struct{})
+	m.stop = stop
+	m.mu.Unlock()
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				m.Check(context.Background())
+			}
+		}
+	}()
+	return nil
+}
+
+func (m *GrowthMonitor) Stop() {
+	m.mu.Lock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+	m.mu.Unlock()
+}
@@ -0,0 +1,53 @@
+package sdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type growthTransport struct {
+	bytes     int64
+	timestamp int64
+}
+
+func (g *growthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := fmt.Sprintf("<DomainMetadataResponse><DomainMetadataResult><ItemCount>1</ItemCount>"+
+		"<AttributeValuesSizeBytes>%d</AttributeValuesSizeBytes><Timestamp>%d</Timestamp></DomainMetadataResult></DomainMetadataResponse>", g.bytes, g.timestamp)
+	return &http.Response{StatusCode: 200, Status: "200 OK", Body: io.NopCloser(bytes.NewBufferString(body)), Request: req}, nil
+}
+
+func TestGrowthMonitor(t *testing.T) {
+	gt := &growthTransport{bytes: 6 << 30, timestamp: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).Unix()}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: gt}
+	m := NewGrowthMonitor(c, NewMemoryMetadataStore(48*time.Hour))
+	m.Domains = []string{"d"}
+	m.Window = 48 * time.Hour
+	var fired []GrowthAlert
+	// a handler may stop the monitor
+	m.OnAlert = func(a GrowthAlert) { fired = append(fired, a); m.Stop() }
+	if err := m.Start(0); err == nil {
+		t.Error("Expected Start to refuse a zero interval")
+	}
+
+	if alerts, err := m.Check(context.Background()); err != nil || len(alerts) != 0 {
+		t.Fatalf("%v %v", alerts, err)
+	}
+	// 1GB a day leaves 3 days to the 10GB limit
+	gt.bytes += 1 << 30
+	gt.timestamp += 24 * 60 * 60
+	if _, err := m.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(fired) != 1 || fired[0].Limit != "size" || fired[0].PerDay != 1<<30 || fired[0].Remaining != 3*24*time.Hour {
+		t.Fatalf("%+v", fired)
+	}
+	if alerts, _ := m.Check(context.Background()); len(alerts) != 1 || len(fired) != 1 {
+		t.Errorf("alert fired again: %v", fired)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthState is the result of a HealthMonitor check.
+type HealthState int
+
+const (
+	HealthUnknown HealthState = iota
+	Healthy
+	// Unauthorized means the endpoint answered but rejected the credentials.
+	Unauthorized
+	// Unreachable means the endpoint could not be reached or failed.
+	Unreachable
+)
+
+func (s HealthState) String() string {
+	switch s {
+	case Healthy:
+		return "healthy"
+	case Unauthorized:
+		return "unauthorized"
+	case Unreachable:
+		return "unreachable"
+	}
+	return "unknown"
+}
+
+type HealthStatus struct {
+	State   HealthState
+	Err     error
+	Checked time.Time
+}
+
+// HealthMonitor periodically makes a ListDomains call to check that the
+// endpoint is reachable and accepts the credentials. OnChange, if set, is
+// called from the monitor goroutine whenever the state changes.
+type HealthMonitor struct {
+	Interval time.Duration
+	Timeout  time.Duration
+	OnChange func(old, new HealthStatus)
+	db       SimpleDB
+	mu       sync.Mutex
+	status   HealthStatus
+	changes  chan HealthStatus
+	stop     chan struct{}
+}
+
+// NewHealthMonitor returns a monitor checking every interval. Retries are
+// disabled so a check reports the endpoint's state rather than waiting out a
+// backoff.
+func NewHealthMonitor(db SimpleDB, interval time.Duration) *HealthMonitor {
+	db.MaxRetries = 0
+	return &HealthMonitor{Interval: interval, Timeout: 10 * time.Second, db: db, changes: make(chan HealthStatus, 1)}
+}
+
+// Check runs one check and records its result.
+func (m *HealthMonitor) Check(ctx context.Context) HealthStatus {
+	if m.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.Timeout)
+		defer cancel()
+	}
+	db := m.db.WithContext(ctx)
+	_, err := db.ListDomains()
+	s := HealthStatus{State: healthState(err), Err: err, Checked: time.Now()}
+
+	m.mu.Lock()
+	old := m.status
+	m.status = s
+	if old.State != s.State {
+		// keep only the latest transition for a slow reader, under mu so
+		// concurrent checks never find the buffer full
+		select {
+		case <-m.changes:
+		default:
+		}
+		m.changes <- s
+	}
+	m.mu.Unlock()
+	if old.State != s.State && m.OnChange != nil {
+		m.OnChange(old, s)
+	}
+	return s
+}
+
+func healthState(err error) HealthState {
+	if err == nil {
+		return Healthy
+	}
+	if e, ok := err.(SimpleDBError); ok && e.StatusCode < 500 {
+		switch e.Code {
+		case "AuthFailure", "AuthMissingFailure", "InvalidClientTokenId", "SignatureDoesNotMatch", "AccessFailure", "OptInRequired":
+			return Unauthorized
+		}
+	}
+	return Unreachable
+}
+
+func (m *HealthMonitor) Status() HealthStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// Changes returns a channel that receives the status after every state
+// change. Only the latest change is kept if it is not read in time.
+func (m *HealthMonitor) Changes() <-chan HealthStatus {
+	return m.changes
+}
+
+// Start checks immediately and then every Interval until Stop is called.
+// It fails if Interval is not positive.
+func (m *HealthMonitor) Start() error {
+	if err := checkInterval(m.Interval); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return nil
+	}
+	stop := make(chan struct{})
+	m.stop = stop
+	m.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			<-stop
+			cancel()
+		}()
+		t := time.NewTicker(m.Interval)
+		defer t.Stop()
+		for {
+			m.Check(ctx)
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// checkInterval refuses the interval of a periodic task that time.NewTicker
+// would panic on.
+func checkInterval(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("sdb: interval %v is not positive", d)
+	}
+	return nil
+}
+
+func (m *HealthMonitor) Stop() {
+	m.mu.Lock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+	m.mu.Unlock()
+}
+
+// ServeHTTP answers 200 when the last check was healthy and 503 otherwise,
+// for use as a readiness probe.
+func (m *HealthMonitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s := m.Status()
+	if s.State != Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write([]byte(s.State.String() + "\n"))
+}
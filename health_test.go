@@ -0,0 +1,66 @@
+package sdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type healthTransport struct {
+	status int
+	body   string
+	err    error
+}
+
+func (h *healthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if h.err != nil {
+		return nil, h.err
+	}
+	return &http.Response{StatusCode: h.status, Status: http.StatusText(h.status), Body: io.NopCloser(bytes.NewBufferString(h.body)), Request: req}, nil
+}
+
+func TestHealthMonitor(t *testing.T) {
+	ht := &healthTransport{status: 200, body: "<ListDomainsResponse/>"}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: ht}
+	m := NewHealthMonitor(c, 0)
+	var transitions []HealthState
+	m.OnChange = func(old, new HealthStatus) { transitions = append(transitions, new.State) }
+
+	if s := m.Check(context.Background()); s.State != Healthy {
+		t.Fatalf("state %v, err %v", s.State, s.Err)
+	}
+	m.Check(context.Background())
+	ht.status = 403
+	ht.body = "<Response><Errors><Error><Code>SignatureDoesNotMatch</Code><Message>bad</Message></Error></Errors></Response>"
+	m.Check(context.Background())
+	ht.err = errors.New("connection refused")
+	m.Check(context.Background())
+
+	want := []HealthState{Healthy, Unauthorized, Unreachable}
+	if len(transitions) != len(want) {
+		t.Fatalf("transitions %v, want %v", transitions, want)
+	}
+	for j := range want {
+		if transitions[j] != want[j] {
+			t.Errorf("transition %d = %v, want %v", j, transitions[j], want[j])
+		}
+	}
+	if s := <-m.Changes(); s.State != Unreachable {
+		t.Errorf("latest change %v", s.State)
+	}
+
+	if err := m.Start(); err == nil {
+		t.Error("Expected Start to refuse a zero interval")
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("readiness status %d", rec.Code)
+	}
+}
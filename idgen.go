@@ -0,0 +1,173 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// IDGenerator returns a new unique item name.
+type IDGenerator func() (string, error)
+
+var (
+	// UUIDv4 generates random RFC 4122 version 4 UUIDs.
+	UUIDv4 IDGenerator = newUUIDv4
+	// ULID generates 26 character ULIDs, which sort by creation millisecond.
+	ULID IDGenerator = newULID
+	// KSUID generates 27 character KSUIDs, which sort by creation second.
+	KSUID IDGenerator = newKSUID
+	// TimePrefixed generates the zero padded Unix nanoseconds followed by
+	// random hex, readable and sortable.
+	TimePrefixed IDGenerator = newTimePrefixed
+)
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	return b, err
+}
+
+func newUUIDv4() (string, error) {
+	b, err := randomBytes(16)
+	if err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func newULID() (string, error) {
+	b, err := randomBytes(16)
+	if err != nil {
+		return "", err
+	}
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	for j := 5; j >= 0; j-- {
+		b[j] = byte(ms)
+		ms >>= 8
+	}
+	// 128 bits as 26 base32 digits, the first holding the top 3 bits.
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	out := make([]byte, 26)
+	for j := 25; j >= 0; j-- {
+		out[j] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out), nil
+}
+
+const (
+	base62      = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	ksuidEpoch  = 1400000000
+	ksuidLength = 27
+)
+
+func newKSUID() (string, error) {
+	b, err := randomBytes(20)
+	if err != nil {
+		return "", err
+	}
+	binary.BigEndian.PutUint32(b, uint32(time.Now().Unix()-ksuidEpoch))
+	// big.Int.Text(62) puts lower case before upper case, which would not
+	// sort in byte order.
+	n := new(big.Int).SetBytes(b)
+	base, mod := big.NewInt(62), new(big.Int)
+	out := []byte(strings.Repeat("0", ksuidLength))
+	for j := ksuidLength - 1; j >= 0 && n.Sign() > 0; j-- {
+		n.DivMod(n, base, mod)
+		out[j] = base62[mod.Int64()]
+	}
+	return string(out), nil
+}
+
+func newTimePrefixed() (string, error) {
+	b, err := randomBytes(8)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%019d-%s", time.Now().UnixNano(), hex.EncodeToString(b)), nil
+}
+
+// maxNameAttempts bounds how often PutIfNotExists generates a new name after
+// a collision.
+const maxNameAttempts = 3
+
+// IDAttribute is written by PutIfNotExists to every item it creates, holding
+// the item name. Its absence is the condition of the put.
+const IDAttribute = "sdb.id"
+
+// PutIfNotExists puts i only if no item of that name was created by it yet,
+// using the condition that IDAttribute does not exist. If i has no name one
+// is generated with NameGenerator, ULID by default, and regenerated on a
+// collision. The name used is left in i.Name.
+func (sdb *SimpleDB) PutIfNotExists(domain string, i *Item) (r PutAttributesResponse, err error) {
+	db := *sdb
+	db.fullPut = true
+	c := Condition{Name: IDAttribute, Exists: false}
+	if i.Name != "" {
+		return db.PutAttributesIf(domain, withID(i), c)
+	}
+	gen := sdb.NameGenerator
+	if gen == nil {
+		gen = ULID
+	}
+	for attempt := 0; attempt < maxNameAttempts; attempt++ {
+		if i.Name, err = gen(); err != nil {
+			return
+		}
+		r, err = db.PutAttributesIf(domain, withID(i), c)
+		if !IsConditionalCheckFailed(err) {
+			return
+		}
+	}
+	return
+}
+
+// withID returns a copy of i with IDAttribute set to its name, replacing an
+// IDAttribute copied from another item.
+func withID(i *Item) *Item {
+	put := &Item{Name: i.Name}
+	for _, a := range i.Attributes {
+		if a.Name != IDAttribute {
+			put.Attributes = append(put.Attributes, a)
+		}
+	}
+	put.ReplaceAttribute(IDAttribute, i.Name)
+	return put
+}
@@ -0,0 +1,44 @@
+package sdb
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestIDGenerators(t *testing.T) {
+	tests := []struct {
+		name string
+		gen  IDGenerator
+		re   string
+	}{
+		{"UUIDv4", UUIDv4, "^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$"},
+		{"ULID", ULID, "^[0-7][0-9A-HJKMNP-TV-Z]{25}$"},
+		{"KSUID", KSUID, "^[0-9A-Za-z]{27}$"},
+		{"TimePrefixed", TimePrefixed, "^[0-9]{19}-[0-9a-f]{16}$"},
+	}
+	for _, tt := range tests {
+		a, err := tt.gen()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !regexp.MustCompile(tt.re).MatchString(a) {
+			t.Errorf("%s: malformed %s", tt.name, a)
+		}
+		b, _ := tt.gen()
+		if a == b {
+			t.Errorf("%s: generated %s twice", tt.name, a)
+		}
+	}
+
+	var ids []string
+	for j := 0; j < 3; j++ {
+		id, _ := ULID()
+		ids = append(ids, id)
+		time.Sleep(2 * time.Millisecond)
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Error("ULIDs should sort by creation time", ids)
+	}
+}
@@ -0,0 +1,56 @@
+package sdb_test
+
+import (
+	"testing"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestChecksumPartialWrites(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	db.Checksum = "_sum"
+	db.ChecksumKey = []byte("checksum key")
+	if _, err := db.CreateDomain("users"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.PutAttributes("users", &sdb.Item{Name: "u1", Attributes: []sdb.Attribute{
+		{Name: "name", Value: "Ann", Replace: true}, {Name: "age", Value: "42", Replace: true}, {Name: "tag", Value: "a", Replace: true},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	read := func(step string) sdb.Item {
+		t.Helper()
+		r, err := db.GetAttributes("users", "u1")
+		if err != nil {
+			t.Fatalf("read after %s: %v", step, err)
+		}
+		i := sdb.Item{Name: "u1", Attributes: r.Attributes}
+		if i.Value("_sum") == "" {
+			t.Errorf("no checksum after %s: %+v", step, r.Attributes)
+		}
+		return i
+	}
+
+	if _, err := db.DeleteAttributes("users", &sdb.Item{Name: "u1", Attributes: []sdb.Attribute{{Name: "tag"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if i := read("delete"); i.Value("tag") != "" {
+		t.Errorf("tag not deleted: %+v", i.Attributes)
+	}
+
+	if err := db.PatchAttributes("users", "u1", map[string][]string{"age": {"43"}}); err != nil {
+		t.Fatal(err)
+	}
+	if i := read("patch"); i.Value("age") != "43" || i.Value("name") != "Ann" {
+		t.Errorf("patched %+v", i.Attributes)
+	}
+
+	if err := db.PatchAttributes("users", "u1", map[string][]string{"age": {"44"}, "name": nil}); err != nil {
+		t.Fatal(err)
+	}
+	if i := read("patch with delete"); i.Value("age") != "44" || i.Value("name") != "" {
+		t.Errorf("patched %+v", i.Attributes)
+	}
+}
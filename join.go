@@ -0,0 +1,81 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+)
+
+// Joined is an item of the primary query of Join with the items its foreign
+// key names, in the order of the key's values. Names without an item are
+// left out.
+type Joined struct {
+	Item    Item
+	Related []Item
+}
+
+// Join runs q and fetches the items of domain named by the attribute key of
+// the results, with one GetByNames per page of results instead of one
+// GetAttributes per item. Multi-valued keys join several items.
+func (sdb *SimpleDB) Join(ctx context.Context, q string, key string, domain string) (joined []Joined, err error) {
+	db := sdb.WithContext(ctx)
+	p := db.SelectPager(q)
+	for !p.Done() {
+		var page Page[Item]
+		if page, err = p.Next(ctx); err != nil {
+			return
+		}
+		var names []string
+		for _, i := range page.Items {
+			for _, a := range i.Attributes {
+				if a.Name == key {
+					names = append(names, a.Value)
+				}
+			}
+		}
+		var related []Item
+		if related, err = db.GetByNames(domain, names); err != nil {
+			return
+		}
+		byName := make(map[string]Item, len(related))
+		for _, r := range related {
+			byName[r.Name] = r
+		}
+		for _, i := range page.Items {
+			j := Joined{Item: i}
+			for _, a := range i.Attributes {
+				if r, ok := byName[a.Value]; ok && a.Name == key {
+					j.Related = append(j.Related, r)
+				}
+			}
+			joined = append(joined, j)
+		}
+	}
+	return
+}
@@ -0,0 +1,50 @@
+package sdb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestJoin(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	for _, d := range []string{"orders", "customers"} {
+		if _, err := db.CreateDomain(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put := func(domain, name string, attrs ...string) {
+		i := sdb.NewItem(name)
+		for j := 0; j < len(attrs); j += 2 {
+			i.AddAttribute(attrs[j], attrs[j+1])
+		}
+		if _, err := db.PutAttributes(domain, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("customers", "c1", "name", "Ann")
+	put("customers", "c2", "name", "Bo")
+	put("orders", "o1", "customer", "c1")
+	put("orders", "o2", "customer", "c2", "customer", "c1")
+	put("orders", "o3", "customer", "gone")
+
+	joined, err := db.Join(context.Background(), "select * from orders", "customer", "customers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(joined) != 3 {
+		t.Fatalf("Expected 3 results, got %v", joined)
+	}
+	if r := joined[0].Related; len(r) != 1 || r[0].Value("name") != "Ann" {
+		t.Errorf("Unexpected o1 join %v", r)
+	}
+	if r := joined[1].Related; len(r) != 2 || r[0].Name != "c2" || r[1].Name != "c1" {
+		t.Errorf("Unexpected o2 join %v", r)
+	}
+	if len(joined[2].Related) != 0 {
+		t.Errorf("Expected no match for o3, got %v", joined[2].Related)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("sdb: invalid composite key")
+
+// KeyFormat joins and splits composite item names such as tenant#type#id.
+// Separator and Escape occurring in a part are preceded by Escape.
+type KeyFormat struct {
+	Separator rune
+	Escape    rune
+}
+
+// DefaultKeyFormat separates parts with '#' and escapes with '\'.
+var DefaultKeyFormat = KeyFormat{Separator: '#', Escape: '\\'}
+
+func (f KeyFormat) escape(part string) string {
+	var b strings.Builder
+	for _, r := range part {
+		if r == f.Separator || r == f.Escape {
+			b.WriteRune(f.Escape)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (f KeyFormat) Join(parts ...string) string {
+	escaped := make([]string, len(parts))
+	for j, p := range parts {
+		escaped[j] = f.escape(p)
+	}
+	return strings.Join(escaped, string(f.Separator))
+}
+
+// Prefix returns the joined parts followed by a separator, the common prefix
+// of every key starting with those parts.
+func (f KeyFormat) Prefix(parts ...string) string {
+	return f.Join(parts...) + string(f.Separator)
+}
+
+func (f KeyFormat) Split(key string) (parts []string, err error) {
+	var b strings.Builder
+	escaped := false
+	for _, r := range key {
+		switch {
+		case escaped:
+			b.WriteRune(r)
+			escaped = false
+		case r == f.Escape:
+			escaped = true
+		case r == f.Separator:
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if escaped {
+		return nil, ErrInvalidKey
+	}
+	return append(parts, b.String()), nil
+}
+
+func JoinKey(parts ...string) string {
+	return DefaultKeyFormat.Join(parts...)
+}
+
+func SplitKey(key string) ([]string, error) {
+	return DefaultKeyFormat.Split(key)
+}
+
+// WherePrefix matches items where attr starts with prefix, for example
+// WherePrefix("itemName()", DefaultKeyFormat.Prefix(tenant, "order")).
+func (q *Query) WherePrefix(attr string, prefix string) *Query {
+	return q.WhereExpr(quoteAttribute(attr) + " like " + Quote(likePrefix(prefix)))
+}
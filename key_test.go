@@ -0,0 +1,40 @@
+package sdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompositeKeys(t *testing.T) {
+	tests := []struct {
+		parts []string
+		key   string
+	}{
+		{[]string{"acme", "order", "42"}, "acme#order#42"},
+		{[]string{"a#b", `c\d`, ""}, `a\#b#c\\d#`},
+		{[]string{""}, ""},
+	}
+	for _, tt := range tests {
+		if k := JoinKey(tt.parts...); k != tt.key {
+			t.Errorf("JoinKey(%q) = %s, want %s", tt.parts, k, tt.key)
+		}
+		parts, err := SplitKey(tt.key)
+		if err != nil || !reflect.DeepEqual(parts, tt.parts) {
+			t.Errorf("SplitKey(%s) = %q, %v", tt.key, parts, err)
+		}
+	}
+	if _, err := SplitKey(`a\`); err != ErrInvalidKey {
+		t.Error("Expected ErrInvalidKey for trailing escape")
+	}
+
+	f := KeyFormat{Separator: '|', Escape: '~'}
+	if k := f.Join("a|b", "c"); k != "a~|b|c" {
+		t.Error(k)
+	}
+
+	q := NewQuery("d").WherePrefix("itemName()", DefaultKeyFormat.Prefix("50%", "order"))
+	expected := `select * from ` + "`d`" + ` where itemName() like '50\%#order#%'`
+	if s := q.String(); s != expected {
+		t.Errorf("Expected %s, got %s", expected, s)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+type Entry struct {
+	Rank   int
+	Member string
+	Score  float64
+}
+
+// Leaderboard keeps member scores ordered highest first. Several boards can
+// share a domain, each member is an item named board#member with the score
+// stored with EncodeFloat.
+type Leaderboard struct {
+	Domain string
+	Board  string
+	db     SimpleDB
+}
+
+func NewLeaderboard(db SimpleDB, domain string, board string) *Leaderboard {
+	return &Leaderboard{Domain: domain, Board: board, db: db}
+}
+
+func (l *Leaderboard) SetScore(member string, score float64) error {
+	i := NewItem(l.Board + "#" + member)
+	i.ReplaceAttribute("board", l.Board)
+	i.ReplaceAttribute("member", member)
+	i.ReplaceAttribute("score", EncodeFloat(score))
+	db := l.db
+	_, err := db.PutAttributes(l.Domain, i)
+	return err
+}
+
+func (l *Leaderboard) Remove(member string) error {
+	db := l.db
+	_, err := db.DeleteItem(l.Domain, l.Board+"#"+member)
+	return err
+}
+
+// Query returns the query for all entries of the board in rank order.
+func (l *Leaderboard) Query() *Query {
+	return NewQuery(l.Domain).
+		Output("member", "score").
+		Where("board", "=", l.Board).
+		WhereExpr("`score` is not null").
+		OrderBy("score", true)
+}
+
+// TopQuery returns the Select expression for the n highest scores.
+func (l *Leaderboard) TopQuery(n int) string {
+	return l.Query().Limit(n).String()
+}
+
+func (l *Leaderboard) Top(n int) ([]Entry, error) {
+	return l.Page(0, n)
+}
+
+// Page returns size entries starting at rank offset+1. Entries before offset
+// are skipped with count queries rather than fetched.
+func (l *Leaderboard) Page(offset int, size int) (entries []Entry, err error) {
+	db := l.db
+	page, err := db.SelectOffset(l.Query(), offset, size)
+	if err != nil {
+		return
+	}
+	for n, i := range page.Items {
+		e := Entry{Rank: offset + n + 1, Member: i.Value("member")}
+		if e.Score, err = DecodeFloat(i.Value("score")); err != nil {
+			return
+		}
+		entries = append(entries, e)
+	}
+	return
+}
@@ -0,0 +1,53 @@
+package sdb_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestLeaderboard(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	if _, err := db.CreateDomain("boards"); err != nil {
+		t.Fatal(err)
+	}
+	l := sdb.NewLeaderboard(db, "boards", "weekly")
+	other := sdb.NewLeaderboard(db, "boards", "daily")
+	scores := map[string]float64{"ann": 30, "bob": -5, "cid": 12.5, "dot": 100, "eve": 0}
+	for m, s := range scores {
+		if err := l.SetScore(m, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := other.SetScore("zed", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetScore("cid", 50); err != nil {
+		t.Fatal(err)
+	}
+
+	top, err := l.Top(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(top); got != "[{1 dot 100} {2 cid 50} {3 ann 30}]" {
+		t.Fatalf("Top(3) = %s", got)
+	}
+	page, err := l.Page(3, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(page); got != "[{4 eve 0} {5 bob -5}]" {
+		t.Fatalf("Page(3, 10) = %s", got)
+	}
+
+	if err := l.Remove("dot"); err != nil {
+		t.Fatal(err)
+	}
+	if top, err = l.Top(1); err != nil || len(top) != 1 || top[0].Member != "cid" {
+		t.Fatalf("Top(1) after Remove = %v, %v", top, err)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrLeaseLost = errors.New("lease is held by another owner")
+
+// Lease gives one owner at a time exclusive use of a named resource, such as a
+// partition of a poller or a cron job. The lease is an item holding the owner,
+// an expiry time and a version. An expired lease can be taken over by any
+// owner, so the holder must renew it well before TTL passes.
+type Lease struct {
+	Domain  string
+	Name    string
+	Owner   string
+	TTL     time.Duration
+	db      SimpleDB
+	mu      sync.Mutex
+	version string
+	stop    chan struct{}
+}
+
+func NewLease(db SimpleDB, domain string, name string, owner string, ttl time.Duration) *Lease {
+	db.ConsistentRead = true
+	return &Lease{Domain: domain, Name: name, Owner: owner, TTL: ttl, db: db}
+}
+
+// Acquire claims the lease if it is free, expired or already held by Owner.
+func (l *Lease) Acquire() (ok bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	db := l.db
+	r, err := db.GetAttributes(l.Domain, l.Name)
+	if err != nil {
+		return
+	}
+	i := Item{Name: l.Name, Attributes: r.Attributes}
+
+	c := Condition{Name: "version"}
+	if version := i.Value("version"); version != "" {
+		if i.Value("owner") != l.Owner && i.Value("expires") > sortableMillis(time.Now()) {
+			return false, nil
+		}
+		c = Condition{Name: "version", Value: version, Exists: true}
+	}
+	err = l.put(c)
+	if IsConditionalCheckFailed(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Renew extends a held lease by TTL. ErrLeaseLost is returned if the lease
+// expired and was taken by another owner.
+func (l *Lease) Renew() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.version == "" {
+		return ErrLeaseLost
+	}
+	err := l.put(Condition{Name: "version", Value: l.version, Exists: true})
+	if IsConditionalCheckFailed(err) {
+		l.version = ""
+		return ErrLeaseLost
+	}
+	return err
+}
+
+// KeepAlive renews the lease every interval until Release is called. A failed
+// renewal is retried on the next tick, the error is sent on the returned
+// channel and renewal stops once the lease is lost or TTL has passed since the
+// last successful renewal. An interval that is not positive is refused.
+func (l *Lease) KeepAlive(interval time.Duration) (<-chan error, error) {
+	if err := checkInterval(interval); err != nil {
+		return nil, err
+	}
+	lost := make(chan error, 1)
+	stop := make(chan struct{})
+	l.mu.Lock()
+	if l.stop != nil {
+		close(l.stop)
+	}
+	l.stop = stop
+	l.mu.Unlock()
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		renewed := time.Now()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				err := l.Renew()
+				if err == nil {
+					renewed = time.Now()
+					continue
+				}
+				if err == ErrLeaseLost || time.Since(renewed) >= l.TTL {
+					lost <- err
+					return
+				}
+			}
+		}
+	}()
+	return lost, nil
+}
+
+// Release stops any KeepAlive and deletes the lease if it is still held.
+func (l *Lease) Release() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stop != nil {
+		close(l.stop)
+		l.stop = nil
+	}
+	if l.version == "" {
+		return nil
+	}
+	db := l.db
+	_, err := db.DeleteItemIf(l.Domain, l.Name, Condition{Name: "version", Value: l.version, Exists: true})
+	l.version = ""
+	if IsConditionalCheckFailed(err) {
+		return ErrLeaseLost
+	}
+	return err
+}
+
+func (l *Lease) put(c Condition) error {
+	next := 1
+	if c.Exists {
+		v, err := strconv.Atoi(c.Value)
+		if err != nil {
+			return err
+		}
+		next = v + 1
+	}
+	i := NewItem(l.Name)
+	i.ReplaceAttribute("owner", l.Owner)
+	i.ReplaceAttribute("expires", sortableMillis(time.Now().Add(l.TTL)))
+	i.ReplaceAttribute("version", strconv.Itoa(next))
+
+	db := l.db
+	if _, err := db.PutAttributesIf(l.Domain, i, c); err != nil {
+		return err
+	}
+	l.version = strconv.Itoa(next)
+	return nil
+}
@@ -0,0 +1,127 @@
+package sdb_test
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+// failingTransport fails the next fail requests before passing requests on
+// to the wrapped transport.
+type failingTransport struct {
+	http.RoundTripper
+	fail int32
+}
+
+func (t *failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if atomic.AddInt32(&t.fail, -1) >= 0 {
+		return nil, errors.New("connection reset")
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
+
+func TestLease(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	if _, err := db.CreateDomain("leases"); err != nil {
+		t.Fatal(err)
+	}
+	a := sdb.NewLease(db, "leases", "cron", "a", time.Hour)
+	b := sdb.NewLease(db, "leases", "cron", "b", time.Hour)
+
+	if ok, err := a.Acquire(); err != nil || !ok {
+		t.Fatalf("a.Acquire = %v, %v", ok, err)
+	}
+	if ok, err := a.Acquire(); err != nil || !ok {
+		t.Fatalf("second a.Acquire = %v, %v", ok, err)
+	}
+	if ok, err := b.Acquire(); err != nil || ok {
+		t.Fatalf("b.Acquire of a held lease = %v, %v", ok, err)
+	}
+	if err := a.Renew(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Renew(); err != sdb.ErrLeaseLost {
+		t.Fatalf("b.Renew = %v", err)
+	}
+	if err := a.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := b.Acquire(); err != nil || !ok {
+		t.Fatalf("b.Acquire of a released lease = %v, %v", ok, err)
+	}
+	if err := b.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	// An expired lease can be taken over, after which the old owner has lost it.
+	c := sdb.NewLease(db, "leases", "expiring", "c", -time.Minute)
+	d := sdb.NewLease(db, "leases", "expiring", "d", time.Hour)
+	if ok, err := c.Acquire(); err != nil || !ok {
+		t.Fatalf("c.Acquire = %v, %v", ok, err)
+	}
+	if ok, err := d.Acquire(); err != nil || !ok {
+		t.Fatalf("d.Acquire of an expired lease = %v, %v", ok, err)
+	}
+	if err := c.Renew(); err != sdb.ErrLeaseLost {
+		t.Fatalf("c.Renew after takeover = %v", err)
+	}
+}
+
+func TestLeaseKeepAlive(t *testing.T) {
+	f := sdbtest.NewFake()
+	tr := &failingTransport{RoundTripper: f}
+	db := f.Client()
+	db.HTTPClient = &http.Client{Transport: tr}
+	if _, err := db.CreateDomain("leases"); err != nil {
+		t.Fatal(err)
+	}
+	l := sdb.NewLease(db, "leases", "cron", "a", time.Hour)
+	if ok, err := l.Acquire(); err != nil || !ok {
+		t.Fatalf("Acquire = %v, %v", ok, err)
+	}
+
+	// A transient failure does not end the keep alive.
+	atomic.StoreInt32(&tr.fail, 2)
+	if _, err := l.KeepAlive(0); err == nil {
+		t.Error("expected KeepAlive to refuse a zero interval")
+	}
+	lost, err := l.KeepAlive(time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&tr.fail) > -3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-lost:
+		t.Fatalf("KeepAlive gave up after a transient error: %v", err)
+	default:
+	}
+
+	// Losing the lease does.
+	other := sdb.NewLease(db, "leases", "cron", "b", time.Hour)
+	if _, err := db.DeleteItem("leases", "cron"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := other.Acquire(); err != nil || !ok {
+		t.Fatalf("other.Acquire = %v, %v", ok, err)
+	}
+	select {
+	case err := <-lost:
+		if err != sdb.ErrLeaseLost {
+			t.Fatalf("KeepAlive sent %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("KeepAlive did not report the lost lease")
+	}
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+}
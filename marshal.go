@@ -0,0 +1,920 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Struct fields are mapped to attributes with the sdb tag:
+//
+//	ID   string    `sdb:",itemname"` the item name
+//	Name string    `sdb:"name"`      attribute name
+//	Tags []string  `sdb:"tags"`      multi-valued attribute
+//	Data []byte    `sdb:"data"`      binary value, see SetBinary
+//	Addr Address   `sdb:"addr,codec=json"` encoded with a registered Codec
+//	Kind string    `sdb:"kind,enum=a|b"` one of the listed values, see Enum
+//	Addr Address   `sdb:"addr"`      flattened to addr.city, addr.zip, ...
+//	Lines []Line   `sdb:"lines"`     flattened to lines.0.sku, ... and lines.len
+//	Meta Meta      `sdb:"meta,json"` JSON text, chunked as with SetChunked
+//	Note string    `sdb:"note,omitempty"` not stored when zero
+//	Skip int       `sdb:"-"`         not stored
+//
+// Exported fields without a tag use the field name. Integers, floats and
+// times are stored with EncodeInt, EncodeFloat and EncodeTime so they sort
+// correctly in Select. Struct fields, and slices of structs, are flattened
+// to dotted attribute names unless a codec applies, from the codec option
+// or the domain's Codec.
+//
+// Nil pointers, slices and maps, empty multi-valued attributes and zero
+// omitempty fields are null: they are not stored, and PutStruct deletes
+// their attributes from an existing item, see MarshalDeletes, along with
+// the elements removed from slices of structs.
+
+var ErrNotStruct = errors.New("value must be a pointer to a struct")
+
+type field struct {
+	name     string
+	index    []int
+	itemName bool
+	codec    string
+	enum     []string
+	json     bool
+	omit     bool
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func structFields(t reflect.Type) (fields []field) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		tag := sf.Tag.Get("sdb")
+		if tag == "-" {
+			continue
+		}
+		f := field{name: sf.Name, index: sf.Index}
+		parts := strings.Split(tag, ",")
+		if parts[0] != "" {
+			f.name = parts[0]
+		}
+		for _, opt := range parts[1:] {
+			switch {
+			case opt == "itemname":
+				f.itemName = true
+			case opt == "json":
+				f.json = true
+			case opt == "omitempty":
+				f.omit = true
+			case strings.HasPrefix(opt, "codec="):
+				f.codec = opt[len("codec="):]
+			case strings.HasPrefix(opt, "enum="):
+				f.enum = strings.Split(opt[len("enum="):], "|")
+			}
+		}
+		fields = append(fields, f)
+	}
+	return
+}
+
+func structValue(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return rv, ErrNotStruct
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return rv, ErrNotStruct
+	}
+	return rv, nil
+}
+
+// MarshalItem converts a struct to an item. All attributes are marked for
+// replace so putting the item overwrites the stored values.
+func MarshalItem(v interface{}) (i *Item, err error) {
+	return marshalItem(v, nil)
+}
+
+// marshalItem uses def for fields without a codec option whose type has no
+// native encoding.
+func marshalItem(v interface{}, def Codec) (i *Item, err error) {
+	rv, err := structValue(v)
+	if err != nil {
+		return
+	}
+	if err = beforePut(v); err != nil {
+		return
+	}
+	i = NewItem("")
+	if err = marshalStruct(i, rv, "", def); err != nil {
+		return nil, err
+	}
+	derive(rv.Type(), i)
+	return
+}
+
+// marshalStruct adds the fields of rv to i, prefixing their names with
+// prefix. The item name is only taken from the outermost struct.
+func marshalStruct(i *Item, rv reflect.Value, prefix string, def Codec) (err error) {
+	for _, f := range structFields(rv.Type()) {
+		fv := rv.FieldByIndex(f.index)
+		if f.itemName {
+			if prefix == "" {
+				i.Name = fmt.Sprint(fv.Interface())
+			}
+			continue
+		}
+		if null(f, fv) {
+			continue
+		}
+		f.name = prefix + f.name
+		switch {
+		case f.json:
+			err = marshalJSON(i, f, fv)
+		case flattened(f, fv.Type(), def):
+			err = marshalNested(i, f, fv, def)
+		case f.codec != "" || def != nil && !nativeType(fv.Type()):
+			err = marshalCodec(i, f, fv, def)
+		default:
+			err = marshalField(i, f, fv)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// null reports whether fv is not stored, see MarshalItem.
+func null(f field, fv reflect.Value) bool {
+	switch fv.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		if fv.IsNil() {
+			return true
+		}
+	}
+	return f.omit && fv.IsZero()
+}
+
+// MarshalDeletes returns the attributes of the null fields of v, the struct
+// v points to, and its unset derived attributes, see RegisterDerived, as an
+// item for DeleteAttributes. Chunked and binary values
+// are deleted by their chunk count and slices of structs by their length,
+// which is enough for UnmarshalItem to read them as absent. The elements of
+// slices of structs are left, see MarshalDeletesFrom.
+func MarshalDeletes(v interface{}) (i *Item, err error) {
+	return marshalDeletes(v, nil)
+}
+
+// MarshalDeletesFrom is MarshalDeletes that also deletes the attributes of
+// stored, the item as read before v is put, that belong to elements of
+// slices of structs v no longer has. PutStruct and Repository.PutAll read
+// the stored item for this when v has slices of structs.
+func MarshalDeletesFrom(v interface{}, stored Item) (i *Item, err error) {
+	if i, err = MarshalDeletes(v); err != nil {
+		return
+	}
+	rv, _ := structValue(v)
+	put := NewItem(i.Name)
+	if err = marshalStruct(put, rv, "", nil); err != nil {
+		return nil, err
+	}
+	derive(rv.Type(), put)
+	for _, name := range staleElements(stored, put, i) {
+		i.AddAttribute(name, "")
+	}
+	return
+}
+
+// hasElements reports whether put or del, as written for a struct, has
+// slices of structs, by their length attribute.
+func hasElements(put *Item, del *Item) bool {
+	for _, a := range append(put.Attributes[:len(put.Attributes):len(put.Attributes)], del.Attributes...) {
+		if strings.HasSuffix(a.Name, ".len") {
+			return true
+		}
+	}
+	return false
+}
+
+// staleElements lists the attributes of stored under an element of a slice
+// of structs, name.N.attr with name.len stored, that neither put writes nor
+// del deletes already.
+func staleElements(stored Item, put *Item, del *Item) (names []string) {
+	storedNames := make(map[string]bool)
+	for _, a := range stored.Attributes {
+		storedNames[a.Name] = true
+	}
+	skip := make(map[string]bool)
+	for _, a := range append(put.Attributes[:len(put.Attributes):len(put.Attributes)], del.Attributes...) {
+		skip[a.Name] = true
+	}
+	for _, a := range stored.Attributes {
+		if skip[a.Name] {
+			continue
+		}
+		parts := strings.Split(a.Name, ".")
+		for k := 1; k < len(parts)-1; k++ {
+			if _, err := strconv.ParseUint(parts[k], 10, 0); err == nil && storedNames[strings.Join(parts[:k], ".")+".len"] {
+				names = append(names, a.Name)
+				skip[a.Name] = true
+				break
+			}
+		}
+	}
+	return
+}
+
+func marshalDeletes(v interface{}, def Codec) (i *Item, err error) {
+	rv, err := structValue(v)
+	if err != nil {
+		return
+	}
+	i = &Item{}
+	for _, f := range structFields(rv.Type()) {
+		if f.itemName {
+			i.Name = fmt.Sprint(rv.FieldByIndex(f.index).Interface())
+		}
+	}
+	for _, name := range deletedAttributes(rv, "", def, false) {
+		i.AddAttribute(name, "")
+	}
+	put := NewItem("")
+	if err = marshalStruct(put, rv, "", def); err != nil {
+		return nil, err
+	}
+	for _, name := range derive(rv.Type(), put) {
+		i.AddAttribute(name, "")
+	}
+	return
+}
+
+// deletedAttributes lists the attributes of the null fields of rv, or of
+// all fields when all is set.
+func deletedAttributes(rv reflect.Value, prefix string, def Codec, all bool) (names []string) {
+	for _, f := range structFields(rv.Type()) {
+		if f.itemName {
+			continue
+		}
+		fv := rv.FieldByIndex(f.index)
+		name := prefix + f.name
+		empty := all || null(f, fv)
+		t := fv.Type()
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch {
+		case f.json, f.codec != "" || def != nil && !nativeType(t),
+			t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+			if empty {
+				names = append(names, name+".chunks")
+			}
+		case flattened(f, t, def) && t.Kind() == reflect.Slice:
+			if empty {
+				names = append(names, name+".len")
+			}
+		case flattened(f, t, def):
+			if empty {
+				names = append(names, deletedAttributes(reflect.Zero(t), name+".", def, true)...)
+			} else {
+				names = append(names, deletedAttributes(reflect.Indirect(fv), name+".", def, false)...)
+			}
+		case empty || t.Kind() == reflect.Slice && reflect.Indirect(fv).Len() == 0:
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// flattened reports whether a field of type t is stored as dotted
+// attributes: a struct other than time.Time or a slice of them, without a
+// codec.
+func flattened(f field, t reflect.Type, def Codec) bool {
+	if f.codec != "" || def != nil {
+		return false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+	return t.Kind() == reflect.Struct && t != timeType
+}
+
+// marshalNested flattens a struct to name.attr and a slice of structs to
+// name.N.attr with the length in name.len.
+func marshalNested(i *Item, f field, fv reflect.Value, def Codec) error {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+	if fv.Kind() != reflect.Slice {
+		return marshalStruct(i, fv, f.name+".", def)
+	}
+	if fv.IsNil() {
+		return nil
+	}
+	for j := 0; j < fv.Len(); j++ {
+		ev := fv.Index(j)
+		if ev.Kind() == reflect.Ptr {
+			if ev.IsNil() {
+				continue
+			}
+			ev = ev.Elem()
+		}
+		if err := marshalStruct(i, ev, f.name+"."+strconv.Itoa(j)+".", def); err != nil {
+			return err
+		}
+	}
+	i.ReplaceAttribute(f.name+".len", strconv.Itoa(fv.Len()))
+	return nil
+}
+
+func marshalJSON(i *Item, f field, fv reflect.Value) error {
+	if fv.Kind() == reflect.Ptr && fv.IsNil() {
+		return nil
+	}
+	b, err := json.Marshal(fv.Interface())
+	if err != nil {
+		return fmt.Errorf("%s: %v", f.name, err)
+	}
+	return i.SetChunked(f.name, string(b))
+}
+
+func fieldCodec(f field, def Codec) (Codec, error) {
+	if f.codec == "" {
+		return def, nil
+	}
+	c, ok := LookupCodec(f.codec)
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown codec %s", f.name, f.codec)
+	}
+	return c, nil
+}
+
+func marshalCodec(i *Item, f field, fv reflect.Value, def Codec) error {
+	c, err := fieldCodec(f, def)
+	if err != nil {
+		return err
+	}
+	if fv.Kind() == reflect.Ptr && fv.IsNil() {
+		return nil
+	}
+	b, err := c.Marshal(fv.Interface())
+	if err != nil {
+		return fmt.Errorf("%s: %v", f.name, err)
+	}
+	return i.SetBinary(f.name, b, false)
+}
+
+func marshalField(i *Item, f field, fv reflect.Value) error {
+	name := f.name
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Uint8 {
+		return i.SetBinary(name, fv.Bytes(), false)
+	}
+	if fv.Kind() == reflect.Slice {
+		for j := 0; j < fv.Len(); j++ {
+			s, err := encodeValue(fv.Index(j))
+			if err == nil {
+				err = checkEnum(enumValues(f, fv.Type().Elem()), s)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			i.ReplaceAttribute(name, s)
+		}
+		return nil
+	}
+	s, err := encodeValue(fv)
+	if err == nil {
+		err = checkEnum(enumValues(f, fv.Type()), s)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	i.ReplaceAttribute(name, s)
+	return nil
+}
+
+// nativeType reports whether values of t are encoded without a codec.
+func nativeType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice {
+		if t.Elem().Kind() == reflect.Uint8 {
+			return true
+		}
+		t = t.Elem()
+	}
+	if t == timeType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func encodeValue(v reflect.Value) (string, error) {
+	if v.Type() == timeType {
+		return EncodeTime(v.Interface().(time.Time)), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return EncodeInt(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprintf("%020d", v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return EncodeFloat(v.Float()), nil
+	}
+	return "", fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// UnmarshalItem sets the fields of the struct v points to from the item.
+// Fields without a matching attribute are left unchanged.
+func UnmarshalItem(i Item, v interface{}) error {
+	return unmarshalItem(i, v, nil)
+}
+
+func unmarshalItem(i Item, v interface{}, def Codec) error {
+	if reflect.ValueOf(v).Kind() != reflect.Ptr {
+		return ErrNotStruct
+	}
+	rv, err := structValue(v)
+	if err != nil {
+		return err
+	}
+	values := make(map[string][]string)
+	for _, a := range i.Attributes {
+		if !isDerived(rv.Type(), a.Name) {
+			values[a.Name] = append(values[a.Name], a.Value)
+		}
+	}
+	if err = unmarshalStruct(i, values, rv, "", def); err != nil {
+		return err
+	}
+	return afterGet(v)
+}
+
+func unmarshalStruct(i Item, values map[string][]string, rv reflect.Value, prefix string, def Codec) (err error) {
+	for _, f := range structFields(rv.Type()) {
+		fv := rv.FieldByIndex(f.index)
+		if f.itemName {
+			if prefix != "" {
+				continue
+			}
+			if err = decodeValue(fv, i.Name); err != nil {
+				return fmt.Errorf("item %s field %s: %w", i.Name, f.name, err)
+			}
+			continue
+		}
+		f.name = prefix + f.name
+		switch {
+		case f.json:
+			err = unmarshalJSON(i, f, fv)
+		case flattened(f, fv.Type(), def):
+			// errors come wrapped from the nested fields
+			if err = unmarshalNested(i, values, f, fv, def); err != nil {
+				return
+			}
+			continue
+		case f.codec != "" || def != nil && !nativeType(fv.Type()):
+			err = unmarshalCodec(i, f, fv, def)
+		default:
+			err = unmarshalField(i, f, fv, values[f.name])
+		}
+		if err != nil {
+			return fmt.Errorf("item %s field %s: %w", i.Name, f.name, err)
+		}
+	}
+	return nil
+}
+
+// unmarshalNested reads a field flattened by marshalNested. Nil pointers
+// stay nil when no attribute of the field is present.
+func unmarshalNested(i Item, values map[string][]string, f field, fv reflect.Value, def Codec) error {
+	t := fv.Type()
+	if t.Kind() == reflect.Ptr {
+		if !hasPrefix(values, f.name+".") {
+			return nil
+		}
+		p := reflect.New(t.Elem())
+		if err := unmarshalNested(i, values, f, p.Elem(), def); err != nil {
+			return err
+		}
+		fv.Set(p)
+		return nil
+	}
+	if t.Kind() != reflect.Slice {
+		return unmarshalStruct(i, values, fv, f.name+".", def)
+	}
+	l, ok := values[f.name+".len"]
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(l[0])
+	if err != nil || n < 0 {
+		return fmt.Errorf("item %s field %s: invalid length %q", i.Name, f.name, l[0])
+	}
+	s := reflect.MakeSlice(t, n, n)
+	for j := 0; j < n; j++ {
+		ev := s.Index(j)
+		if ev.Kind() == reflect.Ptr {
+			ev.Set(reflect.New(ev.Type().Elem()))
+			ev = ev.Elem()
+		}
+		if err = unmarshalStruct(i, values, ev, f.name+"."+strconv.Itoa(j)+".", def); err != nil {
+			return err
+		}
+	}
+	fv.Set(s)
+	return nil
+}
+
+func hasPrefix(values map[string][]string, prefix string) bool {
+	for name := range values {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func unmarshalJSON(i Item, f field, fv reflect.Value) error {
+	s, ok, err := i.Chunked(f.name)
+	if !ok || err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(s), fv.Addr().Interface())
+}
+
+func unmarshalCodec(i Item, f field, fv reflect.Value, def Codec) error {
+	c, err := fieldCodec(f, def)
+	if err != nil {
+		return err
+	}
+	data, ok, err := i.Binary(f.name)
+	if !ok || err != nil {
+		return err
+	}
+	return c.Unmarshal(data, fv.Addr().Interface())
+}
+
+func unmarshalField(i Item, f field, fv reflect.Value, values []string) error {
+	t := fv.Type()
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+		data, ok, err := i.Binary(f.name)
+		if ok {
+			fv.SetBytes(data)
+		}
+		return err
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		p := reflect.New(t.Elem())
+		if err := unmarshalField(i, f, p.Elem(), values); err != nil {
+			return err
+		}
+		fv.Set(p)
+		return nil
+	}
+	if t.Kind() == reflect.Slice {
+		s := reflect.MakeSlice(t, len(values), len(values))
+		for j, v := range values {
+			if err := checkEnum(enumValues(f, t.Elem()), v); err != nil {
+				return err
+			}
+			if err := decodeValue(s.Index(j), v); err != nil {
+				return err
+			}
+		}
+		fv.Set(s)
+		return nil
+	}
+	if err := checkEnum(enumValues(f, t), values[0]); err != nil {
+		return err
+	}
+	return decodeValue(fv, values[0])
+}
+
+func decodeValue(v reflect.Value, s string) error {
+	if v.Type() == timeType {
+		t, err := DecodeTime(s)
+		if err == nil {
+			v.Set(reflect.ValueOf(t))
+		}
+		return err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := DecodeInt(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := DecodeFloat(s)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// PutStruct stores the struct v points to as an item, the item name is taken
+// from the field tagged itemname. An empty string item name is generated, see
+// PutIfNotExists, and set in the struct. The attributes of null fields are
+// deleted with a DeleteAttributes call after the put, the two calls are not
+// atomic.
+func (sdb *SimpleDB) PutStruct(domain string, v interface{}) (err error) {
+	i, err := marshalItem(v, sdb.domainCodec(domain))
+	if err != nil {
+		return
+	}
+	if i.Name == "" {
+		return sdb.putNewStruct(domain, i, v)
+	}
+	if err = sdb.validateItemNames(domain, i); err != nil {
+		return
+	}
+	del, err := marshalDeletes(v, sdb.domainCodec(domain))
+	if err != nil {
+		return
+	}
+	if hasElements(i, del) {
+		db := *sdb
+		db.ConsistentRead = true
+		var r GetAttributesResponse
+		if r, err = db.GetAttributes(domain, i.Name); err != nil {
+			return
+		}
+		for _, name := range staleElements(Item{Name: i.Name, Attributes: r.Attributes}, i, del) {
+			del.AddAttribute(name, "")
+		}
+	}
+	if len(i.Attributes) > 0 || len(del.Attributes) == 0 {
+		db := *sdb
+		db.fullPut = true
+		if _, err = db.PutAttributes(domain, i); err != nil {
+			return
+		}
+	}
+	if len(del.Attributes) > 0 {
+		_, err = sdb.DeleteAttributes(domain, del)
+	}
+	return
+}
+
+// putNewStruct stores a struct without item name with PutIfNotExists and
+// sets the generated name in its itemname field.
+func (sdb *SimpleDB) putNewStruct(domain string, i *Item, v interface{}) (err error) {
+	rv, _ := structValue(v)
+	var nameField reflect.Value
+	for _, f := range structFields(rv.Type()) {
+		if f.itemName {
+			nameField = rv.FieldByIndex(f.index)
+		}
+	}
+	if !nameField.IsValid() || nameField.Kind() != reflect.String || !nameField.CanSet() {
+		return errors.New("sdb: item name is empty and can not be generated")
+	}
+	// The name is generated later, validate the attribute names with a
+	// placeholder.
+	if err = sdb.validateItemNames(domain, &Item{Name: "-", Attributes: i.Attributes}); err != nil {
+		return
+	}
+	if _, err = sdb.PutIfNotExists(domain, i); err != nil {
+		return
+	}
+	nameField.SetString(i.Name)
+	return
+}
+
+// GetStruct reads the item into the struct v points to. found is false if the
+// item does not exist.
+func (sdb *SimpleDB) GetStruct(domain string, itemName string, v interface{}) (found bool, err error) {
+	if err = sdb.validateItemNames(domain, &Item{Name: itemName}); err != nil {
+		return
+	}
+	r, err := sdb.GetAttributes(domain, itemName)
+	if err != nil || len(r.Attributes) == 0 {
+		return
+	}
+	i := Item{Name: itemName, Attributes: r.Attributes}
+	sdb.checkDrift(domain, i, v)
+	return true, unmarshalItem(i, v, sdb.domainCodec(domain))
+}
+
+// SelectInto runs q, following NextToken until all pages are read, and
+// appends every item to the slice dest points to. The slice elements are
+// structs or pointers to structs tagged as for UnmarshalItem. A select *
+// only asks for the attributes of their Projection. When a page fails the
+// slice is left unchanged, or with PartialResults holds the items of the
+// pages read before. An item that does not unmarshal fails the page the
+// same way.
+func (sdb *SimpleDB) SelectInto(q string, dest interface{}) (err error) {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.Elem().Kind() != reflect.Slice {
+		return errors.New("sdb: SelectInto needs a pointer to a slice")
+	}
+	slice := dv.Elem()
+	elem := slice.Type().Elem()
+	ptr := elem.Kind() == reflect.Ptr
+	if ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return ErrNotStruct
+	}
+	def := sdb.domainCodec(selectDomain(q))
+	q = sdb.projectSelect(q, dest)
+	orig := reflect.ValueOf(slice.Interface())
+	pages := 0
+	fail := func(err error, token string) error {
+		if !sdb.PartialResults {
+			dv.Elem().Set(orig)
+			return err
+		}
+		dv.Elem().Set(slice)
+		return &PartialError{Op: "SelectInto", Pages: pages, Items: slice.Len() - orig.Len(), NextToken: token, Err: err}
+	}
+
+	token := ""
+	for {
+		r, err := sdb.SelectWithToken(q, token)
+		if err != nil {
+			return fail(err, token)
+		}
+		read := slice
+		for _, i := range r.Items {
+			v := reflect.New(elem)
+			if err = unmarshalItem(i, v.Interface(), def); err != nil {
+				slice = read
+				return fail(err, token)
+			}
+			if !ptr {
+				v = v.Elem()
+			}
+			slice = reflect.Append(slice, v)
+		}
+		dv.Elem().Set(slice)
+		pages++
+		if r.NextToken == "" {
+			return nil
+		}
+		token = r.NextToken
+	}
+}
+
+// Projection returns the attributes UnmarshalItem reads for v, a struct, a
+// slice of structs or a pointer to either. ok is false when a field is
+// stored in chunks, binary and codec fields, whose attributes can not be
+// listed up front.
+func Projection(v interface{}) (attrs []string, ok bool) {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, false
+	}
+	return projection(t, "")
+}
+
+func projection(t reflect.Type, prefix string) (attrs []string, ok bool) {
+	itemName := false
+	for _, f := range structFields(t) {
+		if f.itemName {
+			itemName = true
+			continue
+		}
+		ft := t.FieldByIndex(f.index).Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && ft != timeType && f.codec == "" && !f.json {
+			nested, ok := projection(ft, prefix+f.name+".")
+			if !ok {
+				return nil, false
+			}
+			attrs = append(attrs, nested...)
+			continue
+		}
+		if f.codec != "" || f.json || !nativeType(ft) || ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Uint8 {
+			return nil, false
+		}
+		attrs = append(attrs, prefix+f.name)
+	}
+	if len(attrs) == 0 && itemName && prefix == "" {
+		attrs = []string{"itemName()"}
+	}
+	return attrs, true
+}
+
+// OutputFor limits the query output to the Projection of v, leaving it
+// unchanged when v has no projection.
+func (q *Query) OutputFor(v interface{}) *Query {
+	if attrs, ok := Projection(v); ok && len(attrs) > 0 {
+		q.Output(attrs...)
+	}
+	return q
+}
+
+// projectSelect replaces the * output of the Select expression q with the
+// Projection of v. q is returned unchanged when it names its output, v has
+// no projection or the client verifies checksums, which needs every
+// attribute.
+func (sdb *SimpleDB) projectSelect(q string, v interface{}) string {
+	if sdb.Checksum != "" {
+		return q
+	}
+	attrs, ok := Projection(v)
+	if !ok || len(attrs) == 0 {
+		return q
+	}
+	toks, err := lexSelect(q)
+	if err != nil || len(toks) < 2 || !strings.EqualFold(toks[0].text, "select") || toks[1].text != "*" {
+		return q
+	}
+	quoted := make([]string, len(attrs))
+	for n, a := range attrs {
+		quoted[n] = quoteAttribute(a)
+	}
+	return q[:toks[1].offset] + strings.Join(quoted, ", ") + q[toks[1].offset+1:]
+}
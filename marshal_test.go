@@ -0,0 +1,280 @@
+package sdb
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type marshalTest struct {
+	ID      string `sdb:",itemname"`
+	Name    string `sdb:"name"`
+	Age     int
+	Score   float64
+	Active  bool
+	Created time.Time
+	Tags    []string `sdb:"tags"`
+	Data    []byte
+	Nick    *string
+	Address marshalAddress `sdb:"address,codec=json"`
+	Skip    string         `sdb:"-"`
+}
+
+type marshalAddress struct {
+	Street string
+	City   string
+}
+
+func TestMarshalItem(t *testing.T) {
+	nick := "rb"
+	in := marshalTest{
+		ID:      "user-1",
+		Name:    "Roland",
+		Age:     -3,
+		Score:   1.5,
+		Active:  true,
+		Created: time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC),
+		Tags:    []string{"a", "b"},
+		Data:    []byte{0, 1, 2},
+		Nick:    &nick,
+		Address: marshalAddress{Street: "Storgatan 1", City: "Stockholm"},
+		Skip:    "skipped",
+	}
+	i, err := MarshalItem(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Name != "user-1" || i.Value("name") != "Roland" || i.Value("Skip") != "" {
+		t.Errorf("Unexpected item %v", i)
+	}
+
+	var out marshalTest
+	if err = UnmarshalItem(*i, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Skip = ""
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("Expected %v, got %v", in, out)
+	}
+}
+
+func TestBinaryCompressed(t *testing.T) {
+	data := []byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	i := NewItem("bin")
+	if err := i.SetBinary("data", data, true); err != nil {
+		t.Fatal(err)
+	}
+	out, ok, err := i.Binary("data")
+	if err != nil || !ok || string(out) != string(data) {
+		t.Errorf("Binary value did not round trip, ok=%v err=%v", ok, err)
+	}
+}
+
+func TestSelectInto(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.Cache = NewSelectCache(time.Minute, 10)
+	q := "select * from users"
+	// the select * is narrowed to the projection of user
+	projected := "select `name` from users"
+	page := func(token, next string, names ...string) {
+		r := SelectResponse{NextToken: next}
+		for _, n := range names {
+			r.Items = append(r.Items, Item{Name: n, Attributes: []Attribute{{Name: "name", Value: "N" + n}}})
+		}
+		c.Cache.put(selectCacheKey(projected, token, false), projected, r)
+	}
+	page("", "t1", "a", "b")
+	page("t1", "", "c")
+
+	type user struct {
+		ID   string `sdb:",itemname"`
+		Name string `sdb:"name"`
+	}
+	var users []*user
+	if err := c.SelectInto(q, &users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 || users[2].ID != "c" || users[2].Name != "Nc" {
+		t.Errorf("%+v", users)
+	}
+	if err := c.SelectInto(q, users); err == nil {
+		t.Error("Expected error for non-pointer destination")
+	}
+}
+
+func TestProjection(t *testing.T) {
+	type user struct {
+		ID    string `sdb:",itemname"`
+		Name  string `sdb:"name"`
+		Tags  []string
+		Since *time.Time `sdb:"since"`
+		Skip  string     `sdb:"-"`
+	}
+	var users []user
+	q := NewQuery("users").OutputFor(&users).Where("name", "=", "x")
+	expected := "select `name`, `Tags`, `since` from `users` where `name` = 'x'"
+	if s := q.String(); s != expected {
+		t.Errorf("Expected %s, got %s", expected, s)
+	}
+	if _, ok := Projection(marshalTest{}); ok {
+		t.Error("Expected no projection for a struct with binary fields")
+	}
+
+	type names struct {
+		ID string `sdb:",itemname"`
+	}
+	if attrs, ok := Projection(names{}); !ok || !reflect.DeepEqual(attrs, []string{"itemName()"}) {
+		t.Errorf("Unexpected projection %v %v", attrs, ok)
+	}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	tests := []struct {
+		v    interface{}
+		q    string
+		want string
+	}{
+		{&users, "select * from `users` where `name` = '*'", "select `name`, `Tags`, `since` from `users` where `name` = '*'"},
+		{&users, "SELECT  * FROM users", "SELECT  `name`, `Tags`, `since` FROM users"},
+		{&users, "select count(*) from users", "select count(*) from users"},
+		{&users, "select `name` from users", "select `name` from users"},
+		{[]names{}, "select * from users", "select itemName() from users"},
+		{[]marshalTest{}, "select * from users", "select * from users"},
+	}
+	for _, tt := range tests {
+		if got := c.projectSelect(tt.q, tt.v); got != tt.want {
+			t.Errorf("projectSelect(%q) = %q, want %q", tt.q, got, tt.want)
+		}
+	}
+	c.Checksum = "sum"
+	if got := c.projectSelect("select * from users", &users); got != "select * from users" {
+		t.Errorf("projectSelect with checksums = %q", got)
+	}
+}
+
+func TestMarshalNested(t *testing.T) {
+	type line struct {
+		SKU string `sdb:"sku"`
+		Qty int    `sdb:"qty"`
+	}
+	type order struct {
+		ID    string            `sdb:",itemname"`
+		Ship  marshalAddress    `sdb:"ship"`
+		Bill  *marshalAddress   `sdb:"bill"`
+		Lines []line            `sdb:"lines"`
+		Meta  map[string]string `sdb:"meta,json"`
+	}
+	in := order{
+		ID:    "o1",
+		Ship:  marshalAddress{Street: "Storgatan 1", City: "Stockholm"},
+		Lines: []line{{SKU: "a", Qty: 1}, {SKU: "b", Qty: 2}},
+		Meta:  map[string]string{"k": "v"},
+	}
+	i, err := MarshalItem(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Name != "o1" || i.Value("ship.City") != "Stockholm" || i.Value("lines.1.sku") != "b" || i.Value("lines.len") != "2" {
+		t.Errorf("Unexpected item %v", i)
+	}
+	if meta, _, _ := i.Chunked("meta"); i.Value("bill.City") != "" || meta != `{"k":"v"}` {
+		t.Errorf("Unexpected item %v", i)
+	}
+
+	var out order
+	if err = UnmarshalItem(*i, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("Expected %v, got %v", in, out)
+	}
+
+	type flat struct {
+		Name string         `sdb:"name"`
+		Ship marshalAddress `sdb:"ship"`
+	}
+	attrs, ok := Projection(flat{})
+	if !ok || !reflect.DeepEqual(attrs, []string{"name", "ship.Street", "ship.City"}) {
+		t.Errorf("Unexpected projection %v %v", attrs, ok)
+	}
+	if _, ok = Projection(order{}); ok {
+		t.Error("Expected no projection for a struct with a slice of structs")
+	}
+
+	// shrinking the slice deletes the elements left in the stored item
+	in.Lines = in.Lines[:1]
+	del, err := MarshalDeletesFrom(&in, *i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, a := range del.Attributes {
+		names = append(names, a.Name)
+	}
+	expected := []string{"bill.Street", "bill.City", "lines.1.sku", "lines.1.qty"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+}
+
+type actionTransport struct {
+	calls []url.Values
+}
+
+func (at *actionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b, _ := io.ReadAll(req.Body)
+	p, _ := url.ParseQuery(string(b))
+	at.calls = append(at.calls, p)
+	return &http.Response{StatusCode: 200, Status: "200 OK", Body: io.NopCloser(bytes.NewBufferString("<Response/>")), Request: req}, nil
+}
+
+func TestMarshalNull(t *testing.T) {
+	type user struct {
+		ID    string           `sdb:",itemname"`
+		Name  string           `sdb:"name"`
+		Note  string           `sdb:"note,omitempty"`
+		Age   int              `sdb:"age,omitempty"`
+		Nick  *string          `sdb:"nick"`
+		Tags  []string         `sdb:"tags"`
+		Data  []byte           `sdb:"data"`
+		Home  *marshalAddress  `sdb:"home"`
+		Lines []marshalAddress `sdb:"lines"`
+	}
+	u := user{ID: "u1", Tags: []string{}}
+	i, err := MarshalItem(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(i.Attributes) != 1 || i.Attributes[0].Name != "name" {
+		t.Errorf("Unexpected item %v", i)
+	}
+	del, err := MarshalDeletes(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, a := range del.Attributes {
+		names = append(names, a.Name)
+	}
+	expected := []string{"note", "age", "nick", "tags", "data.chunks", "home.Street", "home.City", "lines.len"}
+	if del.Name != "u1" || !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+
+	at := &actionTransport{}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: at}
+	u.Age = 3
+	if err = c.PutStruct("users", &u); err != nil {
+		t.Fatal(err)
+	}
+	// the slice of structs makes PutStruct read the elements to delete
+	if len(at.calls) != 3 || at.calls[0].Get("Action") != "GetAttributes" || at.calls[1].Get("Action") != "PutAttributes" || at.calls[2].Get("Action") != "DeleteAttributes" {
+		t.Fatalf("Unexpected calls %v", at.calls)
+	}
+	if at.calls[2].Get("Attribute.1.Name") != "note" || at.calls[2].Get("Attribute.2.Name") != "nick" || at.calls[2].Get("Attribute.1.Value") != "" {
+		t.Errorf("Unexpected delete %v", at.calls[2])
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Mask transforms the value of an attribute as it is read.
+type Mask func(v string) string
+
+// Masks maps attribute names to the Mask applied to their values on reads
+// through the client, so tooling using it never sees the raw values. Like
+// hidden attributes, masked attributes clear RawResponse and can not be
+// selected with SelectDecode or a Select Unmarshaler. Selects filtering or
+// sorting on a masked attribute are refused, since the items matched would
+// reveal its values.
+type Masks map[string]Mask
+
+// MaskRedact replaces every value with REDACTED.
+func MaskRedact(v string) string {
+	return redacted
+}
+
+// MaskTruncate keeps the first n characters of a value.
+func MaskTruncate(n int) Mask {
+	return func(v string) string {
+		if utf8.RuneCountInString(v) <= n {
+			return v
+		}
+		for j := range v {
+			if n == 0 {
+				return v[:j]
+			}
+			n--
+		}
+		return v
+	}
+}
+
+// MaskHash replaces a value with its HMAC-SHA256 under key in hex, so
+// masked values can still be compared and joined but not recovered without
+// the key.
+func MaskHash(key string) Mask {
+	return func(v string) string {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(v))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+}
+
+func (m Masks) attributes(attrs []Attribute) []Attribute {
+	if len(m) == 0 {
+		return attrs
+	}
+	out := make([]Attribute, len(attrs))
+	for j, a := range attrs {
+		if f := m[a.Name]; f != nil {
+			a.Value = f(a.Value)
+		}
+		out[j] = a
+	}
+	return out
+}
+
+// readAttributes decrypts the attributes read of item, verifies its
+// Checksum and applies the Policy and Masks.
+func (sdb *SimpleDB) readAttributes(item string, attrs []Attribute) ([]Attribute, error) {
+	attrs, err := sdb.Encryption.decryptAttributes(sdb.context(), attrs)
+	if err != nil {
+		return nil, err
+	}
+	if err = sdb.verifyChecksum(item, attrs); err != nil {
+		return nil, err
+	}
+	return sdb.Masks.attributes(sdb.Policy.attributes(attrs)), nil
+}
+
+func (sdb *SimpleDB) readItems(items []Item) ([]Item, error) {
+	if sdb.Encryption == nil && sdb.Checksum == "" && !sdb.Policy.hides() && len(sdb.Masks) == 0 {
+		return items, nil
+	}
+	out := make([]Item, len(items))
+	for j, i := range items {
+		attrs, err := sdb.readAttributes(i.Name, i.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		out[j] = Item{Name: i.Name, Attributes: attrs}
+	}
+	return out, nil
+}
+
+// checkSelect applies the Policy to q and refuses expressions filtering or
+// sorting on masked attributes and, when the results will not be filtered,
+// outputs that may return masked values.
+func (sdb *SimpleDB) checkSelect(q string, filtered bool) error {
+	if err := sdb.Policy.checkSelect(q, filtered); err != nil || len(sdb.Masks) == 0 {
+		return err
+	}
+	s, err := ParseSelect(q)
+	if err != nil {
+		return err
+	}
+	attrs := []string{s.OrderBy}
+	for _, c := range comparisons(s.Where, nil) {
+		attrs = append(attrs, c.Attribute)
+	}
+	if !filtered {
+		attrs = append(attrs, s.Output...)
+	}
+	for _, a := range attrs {
+		if a == "*" && !filtered || sdb.Masks[a] != nil {
+			return fmt.Errorf("Select refused: attribute %s is masked", a)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package sdb
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMasks(t *testing.T) {
+	if got := MaskTruncate(2)("Ånna"); got != "Ån" {
+		t.Errorf("MaskTruncate = %q", got)
+	}
+	if a, b := MaskHash("k")("123"), MaskHash("k")("123"); a != b || a == "123" || len(a) != 64 {
+		t.Errorf("MaskHash = %q, %q", a, b)
+	}
+
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: &policyTransport{}}
+	c.Masks = Masks{"ssn": MaskRedact, "name": MaskTruncate(1)}
+
+	r, err := c.GetAttributes("users", "u1")
+	if err != nil || r.Attributes[0].Value != "A" || r.Attributes[1].Value != "REDACTED" || c.RawResponse != "" {
+		t.Fatalf("GetAttributes = %+v, %v", r.Attributes, err)
+	}
+	s, err := c.Select("select * from users")
+	if err != nil || s.Items[0].Attributes[1].Value != "REDACTED" {
+		t.Fatalf("Select = %+v, %v", s.Items, err)
+	}
+	if err := c.SelectDecode("select ssn from users", "", &struct{}{}); err == nil {
+		t.Error("SelectDecode of a masked attribute was not refused")
+	}
+	for _, q := range []string{"select * from users where ssn like '123%'", "select name from users where name is not null order by name"} {
+		if _, err := c.Select(q); err == nil {
+			t.Errorf("%s: filter on a masked attribute was not refused", q)
+		}
+	}
+}
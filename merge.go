@@ -0,0 +1,101 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"sort"
+	"sync"
+)
+
+// MergeSorted merges item lists that are each ordered by attr into one list
+// ordered by attr, keeping at most limit items (all items if limit is 0).
+// Values are compared as strings, so numbers and times must be stored with
+// the sortable encodings. Items without the attribute sort first.
+func MergeSorted(lists [][]Item, attr string, desc bool, limit int) []Item {
+	var merged []Item
+	for _, l := range lists {
+		merged = append(merged, l...)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		a, b := merged[i].sortValue(attr), merged[j].sortValue(attr)
+		if desc {
+			return a > b
+		}
+		return a < b
+	})
+	if limit > 0 && len(merged) > limit {
+		merged = merged[:limit]
+	}
+	return merged
+}
+
+func (i Item) sortValue(attr string) string {
+	if attr == "itemName()" {
+		return i.Name
+	}
+	return i.Value(attr)
+}
+
+// SelectMerged runs q against every domain concurrently and returns the
+// first limit items of the combined results ordered by attr, or all of them
+// if limit is 0. Each domain is queried for at most limit items since no
+// more can make the global page.
+func (sdb *SimpleDB) SelectMerged(domains []string, q *Query, attr string, desc bool, limit int) (items []Item, err error) {
+	lists := make([][]Item, len(domains))
+	errs := make([]error, len(domains))
+	var wg sync.WaitGroup
+	for n, domain := range domains {
+		dq := q.ForDomain(domain).OrderBy(attr, desc)
+		if attr != "itemName()" {
+			dq.WhereExpr(quoteAttribute(attr) + " is not null")
+		}
+		wg.Add(1)
+		go func(n int, dq *Query) {
+			defer wg.Done()
+			db := *sdb
+			if limit > 0 {
+				page, err := db.SelectOffset(dq, 0, limit)
+				lists[n], errs[n] = page.Items, err
+				return
+			}
+			c := db.SelectCursor(dq.String())
+			for c.Next(db.context()) {
+				lists[n] = append(lists[n], c.Item())
+			}
+			errs[n] = c.Err()
+		}(n, dq)
+	}
+	wg.Wait()
+	for _, err = range errs {
+		if err != nil {
+			return
+		}
+	}
+	return MergeSorted(lists, attr, desc, limit), nil
+}
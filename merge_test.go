@@ -0,0 +1,26 @@
+package sdb
+
+import (
+	"testing"
+)
+
+func scoreItem(name string, score int64) Item {
+	i := NewItem(name)
+	i.AddAttribute("score", EncodeInt(score))
+	return *i
+}
+
+func TestMergeSorted(t *testing.T) {
+	a := []Item{scoreItem("a1", 9), scoreItem("a2", 3), scoreItem("a3", -4)}
+	b := []Item{scoreItem("b1", 7), scoreItem("b2", 5)}
+	merged := MergeSorted([][]Item{a, b}, "score", true, 4)
+	expected := []string{"a1", "b1", "b2", "a2"}
+	if len(merged) != len(expected) {
+		t.Fatalf("Expected %d items, got %d", len(expected), len(merged))
+	}
+	for n, i := range merged {
+		if i.Name != expected[n] {
+			t.Errorf("Expected %s at %d, got %s", expected[n], n, i.Name)
+		}
+	}
+}
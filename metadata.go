@@ -0,0 +1,209 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SimpleDB per-domain limits, see the SimpleDB developer guide.
+const (
+	MaxDomainSizeBytes  int64 = 10 * 1024 * 1024 * 1024
+	MaxDomainAttributes int64 = 1000000000
+)
+
+// DomainPollInterval is how often WaitForDomain checks a domain.
+var DomainPollInterval = time.Second
+
+type LimitWarning struct {
+	Domain string
+	Limit  string
+	Used   int64
+	Max    int64
+}
+
+type cachedMetadata struct {
+	r       DomainMetadataResponse
+	fetched time.Time
+}
+
+// DomainMetadataCache caches DomainMetadata responses for TTL and can
+// optionally refresh all known domains in the background.
+type DomainMetadataCache struct {
+	TTL     time.Duration
+	db      SimpleDB
+	mu      sync.Mutex
+	entries map[string]cachedMetadata
+	stop    chan struct{}
+}
+
+func (w LimitWarning) Ratio() float64 {
+	return float64(w.Used) / float64(w.Max)
+}
+
+func (w LimitWarning) String() string {
+	return fmt.Sprintf("domain %s is at %.1f%% of the %s limit (%d of %d)", w.Domain, w.Ratio()*100, w.Limit, w.Used, w.Max)
+}
+
+// SizeBytes returns the storage used by the domain as counted against the 10GB limit.
+func (r DomainMetadataResponse) SizeBytes() int64 {
+	return r.ItemNamesSizeBytes + r.AttributeNamesSizeBytes + r.AttributeValuesSizeBytes
+}
+
+// CheckDomainLimits returns a warning for every domain limit where usage is at
+// or above threshold, given as a fraction (0.8 means 80%).
+func CheckDomainLimits(domain string, r DomainMetadataResponse, threshold float64) (w []LimitWarning) {
+	for _, l := range domainLimits(domain, r) {
+		if l.Ratio() >= threshold {
+			w = append(w, l)
+		}
+	}
+	return
+}
+
+// domainLimits returns the usage of every domain limit.
+func domainLimits(domain string, r DomainMetadataResponse) []LimitWarning {
+	return []LimitWarning{
+		{Domain: domain, Limit: "size", Used: r.SizeBytes(), Max: MaxDomainSizeBytes},
+		{Domain: domain, Limit: "attribute", Used: r.AttributeValueCount, Max: MaxDomainAttributes},
+	}
+}
+
+// WaitForDomain polls DomainMetadata until domain exists, or with exists
+// false until it is gone. CreateDomain and DeleteDomain are eventually
+// consistent, so a new domain may not be usable as soon as they return.
+func (sdb *SimpleDB) WaitForDomain(ctx context.Context, domain string, exists bool) error {
+	db := sdb.WithContext(ctx)
+	for {
+		_, err := db.DomainMetadata(domain)
+		if e, ok := err.(SimpleDBError); ok && e.Code == "NoSuchDomain" {
+			if !exists {
+				return nil
+			}
+		} else if err != nil {
+			return err
+		} else if exists {
+			return nil
+		}
+		if err = db.sleep(DomainPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// NewDomainMetadataCache returns a cache of the DomainMetadata of db's
+// domains, kept for ttl.
+func NewDomainMetadataCache(db SimpleDB, ttl time.Duration) *DomainMetadataCache {
+	return &DomainMetadataCache{TTL: ttl, db: db, entries: make(map[string]cachedMetadata)}
+}
+
+func (c *DomainMetadataCache) DomainMetadata(name string) (r DomainMetadataResponse, err error) {
+	c.mu.Lock()
+	e, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && time.Since(e.fetched) < c.TTL {
+		return e.r, nil
+	}
+	return c.Refresh(name)
+}
+
+// Refresh fetches DomainMetadata for name regardless of the cached age.
+// The lock is only held to store the result, so cached reads do not wait
+// for the request.
+func (c *DomainMetadataCache) Refresh(name string) (r DomainMetadataResponse, err error) {
+	db := c.db
+	r, err = db.DomainMetadata(name)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	c.entries[name] = cachedMetadata{r: r, fetched: time.Now()}
+	c.mu.Unlock()
+	return
+}
+
+func (c *DomainMetadataCache) Invalidate(name string) {
+	c.mu.Lock()
+	delete(c.entries, name)
+	c.mu.Unlock()
+}
+
+// StartRefresh refreshes every cached domain each interval until Stop is
+// called. Refresh errors leave the previous entry in place. An interval
+// that is not positive is refused.
+func (c *DomainMetadataCache) StartRefresh(interval time.Duration) error {
+	if err := checkInterval(interval); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if c.stop != nil {
+		c.mu.Unlock()
+		return nil
+	}
+	stop := make(chan struct{})
+	c.stop = stop
+	c.mu.Unlock()
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				for _, name := range c.domains() {
+					c.Refresh(name)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *DomainMetadataCache) Stop() {
+	c.mu.Lock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+	c.mu.Unlock()
+}
+
+func (c *DomainMetadataCache) domains() (names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name := range c.entries {
+		names = append(names, name)
+	}
+	return
+}
@@ -0,0 +1,68 @@
+package sdb
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCheckDomainLimits(t *testing.T) {
+	var r DomainMetadataResponse
+	r.AttributeValuesSizeBytes = MaxDomainSizeBytes / 10 * 9
+	r.AttributeValueCount = MaxDomainAttributes / 2
+
+	w := CheckDomainLimits(TestDomain, r, 0.8)
+	if len(w) != 1 {
+		t.Fatalf("Expected one warning, got %v", w)
+	}
+	if w[0].Limit != "size" {
+		t.Error(w[0])
+	}
+
+	if w = CheckDomainLimits(TestDomain, r, 0.95); len(w) != 0 {
+		t.Errorf("Expected no warnings, got %v", w)
+	}
+}
+
+type blockingTransport struct {
+	started, release chan struct{}
+}
+
+func (bt *blockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	bt.started <- struct{}{}
+	<-bt.release
+	body := "<DomainMetadataResponse><DomainMetadataResult><ItemCount>2</ItemCount></DomainMetadataResult></DomainMetadataResponse>"
+	return &http.Response{StatusCode: 200, Status: "200 OK", Body: io.NopCloser(bytes.NewBufferString(body)), Request: req}, nil
+}
+
+func TestDomainMetadataCacheRefresh(t *testing.T) {
+	bt := &blockingTransport{started: make(chan struct{}), release: make(chan struct{})}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: bt}
+	mc := NewDomainMetadataCache(c, time.Hour)
+
+	go mc.Refresh("d")
+	<-bt.started
+	bt.release <- struct{}{}
+	for mc.domains() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A Refresh in flight does not block reads of the cached entry.
+	done := make(chan error)
+	go func() { _, err := mc.Refresh("d"); done <- err }()
+	<-bt.started
+	if r, err := mc.DomainMetadata("d"); err != nil || r.ItemCount != 2 {
+		t.Errorf("DomainMetadata = %+v, %v", r, err)
+	}
+	bt.release <- struct{}{}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	if err := mc.StartRefresh(0); err == nil {
+		t.Error("expected StartRefresh to refuse a zero interval")
+	}
+}
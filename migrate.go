@@ -0,0 +1,226 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultVersionAttribute holds the schema version of migrated items.
+const DefaultVersionAttribute = "sdb.schema"
+
+// Migration upgrades an item from schema version Version-1 to Version.
+type Migration struct {
+	Version int
+	Name    string
+	Apply   func(i *Item) error
+}
+
+// Migrator applies migrations to the items of a domain, lazily when items
+// are read with Get or eagerly with Backfill. Items without a version
+// attribute are at version 0.
+type Migrator struct {
+	Domain           string
+	VersionAttribute string
+	// WriteBack makes Get store items it migrated.
+	WriteBack  bool
+	migrations []Migration
+	db         SimpleDB
+}
+
+// NewMigrator returns a migrator for domain. Migration versions must be
+// 1, 2, 3 and so on without gaps, in any order.
+func NewMigrator(db SimpleDB, domain string, migrations ...Migration) (*Migrator, error) {
+	ms := append([]Migration(nil), migrations...)
+	sort.Slice(ms, func(a, b int) bool { return ms[a].Version < ms[b].Version })
+	for j, m := range ms {
+		if m.Version != j+1 {
+			return nil, fmt.Errorf("migrations: expected version %d, found %d", j+1, m.Version)
+		}
+	}
+	db.ConsistentRead = true
+	return &Migrator{Domain: domain, VersionAttribute: DefaultVersionAttribute, migrations: ms, db: db}, nil
+}
+
+// Latest returns the schema version items are migrated to.
+func (m *Migrator) Latest() int {
+	return len(m.migrations)
+}
+
+// Version returns the schema version of i.
+func (m *Migrator) Version(i Item) (int, error) {
+	s := i.Value(m.VersionAttribute)
+	if s == "" {
+		return 0, nil
+	}
+	v, err := DecodeInt(s)
+	return int(v), err
+}
+
+// Migrate applies the pending migrations to i in memory, reporting whether
+// any were applied.
+func (m *Migrator) Migrate(i *Item) (changed bool, err error) {
+	v, err := m.Version(*i)
+	if err != nil {
+		return
+	}
+	if v > m.Latest() {
+		return false, fmt.Errorf("migrations: item %s has unknown version %d", i.Name, v)
+	}
+	for _, mg := range m.migrations[v:] {
+		if err = mg.Apply(i); err != nil {
+			return false, fmt.Errorf("migration %d %s of item %s: %v", mg.Version, mg.Name, i.Name, err)
+		}
+		changed = true
+	}
+	if changed {
+		// drop the old version so it is replaced, not added to
+		attrs := i.Attributes[:0:0]
+		for _, a := range i.Attributes {
+			if a.Name != m.VersionAttribute {
+				attrs = append(attrs, a)
+			}
+		}
+		i.Attributes = attrs
+		i.ReplaceAttribute(m.VersionAttribute, EncodeInt(int64(m.Latest())))
+	}
+	return
+}
+
+// store writes the migrated item if the stored version is still the one it
+// was migrated from.
+func (m *Migrator) store(current Item, migrated Item) error {
+	c := Condition{Name: m.VersionAttribute, Value: current.Value(m.VersionAttribute), Exists: true}
+	if c.Value == "" {
+		c = Condition{Name: m.VersionAttribute}
+	}
+	db := m.db
+	return db.writeDiff(m.Domain, current, migrated, &c)
+}
+
+// Get reads an item and migrates it, storing the result if WriteBack is set.
+func (m *Migrator) Get(itemName string) (i Item, found bool, err error) {
+	db := m.db
+	r, err := db.GetAttributes(m.Domain, itemName)
+	if err != nil || len(r.Attributes) == 0 {
+		return
+	}
+	current := Item{Name: itemName, Attributes: r.Attributes}
+	i = Item{Name: itemName, Attributes: append([]Attribute(nil), r.Attributes...)}
+	changed, err := m.Migrate(&i)
+	if err != nil || !changed || !m.WriteBack {
+		return i, true, err
+	}
+	if err = m.store(current, i); IsConditionalCheckFailed(err) {
+		err = nil
+	}
+	return i, true, err
+}
+
+// Backfill migrates and stores every item below the latest version. Items
+// changed concurrently are skipped, they are migrated by the next run or
+// read. It returns the number of items migrated.
+func (m *Migrator) Backfill(ctx context.Context) (n int, err error) {
+	if m.Latest() == 0 {
+		return
+	}
+	a := quoteAttribute(m.VersionAttribute)
+	q := NewQuery(m.Domain).WhereExpr("(" + a + " < " + Quote(EncodeInt(int64(m.Latest()))) + " or " + a + " is null)")
+	db := m.db
+	c := db.SelectCursor(q.String())
+	for c.Next(ctx) {
+		current := c.Item()
+		i := Item{Name: current.Name, Attributes: append([]Attribute(nil), current.Attributes...)}
+		if _, err = m.Migrate(&i); err != nil {
+			return
+		}
+		if err = m.store(current, i); err != nil {
+			if !IsConditionalCheckFailed(err) {
+				return
+			}
+			err = nil
+			continue
+		}
+		n++
+	}
+	return n, c.Err()
+}
+
+// RenameAttribute returns a migration function moving the values of from to
+// to.
+func RenameAttribute(from string, to string) func(*Item) error {
+	return func(i *Item) error {
+		for j := range i.Attributes {
+			if i.Attributes[j].Name == from {
+				i.Attributes[j].Name = to
+			}
+		}
+		return nil
+	}
+}
+
+// ReencodeValues returns a migration function converting every value of
+// attr with f, for example from decimal strings to EncodeInt.
+func ReencodeValues(attr string, f func(string) (string, error)) func(*Item) error {
+	return func(i *Item) (err error) {
+		for j := range i.Attributes {
+			if i.Attributes[j].Name == attr {
+				if i.Attributes[j].Value, err = f(i.Attributes[j].Value); err != nil {
+					return
+				}
+			}
+		}
+		return
+	}
+}
+
+// SplitValues returns a migration function splitting each value of attr on
+// sep into separate values, turning a delimited list into a multi-valued
+// attribute.
+func SplitValues(attr string, sep string) func(*Item) error {
+	return func(i *Item) error {
+		var attrs []Attribute
+		for _, a := range i.Attributes {
+			if a.Name != attr {
+				attrs = append(attrs, a)
+				continue
+			}
+			for _, v := range strings.Split(a.Value, sep) {
+				if v != "" {
+					attrs = append(attrs, Attribute{Name: attr, Value: v})
+				}
+			}
+		}
+		i.Attributes = attrs
+		return nil
+	}
+}
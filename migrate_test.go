@@ -0,0 +1,75 @@
+package sdb
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	m, err := NewMigrator(NewSimpleDB("a", "s", SDBRegionEUWest1), "users",
+		Migration{Version: 2, Name: "encode age", Apply: ReencodeValues("age", func(s string) (string, error) {
+			n, err := strconv.Atoi(s)
+			return EncodeInt(int64(n)), err
+		})},
+		Migration{Version: 1, Name: "rename", Apply: RenameAttribute("years", "age")},
+		Migration{Version: 3, Name: "split tags", Apply: SplitValues("tags", ",")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := NewItem("u1")
+	i.AddAttribute("years", "42")
+	i.AddAttribute("tags", "a,b")
+	changed, err := m.Migrate(i)
+	if err != nil || !changed {
+		t.Fatal(changed, err)
+	}
+	if i.Value("age") != EncodeInt(42) || len(i.Attributes) != 4 {
+		t.Errorf("%+v", i.Attributes)
+	}
+	if v, _ := m.Version(*i); v != 3 {
+		t.Errorf("Version = %d", v)
+	}
+	if changed, _ = m.Migrate(i); changed {
+		t.Error("Migrating a current item should not change it")
+	}
+
+	i = NewItem("u2")
+	i.AddAttribute("age", "x")
+	i.ReplaceAttribute(DefaultVersionAttribute, EncodeInt(1))
+	if _, err = m.Migrate(i); err == nil {
+		t.Error("Expected migration error for a bad age")
+	}
+
+	if _, err = NewMigrator(NewSimpleDB("a", "s", SDBRegionEUWest1), "users", Migration{Version: 2}); err == nil {
+		t.Error("Expected error for a missing migration version")
+	}
+}
+
+func TestMigrateWriteBack(t *testing.T) {
+	it := &itemTransport{attrs: []Attribute{{Name: "years", Value: "42"}, {Name: DefaultVersionAttribute, Value: EncodeInt(1)}}}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: it}
+	m, err := NewMigrator(c, "users",
+		Migration{Version: 1, Name: "rename", Apply: RenameAttribute("years", "age")},
+		Migration{Version: 2, Name: "rename back", Apply: RenameAttribute("age", "years")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.WriteBack = true
+	if _, _, err = m.Get("u1"); err != nil {
+		t.Fatal(err)
+	}
+	var versions []string
+	for _, a := range it.attrs {
+		if a.Name == DefaultVersionAttribute {
+			versions = append(versions, a.Value)
+		}
+	}
+	if len(versions) != 1 || versions[0] != EncodeInt(2) {
+		t.Errorf("stored versions %v", versions)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"errors"
+	"strconv"
+)
+
+var ErrConflict = errors.New("item was modified concurrently")
+
+// ConflictStrategy decides what to write after a conditional write failed
+// because another writer changed the item. attempted is the item that failed
+// to be written, current the item as stored now and update the function
+// passed to Update. The returned item is written conditionally on the version
+// of current.
+type ConflictStrategy interface {
+	Resolve(attempted Item, current Item, update func(Item) (Item, error)) (Item, error)
+}
+
+type retryWithReload struct{}
+
+type lastWriterWins struct{}
+
+// MergeFunc resolves a conflict by merging the attempted and the stored item.
+type MergeFunc func(attempted Item, current Item) (Item, error)
+
+var (
+	// RetryWithReload runs the update function again on the stored item.
+	RetryWithReload ConflictStrategy = retryWithReload{}
+	// LastWriterWins writes the attempted item over the stored one.
+	LastWriterWins ConflictStrategy = lastWriterWins{}
+)
+
+func (retryWithReload) Resolve(attempted Item, current Item, update func(Item) (Item, error)) (Item, error) {
+	return update(current)
+}
+
+func (lastWriterWins) Resolve(attempted Item, current Item, update func(Item) (Item, error)) (Item, error) {
+	return attempted, nil
+}
+
+func (f MergeFunc) Resolve(attempted Item, current Item, update func(Item) (Item, error)) (Item, error) {
+	return f(attempted, current)
+}
+
+// OptimisticLock updates items guarded by a version attribute. A write only
+// succeeds if the version is unchanged since the item was read, conflicts are
+// handed to Strategy. With a nil Strategy conflicts return ErrConflict.
+type OptimisticLock struct {
+	Domain           string
+	VersionAttribute string
+	MaxAttempts      int
+	Strategy         ConflictStrategy
+	db               SimpleDB
+}
+
+func NewOptimisticLock(db SimpleDB, domain string, strategy ConflictStrategy) *OptimisticLock {
+	db.ConsistentRead = true
+	return &OptimisticLock{Domain: domain, VersionAttribute: "version", MaxAttempts: 5, Strategy: strategy, db: db}
+}
+
+// Update reads the item, passes it to update and writes the result with the
+// version incremented. A missing item is passed as an item without
+// attributes and created.
+func (o *OptimisticLock) Update(itemName string, update func(Item) (Item, error)) (written Item, err error) {
+	current, err := o.read(itemName)
+	if err != nil {
+		return
+	}
+	desired, err := update(current)
+	if err != nil {
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		written, err = o.write(current, desired)
+		if !IsConditionalCheckFailed(err) {
+			return
+		}
+		if o.Strategy == nil || attempt >= o.MaxAttempts {
+			return written, ErrConflict
+		}
+		if current, err = o.read(itemName); err != nil {
+			return
+		}
+		if desired, err = o.Strategy.Resolve(desired, current, update); err != nil {
+			return
+		}
+	}
+}
+
+func (o *OptimisticLock) read(itemName string) (i Item, err error) {
+	db := o.db
+	r, err := db.GetAttributes(o.Domain, itemName)
+	return Item{Name: itemName, Attributes: r.Attributes}, err
+}
+
+func (o *OptimisticLock) write(current Item, desired Item) (written Item, err error) {
+	c := Condition{Name: o.VersionAttribute}
+	next := 1
+	if v := current.Value(o.VersionAttribute); v != "" {
+		c = Condition{Name: o.VersionAttribute, Value: v, Exists: true}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return written, err
+		}
+		next = n + 1
+	}
+
+	written = Item{Name: current.Name}
+	for _, a := range desired.Attributes {
+		if a.Name != o.VersionAttribute {
+			written.Attributes = append(written.Attributes, a)
+		}
+	}
+	written.AddAttribute(o.VersionAttribute, strconv.Itoa(next))
+
+	db := o.db
+	err = db.writeDiff(o.Domain, current, written, &c)
+	return
+}
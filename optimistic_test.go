@@ -0,0 +1,76 @@
+package sdb_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestOptimisticLock(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	if _, err := db.CreateDomain("counters"); err != nil {
+		t.Fatal(err)
+	}
+	increment := func(i sdb.Item) (sdb.Item, error) {
+		n, _ := strconv.Atoi(i.Value("n"))
+		i.Attributes = nil
+		i.AddAttribute("n", strconv.Itoa(n+1))
+		return i, nil
+	}
+	// concurrent returns an update that lets other increment the item before
+	// the first write of the returned update is made.
+	concurrent := func(other *sdb.OptimisticLock) func(sdb.Item) (sdb.Item, error) {
+		calls := 0
+		return func(i sdb.Item) (sdb.Item, error) {
+			if calls++; calls == 1 {
+				if _, err := other.Update(i.Name, increment); err != nil {
+					t.Fatal(err)
+				}
+			}
+			return increment(i)
+		}
+	}
+
+	l := sdb.NewOptimisticLock(db, "counters", nil)
+	for want := 1; want <= 2; want++ {
+		i, err := l.Update("c", increment)
+		if err != nil || i.Value("n") != strconv.Itoa(want) || i.Value("version") != strconv.Itoa(want) {
+			t.Fatalf("Update = %+v, %v", i, err)
+		}
+	}
+
+	if _, err := l.Update("c", concurrent(l)); err != sdb.ErrConflict {
+		t.Fatalf("Update without a strategy returned %v", err)
+	}
+
+	cases := []struct {
+		strategy sdb.ConflictStrategy
+		n        string
+	}{
+		// n is 2 after the conflicting write.
+		{sdb.RetryWithReload, "3"},
+		{sdb.LastWriterWins, "2"},
+		{sdb.MergeFunc(func(attempted sdb.Item, current sdb.Item) (sdb.Item, error) {
+			current.Attributes = nil
+			current.AddAttribute("n", "merged")
+			return current, nil
+		}), "merged"},
+	}
+	for _, c := range cases {
+		db := f.Client()
+		if _, err := db.DeleteItem("counters", "c"); err != nil {
+			t.Fatal(err)
+		}
+		l := sdb.NewOptimisticLock(db, "counters", c.strategy)
+		if _, err := l.Update("c", increment); err != nil {
+			t.Fatal(err)
+		}
+		i, err := l.Update("c", concurrent(l))
+		if err != nil || i.Value("n") != c.n || i.Value("version") != "3" {
+			t.Fatalf("Update with %T = %+v, %v", c.strategy, i, err)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// OutboxEvent is an event recorded by Outbox.Put for a write of Item in
+// Domain.
+type OutboxEvent struct {
+	ID      string
+	Type    string
+	Payload string
+	Domain  string
+	Item    string
+	Created time.Time
+}
+
+// Outbox records events in a domain of its own together with the writes
+// they describe, for delivery to a message bus by Poll. SimpleDB has no
+// transactions, so Put writes the event as pending, then the data item
+// with the event ID added to the values of Attribute, then makes the event
+// ready and removes the ID again. A pending event left by a crash is made
+// ready by Poll once PendingTimeout has passed if the item carries its ID,
+// and dropped otherwise. Events are delivered at least once.
+type Outbox struct {
+	Domain         string
+	Attribute      string
+	PendingTimeout time.Duration
+	// BatchSize is the number of events Poll reads per Select.
+	BatchSize int
+	db        SimpleDB
+}
+
+// NewOutbox returns an Outbox recording its events in domain.
+func NewOutbox(db SimpleDB, domain string) *Outbox {
+	db.ConsistentRead = true
+	return &Outbox{Domain: domain, Attribute: "outbox_event", PendingTimeout: time.Minute, BatchSize: 25, db: db}
+}
+
+// Put puts i to domain, only if c holds when c is not nil, and records an
+// event of type typ with payload for it. No event is delivered if the put
+// is refused. If its outcome is unknown, as after a lost response, the
+// event is left pending for Poll to resolve. Once i is written Put
+// succeeds, an event that could not be made ready is recovered by Poll.
+func (o *Outbox) Put(ctx context.Context, domain string, i *Item, c *Condition, typ string, payload string) (id string, err error) {
+	db := o.db.WithContext(ctx)
+	if id, err = TimePrefixed(); err != nil {
+		return
+	}
+	e := NewItem(id)
+	e.AddAttribute("state", "pending")
+	e.AddAttribute("created", sortableMillis(time.Now()))
+	e.AddAttribute("type", typ)
+	e.AddAttribute("domain", domain)
+	e.AddAttribute("item", i.Name)
+	if err = e.SetChunked("payload", payload); err != nil {
+		return
+	}
+	if _, err = db.PutAttributesIf(o.Domain, e, Condition{Name: "state"}); err != nil {
+		return
+	}
+
+	// the ID is added rather than replaced, so a later Put does not hide
+	// that this one was written
+	marked := *i
+	marked.Attributes = append(append([]Attribute(nil), i.Attributes...), Attribute{Name: o.Attribute, Value: id})
+	if c != nil {
+		_, err = db.PutAttributesIf(domain, &marked, *c)
+	} else {
+		_, err = db.PutAttributes(domain, &marked)
+	}
+	if err != nil {
+		if refused(err) {
+			db.DeleteItemIf(o.Domain, id, Condition{Name: "state", Value: "pending", Exists: true})
+		}
+		return "", err
+	}
+	if o.setState(db, id, "pending", "ready") == nil {
+		o.unmark(db, domain, i.Name, id)
+	}
+	return id, nil
+}
+
+// refused reports whether the write that failed with err was certainly not
+// applied: it was refused before being sent or by SimpleDB. Network errors
+// and server errors leave the outcome open.
+func refused(err error) bool {
+	var re *RequestError
+	if errors.As(err, &re) {
+		return false
+	}
+	var se SimpleDBError
+	if errors.As(err, &se) {
+		return se.StatusCode < 500
+	}
+	return true
+}
+
+// unmark removes the ID of a ready event from the data item. A marker left
+// behind is harmless, recover only looks at pending events.
+func (o *Outbox) unmark(db SimpleDB, domain string, name string, id string) {
+	db.DeleteAttributes(domain, &Item{Name: name, Attributes: []Attribute{{Name: o.Attribute, Value: id}}})
+}
+
+// Poll recovers pending events older than PendingTimeout, then passes the
+// ready events to handler in the order they were recorded and marks them
+// dispatched. It stops at the first handler error, which is returned, so
+// the event is retried by the next Poll.
+func (o *Outbox) Poll(ctx context.Context, handler func(context.Context, OutboxEvent) error) (n int, err error) {
+	db := o.db.WithContext(ctx)
+	if err = o.recover(db); err != nil {
+		return
+	}
+	q := NewQuery(o.Domain).Where("state", "=", "ready").WhereExpr("`created` is not null").OrderBy("created", false).Limit(o.BatchSize)
+	for {
+		var r SelectResponse
+		if r, err = db.Select(q.String()); err != nil || len(r.Items) == 0 {
+			return
+		}
+		for _, i := range r.Items {
+			var e OutboxEvent
+			if e, err = outboxEvent(i); err != nil {
+				return
+			}
+			if err = handler(ctx, e); err != nil {
+				return
+			}
+			if err = o.setState(db, i.Name, "ready", "dispatched"); err != nil && !IsConditionalCheckFailed(err) {
+				return
+			}
+			err = nil
+			n++
+		}
+	}
+}
+
+// Run calls Poll every interval until ctx is done.
+func (o *Outbox) Run(ctx context.Context, interval time.Duration, handler func(context.Context, OutboxEvent) error) error {
+	if err := checkInterval(interval); err != nil {
+		return err
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if _, err := o.Poll(ctx, handler); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Purge deletes the events dispatched before t.
+func (o *Outbox) Purge(ctx context.Context, t time.Time) error {
+	db := o.db.WithContext(ctx)
+	q := NewQuery(o.Domain).Output("itemName()").Where("state", "=", "dispatched").Where("created", "<", sortableMillis(t))
+	var items []*Item
+	err := db.SelectStream(ctx, q.String(), func(i Item) error {
+		items = append(items, &Item{Name: i.Name})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return runBatches(ctx, "Purge", batches(items), func(ctx context.Context, k int, batch []*Item) (err error) {
+		db := o.db.WithContext(ctx)
+		_, err = db.BatchDeleteAttributes(o.Domain, batch)
+		return
+	})
+}
+
+// recover resolves the pending events older than PendingTimeout.
+func (o *Outbox) recover(db SimpleDB) error {
+	q := NewQuery(o.Domain).Where("state", "=", "pending").Where("created", "<", sortableMillis(time.Now().Add(-o.PendingTimeout)))
+	var pending []Item
+	err := db.SelectStream(db.context(), q.String(), func(i Item) error {
+		pending = append(pending, i)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, i := range pending {
+		d, err := db.GetAttributes(i.Value("domain"), i.Value("item"))
+		if err != nil {
+			return err
+		}
+		if hasValue(d.Attributes, o.Attribute, i.Name) {
+			if err = o.setState(db, i.Name, "pending", "ready"); err == nil {
+				o.unmark(db, i.Value("domain"), i.Value("item"), i.Name)
+			}
+		} else {
+			_, err = db.DeleteItemIf(o.Domain, i.Name, Condition{Name: "state", Value: "pending", Exists: true})
+		}
+		if err != nil && !IsConditionalCheckFailed(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasValue(attrs []Attribute, name string, value string) bool {
+	for _, a := range attrs {
+		if a.Name == name && a.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *Outbox) setState(db SimpleDB, id string, from string, to string) error {
+	i := NewItem(id)
+	i.ReplaceAttribute("state", to)
+	_, err := db.PutAttributesIf(o.Domain, i, Condition{Name: "state", Value: from, Exists: true})
+	return err
+}
+
+func outboxEvent(i Item) (e OutboxEvent, err error) {
+	e = OutboxEvent{ID: i.Name, Type: i.Value("type"), Domain: i.Value("domain"), Item: i.Value("item")}
+	if e.Payload, _, err = i.Chunked("payload"); err != nil {
+		return
+	}
+	ms, err := strconv.ParseInt(i.Value("created"), 10, 64)
+	if err != nil {
+		return
+	}
+	e.Created = time.UnixMilli(ms)
+	return
+}
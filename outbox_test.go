@@ -0,0 +1,139 @@
+package sdb_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+// lostResponseTransport forwards the first request that matches, then
+// fails it as if the response was lost.
+type lostResponseTransport struct {
+	http.RoundTripper
+	match func(p url.Values) bool
+	lost  bool
+}
+
+func (l *lostResponseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b, _ := io.ReadAll(req.Body)
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	p, _ := url.ParseQuery(string(b))
+	r, err := l.RoundTripper.RoundTrip(req)
+	if err == nil && !l.lost && l.match(p) {
+		l.lost = true
+		r.Body.Close()
+		return nil, errors.New("connection reset")
+	}
+	return r, err
+}
+
+func TestOutbox(t *testing.T) {
+	ctx := context.Background()
+	f := sdbtest.NewFake()
+	db := f.Client()
+	for _, d := range []string{"orders", "outbox"} {
+		if _, err := db.CreateDomain(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	o := sdb.NewOutbox(db, "outbox")
+	order := func(name string) *sdb.Item {
+		i := sdb.NewItem(name)
+		i.ReplaceAttribute("total", "10")
+		return i
+	}
+	if _, err := o.Put(ctx, "orders", order("o1"), nil, "created", `{"id":"o1"}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Put(ctx, "orders", order("o2"), nil, "created", `{"id":"o2"}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Put(ctx, "orders", order("o1"), &sdb.Condition{Name: "total"}, "created", ""); !sdb.IsConditionalCheckFailed(err) {
+		t.Fatalf("expected a failed condition, got %v", err)
+	}
+	if r, _ := db.GetAttributes("orders", "o1"); (sdb.Item{Attributes: r.Attributes}).Value(o.Attribute) != "" {
+		t.Errorf("expected the marker of a ready event to be removed, got %v", r.Attributes)
+	}
+
+	var got []sdb.OutboxEvent
+	fail := errors.New("bus down")
+	n, err := o.Poll(ctx, func(_ context.Context, e sdb.OutboxEvent) error {
+		if len(got) == 1 {
+			return fail
+		}
+		got = append(got, e)
+		return nil
+	})
+	if err != fail || n != 1 || got[0].Item != "o1" || got[0].Payload != `{"id":"o1"}` || got[0].Type != "created" {
+		t.Fatalf("Poll = %d, %v, %+v", n, err, got)
+	}
+	n, err = o.Poll(ctx, func(_ context.Context, e sdb.OutboxEvent) error {
+		got = append(got, e)
+		return nil
+	})
+	if err != nil || n != 1 || got[1].Item != "o2" {
+		t.Fatalf("Poll = %d, %v, %+v", n, err, got)
+	}
+
+	// Events left pending by a crash are made ready if the write happened.
+	for _, e := range []struct{ id, item string }{{"e1", "o1"}, {"e2", "o3"}} {
+		i := sdb.NewItem(e.id)
+		i.AddAttribute("state", "pending")
+		i.AddAttribute("created", "000000000000001")
+		i.AddAttribute("domain", "orders")
+		i.AddAttribute("item", e.item)
+		if _, err := db.PutAttributes("outbox", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// e9 was written after e1 and carries its own marker
+	i := order("o1")
+	i.AddAttribute(o.Attribute, "e1")
+	i.AddAttribute(o.Attribute, "e9")
+	if _, err := db.PutAttributes("orders", i); err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	if n, err = o.Poll(ctx, func(_ context.Context, e sdb.OutboxEvent) error {
+		got = append(got, e)
+		return nil
+	}); err != nil || n != 1 || got[0].ID != "e1" {
+		t.Fatalf("Poll = %d, %v, %+v", n, err, got)
+	}
+	if r, _ := db.GetAttributes("outbox", "e2"); len(r.Attributes) != 0 {
+		t.Errorf("expected the event without a write to be dropped, got %v", r.Attributes)
+	}
+	if r, _ := db.GetAttributes("orders", "o1"); (sdb.Item{Attributes: r.Attributes}).Value(o.Attribute) != "e9" {
+		t.Errorf("expected only the marker of e9 to be left, got %v", r.Attributes)
+	}
+
+	// a Put whose response is lost leaves its event pending for Poll
+	lossy := db
+	lossy.HTTPClient = &http.Client{Transport: &lostResponseTransport{RoundTripper: f, match: func(p url.Values) bool {
+		return p.Get("Action") == "PutAttributes" && p.Get("DomainName") == "orders"
+	}}}
+	lo := sdb.NewOutbox(lossy, "outbox")
+	lo.PendingTimeout = -time.Minute
+	if _, err = lo.Put(ctx, "orders", order("o4"), &sdb.Condition{Name: "total"}, "created", ""); !errors.Is(err, sdb.ErrOutcomeUnknown) {
+		t.Fatalf("expected an unknown outcome, got %v", err)
+	}
+	got = nil
+	if n, err = lo.Poll(ctx, func(_ context.Context, e sdb.OutboxEvent) error {
+		got = append(got, e)
+		return nil
+	}); err != nil || n != 1 || got[0].Item != "o4" {
+		t.Fatalf("Poll = %d, %v, %+v", n, err, got)
+	}
+
+	if err = o.Run(ctx, 0, nil); err == nil {
+		t.Error("expected Run to refuse a zero interval")
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import "context"
+
+// Page is one page of a paginated operation. HasMore reports whether another
+// page can be fetched with NextToken.
+type Page[T any] struct {
+	Items     []T
+	NextToken string
+	HasMore   bool
+	BoxUsage  float64
+}
+
+// PageFunc fetches the page starting at token, an empty token is the first page.
+type PageFunc[T any] func(ctx context.Context, token string) (Page[T], error)
+
+// Pager walks the pages of a paginated operation:
+//
+//	p := db.SelectPager(q)
+//	for !p.Done() {
+//		page, err := p.Next(ctx)
+//		...
+//	}
+type Pager[T any] struct {
+	fetch   PageFunc[T]
+	token   string
+	done    bool
+	partial bool
+}
+
+func NewPager[T any](fetch PageFunc[T]) *Pager[T] {
+	return &Pager[T]{fetch: fetch}
+}
+
+// Done reports whether the last page has been returned.
+func (p *Pager[T]) Done() bool {
+	return p.done
+}
+
+// Next fetches the next page. After an error Next can be called again to
+// retry the same page.
+func (p *Pager[T]) Next(ctx context.Context) (page Page[T], err error) {
+	if p.done {
+		return
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	page, err = p.fetch(ctx, p.token)
+	if err != nil {
+		return
+	}
+	page.HasMore = page.NextToken != ""
+	p.token = page.NextToken
+	p.done = !page.HasMore
+	return
+}
+
+// Partial makes All return the items read before an error, with a
+// *PartialError, instead of none.
+func (p *Pager[T]) Partial(partial bool) *Pager[T] {
+	p.partial = partial
+	return p
+}
+
+// All fetches the remaining pages and returns their items.
+func (p *Pager[T]) All(ctx context.Context) (items []T, err error) {
+	pages := 0
+	for !p.Done() {
+		var page Page[T]
+		if page, err = p.Next(ctx); err != nil {
+			if !p.partial {
+				return nil, err
+			}
+			return items, &PartialError{Op: "Select", Pages: pages, Items: len(items), NextToken: p.token, Err: err}
+		}
+		pages++
+		items = append(items, page.Items...)
+	}
+	return
+}
+
+// SelectPage runs one page of a Select.
+func (sdb *SimpleDB) SelectPage(ctx context.Context, q string, token string) (page Page[Item], err error) {
+	db := sdb.WithContext(ctx)
+	r, err := db.SelectWithToken(q, token)
+	if err != nil {
+		return
+	}
+	return Page[Item]{Items: r.Items, NextToken: r.NextToken, HasMore: r.NextToken != "", BoxUsage: r.ResponseMetadata.BoxUsage}, nil
+}
+
+func (sdb *SimpleDB) SelectPager(q string) *Pager[Item] {
+	db := *sdb
+	return NewPager(func(ctx context.Context, token string) (Page[Item], error) {
+		return db.SelectPage(ctx, q, token)
+	}).Partial(sdb.PartialResults)
+}
+
+func (sdb *SimpleDB) ListDomainsPager() *Pager[string] {
+	db := *sdb
+	return NewPager(func(ctx context.Context, token string) (page Page[string], err error) {
+		c := db.WithContext(ctx)
+		r, err := c.ListDomainsWithToken(token)
+		if err != nil {
+			return
+		}
+		return Page[string]{Items: r.DomainNames, NextToken: r.NextToken, BoxUsage: r.ResponseMetadata.BoxUsage}, nil
+	})
+}
@@ -0,0 +1,53 @@
+package sdb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPartialResults(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: &pagesTransport{pages: []string{streamPage1, "<"}}}
+	items, err := c.SelectPager("select * from d").All(context.Background())
+	if err == nil || items != nil {
+		t.Errorf("Expected no items without PartialResults, got %v %v", items, err)
+	}
+
+	c.PartialResults = true
+	c.HTTPClient = &http.Client{Transport: &pagesTransport{pages: []string{streamPage1, "<"}}}
+	items, err = c.SelectPager("select * from d").All(context.Background())
+	var pe *PartialError
+	if !errors.As(err, &pe) || len(items) != 2 || pe.Pages != 1 || pe.Items != 2 || pe.NextToken != "t1" {
+		t.Errorf("Unexpected partial result %v %v", items, err)
+	}
+
+	type row struct {
+		ID string `sdb:",itemname"`
+	}
+	rows := []row{{"x"}}
+	c.HTTPClient = &http.Client{Transport: &pagesTransport{pages: []string{streamPage1, "<"}}}
+	if err = c.SelectInto("select * from d", &rows); !errors.As(err, &pe) || len(rows) != 3 || rows[2].ID != "i2" {
+		t.Errorf("Unexpected partial result %v %v", rows, err)
+	}
+	c.PartialResults = false
+	c.HTTPClient = &http.Client{Transport: &pagesTransport{pages: []string{streamPage1, "<"}}}
+	if err = c.SelectInto("select * from d", &rows); err == nil || len(rows) != 3 {
+		t.Errorf("Expected unchanged slice, got %v %v", rows, err)
+	}
+
+	// a is not a time, so the first item of the second page fails to
+	// unmarshal
+	type timed struct {
+		ID string    `sdb:",itemname"`
+		A  time.Time `sdb:"a"`
+	}
+	ts := []timed{{ID: "x"}}
+	page1 := `<SelectResponse><SelectResult><Item><Name>i0</Name></Item><NextToken>t0</NextToken></SelectResult></SelectResponse>`
+	c.HTTPClient = &http.Client{Transport: &pagesTransport{pages: []string{page1, streamPage1}}}
+	if err = c.SelectInto("select * from d", &ts); err == nil || len(ts) != 1 {
+		t.Errorf("Expected unchanged slice, got %v %v", ts, err)
+	}
+}
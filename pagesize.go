@@ -0,0 +1,95 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// PageSizer adapts the limit of Select pages so a page takes about Target,
+// for interactive use where a slow page matters more than the number of
+// round trips. After every page the time and, when MaxBoxUsage is set, the
+// BoxUsage per item are used to estimate the size meeting the targets,
+// moving halfway there to smooth out noise. Share one PageSizer between
+// pagers of similar queries.
+type PageSizer struct {
+	Target      time.Duration
+	MaxBoxUsage float64
+	Min         int
+	Max         int
+	mu          sync.Mutex
+	size        int
+}
+
+// NewPageSizer starts at 100 items per page, between 10 and MaxSelectLimit.
+func NewPageSizer(target time.Duration) *PageSizer {
+	return &PageSizer{Target: target, Min: 10, Max: MaxSelectLimit, size: 100}
+}
+
+// Size returns the limit for the next page.
+func (s *PageSizer) Size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Observe records a page of n items that took took and used boxUsage.
+func (s *PageSizer) Observe(n int, took time.Duration, boxUsage float64) {
+	if n <= 0 || took <= 0 {
+		return
+	}
+	estimate := float64(s.Target) / (float64(took) / float64(n))
+	if s.MaxBoxUsage > 0 && boxUsage > 0 {
+		estimate = min(estimate, s.MaxBoxUsage/(boxUsage/float64(n)))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	size := (float64(s.size) + estimate) / 2
+	s.size = max(s.Min, min(s.Max, MaxSelectLimit, int(size)))
+	if s.size < 1 {
+		s.size = 1
+	}
+}
+
+// SizedPager pages through q with limits chosen by s. The limit of q is
+// replaced on every page.
+func (sdb *SimpleDB) SizedPager(q *Query, s *PageSizer) *Pager[Item] {
+	db := *sdb
+	p := *q
+	return NewPager(func(ctx context.Context, token string) (page Page[Item], err error) {
+		start := time.Now()
+		if page, err = db.SelectPage(ctx, p.Limit(s.Size()).String(), token); err != nil {
+			return
+		}
+		s.Observe(len(page.Items), time.Since(start), page.BoxUsage)
+		return
+	}).Partial(sdb.PartialResults)
+}
@@ -0,0 +1,60 @@
+package sdb
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestPageSizer(t *testing.T) {
+	s := NewPageSizer(100 * time.Millisecond)
+	s.Observe(100, 400*time.Millisecond, 0)
+	if n := s.Size(); n != 62 {
+		t.Errorf("Expected 62 after a slow page, got %d", n)
+	}
+	for j := 0; j < 20; j++ {
+		s.Observe(s.Size(), time.Duration(s.Size())*time.Millisecond/100, 0)
+	}
+	if n := s.Size(); n != MaxSelectLimit {
+		t.Errorf("Expected %d after fast pages, got %d", MaxSelectLimit, n)
+	}
+	s.MaxBoxUsage = 0.001
+	s.Observe(100, time.Millisecond, 0.01)
+	if n := s.Size(); n != 1255 {
+		t.Errorf("Expected BoxUsage to bound the size, got %d", n)
+	}
+	s.Observe(0, time.Second, 0)
+	if n := s.Size(); n != 1255 {
+		t.Errorf("Empty pages should not change the size, got %d", n)
+	}
+}
+
+// exprTransport records the select expressions sent through pages.
+type exprTransport struct {
+	pagesTransport
+	exprs []string
+}
+
+func (e *exprTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b, _ := io.ReadAll(req.Body)
+	p, _ := url.ParseQuery(string(b))
+	e.exprs = append(e.exprs, p.Get("SelectExpression"))
+	return e.pagesTransport.RoundTrip(req)
+}
+
+func TestSizedPager(t *testing.T) {
+	et := &exprTransport{pagesTransport: pagesTransport{pages: []string{streamPage1, streamPage2}}}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: et}
+	s := NewPageSizer(time.Hour)
+	items, err := c.SizedPager(NewQuery("d").Limit(5), s).All(context.Background())
+	if err != nil || len(items) != 3 {
+		t.Fatal(items, err)
+	}
+	if len(et.exprs) != 2 || et.exprs[0] != "select * from `d` limit 100" || et.exprs[1] == et.exprs[0] {
+		t.Errorf("Unexpected expressions %v", et.exprs)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// queryHashSize is the length of the query hash at the start of a page token.
+const queryHashSize = 8
+
+// PageTokens wraps SimpleDB NextToken values into opaque URL safe tokens for
+// web APIs. Every token carries a hash of the select expression it belongs
+// to, so a token can not be used to continue another query. With a key the
+// tokens are signed with HMAC-SHA256 and tampered tokens are rejected by
+// Unwrap.
+type PageTokens struct {
+	Key []byte
+}
+
+// Wrap returns the page token for a NextToken of query, an empty NextToken
+// gives an empty page token.
+func (p PageTokens) Wrap(query string, nextToken string) string {
+	if nextToken == "" {
+		return ""
+	}
+	b := append(queryHash(query), nextToken...)
+	if len(p.Key) > 0 {
+		b = append(p.mac(b), b...)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Unwrap returns the NextToken of a page token created by Wrap for the same
+// query.
+func (p PageTokens) Unwrap(query string, token string) (nextToken string, err error) {
+	if token == "" {
+		return
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", ErrInvalidPageToken
+	}
+	if len(p.Key) > 0 {
+		if len(b) < sha256.Size || !hmac.Equal(b[:sha256.Size], p.mac(b[sha256.Size:])) {
+			return "", ErrInvalidPageToken
+		}
+		b = b[sha256.Size:]
+	}
+	if len(b) < queryHashSize || !bytes.Equal(b[:queryHashSize], queryHash(query)) {
+		return "", ErrInvalidPageToken
+	}
+	return string(b[queryHashSize:]), nil
+}
+
+func (p PageTokens) mac(b []byte) []byte {
+	m := hmac.New(sha256.New, p.Key)
+	m.Write(b)
+	return m.Sum(nil)
+}
+
+func queryHash(query string) []byte {
+	h := sha256.Sum256([]byte(query))
+	return h[:queryHashSize]
+}
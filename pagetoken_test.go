@@ -0,0 +1,32 @@
+package sdb
+
+import (
+	"testing"
+)
+
+func TestPageTokens(t *testing.T) {
+	q := "select * from `users`"
+	next := "rO0ABXNyACdjb20uYW1hem9uLnNkcy5RdWVyeVByb2Nlc3Nvci5Nb3JlVG9rZW4="
+	for _, p := range []PageTokens{{}, {Key: []byte("secret")}} {
+		token := p.Wrap(q, next)
+		if out, err := p.Unwrap(q, token); err != nil || out != next {
+			t.Errorf("Token did not round trip, got %q %v", out, err)
+		}
+		if _, err := p.Unwrap("select * from `admins`", token); err != ErrInvalidPageToken {
+			t.Error("Expected token of another query to be rejected")
+		}
+	}
+
+	p := PageTokens{Key: []byte("secret")}
+	token := []byte(p.Wrap(q, next))
+	token[len(token)-2] ^= 1
+	if _, err := p.Unwrap(q, string(token)); err != ErrInvalidPageToken {
+		t.Error("Expected tampered token to be rejected")
+	}
+	if _, err := (PageTokens{Key: []byte("other")}).Unwrap(q, p.Wrap(q, next)); err != ErrInvalidPageToken {
+		t.Error("Expected token signed with another key to be rejected")
+	}
+	if _, err := (PageTokens{}).Unwrap(q, "c2hvcnQ"); err != ErrInvalidPageToken {
+		t.Error("Expected short token to be rejected")
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import "strings"
+
+// PatchAttributes sets the attributes in changes to exactly the given values,
+// creating the item if it does not exist. An attribute mapped to no values is
+// deleted, attributes not in changes are left alone. The item is read, with
+// ConsistentRead if the client has it set, and only the difference is
+// written: one put, which replaces the attributes that change, and one
+// delete for values that are only removed. Without a condition a concurrent
+// write between the read and the writes may be mixed with the patch, use
+// PatchAttributesIf to prevent it.
+func (sdb *SimpleDB) PatchAttributes(domain string, itemName string, changes map[string][]string) (err error) {
+	return sdb.patchAttributes(domain, itemName, changes, nil)
+}
+
+// PatchAttributesIf is PatchAttributes where the write is only made if c holds.
+// Every write is conditional, so a failed condition on the first write leaves
+// the item untouched. Without a difference the condition is checked with a
+// consistent read.
+func (sdb *SimpleDB) PatchAttributesIf(domain string, itemName string, changes map[string][]string, c Condition) (err error) {
+	return sdb.patchAttributes(domain, itemName, changes, &c)
+}
+
+func (sdb *SimpleDB) patchAttributes(domain string, itemName string, changes map[string][]string, c *Condition) (err error) {
+	r, err := sdb.GetAttributes(domain, itemName)
+	if err != nil {
+		return
+	}
+	current := Item{Name: itemName, Attributes: r.Attributes}
+	desired := Item{Name: itemName}
+	for _, a := range r.Attributes {
+		if _, ok := changes[a.Name]; !ok {
+			desired.Attributes = append(desired.Attributes, a)
+		}
+	}
+	for name, values := range changes {
+		for _, v := range values {
+			desired.AddAttribute(name, v)
+		}
+	}
+	return sdb.writeDiff(domain, current, desired, c)
+}
+
+// writeDiff writes the changes needed to turn current into desired with at
+// most one put and one delete, see writeChanges.
+func (sdb *SimpleDB) writeDiff(domain string, current Item, desired Item, c *Condition) (err error) {
+	d := DiffItems(current, desired)
+	put := NewItem(desired.Name)
+	del := NewItem(desired.Name)
+	for _, ad := range append(d.Added, d.Changed...) {
+		switch {
+		case len(ad.Added) > 0 && len(ad.Removed) > 0:
+			// replace rather than put and delete so readers never see
+			// old and new values together
+			for _, v := range ad.Values {
+				put.ReplaceAttribute(ad.Name, v)
+			}
+		case len(ad.Added) > 0:
+			for _, v := range ad.Added {
+				put.AddAttribute(ad.Name, v)
+			}
+		default:
+			for _, v := range ad.Removed {
+				del.AddAttribute(ad.Name, v)
+			}
+		}
+	}
+	for _, ad := range d.Removed {
+		del.AddAttribute(ad.Name, "")
+	}
+	return sdb.writeChanges(domain, put, del, c)
+}
+
+// writeChanges puts put and then deletes del. The condition, if any, is
+// checked by both writes: the delete expects the value the put gave the
+// condition attribute. A failed condition on the delete leaves the put in
+// place. Without anything to write the condition is checked by a consistent
+// read instead. With a Checksum the delete also removes the checksum and
+// recomputes it, reads between the two writes fail with an IntegrityError.
+func (sdb *SimpleDB) writeChanges(domain string, put *Item, del *Item, c *Condition) (err error) {
+	if len(put.Attributes) == 0 && len(del.Attributes) == 0 {
+		if c != nil {
+			err = sdb.checkCondition(domain, put.Name, *c)
+		}
+		return
+	}
+	if sdb.Checksum != "" && len(put.Attributes) > 0 && len(del.Attributes) == 0 {
+		// the delete removes the checksum the put made stale
+		del = &Item{Name: put.Name, Attributes: []Attribute{{Name: sdb.Checksum}}}
+	}
+	if len(put.Attributes) > 0 {
+		db := *sdb
+		db.partialPut = true
+		if _, err = db.putAttributes(domain, put, c); err != nil {
+			return
+		}
+		if c != nil {
+			next := conditionAfter(*c, put)
+			c = &next
+		}
+	}
+	if len(del.Attributes) > 0 {
+		_, err = sdb.deleteAttributes(domain, del, c)
+	}
+	return
+}
+
+// conditionAfter returns c as it holds after put was written with c.
+func conditionAfter(c Condition, put *Item) Condition {
+	var values []Attribute
+	for _, a := range put.Attributes {
+		if a.Name == c.Name {
+			values = append(values, a)
+		}
+	}
+	if len(values) == 1 && (values[0].Replace || !c.Exists) {
+		return Condition{Name: c.Name, Value: values[0].Value, Exists: true}
+	}
+	return c
+}
+
+// checkCondition returns a ConditionalCheckFailed error unless c holds for
+// the stored item.
+func (sdb *SimpleDB) checkCondition(domain string, itemName string, c Condition) error {
+	db := *sdb
+	db.ConsistentRead = true
+	r, err := db.GetAttributes(domain, itemName)
+	if err != nil {
+		return err
+	}
+	var values []string
+	for _, a := range r.Attributes {
+		if a.Name == c.Name {
+			values = append(values, a.Value)
+		}
+	}
+	switch {
+	case !c.Exists && len(values) == 0:
+		return nil
+	case c.Exists && len(values) == 1 && values[0] == c.Value:
+		return nil
+	case !c.Exists:
+		return SimpleDBError{Code: "ConditionalCheckFailed", Message: "Attribute (" + c.Name + ") value exists", StatusCode: 409}
+	case len(values) == 0:
+		return SimpleDBError{Code: "AttributeDoesNotExist", Message: "Attribute (" + c.Name + ") does not exist", StatusCode: 404}
+	}
+	return SimpleDBError{Code: "ConditionalCheckFailed", Message: "Conditional check failed. Attribute (" + c.Name + ") value is (" + strings.Join(values, ", ") + ") but was expected (" + c.Value + ")", StatusCode: 409}
+}
@@ -0,0 +1,101 @@
+package sdb_test
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestPatchAttributes(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	db.ConsistentRead = true
+	if _, err := db.CreateDomain("items"); err != nil {
+		t.Fatal(err)
+	}
+	stored := func() string {
+		t.Helper()
+		r, err := db.GetAttributes("items", "i")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s []string
+		for _, a := range r.Attributes {
+			s = append(s, a.Name+"="+a.Value)
+		}
+		sort.Strings(s)
+		return strings.Join(s, ",")
+	}
+
+	i := sdb.NewItem("i")
+	i.AddAttribute("color", "red")
+	i.AddAttribute("size", "s")
+	i.AddAttribute("size", "m")
+	i.AddAttribute("version", "1")
+	if _, err := db.PutAttributes("items", i); err != nil {
+		t.Fatal(err)
+	}
+
+	err := db.PatchAttributes("items", "i", map[string][]string{"size": {"l"}, "tags": {"a", "b"}, "color": nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stored(); got != "size=l,tags=a,tags=b,version=1" {
+		t.Fatalf("stored after patch: %s", got)
+	}
+
+	// Only the difference is written.
+	var actions []string
+	patch := db
+	patch.HTTPClient = &http.Client{Transport: &racingTransport{RoundTripper: f, match: func(p url.Values) bool {
+		actions = append(actions, p.Get("Action"))
+		return false
+	}}}
+	if err = patch.PatchAttributes("items", "i", map[string][]string{"size": {"l"}, "tags": {"b", "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(actions, ",") != "GetAttributes" {
+		t.Errorf("unchanged patch sent %v", actions)
+	}
+	actions = nil
+	if err = patch.PatchAttributes("items", "i", map[string][]string{"size": {"l"}, "tags": {"a", "c"}}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(actions, ",") != "GetAttributes,PutAttributes" {
+		t.Errorf("patch sent %v", actions)
+	}
+	if got := stored(); got != "size=l,tags=a,tags=c,version=1" {
+		t.Fatalf("stored after second patch: %s", got)
+	}
+
+	// A failed condition leaves the item untouched.
+	err = db.PatchAttributesIf("items", "i", map[string][]string{"size": {"xl"}}, sdb.Condition{Name: "version", Value: "2", Exists: true})
+	if !sdb.IsConditionalCheckFailed(err) {
+		t.Fatalf("expected a failed condition, got %v", err)
+	}
+	// The delete is conditional on the version the put wrote.
+	err = db.PatchAttributesIf("items", "i", map[string][]string{"version": {"2"}, "tags": nil}, sdb.Condition{Name: "version", Value: "1", Exists: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stored(); got != "size=l,version=2" {
+		t.Fatalf("stored after conditional patch: %s", got)
+	}
+
+	// Without changes the condition is still checked.
+	for _, c := range []sdb.Condition{{Name: "version", Value: "1", Exists: true}, {Name: "version"}, {Name: "missing", Value: "x", Exists: true}} {
+		if err = db.PatchAttributesIf("items", "i", nil, c); !sdb.IsConditionalCheckFailed(err) {
+			t.Fatalf("empty patch with %+v returned %v", c, err)
+		}
+	}
+	for _, c := range []sdb.Condition{{Name: "version", Value: "2", Exists: true}, {Name: "missing"}} {
+		if err = db.PatchAttributesIf("items", "i", nil, c); err != nil {
+			t.Fatalf("empty patch with %+v returned %v", c, err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Access is the access a client has to an attribute under an
+// AttributePolicy.
+type Access int
+
+const (
+	ReadWrite Access = iota
+	// ReadOnly attributes are returned by reads but can not be written.
+	ReadOnly
+	// Hidden attributes are stripped from reads, can not be written and
+	// can not be used in Select expressions.
+	Hidden
+)
+
+func (a Access) String() string {
+	switch a {
+	case ReadOnly:
+		return "read-only"
+	case Hidden:
+		return "hidden"
+	}
+	return "read-write"
+}
+
+// AttributePolicy restricts a client's access to attributes by name in
+// every domain, for example to keep PII from analytics code. Attributes not
+// listed are ReadWrite. Deleting a whole item is refused while any attribute
+// is protected, since it would delete those too. With Hidden attributes
+// RawResponse is cleared after reads, and SelectDecode and a Select
+// Unmarshaler, whose results the policy can not filter, only accept Selects
+// of explicitly named attributes.
+type AttributePolicy map[string]Access
+
+// PolicyError is returned for operations the AttributePolicy forbids.
+type PolicyError struct {
+	Attribute string
+	Access    Access
+	Op        string
+}
+
+func (e PolicyError) Error() string {
+	return fmt.Sprintf("%s refused: attribute %s is %s", e.Op, e.Attribute, e.Access)
+}
+
+func (p AttributePolicy) hides() bool {
+	for _, a := range p {
+		if a == Hidden {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWrite refuses writes to protected attributes. An item without
+// attributes stands for deleting the whole item in DeleteAttributes and
+// BatchDeleteAttributes.
+func (p AttributePolicy) checkWrite(op string, items ...*Item) error {
+	if len(p) == 0 {
+		return nil
+	}
+	for _, i := range items {
+		if len(i.Attributes) == 0 && (op == "DeleteAttributes" || op == "BatchDeleteAttributes") {
+			names := make([]string, 0, len(p))
+			for name, a := range p {
+				if a != ReadWrite {
+					names = append(names, name)
+				}
+			}
+			if len(names) > 0 {
+				sort.Strings(names)
+				return PolicyError{Attribute: names[0], Access: p[names[0]], Op: op}
+			}
+		}
+		for _, a := range i.Attributes {
+			if access := p[a.Name]; access != ReadWrite {
+				return PolicyError{Attribute: a.Name, Access: access, Op: op}
+			}
+		}
+	}
+	return nil
+}
+
+// checkSelect refuses expressions that name a hidden attribute. Unless the
+// results are filtered, a "*" output is refused too.
+func (p AttributePolicy) checkSelect(q string, filtered bool) error {
+	if !p.hides() {
+		return nil
+	}
+	s, err := ParseSelect(q)
+	if err != nil {
+		return err
+	}
+	attrs := append([]string{s.OrderBy}, s.Output...)
+	for _, c := range comparisons(s.Where, nil) {
+		attrs = append(attrs, c.Attribute)
+	}
+	for _, a := range attrs {
+		if p[a] == Hidden || a == "*" && !filtered {
+			return PolicyError{Attribute: a, Access: Hidden, Op: "Select"}
+		}
+	}
+	return nil
+}
+
+// attributes returns attrs without the hidden ones, leaving attrs unchanged.
+func (p AttributePolicy) attributes(attrs []Attribute) []Attribute {
+	if !p.hides() {
+		return attrs
+	}
+	out := make([]Attribute, 0, len(attrs))
+	for _, a := range attrs {
+		if p[a.Name] != Hidden {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// clearRawResponse drops the response of a read that may hold hidden or
+// masked values.
+func (sdb *SimpleDB) clearRawResponse() {
+	if sdb.Policy.hides() || len(sdb.Masks) > 0 {
+		sdb.RawResponse = ""
+	}
+}
@@ -0,0 +1,75 @@
+package sdb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+type policyTransport struct {
+	calls int
+}
+
+func (pt *policyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	pt.calls++
+	b, _ := io.ReadAll(req.Body)
+	p, _ := url.ParseQuery(string(b))
+	attrs := "<Attribute><Name>name</Name><Value>Ann</Value></Attribute><Attribute><Name>ssn</Name><Value>123</Value></Attribute>"
+	var body string
+	switch p.Get("Action") {
+	case "GetAttributes":
+		body = "<GetAttributesResponse><GetAttributesResult>" + attrs + "</GetAttributesResult></GetAttributesResponse>"
+	case "Select":
+		body = "<SelectResponse><SelectResult><Item><Name>u1</Name>" + attrs + "</Item></SelectResult></SelectResponse>"
+	default:
+		body = "<Response/>"
+	}
+	return &http.Response{StatusCode: 200, Status: "200 OK", Body: io.NopCloser(bytes.NewBufferString(body)), Request: req}, nil
+}
+
+func TestAttributePolicy(t *testing.T) {
+	pt := &policyTransport{}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: pt}
+	c.Policy = AttributePolicy{"ssn": Hidden, "created": ReadOnly}
+
+	r, err := c.GetAttributes("users", "u1")
+	if err != nil || len(r.Attributes) != 1 || r.Attributes[0].Name != "name" || c.RawResponse != "" {
+		t.Fatalf("GetAttributes = %+v, %v, raw %q", r.Attributes, err, c.RawResponse)
+	}
+	s, err := c.Select("select * from users where name = 'Ann'")
+	if err != nil || len(s.Items) != 1 || len(s.Items[0].Attributes) != 1 {
+		t.Fatalf("Select = %+v, %v", s.Items, err)
+	}
+
+	calls := pt.calls
+	var pe PolicyError
+	for _, err := range []error{
+		func() error { _, err := c.Select("select name from users where ssn = '123'"); return err }(),
+		func() error { return c.SelectDecode("select * from users", "", &struct{}{}) }(),
+		func() error {
+			_, err := c.PutAttributes("users", &Item{Name: "u1", Attributes: []Attribute{{Name: "created", Value: "x"}}})
+			return err
+		}(),
+		func() error { _, err := c.DeleteItem("users", "u1"); return err }(),
+		func() error { _, err := c.BatchDeleteAttributes("users", []*Item{{Name: "u1"}}); return err }(),
+		func() error {
+			_, err := c.Replay("Action=BatchDeleteAttributes&DomainName=users&Item.1.ItemName=u1", "")
+			return err
+		}(),
+	} {
+		if !errors.As(err, &pe) {
+			t.Errorf("expected a PolicyError, got %v", err)
+		}
+	}
+	if pt.calls != calls {
+		t.Errorf("refused operations made %d requests", pt.calls-calls)
+	}
+
+	if _, err := c.PutAttributes("users", &Item{Name: "u1", Attributes: []Attribute{{Name: "name", Value: "Bo"}}}); err != nil {
+		t.Error(err)
+	}
+}
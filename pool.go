@@ -0,0 +1,204 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxDomains is the default number of domains an account may create.
+const MaxDomains = 250
+
+var ErrDomainLimit = errors.New("sdb: domain limit reached")
+
+// DomainPool hands out short-lived domains, for tests or per-tenant staging,
+// without running into the account domain limit. Domain names are the prefix
+// followed by the creation time and a random suffix, so that Collect can find
+// expired domains from the domain list alone.
+type DomainPool struct {
+	Prefix string
+	// MaxAge is how long a domain is kept, older ones are deleted by Collect
+	// and not reused after Release.
+	MaxAge time.Duration
+	// Limit is the account domain limit, MaxDomains by default.
+	Limit int
+	db    SimpleDB
+	mu    sync.Mutex
+	free  []string
+}
+
+func NewDomainPool(db SimpleDB, prefix string, maxAge time.Duration) *DomainPool {
+	db.ConsistentRead = true
+	return &DomainPool{Prefix: prefix, MaxAge: maxAge, Limit: MaxDomains, db: db}
+}
+
+func (p *DomainPool) newName() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return p.Prefix + strconv.FormatInt(time.Now().Unix(), 36) + "." + hex.EncodeToString(b), nil
+}
+
+// Created returns the creation time encoded in a domain name of the pool.
+func (p *DomainPool) Created(domain string) (t time.Time, ok bool) {
+	if !strings.HasPrefix(domain, p.Prefix) {
+		return
+	}
+	s := strings.TrimPrefix(domain, p.Prefix)
+	dot := strings.IndexByte(s, '.')
+	if dot < 0 {
+		return
+	}
+	n, err := strconv.ParseInt(s[:dot], 36, 64)
+	if err != nil {
+		return
+	}
+	return time.Unix(n, 0), true
+}
+
+func (p *DomainPool) expired(domain string) bool {
+	t, ok := p.Created(domain)
+	return ok && p.MaxAge > 0 && time.Since(t) > p.MaxAge
+}
+
+// Acquire returns an empty domain, reusing a released one when possible.
+// Released domains that expired meanwhile are deleted. When the account is at
+// its limit expired domains are collected first and ErrDomainLimit is
+// returned if that frees none.
+func (p *DomainPool) Acquire() (domain string, err error) {
+	db := p.db
+	for {
+		p.mu.Lock()
+		if len(p.free) == 0 {
+			p.mu.Unlock()
+			break
+		}
+		domain, p.free = p.free[len(p.free)-1], p.free[:len(p.free)-1]
+		p.mu.Unlock()
+		if !p.expired(domain) {
+			return domain, nil
+		}
+		if _, err = db.DeleteDomain(domain); err != nil {
+			return "", err
+		}
+	}
+
+	names, err := db.ListDomainsPager().All(context.Background())
+	if err != nil {
+		return "", err
+	}
+	if len(names) >= p.Limit {
+		var deleted []string
+		if deleted, err = p.Collect(); err != nil {
+			return "", err
+		}
+		if len(names)-len(deleted) >= p.Limit {
+			return "", ErrDomainLimit
+		}
+	}
+
+	if domain, err = p.newName(); err != nil {
+		return "", err
+	}
+	if _, err = db.CreateDomain(domain); err != nil {
+		if e, ok := err.(SimpleDBError); ok && e.Code == "NumberDomainsExceeded" {
+			err = ErrDomainLimit
+		}
+		return "", err
+	}
+	return domain, nil
+}
+
+// Release deletes every item of domain and keeps it for the next Acquire.
+// Expired domains are deleted instead.
+func (p *DomainPool) Release(domain string) error {
+	db := p.db
+	if p.expired(domain) {
+		_, err := db.DeleteDomain(domain)
+		return err
+	}
+	q := "select itemName() from " + QuoteName(domain)
+	token := ""
+	for {
+		r, err := db.SelectWithToken(q, token)
+		if err != nil {
+			return err
+		}
+		for _, i := range r.Items {
+			if _, err = db.DeleteItem(domain, i.Name); err != nil {
+				return err
+			}
+		}
+		if r.NextToken == "" {
+			break
+		}
+		token = r.NextToken
+	}
+	p.mu.Lock()
+	p.free = append(p.free, domain)
+	p.mu.Unlock()
+	return nil
+}
+
+// Collect deletes every domain with the pool's prefix older than MaxAge,
+// including domains created by other processes using the same prefix.
+func (p *DomainPool) Collect() (deleted []string, err error) {
+	db := p.db
+	names, err := db.ListDomainsPager().All(context.Background())
+	if err != nil {
+		return
+	}
+	for _, n := range names {
+		if !p.expired(n) {
+			continue
+		}
+		if _, err = db.DeleteDomain(n); err != nil {
+			return
+		}
+		deleted = append(deleted, n)
+	}
+	p.mu.Lock()
+	free := p.free[:0]
+	for _, n := range p.free {
+		if !p.expired(n) {
+			free = append(free, n)
+		}
+	}
+	p.free = free
+	p.mu.Unlock()
+	return
+}
@@ -0,0 +1,30 @@
+package sdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDomainPoolNames(t *testing.T) {
+	p := NewDomainPool(NewSimpleDB("a", "s", SDBRegionEUWest1), "test-", time.Hour)
+	n, err := p.newName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ValidateDomainName(n); err != nil {
+		t.Error(err)
+	}
+	if c, ok := p.Created(n); !ok || time.Since(c) > time.Minute {
+		t.Error(n, c, ok)
+	}
+	if p.expired(n) {
+		t.Error("New domain should not be expired")
+	}
+	old := "test-kz0.00000000"
+	if !p.expired(old) {
+		t.Error("Expected old domain to be expired")
+	}
+	if _, ok := p.Created("other-kz0.00000000"); ok {
+		t.Error("Domain without prefix should not belong to the pool")
+	}
+}
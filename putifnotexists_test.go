@@ -0,0 +1,41 @@
+package sdb_test
+
+import (
+	"testing"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestPutIfNotExists(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	if _, err := db.CreateDomain("d"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.PutIfNotExists("d", &sdb.Item{Name: "a", Attributes: []sdb.Attribute{{Name: "x", Value: "1"}}}); err != nil {
+		t.Fatal(err)
+	}
+	// The second put starts with an attribute the stored item lacks.
+	_, err := db.PutIfNotExists("d", &sdb.Item{Name: "a", Attributes: []sdb.Attribute{{Name: "y", Value: "2"}, {Name: "x", Value: "3"}}})
+	if !sdb.IsConditionalCheckFailed(err) {
+		t.Fatalf("expected a failed condition, got %v", err)
+	}
+	r, err := db.GetAttributes("d", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := sdb.Item{Attributes: r.Attributes}
+	if stored.Value("x") != "1" || stored.Value("y") != "" || stored.Value(sdb.IDAttribute) != "a" {
+		t.Errorf("existing item overwritten: %+v", r.Attributes)
+	}
+
+	i := &sdb.Item{Attributes: []sdb.Attribute{{Name: sdb.IDAttribute, Value: "a"}, {Name: "x", Value: "4"}}}
+	if _, err = db.PutIfNotExists("d", i); err != nil || i.Name == "" {
+		t.Fatal(i.Name, err)
+	}
+	r, err = db.GetAttributes("d", i.Name)
+	if stored = (sdb.Item{Attributes: r.Attributes}); err != nil || len(r.Attributes) != 2 || stored.Value(sdb.IDAttribute) != i.Name {
+		t.Errorf("copied id not replaced: %+v %v", r.Attributes, err)
+	}
+}
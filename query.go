@@ -0,0 +1,181 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Query builds a Select expression. Values passed to the Where methods are
+// quoted, names are quoted unless they are a function such as itemName().
+type Query struct {
+	domain  string
+	output  string
+	where   []string
+	orderBy string
+	desc    bool
+	limit   int
+}
+
+func NewQuery(domain string) *Query {
+	return &Query{domain: domain, output: "*"}
+}
+
+// Output selects the given attributes instead of all attributes.
+func (q *Query) Output(attrs ...string) *Query {
+	quoted := make([]string, len(attrs))
+	for i, a := range attrs {
+		quoted[i] = quoteAttribute(a)
+	}
+	q.output = strings.Join(quoted, ", ")
+	return q
+}
+
+// Count makes the query return the number of matching items.
+func (q *Query) Count() *Query {
+	q.output = "count(*)"
+	return q
+}
+
+// Where adds the predicate `attr` op 'value', for example Where("age", ">", "042").
+func (q *Query) Where(attr string, op string, value string) *Query {
+	return q.WhereExpr(quoteAttribute(attr) + " " + op + " " + Quote(value))
+}
+
+func (q *Query) WhereIn(attr string, values ...string) *Query {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = Quote(v)
+	}
+	return q.WhereExpr(quoteAttribute(attr) + " in (" + strings.Join(quoted, ", ") + ")")
+}
+
+// WhereAll matches items where the multi-valued attr has every one of values.
+func (q *Query) WhereAll(attr string, values ...string) *Query {
+	preds := make([]string, len(values))
+	for i, v := range values {
+		preds[i] = quoteAttribute(attr) + " = " + Quote(v)
+	}
+	return q.WhereExpr("(" + strings.Join(preds, " intersection ") + ")")
+}
+
+// WhereExpr adds a predicate as is. All predicates are combined with and.
+func (q *Query) WhereExpr(expr string) *Query {
+	q.where = append(q.where, expr)
+	return q
+}
+
+func (q *Query) OrderBy(attr string, desc bool) *Query {
+	q.orderBy = attr
+	q.desc = desc
+	return q
+}
+
+func (q *Query) Limit(n int) *Query {
+	q.limit = n
+	return q
+}
+
+// ForDomain returns a copy of q that selects from domain.
+func (q *Query) ForDomain(domain string) *Query {
+	c := *q
+	c.domain = domain
+	c.where = append([]string(nil), q.where...)
+	return &c
+}
+
+func (q *Query) String() string {
+	s := "select " + q.output + " from " + QuoteName(q.domain)
+	if len(q.where) > 0 {
+		s += " where " + strings.Join(q.where, " and ")
+	}
+	if q.orderBy != "" {
+		s += " order by " + quoteAttribute(q.orderBy)
+		if q.desc {
+			s += " desc"
+		}
+	}
+	if q.limit > 0 {
+		s += " limit " + strconv.Itoa(q.limit)
+	}
+	return s
+}
+
+// skip returns the NextToken positioned after the first n items matching q,
+// using count(*) queries so the skipped items are not transferred. An empty
+// token with a nil error means fewer than n items match.
+func (sdb *SimpleDB) skip(q Query, n int) (token string, err error) {
+	for n > 0 {
+		c := q
+		c.Count().Limit(n)
+		var r SelectResponse
+		r, err = sdb.SelectWithToken(c.String(), token)
+		if err != nil || len(r.Items) == 0 {
+			return
+		}
+		var counted int
+		if counted, err = strconv.Atoi(r.Items[0].Value("Count")); err != nil {
+			return
+		}
+		n -= counted
+		token = r.NextToken
+		if token == "" {
+			return
+		}
+	}
+	return
+}
+
+// SelectOffset returns up to limit items matching q after skipping the first
+// offset items. The skipped items are counted with count(*) queries and only
+// their NextToken is used, which is cheaper than fetching them but still costs
+// one request per page of skipped items, so large offsets are slow.
+func (sdb *SimpleDB) SelectOffset(q *Query, offset int, limit int) (page Page[Item], err error) {
+	token, err := sdb.skip(*q, offset)
+	if err != nil || (offset > 0 && token == "") {
+		return
+	}
+	p := *q
+	for len(page.Items) < limit {
+		var r SelectResponse
+		r, err = sdb.SelectWithToken(p.Limit(limit-len(page.Items)).String(), token)
+		if err != nil {
+			return
+		}
+		page.Items = append(page.Items, r.Items...)
+		page.BoxUsage += r.ResponseMetadata.BoxUsage
+		page.NextToken, page.HasMore = r.NextToken, r.NextToken != ""
+		if !page.HasMore {
+			return
+		}
+		token = r.NextToken
+	}
+	return
+}
@@ -0,0 +1,16 @@
+package sdb
+
+import (
+	"testing"
+)
+
+func TestQueryString(t *testing.T) {
+	q := NewQuery("my`domain").Output("itemName()", "score").
+		Where("board", "=", "it's").
+		WhereIn("itemName()", "a", "b").
+		OrderBy("score", true).Limit(10)
+	expected := "select itemName(), `score` from `my``domain` where `board` = 'it''s' and itemName() in ('a', 'b') order by `score` desc limit 10"
+	if s := q.String(); s != expected {
+		t.Errorf("Expected %s, got %s", expected, s)
+	}
+}
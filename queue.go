@@ -0,0 +1,209 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var ErrMessageLost = errors.New("message is no longer held by this receiver")
+
+// Message is a queue message handed out by Dequeue. It must be passed back to
+// Ack or Nack before the visibility timeout expires.
+type Message struct {
+	ID           string
+	Body         string
+	ReceiveCount int
+	version      string
+}
+
+// Queue is a low volume message queue kept in a single domain. Every message
+// is an item with a state, a visibility time and a version attribute, receivers
+// claim a message by a conditional put on the version so a message is only
+// handed to one receiver at a time. Messages received more than MaxReceives
+// times are moved to the dead letter state.
+type Queue struct {
+	Domain      string
+	MaxReceives int
+	db          SimpleDB
+}
+
+func NewQueue(db SimpleDB, domain string) *Queue {
+	db.ConsistentRead = true
+	return &Queue{Domain: domain, MaxReceives: 5, db: db}
+}
+
+func (q *Queue) Enqueue(body string) (id string, err error) {
+	return q.EnqueueDelayed(body, 0)
+}
+
+// EnqueueDelayed adds a message that is not visible to receivers until delay
+// has passed.
+func (q *Queue) EnqueueDelayed(body string, delay time.Duration) (id string, err error) {
+	id, err = TimePrefixed()
+	if err != nil {
+		return
+	}
+	i := NewItem(id)
+	i.AddAttribute("state", "ready")
+	i.AddAttribute("visible", sortableMillis(time.Now().Add(delay)))
+	i.AddAttribute("receives", "0")
+	i.AddAttribute("version", "1")
+	if err = i.SetChunked("body", body); err != nil {
+		return
+	}
+	db := q.db
+	_, err = db.PutAttributesIf(q.Domain, i, Condition{Name: "version"})
+	return
+}
+
+// Dequeue claims the oldest visible message and hides it from other receivers
+// for visibility. It returns nil without error when no message is available.
+func (q *Queue) Dequeue(visibility time.Duration) (m *Message, err error) {
+	db := q.db
+	now := time.Now()
+	s := fmt.Sprintf("select * from `%s` where state = 'ready' and visible <= '%s' order by visible limit 10", q.Domain, sortableMillis(now))
+	r, err := db.Select(s)
+	if err != nil {
+		return
+	}
+	for _, i := range r.Items {
+		version := i.Value("version")
+		receives, _ := strconv.Atoi(i.Value("receives"))
+		receives++
+
+		if q.MaxReceives > 0 && receives > q.MaxReceives {
+			_, err := q.update(i.Name, version, map[string]string{"state": "dead"})
+			if err != nil && !IsConditionalCheckFailed(err) {
+				return nil, err
+			}
+			continue
+		}
+
+		next, err := q.update(i.Name, version, map[string]string{
+			"visible":  sortableMillis(now.Add(visibility)),
+			"receives": strconv.Itoa(receives),
+		})
+		if IsConditionalCheckFailed(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		body, _, err := i.Chunked("body")
+		if err != nil {
+			return nil, err
+		}
+		return &Message{ID: i.Name, Body: body, ReceiveCount: receives, version: next}, nil
+	}
+	return
+}
+
+// Ack deletes a processed message. ErrMessageLost is returned if the
+// visibility timeout expired and another receiver claimed the message.
+func (q *Queue) Ack(m *Message) error {
+	db := q.db
+	_, err := db.DeleteItemIf(q.Domain, m.ID, Condition{Name: "version", Value: m.version, Exists: true})
+	if IsConditionalCheckFailed(err) {
+		return ErrMessageLost
+	}
+	return err
+}
+
+// Nack returns a message to the queue, visible again after delay.
+func (q *Queue) Nack(m *Message, delay time.Duration) error {
+	next, err := q.update(m.ID, m.version, map[string]string{"visible": sortableMillis(time.Now().Add(delay))})
+	if IsConditionalCheckFailed(err) {
+		return ErrMessageLost
+	}
+	m.version = next
+	return err
+}
+
+// DeadLetters returns the messages that exceeded MaxReceives.
+func (q *Queue) DeadLetters() (messages []Message, err error) {
+	db := q.db
+	s := fmt.Sprintf("select * from `%s` where state = 'dead'", q.Domain)
+	token := ""
+	for {
+		var r SelectResponse
+		r, err = db.SelectWithToken(s, token)
+		if err != nil {
+			return
+		}
+		for _, i := range r.Items {
+			body, _, err := i.Chunked("body")
+			if err != nil {
+				return nil, err
+			}
+			receives, _ := strconv.Atoi(i.Value("receives"))
+			messages = append(messages, Message{ID: i.Name, Body: body, ReceiveCount: receives, version: i.Value("version")})
+		}
+		if r.NextToken == "" {
+			return
+		}
+		token = r.NextToken
+	}
+}
+
+// Redrive moves a dead letter back to the queue with its receive count reset.
+func (q *Queue) Redrive(m *Message) error {
+	_, err := q.update(m.ID, m.version, map[string]string{
+		"state":    "ready",
+		"visible":  sortableMillis(time.Now()),
+		"receives": "0",
+	})
+	return err
+}
+
+// update replaces attrs and bumps the version if the stored version is still
+// version, it returns the new version.
+func (q *Queue) update(id string, version string, attrs map[string]string) (next string, err error) {
+	v, err := strconv.Atoi(version)
+	if err != nil {
+		return
+	}
+	next = strconv.Itoa(v + 1)
+	i := NewItem(id)
+	for name, value := range attrs {
+		i.ReplaceAttribute(name, value)
+	}
+	i.ReplaceAttribute("version", next)
+	db := q.db
+	_, err = db.PutAttributesIf(q.Domain, i, Condition{Name: "version", Value: version, Exists: true})
+	return
+}
+
+// sortableMillis zero pads Unix milliseconds so string order matches time order.
+func sortableMillis(t time.Time) string {
+	return fmt.Sprintf("%015d", t.UnixNano()/int64(time.Millisecond))
+}
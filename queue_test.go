@@ -0,0 +1,74 @@
+package sdb_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestQueue(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	if _, err := db.CreateDomain("queue"); err != nil {
+		t.Fatal(err)
+	}
+	q := sdb.NewQueue(db, "queue")
+	q.MaxReceives = 2
+
+	long := strings.Repeat("x", 2000)
+	if _, err := q.Enqueue(long); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.EnqueueDelayed("later", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := q.Dequeue(time.Hour)
+	if err != nil || m == nil || m.Body != long || m.ReceiveCount != 1 {
+		t.Fatalf("Dequeue = %+v, %v", m, err)
+	}
+	// The message is hidden and the other one is delayed.
+	if m2, err := q.Dequeue(time.Hour); err != nil || m2 != nil {
+		t.Fatalf("Dequeue of hidden messages = %+v, %v", m2, err)
+	}
+
+	// A second receiver claiming the same version loses the message.
+	stale := *m
+	if err := q.Nack(m, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Ack(&stale); err != sdb.ErrMessageLost {
+		t.Fatalf("Ack of a stale message returned %v", err)
+	}
+
+	m, err = q.Dequeue(0)
+	if err != nil || m == nil || m.ReceiveCount != 2 {
+		t.Fatalf("second Dequeue = %+v, %v", m, err)
+	}
+	// The third receive exceeds MaxReceives and moves the message to the
+	// dead letters.
+	if m, err = q.Dequeue(0); err != nil || m != nil {
+		t.Fatalf("Dequeue past MaxReceives = %+v, %v", m, err)
+	}
+	dead, err := q.DeadLetters()
+	if err != nil || len(dead) != 1 || dead[0].Body != long {
+		t.Fatalf("DeadLetters = %+v, %v", dead, err)
+	}
+
+	if err := q.Redrive(&dead[0]); err != nil {
+		t.Fatal(err)
+	}
+	m, err = q.Dequeue(time.Hour)
+	if err != nil || m == nil || m.ReceiveCount != 1 {
+		t.Fatalf("Dequeue after Redrive = %+v, %v", m, err)
+	}
+	if err := q.Ack(m); err != nil {
+		t.Fatal(err)
+	}
+	if dead, err = q.DeadLetters(); err != nil || len(dead) != 0 {
+		t.Fatalf("DeadLetters after Ack = %+v, %v", dead, err)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"fmt"
+)
+
+// QuotaCheck makes BatchPutAttributes compare the cached domain metadata,
+// plus the size of the batch, with the domain limits before writing.
+type QuotaCheck struct {
+	Metadata *DomainMetadataCache
+	// WarnAt is the fraction of a limit at which OnWarning is called, 0
+	// never warns.
+	WarnAt float64
+	// FailAt is the fraction of a limit at which the write is refused with a
+	// QuotaError, 0 never refuses.
+	FailAt float64
+	// OnWarning receives every limit crossing WarnAt, typically to emit a
+	// metric or log line.
+	OnWarning func(LimitWarning)
+}
+
+// QuotaError is returned by BatchPutAttributes when the write would take the
+// domain past the FailAt fraction of a limit.
+type QuotaError struct {
+	LimitWarning
+}
+
+func (e QuotaError) Error() string {
+	return "write refused: " + e.LimitWarning.String()
+}
+
+// projectedMetadata adds the names and values of items to r. Attribute names
+// are counted as if new, which overestimates for existing names.
+func projectedMetadata(r DomainMetadataResponse, items []*Item) DomainMetadataResponse {
+	for _, i := range items {
+		r.ItemNamesSizeBytes += int64(len(i.Name))
+		for _, a := range i.Attributes {
+			r.AttributeNamesSizeBytes += int64(len(a.Name))
+			r.AttributeValuesSizeBytes += int64(len(a.Value))
+			r.AttributeValueCount++
+		}
+	}
+	return r
+}
+
+func (sdb *SimpleDB) checkQuota(domain string, items []*Item) error {
+	q := sdb.Quota
+	if q == nil || q.Metadata == nil {
+		return nil
+	}
+	r, err := q.Metadata.DomainMetadata(domain)
+	if err != nil {
+		return fmt.Errorf("quota check: %v", err)
+	}
+	r = projectedMetadata(r, items)
+	if q.FailAt > 0 {
+		if w := CheckDomainLimits(domain, r, q.FailAt); len(w) > 0 {
+			return QuotaError{w[0]}
+		}
+	}
+	if q.OnWarning != nil && q.WarnAt > 0 {
+		for _, w := range CheckDomainLimits(domain, r, q.WarnAt) {
+			q.OnWarning(w)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package sdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuotaCheck(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	m := NewDomainMetadataCache(c, time.Hour)
+	m.entries["full"] = cachedMetadata{r: DomainMetadataResponse{AttributeValueCount: MaxDomainAttributes - 3}, fetched: time.Now()}
+	m.entries["busy"] = cachedMetadata{r: DomainMetadataResponse{AttributeValuesSizeBytes: MaxDomainSizeBytes * 85 / 100}, fetched: time.Now()}
+	var warnings []LimitWarning
+	c.Quota = &QuotaCheck{Metadata: m, WarnAt: 0.8, FailAt: 1, OnWarning: func(w LimitWarning) {
+		warnings = append(warnings, w)
+	}}
+
+	i := NewItem("i")
+	i.AddAttribute("a", "1")
+	i.AddAttribute("b", "2")
+	if err := c.checkQuota("full", []*Item{i}); err != nil {
+		t.Error(err)
+	}
+	i.AddAttribute("c", "x")
+	if _, ok := c.checkQuota("full", []*Item{i}).(QuotaError); !ok {
+		t.Error("Expected QuotaError when the batch passes the attribute limit")
+	}
+	if len(warnings) != 1 || warnings[0].Limit != "attribute" {
+		t.Errorf("%v", warnings)
+	}
+
+	warnings = nil
+	if _, err := c.BatchPutAttributes("full", []*Item{i}); err == nil {
+		t.Error("Expected BatchPutAttributes to be refused")
+	}
+	if err := c.checkQuota("busy", []*Item{i}); err != nil || len(warnings) != 1 || warnings[0].Limit != "size" {
+		t.Error(warnings, err)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReadRepair detects eventually consistent reads that miss a write this
+// process made shortly before. Writes of items with a version attribute are
+// remembered for Window, a GetAttributes returning an older version is
+// repeated with ConsistentRead. With Rewrite the consistent result is also
+// put back, conditional on its version, to push it to lagging replicas.
+type ReadRepair struct {
+	VersionAttribute string
+	Window           time.Duration
+	Rewrite          bool
+	mu               sync.Mutex
+	writes           map[string]localWrite
+}
+
+type localWrite struct {
+	version string
+	at      time.Time
+}
+
+func NewReadRepair(versionAttribute string, window time.Duration) *ReadRepair {
+	return &ReadRepair{VersionAttribute: versionAttribute, Window: window, writes: make(map[string]localWrite)}
+}
+
+// compareVersions compares versions numerically when both are integers and
+// as strings otherwise.
+func compareVersions(a, b string) int {
+	na, errA := strconv.ParseInt(a, 10, 64)
+	nb, errB := strconv.ParseInt(b, 10, 64)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	switch {
+	case na < nb:
+		return -1
+	case na > nb:
+		return 1
+	}
+	return 0
+}
+
+func (rr *ReadRepair) recordWrite(domain string, items ...*Item) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	now := time.Now()
+	for k, w := range rr.writes {
+		if now.Sub(w.at) > rr.Window {
+			delete(rr.writes, k)
+		}
+	}
+	for _, i := range items {
+		v := i.Value(rr.VersionAttribute)
+		if v == "" {
+			continue
+		}
+		k := domain + "\x00" + i.Name
+		if w, ok := rr.writes[k]; !ok || compareVersions(v, w.version) >= 0 {
+			rr.writes[k] = localWrite{version: v, at: now}
+		}
+	}
+}
+
+// stale reports whether attrs are older than a recent local write.
+func (rr *ReadRepair) stale(domain string, itemName string, attrs []Attribute) bool {
+	rr.mu.Lock()
+	w, ok := rr.writes[domain+"\x00"+itemName]
+	rr.mu.Unlock()
+	if !ok || time.Since(w.at) > rr.Window {
+		return false
+	}
+	read := Item{Attributes: attrs}
+	return compareVersions(read.Value(rr.VersionAttribute), w.version) < 0
+}
+
+// repair rereads a stale item consistently and optionally writes it back.
+func (sdb *SimpleDB) repair(domain string, itemName string, r GetAttributesResponse) (GetAttributesResponse, error) {
+	rr := sdb.Repair
+	if rr == nil || sdb.p.Get("ConsistentRead") != "" || !rr.stale(domain, itemName, r.Attributes) {
+		return r, nil
+	}
+	db := *sdb
+	db.ConsistentRead = true
+	db.Repair = nil
+	cr, err := db.getAttributes(domain, itemName, true)
+	if err != nil {
+		return r, err
+	}
+	if rr.Rewrite && len(cr.Attributes) > 0 {
+		i := Item{Name: itemName}
+		for _, a := range cr.Attributes {
+			i.ReplaceAttribute(a.Name, a.Value)
+		}
+		c := Condition{Name: rr.VersionAttribute, Value: i.Value(rr.VersionAttribute), Exists: true}
+		if _, err = db.PutAttributesIf(domain, &i, c); err != nil && !IsConditionalCheckFailed(err) {
+			return cr, err
+		}
+	}
+	return cr, nil
+}
@@ -0,0 +1,36 @@
+package sdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReadRepair(t *testing.T) {
+	rr := NewReadRepair("version", time.Minute)
+	i := NewItem("u1")
+	i.AddAttribute("version", "10")
+	rr.recordWrite("users", i)
+
+	tests := []struct {
+		domain string
+		attrs  []Attribute
+		stale  bool
+	}{
+		{"users", []Attribute{{Name: "version", Value: "9"}}, true},
+		{"users", nil, true},
+		{"users", []Attribute{{Name: "version", Value: "10"}}, false},
+		{"users", []Attribute{{Name: "version", Value: "11"}}, false},
+		{"other", []Attribute{{Name: "version", Value: "9"}}, false},
+	}
+	for _, tt := range tests {
+		if s := rr.stale(tt.domain, "u1", tt.attrs); s != tt.stale {
+			t.Errorf("stale(%s, %v) = %v", tt.domain, tt.attrs, s)
+		}
+	}
+
+	rr.Window = 0
+	time.Sleep(time.Millisecond)
+	if rr.stale("users", "u1", nil) {
+		t.Error("Writes older than Window should be forgotten")
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrNoCapture is returned by ParseCapture when no request parameters are
+// found.
+var ErrNoCapture = errors.New("sdb: no request parameters in capture")
+
+// signing parameters are replaced when a captured request is re-signed.
+var signingParameters = []string{"AWSAccessKeyId", "Signature", "SignatureMethod", "SignatureVersion", "Timestamp", "Expires"}
+
+// ParseCapture returns the action parameters of a captured request, given
+// either as RawRequest or as the output of DebugDump. Credentials, the
+// signature and the timestamp are dropped.
+func ParseCapture(s string) (p url.Values, err error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "\nParameters:\n") {
+		p = make(url.Values)
+		sc := bufio.NewScanner(strings.NewReader(s[strings.Index(s, "\nParameters:\n")+len("\nParameters:\n"):]))
+		for sc.Scan() {
+			line := sc.Text()
+			if !strings.HasPrefix(line, "  ") {
+				break
+			}
+			k, v, _ := strings.Cut(strings.TrimPrefix(line, "  "), "=")
+			p.Add(k, v)
+		}
+	} else if p, err = url.ParseQuery(s); err != nil {
+		return
+	}
+	for _, k := range signingParameters {
+		p.Del(k)
+	}
+	if p.Get("Action") == "" {
+		return nil, ErrNoCapture
+	}
+	return
+}
+
+// Replay re-signs a captured request with the client's credentials and
+// sends it, to reproduce a production request. A non-empty domain replaces
+// the captured DomainName, and for a Select the domain in the expression
+// must be changed by the caller. The request is refused like any other by
+// the client's ActionPolicy and AttributePolicy. The raw response is
+// returned and left in RawResponse, with hidden attributes removed and Masks
+// applied.
+func (sdb *SimpleDB) Replay(capture string, domain string) (raw string, err error) {
+	p, err := ParseCapture(capture)
+	if err != nil {
+		return
+	}
+	if domain != "" && p.Get("DomainName") != "" {
+		p.Set("DomainName", domain)
+	}
+	action := p.Get("Action")
+	if err = sdb.Policy.checkWrite(action, replayItems(p)...); err != nil {
+		return
+	}
+	if action == "Select" {
+		if err = sdb.checkSelect(p.Get("SelectExpression"), true); err != nil {
+			return
+		}
+	}
+	sdb.resetParameters()
+	for k, vs := range p {
+		sdb.p[k] = vs
+	}
+	var r Response
+	if err = sdb.post(&r); err != nil {
+		return sdb.RawResponse, err
+	}
+	return sdb.filterReplay(action)
+}
+
+// replayItems returns the items written by the captured request p.
+func replayItems(p url.Values) (items []*Item) {
+	item := func(prefix string) *Item {
+		i := &Item{Name: p.Get(prefix + "ItemName")}
+		for n := 1; p.Has(prefix + "Attribute." + strconv.Itoa(n) + ".Name"); n++ {
+			o := prefix + "Attribute." + strconv.Itoa(n)
+			i.Attributes = append(i.Attributes, Attribute{Name: p.Get(o + ".Name"), Value: p.Get(o + ".Value")})
+		}
+		return i
+	}
+	switch p.Get("Action") {
+	case "PutAttributes", "DeleteAttributes":
+		items = append(items, item(""))
+	case "BatchPutAttributes", "BatchDeleteAttributes":
+		for m := 1; p.Has("Item." + strconv.Itoa(m) + ".ItemName"); m++ {
+			items = append(items, item("Item."+strconv.Itoa(m)+"."))
+		}
+	}
+	return
+}
+
+// filterReplay applies the Policy and Masks to the response of a replayed
+// read, replacing RawResponse. RawResponse is cleared if the response can
+// not be filtered.
+func (sdb *SimpleDB) filterReplay(action string) (raw string, err error) {
+	if !sdb.Policy.hides() && len(sdb.Masks) == 0 {
+		return sdb.RawResponse, nil
+	}
+	body := []byte(sdb.RawResponse)
+	sdb.RawResponse = ""
+	filter := func(attrs []Attribute) []Attribute {
+		return sdb.Masks.attributes(sdb.Policy.attributes(attrs))
+	}
+	var v interface{}
+	switch action {
+	case "GetAttributes":
+		var r GetAttributesResponse
+		if err = xml.Unmarshal(body, &r); err != nil {
+			return
+		}
+		r.Attributes = filter(r.Attributes)
+		v = r
+	case "Select":
+		var r SelectResponse
+		if err = xml.Unmarshal(body, &r); err != nil {
+			return
+		}
+		for j := range r.Items {
+			r.Items[j].Attributes = filter(r.Items[j].Attributes)
+		}
+		v = r
+	default:
+		sdb.RawResponse = string(body)
+		return sdb.RawResponse, nil
+	}
+	out, err := xml.Marshal(v)
+	if err != nil {
+		return
+	}
+	sdb.RawResponse = string(out)
+	return sdb.RawResponse, nil
+}
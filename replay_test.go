@@ -0,0 +1,84 @@
+package sdb
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type captureTransport struct {
+	body string
+}
+
+func (c *captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b, _ := io.ReadAll(req.Body)
+	c.body = string(b)
+	return &http.Response{StatusCode: 200, Status: "200 OK", Body: io.NopCloser(bytes.NewBufferString("<GetAttributesResponse/>")), Request: req}, nil
+}
+
+func TestReplay(t *testing.T) {
+	ct := &captureTransport{}
+	prod := NewSimpleDB("prodkey", "prodsecret", SDBRegionEUWest1)
+	prod.HTTPClient = &http.Client{Transport: ct}
+	if _, err := prod.GetAttributes("orders", "o-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, capture := range map[string]string{"raw": prod.RawRequest, "dump": prod.DebugDump(nil)} {
+		test := NewSimpleDB("testkey", "testsecret", SDBRegionEUWest1)
+		test.HTTPClient = &http.Client{Transport: ct}
+		raw, err := test.Replay(capture, "test-orders")
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if raw != "<GetAttributesResponse/>" {
+			t.Errorf("%s: raw response %q", name, raw)
+		}
+		p, _ := url.ParseQuery(ct.body)
+		if p.Get("Action") != "GetAttributes" || p.Get("ItemName") != "o-1" || p.Get("DomainName") != "test-orders" {
+			t.Errorf("%s: replayed %v", name, p)
+		}
+		if p.Get("AWSAccessKeyId") != "testkey" || ct.body != test.SignRequest(p) {
+			t.Errorf("%s: not re-signed with the test credentials: %v", name, p)
+		}
+	}
+
+	if _, err := ParseCapture("Endpoint: x\n"); err != ErrNoCapture {
+		t.Errorf("ParseCapture of empty dump = %v", err)
+	}
+}
+
+func TestReplayPolicy(t *testing.T) {
+	it := &itemTransport{attrs: []Attribute{{Name: "name", Value: "Ann"}, {Name: "ssn", Value: "123-45"}, {Name: "card", Value: "4111"}}}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: it}
+	c.Policy = AttributePolicy{"ssn": Hidden, "name": ReadOnly}
+	c.Masks = Masks{"card": MaskRedact}
+
+	raw, err := c.Replay("Action=GetAttributes&DomainName=users&ItemName=u1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(raw, "123-45") || strings.Contains(raw, "4111") || !strings.Contains(raw, "Ann") || c.RawResponse != raw {
+		t.Errorf("replayed read not filtered: %s", raw)
+	}
+	if raw, err = c.Replay("Action=Select&SelectExpression=select+*+from+users", ""); err != nil || strings.Contains(raw, "123-45") {
+		t.Errorf("replayed select not filtered: %s %v", raw, err)
+	}
+	if _, err = c.Replay("Action=Select&SelectExpression=select+*+from+users+where+ssn+%3D+'1'", ""); err == nil {
+		t.Error("Expected a select on a hidden attribute to be refused")
+	}
+	if _, err = c.Replay("Action=PutAttributes&DomainName=users&ItemName=u1&Attribute.1.Name=name&Attribute.1.Value=Bob", ""); err == nil {
+		t.Error("Expected a write to a read-only attribute to be refused")
+	}
+	ro := c.WithReadOnly()
+	if _, err = ro.Replay("Action=DeleteAttributes&DomainName=users&ItemName=u2", ""); err == nil {
+		t.Error("Expected a read-only client to refuse a replayed delete")
+	}
+	if it.attrs[0].Value != "Ann" {
+		t.Errorf("refused replay was sent: %+v", it.attrs)
+	}
+}
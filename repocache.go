@@ -0,0 +1,122 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"container/list"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RepositoryCache caches the query pages of the Repositories it is set on.
+// Every domain has a generation counter that the Repositories bump when they
+// write to it, pages are cached under the generation they were read at and
+// are not used once it changes, so no invalidation calls are needed. Writes
+// made outside the Repositories sharing the cache are only seen after TTL.
+// The least recently used pages are evicted beyond MaxEntries.
+type RepositoryCache struct {
+	TTL         time.Duration
+	MaxEntries  int
+	mu          sync.Mutex
+	generations map[string]uint64
+	lru         *list.List
+	entries     map[string]*list.Element
+}
+
+type repositoryCacheEntry struct {
+	key     string
+	items   []Item
+	next    string
+	expires time.Time
+}
+
+// NewRepositoryCache returns an empty cache, see RepositoryCache.
+func NewRepositoryCache(ttl time.Duration, maxEntries int) *RepositoryCache {
+	return &RepositoryCache{TTL: ttl, MaxEntries: maxEntries, generations: make(map[string]uint64), lru: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Generation returns the current generation of domain.
+func (c *RepositoryCache) Generation(domain string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generations[domain]
+}
+
+// Bump starts a new generation of domain, pages cached before are not used
+// anymore.
+func (c *RepositoryCache) Bump(domain string) {
+	c.mu.Lock()
+	c.generations[domain]++
+	c.mu.Unlock()
+}
+
+// key returns the cache key of a page of q, read into values of type typ,
+// at the current generation.
+func (c *RepositoryCache) key(domain, typ, q, token string, consistent bool) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return domain + "\x00" + strconv.FormatUint(c.generations[domain], 10) + "\x00" + typ + "\x00" + selectCacheKey(q, token, consistent)
+}
+
+// get returns a copy of the items cached under key.
+func (c *RepositoryCache) get(key string) (items []Item, next string, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	entry := e.Value.(*repositoryCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(e)
+		return nil, "", false
+	}
+	c.lru.MoveToFront(e)
+	return copyItems(entry.items), entry.next, true
+}
+
+// put caches a copy of items under key.
+func (c *RepositoryCache) put(key string, items []Item, next string) {
+	items = copyItems(items)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	c.entries[key] = c.lru.PushFront(&repositoryCacheEntry{key: key, items: items, next: next, expires: time.Now().Add(c.TTL)})
+	for c.MaxEntries > 0 && c.lru.Len() > c.MaxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *RepositoryCache) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.entries, e.Value.(*repositoryCacheEntry).key)
+}
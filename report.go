@@ -0,0 +1,154 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// SimpleDB bills storage as the raw size of names and values plus
+// StorageOverheadBytes for every item, attribute name and value, at
+// StoragePricePerGBMonth. Adjust the price for the region.
+var (
+	StorageOverheadBytes   int64 = 45
+	StoragePricePerGBMonth       = 0.25
+)
+
+// ReportConcurrency is the number of DomainMetadata calls Report makes at
+// once.
+var ReportConcurrency = 8
+
+type DomainUsage struct {
+	Domain          string
+	Items           int64
+	AttributeNames  int64
+	AttributeValues int64
+	// Bytes is the size counted against the domain limit, BillableBytes
+	// adds the storage overhead.
+	Bytes         int64
+	BillableBytes int64
+}
+
+// UsageReport summarizes the domains of an account, ordered by name.
+type UsageReport struct {
+	Domains       []DomainUsage
+	Items         int64
+	Bytes         int64
+	BillableBytes int64
+}
+
+// MonthlyCost estimates the storage cost of the account in dollars.
+func (r UsageReport) MonthlyCost() float64 {
+	return float64(r.BillableBytes) / (1 << 30) * StoragePricePerGBMonth
+}
+
+func domainUsage(domain string, m DomainMetadataResponse) DomainUsage {
+	return DomainUsage{
+		Domain:          domain,
+		Items:           m.ItemCount,
+		AttributeNames:  m.AttributeNameCount,
+		AttributeValues: m.AttributeValueCount,
+		Bytes:           m.SizeBytes(),
+		BillableBytes:   m.SizeBytes() + StorageOverheadBytes*(m.ItemCount+m.AttributeNameCount+m.AttributeValueCount),
+	}
+}
+
+// Report lists every domain and fetches its metadata concurrently. The
+// first error stops the report.
+func (sdb *SimpleDB) Report(ctx context.Context) (r UsageReport, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	names, err := sdb.ListDomainsPager().All(ctx)
+	if err != nil {
+		return
+	}
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, max(ReportConcurrency, 1))
+	)
+	r.Domains = make([]DomainUsage, len(names))
+	for j, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			db := sdb.WithContext(ctx)
+			m, merr := db.DomainMetadata(name)
+			mu.Lock()
+			defer mu.Unlock()
+			if merr != nil {
+				if err == nil {
+					err = merr
+					cancel()
+				}
+				return
+			}
+			r.Domains[j] = domainUsage(name, m)
+		}()
+	}
+	wg.Wait()
+	if err != nil {
+		return UsageReport{}, err
+	}
+
+	sort.Slice(r.Domains, func(a, b int) bool { return r.Domains[a].Domain < r.Domains[b].Domain })
+	for _, d := range r.Domains {
+		r.Items += d.Items
+		r.Bytes += d.Bytes
+		r.BillableBytes += d.BillableBytes
+	}
+	return
+}
+
+// WriteTable writes the report as an aligned table with a total row.
+func (r UsageReport) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "DOMAIN\tITEMS\tATTR NAMES\tATTR VALUES\tBYTES\tBILLABLE BYTES\t")
+	for _, d := range r.Domains {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t\n", d.Domain, d.Items, d.AttributeNames, d.AttributeValues, d.Bytes, d.BillableBytes)
+	}
+	fmt.Fprintf(tw, "total (%d domains)\t%d\t\t\t%d\t%d\t\n", len(r.Domains), r.Items, r.Bytes, r.BillableBytes)
+	fmt.Fprintf(tw, "est. monthly cost\t$%.2f\t\t\t\t\t\n", r.MonthlyCost())
+	return tw.Flush()
+}
+
+func (r UsageReport) String() string {
+	var b strings.Builder
+	r.WriteTable(&b)
+	return b.String()
+}
@@ -0,0 +1,52 @@
+package sdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type reportTransport struct{}
+
+func (reportTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b, _ := io.ReadAll(req.Body)
+	p, _ := url.ParseQuery(string(b))
+	var body string
+	switch p.Get("Action") {
+	case "ListDomains":
+		body = "<ListDomainsResponse><ListDomainsResult><DomainName>orders</DomainName><DomainName>users</DomainName></ListDomainsResult></ListDomainsResponse>"
+	case "DomainMetadata":
+		n := int64(10)
+		if p.Get("DomainName") == "orders" {
+			n = 1000
+		}
+		body = fmt.Sprintf("<DomainMetadataResponse><DomainMetadataResult><ItemCount>%d</ItemCount><ItemNamesSizeBytes>%d</ItemNamesSizeBytes>"+
+			"<AttributeNameCount>2</AttributeNameCount><AttributeNamesSizeBytes>10</AttributeNamesSizeBytes>"+
+			"<AttributeValueCount>%d</AttributeValueCount><AttributeValuesSizeBytes>%d</AttributeValuesSizeBytes></DomainMetadataResult></DomainMetadataResponse>", n, n*5, n*2, n*20)
+	}
+	return &http.Response{StatusCode: 200, Status: "200 OK", Body: io.NopCloser(bytes.NewBufferString(body)), Request: req}, nil
+}
+
+func TestReport(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: reportTransport{}}
+	r, err := c.Report(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Domains) != 2 || r.Domains[0].Domain != "orders" || r.Items != 1010 {
+		t.Fatalf("%+v", r)
+	}
+	// 5000+10+20000 raw bytes plus 45 for each of 1000 items, 2 names and 2000 values
+	if d := r.Domains[0]; d.Bytes != 25010 || d.BillableBytes != 25010+45*3002 {
+		t.Errorf("%+v", d)
+	}
+	if s := r.String(); !strings.Contains(s, "total (2 domains)") || !strings.Contains(s, "$0.00") {
+		t.Error(s)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+)
+
+// Repository stores structs of type T, tagged as for MarshalItem, in one
+// domain. The batch methods write up to 25 items per call and read with
+// GetByNames, so typed code makes as few calls as the item API.
+type Repository[T any] struct {
+	Domain string
+	// Cache, when set, caches the pages of QueryPages, see RepositoryCache.
+	Cache *RepositoryCache
+	db    SimpleDB
+}
+
+// NewRepository returns a Repository of the items of domain.
+func NewRepository[T any](db SimpleDB, domain string) *Repository[T] {
+	return &Repository[T]{Domain: domain, db: db}
+}
+
+// Put stores v as with PutStruct.
+func (r *Repository[T]) Put(ctx context.Context, v *T) error {
+	db := r.db.WithContext(ctx)
+	defer r.written()
+	return db.PutStruct(r.Domain, v)
+}
+
+// Get reads the named item, v is nil if it does not exist.
+func (r *Repository[T]) Get(ctx context.Context, name string) (v *T, err error) {
+	db := r.db.WithContext(ctx)
+	v = new(T)
+	found, err := db.GetStruct(r.Domain, name, v)
+	if err != nil || !found {
+		return nil, err
+	}
+	return
+}
+
+// Delete deletes the named item.
+func (r *Repository[T]) Delete(ctx context.Context, name string) error {
+	db := r.db.WithContext(ctx)
+	defer r.written()
+	_, err := db.DeleteItem(r.Domain, name)
+	return err
+}
+
+// PutAll stores vs with BatchPutAttributes, then deletes the attributes of
+// their null fields, and of removed slice elements as PutStruct, with
+// BatchDeleteAttributes. Every value needs an item
+// name, names are not generated as by PutStruct. The batches share the time
+// left before the deadline of ctx, see PartialError.
+func (r *Repository[T]) PutAll(ctx context.Context, vs []*T) (err error) {
+	db := r.db.WithContext(ctx)
+	def := db.domainCodec(r.Domain)
+	var puts, dels, sliced []*Item
+	for _, v := range vs {
+		var i, del *Item
+		if i, err = marshalItem(v, def); err != nil {
+			return
+		}
+		if i.Name == "" {
+			return errors.New("sdb: PutAll needs an item name for every value")
+		}
+		if err = db.validateItemNames(r.Domain, i); err != nil {
+			return
+		}
+		if del, err = marshalDeletes(v, def); err != nil {
+			return
+		}
+		puts = append(puts, i)
+		dels = append(dels, del)
+		if hasElements(i, del) {
+			sliced = append(sliced, i)
+		}
+	}
+	if len(sliced) > 0 {
+		names := make([]string, len(sliced))
+		for j, i := range sliced {
+			names[j] = i.Name
+		}
+		read := db
+		read.ConsistentRead = true
+		var stored []Item
+		if stored, err = read.GetByNames(r.Domain, names); err != nil {
+			return
+		}
+		byName := make(map[string]Item, len(stored))
+		for _, s := range stored {
+			byName[s.Name] = s
+		}
+		for j, i := range puts {
+			for _, name := range staleElements(byName[i.Name], i, dels[j]) {
+				dels[j].AddAttribute(name, "")
+			}
+		}
+	}
+	var deletes []*Item
+	for _, del := range dels {
+		if len(del.Attributes) > 0 {
+			deletes = append(deletes, del)
+		}
+	}
+	defer r.written()
+	b := batches(puts)
+	n := len(b)
+	return runBatches(ctx, "PutAll", append(b, batches(deletes)...), func(ctx context.Context, k int, batch []*Item) (err error) {
+		db := r.db.WithContext(ctx)
+		db.fullPut = true
+		if k < n {
+			_, err = db.BatchPutAttributes(r.Domain, batch)
+		} else {
+			_, err = db.BatchDeleteAttributes(r.Domain, batch)
+		}
+		return
+	})
+}
+
+// GetAll reads the named items with GetByNames, in the order of names.
+// Names without an item are left out.
+func (r *Repository[T]) GetAll(ctx context.Context, names []string) (vs []*T, err error) {
+	db := r.db.WithContext(ctx)
+	items, err := db.GetByNames(r.Domain, names)
+	if err != nil {
+		return
+	}
+	return r.unmarshal(items)
+}
+
+// DeleteAll deletes the named items with BatchDeleteAttributes, sharing
+// the time left before the deadline of ctx as PutAll.
+func (r *Repository[T]) DeleteAll(ctx context.Context, names []string) error {
+	items := make([]*Item, len(names))
+	for j, n := range names {
+		items[j] = &Item{Name: n}
+	}
+	defer r.written()
+	return runBatches(ctx, "DeleteAll", batches(items), func(ctx context.Context, k int, batch []*Item) (err error) {
+		db := r.db.WithContext(ctx)
+		_, err = db.BatchDeleteAttributes(r.Domain, batch)
+		return
+	})
+}
+
+// QueryPages walks the results of q a page at a time. A select * only asks
+// for the attributes of the Projection of T. Pages come from the Cache when
+// one is set and the domain has not been written since, they are cached as
+// items and decoded into new values on every hit. The action policy of the
+// client is checked before the Cache.
+func (r *Repository[T]) QueryPages(q string) *Pager[*T] {
+	db := r.db
+	q = db.projectSelect(q, new(T))
+	return NewPager(func(ctx context.Context, token string) (page Page[*T], err error) {
+		if err = db.allowsSelect(q); err != nil {
+			return
+		}
+		var key string
+		if r.Cache != nil {
+			t := reflect.TypeOf(new(T)).Elem()
+			key = r.Cache.key(r.Domain, t.PkgPath()+"."+t.String(), q, token, db.ConsistentRead)
+			if items, next, ok := r.Cache.get(key); ok {
+				page = Page[*T]{NextToken: next}
+				page.Items, err = r.unmarshal(items)
+				return
+			}
+		}
+		p, err := db.SelectPage(ctx, q, token)
+		if err != nil {
+			return
+		}
+		page = Page[*T]{NextToken: p.NextToken, BoxUsage: p.BoxUsage}
+		if page.Items, err = r.unmarshal(p.Items); err != nil {
+			return
+		}
+		if r.Cache != nil {
+			r.Cache.put(key, p.Items, page.NextToken)
+		}
+		return
+	}).Partial(db.PartialResults)
+}
+
+// written starts a new cache generation after a write, also a failed one
+// as it may have been applied in part.
+func (r *Repository[T]) written() {
+	if r.Cache != nil {
+		r.Cache.Bump(r.Domain)
+	}
+}
+
+func (r *Repository[T]) unmarshal(items []Item) (vs []*T, err error) {
+	def := r.db.domainCodec(r.Domain)
+	for _, i := range items {
+		v := new(T)
+		if err = unmarshalItem(i, v, def); err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+	return
+}
@@ -0,0 +1,131 @@
+package sdb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type repoUser struct {
+	ID   string  `sdb:",itemname"`
+	Name string  `sdb:"name"`
+	Nick *string `sdb:"nick"`
+}
+
+func TestRepositoryBatches(t *testing.T) {
+	at := &actionTransport{}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: at}
+	r := NewRepository[repoUser](c, "users")
+	ctx := context.Background()
+
+	var users []*repoUser
+	var names []string
+	for j := 0; j < 30; j++ {
+		u := &repoUser{ID: "u" + strconv.Itoa(j), Name: "N"}
+		users = append(users, u)
+		names = append(names, u.ID)
+	}
+	if err := r.PutAll(ctx, users); err != nil {
+		t.Fatal(err)
+	}
+	if len(at.calls) != 4 {
+		t.Fatalf("Expected 2 puts and 2 deletes, got %d calls", len(at.calls))
+	}
+	if at.calls[1].Get("Action") != "BatchPutAttributes" || at.calls[1].Get("Item.5.ItemName") != "u29" {
+		t.Errorf("Unexpected put %v", at.calls[1])
+	}
+	if at.calls[2].Get("Action") != "BatchDeleteAttributes" || at.calls[2].Get("Item.1.Attribute.1.Name") != "nick" {
+		t.Errorf("Unexpected delete %v", at.calls[2])
+	}
+
+	at.calls = nil
+	if err := r.DeleteAll(ctx, names); err != nil {
+		t.Fatal(err)
+	}
+	if len(at.calls) != 2 || at.calls[0].Get("Item.25.ItemName") != "u24" || at.calls[0].Get("Item.1.Attribute.1.Name") != "" {
+		t.Errorf("Unexpected calls %v", at.calls)
+	}
+	if err := r.PutAll(ctx, []*repoUser{{Name: "x"}}); err == nil {
+		t.Error("Expected error for a value without item name")
+	}
+}
+
+func TestRepositoryReads(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: &policyTransport{}}
+	r := NewRepository[repoUser](c, "users")
+	ctx := context.Background()
+
+	us, err := r.GetAll(ctx, []string{"u1", "u2"})
+	if err != nil || len(us) != 1 || us[0].Name != "Ann" {
+		t.Errorf("Unexpected %v %v", us, err)
+	}
+	us, err = r.QueryPages("select * from users").All(ctx)
+	if err != nil || len(us) != 1 || us[0].ID != "u1" {
+		t.Errorf("Unexpected %v %v", us, err)
+	}
+}
+
+func TestRepositoryCache(t *testing.T) {
+	pt := &policyTransport{}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: pt}
+	r := NewRepository[repoUser](c, "users")
+	r.Cache = NewRepositoryCache(time.Minute, 10)
+	ctx := context.Background()
+	q := "select * from users"
+
+	us, err := r.QueryPages(q).All(ctx)
+	if err != nil || len(us) != 1 {
+		t.Fatal(us, err)
+	}
+	us[0].Name = "changed"
+	if us, err = r.QueryPages(q).All(ctx); err != nil || len(us) != 1 || us[0].Name != "Ann" || pt.calls != 1 {
+		t.Errorf("Expected cached page, got %v %v after %d calls", us, err, pt.calls)
+	}
+
+	if err = r.Put(ctx, &repoUser{ID: "u2", Name: "Bo"}); err != nil {
+		t.Fatal(err)
+	}
+	if r.Cache.Generation("users") != 1 {
+		t.Errorf("Expected generation 1, got %d", r.Cache.Generation("users"))
+	}
+	if _, err = r.QueryPages(q).All(ctx); err != nil || pt.calls != 4 {
+		t.Errorf("Expected a new Select after the write, got %d calls", pt.calls)
+	}
+
+	// repositories of other types and consistent reads do not share pages
+	type label struct {
+		ID   string `sdb:",itemname"`
+		Text string `sdb:"name"`
+	}
+	q = "select name from users"
+	if _, err = r.QueryPages(q).All(ctx); err != nil {
+		t.Fatal(err)
+	}
+	labels := NewRepository[label](c, "users")
+	labels.Cache = r.Cache
+	ls, err := labels.QueryPages(q).All(ctx)
+	if err != nil || len(ls) != 1 || ls[0].Text != "Ann" || pt.calls != 6 {
+		t.Errorf("Expected a Select for the other type, got %v %v after %d calls", ls, err, pt.calls)
+	}
+	consistent := c
+	consistent.ConsistentRead = true
+	cr := NewRepository[repoUser](consistent, "users")
+	cr.Cache = r.Cache
+	if _, err = cr.QueryPages(q).All(ctx); err != nil || pt.calls != 7 {
+		t.Errorf("Expected a consistent Select, got %d calls", pt.calls)
+	}
+
+	// cached pages must not reach clients whose policy refuses the select
+	denied := NewRepository[repoUser](c.WithActionPolicy(ActionPolicy{Deny: []ActionRule{{Actions: []string{"Select"}, Domains: []string{"users"}}}}), "users")
+	denied.Cache = r.Cache
+	var ae ActionError
+	if _, err = denied.QueryPages(q).All(ctx); !errors.As(err, &ae) || pt.calls != 7 {
+		t.Errorf("Expected an ActionError without a call, got %v after %d calls", err, pt.calls)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"reflect"
+	"sync"
+)
+
+type requestIdsKey struct{}
+
+type requestIds struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+// WithRequestIds returns a context that records the RequestId of every call
+// made by a client bound to it with WithContext, so the SimpleDB calls of a
+// user action can be logged with it.
+func WithRequestIds(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestIdsKey{}, &requestIds{})
+}
+
+// RequestIds returns the RequestIds recorded in ctx so far, in call order.
+func RequestIds(ctx context.Context) []string {
+	r, ok := ctx.Value(requestIdsKey{}).(*requestIds)
+	if !ok {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.ids...)
+}
+
+// RequestId returns the RequestId of an error or response returned by the
+// client, or "" if it has none.
+func RequestId(v interface{}) string {
+	switch e := v.(type) {
+	case SimpleDBError:
+		return e.RequestId
+	case error:
+		return ""
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return ""
+	}
+	m := rv.FieldByName("ResponseMetadata")
+	if !m.IsValid() {
+		return ""
+	}
+	if md, ok := m.Interface().(ResponseMetadata); ok {
+		return md.RequestId
+	}
+	return ""
+}
+
+// LastRequestId returns the RequestId of the client's last call.
+func (sdb *SimpleDB) LastRequestId() string {
+	return sdb.requestId
+}
+
+func (sdb *SimpleDB) recordRequestId(v interface{}, err error) {
+	if err != nil {
+		sdb.requestId = RequestId(err)
+	} else {
+		sdb.requestId = RequestId(v)
+	}
+	if sdb.requestId == "" || sdb.ctx == nil {
+		return
+	}
+	if r, ok := sdb.ctx.Value(requestIdsKey{}).(*requestIds); ok {
+		r.mu.Lock()
+		r.ids = append(r.ids, sdb.requestId)
+		r.mu.Unlock()
+	}
+}
@@ -0,0 +1,20 @@
+package sdb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRequestIds(t *testing.T) {
+	ctx := WithRequestIds(context.Background())
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1).WithContext(ctx)
+	c.recordRequestId(&PutAttributesResponse{ResponseMetadata: ResponseMetadata{RequestId: "r1"}}, nil)
+	c.recordRequestId(nil, SimpleDBError{Code: "AuthFailure", RequestId: "r2"})
+	c.recordRequestId(nil, &RequestError{})
+	if ids := RequestIds(ctx); len(ids) != 2 || ids[1] != "r2" {
+		t.Error(ids)
+	}
+	if c.LastRequestId() != "" {
+		t.Error("Expected last RequestId to be cleared by a call without one")
+	}
+}
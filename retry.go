@@ -0,0 +1,177 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryBaseDelay is the delay before the first retry, it doubles with every
+// further attempt and is jittered. Set the client's Backoff to change the
+// strategy.
+var RetryBaseDelay = 100 * time.Millisecond
+
+// MaxRetryAfter caps the delay taken from a Retry-After header.
+var MaxRetryAfter = 30 * time.Second
+
+// RetryEvent describes a retry about to be made, see OnRetry. Attempt is the
+// number of the attempt that failed with Err and Delay the wait before the
+// next one.
+type RetryEvent struct {
+	Action  string
+	Domain  string
+	Attempt int
+	Err     error
+	Delay   time.Duration
+}
+
+// ErrOutcomeUnknown is wrapped by the RequestError of a conditional write
+// that failed without a response, for example by timing out. The write may
+// have been applied, so it is not retried: a retry would fail its condition
+// even though the first attempt succeeded. Read the item to find out.
+var ErrOutcomeUnknown = errors.New("outcome of the conditional write is unknown")
+
+// RequestError is returned when a request fails without a SimpleDB error
+// response, because of a network error or a bare HTTP error status.
+type RequestError struct {
+	Err        error
+	StatusCode int
+	Attempts   int
+	Elapsed    time.Duration
+	RetryAfter time.Duration
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%v (status %d, %d attempts in %v)", e.Err, e.StatusCode, e.Attempts, e.Elapsed)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether err is worth retrying: throttling, 5xx responses
+// and network errors other than context cancellation.
+func Retryable(err error) bool {
+	switch e := err.(type) {
+	case SimpleDBError:
+		return e.StatusCode >= 500 || e.Code == "RequestThrottled" || e.Code == "ServiceUnavailable"
+	case *RequestError:
+		if e.StatusCode != 0 {
+			return e.StatusCode >= 500
+		}
+		return !errors.Is(e.Err, context.Canceled) && !errors.Is(e.Err, context.DeadlineExceeded)
+	}
+	return false
+}
+
+// RetryAfter returns the delay the server asked for before retrying the
+// request that failed with err, 0 when it gave none.
+func RetryAfter(err error) time.Duration {
+	switch e := err.(type) {
+	case SimpleDBError:
+		return e.RetryAfter
+	case *RequestError:
+		return e.RetryAfter
+	}
+	return 0
+}
+
+// outcomeUnknown reports whether err leaves it open if the conditional write
+// being sent was applied, in which case ErrOutcomeUnknown is added to err.
+func (sdb *SimpleDB) outcomeUnknown(err error) bool {
+	e, ok := err.(*RequestError)
+	if !ok || sdb.p.Get("Expected.1.Name") == "" {
+		return false
+	}
+	switch sdb.p.Get("Action") {
+	case "PutAttributes", "DeleteAttributes":
+		e.Err = fmt.Errorf("%w: %w", ErrOutcomeUnknown, e.Err)
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date.
+func parseRetryAfter(h string, now time.Time) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(strings.TrimSpace(h)); err == nil {
+		if s < 0 {
+			return 0
+		}
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// wait sleeps before retry number attempt, returning early with the context's
+// error if it is done. The delay asked for by the server in the response to
+// the failed attempt, up to MaxRetryAfter, replaces the backoff. last is the
+// delay before the previous retry, d the one chosen now.
+func (sdb *SimpleDB) wait(attempt int, last time.Duration, err error) (d time.Duration, werr error) {
+	if d = RetryAfter(err); d > 0 {
+		d = min(d, MaxRetryAfter)
+	} else {
+		d = sdb.backoff(err).Delay(attempt, last)
+	}
+	if sdb.OnRetry != nil {
+		sdb.OnRetry(RetryEvent{Action: sdb.p.Get("Action"), Domain: sdb.requestDomain(), Attempt: attempt, Err: err, Delay: d})
+	}
+	return d, sdb.sleep(d)
+}
+
+// sleep waits for d or until the client's context is done.
+func (sdb *SimpleDB) sleep(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	ctx := sdb.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
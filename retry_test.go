@@ -0,0 +1,107 @@
+package sdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{SimpleDBError{Code: "ServiceUnavailable", StatusCode: 503}, true},
+		{SimpleDBError{Code: "RequestThrottled", StatusCode: 400}, true},
+		{SimpleDBError{Code: "AuthFailure", StatusCode: 403}, false},
+		{&RequestError{Err: errors.New("502 Bad Gateway"), StatusCode: 502}, true},
+		{&RequestError{Err: errors.New("connection reset")}, true},
+		{&RequestError{Err: &url.Error{Op: "Post", Err: context.Canceled}}, false},
+		{errors.New("other"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := Retryable(tt.err); got != tt.want {
+			t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+	tests := []struct {
+		h    string
+		want time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{" 0 ", 0},
+		{"-1", 0},
+		{"Wed, 21 Oct 2015 07:28:05 GMT", 5 * time.Second},
+		{"Wed, 21 Oct 2015 07:27:00 GMT", 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.h, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.h, got, tt.want)
+		}
+	}
+}
+
+type retryAfterTransport struct {
+	calls int
+}
+
+func (rt *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.calls++
+	if rt.calls == 1 {
+		body := "<Response><Errors><Error><Code>ServiceUnavailable</Code><Message>slow down</Message></Error></Errors></Response>"
+		return &http.Response{StatusCode: 503, Status: "503 Service Unavailable", Header: http.Header{"Retry-After": {"120"}},
+			Body: io.NopCloser(bytes.NewBufferString(body)), Request: req}, nil
+	}
+	return &http.Response{StatusCode: 200, Status: "200 OK", Body: io.NopCloser(bytes.NewBufferString("<CreateDomainResponse/>")), Request: req}, nil
+}
+
+func TestRetryAfterHonored(t *testing.T) {
+	defer func(d time.Duration) { MaxRetryAfter = d }(MaxRetryAfter)
+	MaxRetryAfter = 50 * time.Millisecond
+	rt := &retryAfterTransport{}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: rt}
+	c.MaxRetries = 1
+	start := time.Now()
+	if _, err := c.CreateDomain("d"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); rt.calls != 2 || d < MaxRetryAfter {
+		t.Errorf("%d calls in %v, expected a retry after %v", rt.calls, d, MaxRetryAfter)
+	}
+	if got := RetryAfter(SimpleDBError{RetryAfter: time.Second}); got != time.Second {
+		t.Errorf("RetryAfter = %v", got)
+	}
+}
+
+func TestOnRetry(t *testing.T) {
+	defer func(d time.Duration) { MaxRetryAfter = d }(MaxRetryAfter)
+	MaxRetryAfter = time.Millisecond
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: &retryAfterTransport{}}
+	c.MaxRetries = 1
+	var events []RetryEvent
+	c.OnRetry = func(e RetryEvent) { events = append(events, e) }
+	if _, err := c.CreateDomain("d"); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected one retry event, got %v", events)
+	}
+	e := events[0]
+	if e.Action != "CreateDomain" || e.Domain != "d" || e.Attempt != 1 || e.Delay != time.Millisecond || !Throttled(e.Err) {
+		t.Errorf("Unexpected event %+v", e)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Ring is a consistent hash ring. Every node is placed on the ring
+// VirtualNodes times and a key belongs to the first node point at or after
+// its hash, so adding or removing a node only moves the keys of the points
+// next to its own, about 1/n of them.
+type Ring struct {
+	VirtualNodes int
+	Hash         func([]byte) uint64
+	mu           sync.RWMutex
+	points       []ringPoint
+	nodes        []string
+}
+
+type ringPoint struct {
+	hash uint64
+	node string
+}
+
+// RingState is the part of the hash space owned by a node, Share is between
+// 0 and 1.
+type RingState struct {
+	Node   string
+	Points int
+	Share  float64
+}
+
+// NewRing places nodes with virtualNodes points each, 100 if 0, hashed with
+// hash, FNV-1a with a final bit mix if nil.
+func NewRing(virtualNodes int, hash func([]byte) uint64, nodes ...string) *Ring {
+	if virtualNodes <= 0 {
+		virtualNodes = 100
+	}
+	if hash == nil {
+		hash = fnvHash
+	}
+	r := &Ring{VirtualNodes: virtualNodes, Hash: hash}
+	for _, n := range nodes {
+		r.Add(n)
+	}
+	return r
+}
+
+// fnvHash mixes the FNV-1a hash as the murmur3 finalizer does, plain FNV
+// puts keys differing only in their last bytes too close on the ring.
+func fnvHash(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// Add places node on the ring, adding a node twice has no effect.
+func (r *Ring) Add(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, n := range r.nodes {
+		if n == node {
+			return
+		}
+	}
+	r.nodes = append(r.nodes, node)
+	for v := 0; v < r.VirtualNodes; v++ {
+		r.points = append(r.points, ringPoint{r.Hash([]byte(node + "#" + strconv.Itoa(v))), node})
+	}
+	sort.Slice(r.points, func(a, b int) bool { return r.points[a].hash < r.points[b].hash })
+}
+
+// Remove takes node off the ring.
+func (r *Ring) Remove(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var points []ringPoint
+	for _, p := range r.points {
+		if p.node != node {
+			points = append(points, p)
+		}
+	}
+	r.points = points
+	for j, n := range r.nodes {
+		if n == node {
+			r.nodes = append(r.nodes[:j:j], r.nodes[j+1:]...)
+			break
+		}
+	}
+}
+
+// Get returns the node owning key, "" if the ring is empty.
+func (r *Ring) Get(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := r.Hash([]byte(key))
+	j := sort.Search(len(r.points), func(j int) bool { return r.points[j].hash >= h })
+	if j == len(r.points) {
+		j = 0
+	}
+	return r.points[j].node
+}
+
+// Nodes returns the nodes in the order they were added.
+func (r *Ring) Nodes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.nodes...)
+}
+
+// State returns the share of the hash space each node owns, for monitoring
+// how evenly keys are spread.
+func (r *Ring) State() []RingState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	owned := make(map[string]float64)
+	points := make(map[string]int)
+	for j, p := range r.points {
+		// the point owns the hashes after the previous point, wrapping around
+		prev := r.points[(j+len(r.points)-1)%len(r.points)].hash
+		owned[p.node] += float64(p.hash - prev)
+		points[p.node]++
+	}
+	state := make([]RingState, len(r.nodes))
+	for j, n := range r.nodes {
+		share := owned[n] / math.Pow(2, 64)
+		if len(r.nodes) == 1 {
+			share = 1
+		}
+		state[j] = RingState{Node: n, Points: points[n], Share: share}
+	}
+	return state
+}
+
+// clone returns a copy of r that can be changed independently.
+func (r *Ring) clone() *Ring {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return &Ring{VirtualNodes: r.VirtualNodes, Hash: r.Hash, points: append([]ringPoint(nil), r.points...), nodes: append([]string(nil), r.nodes...)}
+}
@@ -0,0 +1,58 @@
+package sdb
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	r := NewRing(0, nil, "a", "b", "c")
+	owner := make(map[string]string)
+	counts := make(map[string]int)
+	for j := 0; j < 3000; j++ {
+		k := "item" + strconv.Itoa(j)
+		owner[k] = r.Get(k)
+		counts[owner[k]]++
+	}
+	for _, n := range []string{"a", "b", "c"} {
+		if counts[n] < 700 || counts[n] > 1300 {
+			t.Errorf("Uneven spread %v", counts)
+		}
+	}
+
+	r.Add("d")
+	moved := 0
+	for k, o := range owner {
+		if n := r.Get(k); n != o {
+			moved++
+			if n != "d" {
+				t.Fatalf("%s moved from %s to %s instead of d", k, o, n)
+			}
+		}
+	}
+	if moved < 450 || moved > 1100 {
+		t.Errorf("Expected about a quarter of the keys to move, %d did", moved)
+	}
+
+	var total float64
+	for _, s := range r.State() {
+		if s.Points != 100 {
+			t.Errorf("Unexpected state %+v", s)
+		}
+		total += s.Share
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Errorf("Shares add up to %v", total)
+	}
+
+	r.Remove("d")
+	for k, o := range owner {
+		if r.Get(k) != o {
+			t.Fatalf("%s did not move back to %s", k, o)
+		}
+	}
+	if NewRing(10, nil).Get("x") != "" {
+		t.Error("Expected no node on an empty ring")
+	}
+}
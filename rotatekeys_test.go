@@ -0,0 +1,102 @@
+package sdb_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+// racingTransport lets race run before the first request it forwards that
+// matches, or the first PutAttributes without match.
+type racingTransport struct {
+	http.RoundTripper
+	race  func()
+	match func(p url.Values) bool
+}
+
+func (r *racingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b, _ := io.ReadAll(req.Body)
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	p, _ := url.ParseQuery(string(b))
+	matches := p.Get("Action") == "PutAttributes"
+	if r.match != nil {
+		matches = r.match(p)
+	}
+	if matches && r.race != nil {
+		race := r.race
+		r.race = nil
+		race()
+	}
+	return r.RoundTripper.RoundTrip(req)
+}
+
+func TestRotateKeys(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	if _, err := db.CreateDomain("users"); err != nil {
+		t.Fatal(err)
+	}
+	keys := sdb.StaticKeys{Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32), "k2": bytes.Repeat([]byte{2}, 32)}, Current: "k1"}
+	db.Encryption = sdb.NewEncryptor(keys, "ssn", "phone")
+	put := func(db sdb.SimpleDB, name string, attrs ...sdb.Attribute) {
+		t.Helper()
+		if _, err := db.PutAttributes("users", &sdb.Item{Name: name, Attributes: attrs}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put(db, "u1", sdb.Attribute{Name: "phone", Value: "1"}, sdb.Attribute{Name: "phone", Value: "2"})
+	put(db, "u2", sdb.Attribute{Name: "ssn", Value: "old"})
+
+	keys.Current = "k2"
+	db.Encryption = sdb.NewEncryptor(keys, "ssn", "phone")
+	put(db, "u1", sdb.Attribute{Name: "phone", Value: "3"})
+
+	// u2 is updated between the read and the rewrite of RotateKeys
+	rt := &racingTransport{RoundTripper: f}
+	rot := db
+	rot.HTTPClient = &http.Client{Transport: rt}
+	rt.race = func() { put(db, "u2", sdb.Attribute{Name: "ssn", Value: "new", Replace: true}) }
+	n, err := rot.RotateKeys(context.Background(), "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := f.Client()
+	for _, name := range []string{"u1", "u2"} {
+		r, err := raw.GetAttributes("users", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range r.Attributes {
+			if id, _ := sdb.EncryptedKeyID(a.Value); id != "k2" {
+				t.Errorf("%s: %s still under %s", name, a.Name, id)
+			}
+		}
+	}
+	r, err := db.GetAttributes("users", "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var phones []string
+	for _, a := range r.Attributes {
+		phones = append(phones, a.Value)
+	}
+	sort.Strings(phones)
+	if strings.Join(phones, ",") != "1,2,3" {
+		t.Errorf("phones after rotation %v", phones)
+	}
+	if r, err = db.GetAttributes("users", "u2"); err != nil || len(r.Attributes) != 1 || r.Attributes[0].Value != "new" {
+		t.Errorf("concurrent update lost: %+v %v", r.Attributes, err)
+	}
+	if n != 1 {
+		t.Errorf("rotated %d items, expected 1", n)
+	}
+}
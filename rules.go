@@ -0,0 +1,190 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Violation describes one way an item breaks a Rule.
+type Violation struct {
+	Item      string
+	Attribute string
+	Reason    string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("item %s attribute %s: %s", v.Item, v.Attribute, v.Reason)
+}
+
+// ValidationError is returned by writes refused by the domain's Rules.
+type ValidationError struct {
+	Domain     string
+	Violations []Violation
+}
+
+func (e ValidationError) Error() string {
+	s := make([]string, len(e.Violations))
+	for j, v := range e.Violations {
+		s[j] = v.String()
+	}
+	return "validation failed for domain " + e.Domain + ": " + strings.Join(s, "; ")
+}
+
+// Write is an item about to be written, as checked by a Rule. Full is set
+// for puts storing a whole item: PutStruct, PutIfNotExists and
+// Repository.PutAll. Other puts may change only some attributes of an item.
+// Delete is set for the attributes given to DeleteAttributes.
+type Write struct {
+	*Item
+	Full   bool
+	Delete bool
+}
+
+// Rule checks a write. Rules see only the attributes of the write, not
+// those already stored.
+type Rule func(w Write) []Violation
+
+// Required reports attributes missing from a full put and deletes of them.
+// Deleting a whole item is allowed.
+func Required(attrs ...string) Rule {
+	return func(w Write) (vs []Violation) {
+		for _, a := range attrs {
+			switch {
+			case w.Delete && hasAttribute(w.Item, a):
+				vs = append(vs, Violation{w.Name, a, "is required and can not be deleted"})
+			case w.Full && !hasAttribute(w.Item, a):
+				vs = append(vs, Violation{w.Name, a, "is required"})
+			}
+		}
+		return
+	}
+}
+
+// Matches reports values of attr that re does not match.
+func Matches(attr string, re *regexp.Regexp) Rule {
+	return valueRule(attr, func(v string) string {
+		if re.MatchString(v) {
+			return ""
+		}
+		return fmt.Sprintf("value %q does not match %s", v, re)
+	})
+}
+
+// OneOf reports values of attr that are not one of values.
+func OneOf(attr string, values ...string) Rule {
+	return valueRule(attr, func(v string) string {
+		for _, a := range values {
+			if v == a {
+				return ""
+			}
+		}
+		return fmt.Sprintf("value %q is not one of %s", v, strings.Join(values, ", "))
+	})
+}
+
+// MaxLength reports values of attr longer than n bytes.
+func MaxLength(attr string, n int) Rule {
+	return valueRule(attr, func(v string) string {
+		if len(v) <= n {
+			return ""
+		}
+		return fmt.Sprintf("value is %d bytes, the maximum is %d", len(v), n)
+	})
+}
+
+// MaxValues reports more than n values of attr.
+func MaxValues(attr string, n int) Rule {
+	return func(w Write) []Violation {
+		if w.Delete {
+			return nil
+		}
+		count := 0
+		for _, a := range w.Attributes {
+			if a.Name == attr {
+				count++
+			}
+		}
+		if count > n {
+			return []Violation{{w.Name, attr, fmt.Sprintf("has %d values, the maximum is %d", count, n)}}
+		}
+		return nil
+	}
+}
+
+func valueRule(attr string, check func(string) string) Rule {
+	return func(w Write) (vs []Violation) {
+		if w.Delete {
+			return
+		}
+		for _, a := range w.Attributes {
+			if a.Name != attr {
+				continue
+			}
+			if reason := check(a.Value); reason != "" {
+				vs = append(vs, Violation{w.Name, attr, reason})
+			}
+		}
+		return
+	}
+}
+
+func hasAttribute(i *Item, name string) bool {
+	for _, a := range i.Attributes {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRules runs the Rules registered for domain against items, written
+// by a put unless del is set.
+func (sdb *SimpleDB) checkRules(domain string, del bool, items ...*Item) error {
+	d := sdb.domains[domain]
+	if d == nil || len(d.Rules) == 0 && d.schema == nil {
+		return nil
+	}
+	rules := d.Rules
+	if d.schema != nil {
+		rules = append(rules[:len(rules):len(rules)], d.schema)
+	}
+	var vs []Violation
+	for _, i := range items {
+		for _, r := range rules {
+			vs = append(vs, r(Write{Item: i, Full: sdb.fullPut && !del, Delete: del})...)
+		}
+	}
+	if len(vs) > 0 {
+		return ValidationError{Domain: domain, Violations: vs}
+	}
+	return nil
+}
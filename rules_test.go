@@ -0,0 +1,59 @@
+package sdb
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.SetDomainDefaults("users", DomainSettings{Rules: []Rule{
+		Required("email", "status"),
+		Matches("email", regexp.MustCompile(`^[^@]+@[^@]+$`)),
+		OneOf("status", "active", "disabled"),
+		MaxLength("bio", 5),
+		MaxValues("tags", 1),
+	}})
+
+	good := NewItem("u1")
+	good.AddAttribute("email", "a@b")
+	good.AddAttribute("status", "active")
+	full := c
+	full.fullPut = true
+	if err := full.checkRules("users", false, good); err != nil {
+		t.Error(err)
+	}
+
+	bad := NewItem("u2")
+	bad.AddAttribute("email", "nope")
+	bad.AddAttribute("bio", "too long")
+	bad.AddAttribute("tags", "a")
+	bad.AddAttribute("tags", "b")
+	err := full.checkRules("users", false, good, bad)
+	e, ok := err.(ValidationError)
+	if !ok || len(e.Violations) != 4 {
+		t.Fatal(err)
+	}
+	if v := e.Violations[0]; v.Item != "u2" || v.Attribute != "status" {
+		t.Error(v)
+	}
+	if _, err = c.PutAttributes("users", bad); err == nil {
+		t.Error("Expected PutAttributes to refuse the item")
+	}
+	if err = full.checkRules("other", false, bad); err != nil {
+		t.Error("Rules should only apply to their domain", err)
+	}
+
+	// partial writes need not repeat required attributes
+	patch := NewItem("u1")
+	patch.AddAttribute("bio", "hi")
+	if err = c.checkRules("users", false, patch); err != nil {
+		t.Error(err)
+	}
+	if err = c.checkRules("users", true, &Item{Name: "u1", Attributes: []Attribute{{Name: "email"}}}); err == nil {
+		t.Error("Expected the delete of a required attribute to be refused")
+	}
+	if err = c.checkRules("users", true, NewItem("u1")); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// schemaAttribute is the chunked attribute holding a schema's JSON.
+const schemaAttribute = "schema"
+
+// AttributeSchema describes one attribute of a domain. Type is one of
+// "string", "int", "float", "time" and "bool", the latter four in the
+// sortable encodings of EncodeInt, EncodeFloat and EncodeTime. Codec names
+// a codec registered with RegisterCodec for values encoded with it.
+type AttributeSchema struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type,omitempty"`
+	Codec    string   `json:"codec,omitempty"`
+	Required bool     `json:"required,omitempty"`
+	Multi    bool     `json:"multi,omitempty"`
+	Values   []string `json:"values,omitempty"`
+	Doc      string   `json:"doc,omitempty"`
+}
+
+// DomainSchema describes the attributes expected in a domain. Indexes
+// lists the attribute combinations queries filter and sort on, for tools;
+// SimpleDB indexes every attribute itself. Strict refuses attributes not
+// described.
+type DomainSchema struct {
+	Domain     string            `json:"domain"`
+	Version    int               `json:"version"`
+	Attributes []AttributeSchema `json:"attributes"`
+	Indexes    [][]string        `json:"indexes,omitempty"`
+	Strict     bool              `json:"strict,omitempty"`
+}
+
+// Attribute returns the schema of the named attribute.
+func (s DomainSchema) Attribute(name string) (a AttributeSchema, ok bool) {
+	for _, a = range s.Attributes {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return AttributeSchema{}, false
+}
+
+// Rule checks writes against the schema. Required attributes are checked
+// like Required does, on full puts and deletes.
+func (s DomainSchema) Rule() Rule {
+	return func(w Write) (vs []Violation) {
+		counts := make(map[string]int)
+		for _, a := range w.Attributes {
+			counts[a.Name]++
+			if w.Delete {
+				continue
+			}
+			as, ok := s.Attribute(a.Name)
+			if !ok {
+				if s.Strict {
+					vs = append(vs, Violation{w.Name, a.Name, "is not in the schema"})
+				}
+				continue
+			}
+			if reason := checkType(as.Type, a.Value); reason != "" {
+				vs = append(vs, Violation{w.Name, a.Name, reason})
+			}
+			if len(as.Values) > 0 {
+				vs = append(vs, OneOf(a.Name, as.Values...)(Write{Item: &Item{Name: w.Name, Attributes: []Attribute{a}}})...)
+			}
+		}
+		var required []string
+		for _, as := range s.Attributes {
+			if as.Required {
+				required = append(required, as.Name)
+			}
+			if !w.Delete && !as.Multi && counts[as.Name] > 1 {
+				vs = append(vs, Violation{w.Name, as.Name, fmt.Sprintf("has %d values, the schema allows one", counts[as.Name])})
+			}
+		}
+		return append(vs, Required(required...)(w)...)
+	}
+}
+
+func checkType(t string, v string) string {
+	var err error
+	switch t {
+	case "", "string":
+		return ""
+	case "int", "float":
+		// both encode to 20 digits
+		_, err = strconv.ParseUint(v, 10, 64)
+		if len(v) != 20 {
+			err = strconv.ErrSyntax
+		}
+	case "time":
+		_, err = DecodeTime(v)
+	case "bool":
+		_, err = strconv.ParseBool(v)
+	default:
+		return fmt.Sprintf("unknown type %q in schema", t)
+	}
+	if err != nil {
+		return fmt.Sprintf("value %q is not an encoded %s", v, t)
+	}
+	return ""
+}
+
+// SchemaRegistry stores DomainSchemas as JSON in a meta domain, one item
+// per described domain, for the client to validate writes and for tools to
+// read.
+type SchemaRegistry struct {
+	Domain string
+	db     SimpleDB
+}
+
+// NewSchemaRegistry returns a registry of the schemas stored in domain.
+func NewSchemaRegistry(db SimpleDB, domain string) *SchemaRegistry {
+	db.ConsistentRead = true
+	return &SchemaRegistry{Domain: domain, db: db}
+}
+
+func (r *SchemaRegistry) Put(s DomainSchema) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	i := &Item{Name: s.Domain}
+	if err = i.SetChunked(schemaAttribute, string(b)); err != nil {
+		return err
+	}
+	db := r.db
+	_, err = db.PutAttributes(r.Domain, i)
+	return err
+}
+
+func (r *SchemaRegistry) Get(domain string) (s DomainSchema, found bool, err error) {
+	db := r.db
+	resp, err := db.GetAttributes(r.Domain, domain)
+	if err != nil {
+		return
+	}
+	return decodeSchema(Item{Name: domain, Attributes: resp.Attributes})
+}
+
+func decodeSchema(i Item) (s DomainSchema, found bool, err error) {
+	v, found, err := i.Chunked(schemaAttribute)
+	if !found || err != nil {
+		return
+	}
+	err = json.Unmarshal([]byte(v), &s)
+	return
+}
+
+// List returns the schemas of all described domains.
+func (r *SchemaRegistry) List(ctx context.Context) (schemas []DomainSchema, err error) {
+	var items []Item
+	if items, err = r.db.SelectPager("select * from " + QuoteName(r.Domain)).All(ctx); err != nil {
+		return
+	}
+	for _, i := range items {
+		s, found, err := decodeSchema(i)
+		if err != nil {
+			return nil, fmt.Errorf("schema of %s: %w", i.Name, err)
+		}
+		if found {
+			schemas = append(schemas, s)
+		}
+	}
+	return
+}
+
+// UseSchemas sets the Rule of every schema in r as the schema rule of the
+// client's domain settings, so writes are validated against the registry.
+// Calling it again replaces the schema rules. Like SetDomainDefaults, call
+// it before the client is used concurrently.
+func (sdb *SimpleDB) UseSchemas(ctx context.Context, r *SchemaRegistry) error {
+	schemas, err := r.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range schemas {
+		d := sdb.domains[s.Domain]
+		if d == nil {
+			sdb.SetDomainDefaults(s.Domain, DomainSettings{})
+			d = sdb.domains[s.Domain]
+		}
+		d.schema = s.Rule()
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package sdb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+var ordersSchema = DomainSchema{
+	Domain:  "orders",
+	Version: 1,
+	Attributes: []AttributeSchema{
+		{Name: "status", Required: true, Values: []string{"open", "paid"}},
+		{Name: "total", Type: "int"},
+		{Name: "tag", Multi: true},
+	},
+	Strict: true,
+}
+
+func TestSchemaRule(t *testing.T) {
+	rule := ordersSchema.Rule()
+	ok := &Item{Name: "o1", Attributes: []Attribute{{Name: "status", Value: "open"}, {Name: "total", Value: EncodeInt(5)}, {Name: "tag", Value: "a"}, {Name: "tag", Value: "b"}}}
+	if vs := rule(Write{Item: ok, Full: true}); len(vs) != 0 {
+		t.Errorf("valid item: %v", vs)
+	}
+	bad := &Item{Name: "o2", Attributes: []Attribute{{Name: "total", Value: "5"}, {Name: "status", Value: "lost"}, {Name: "extra", Value: "x"}}}
+	want := map[string]bool{"total": true, "status": true, "extra": true}
+	vs := rule(Write{Item: bad, Full: true})
+	for _, v := range vs {
+		delete(want, v.Attribute)
+	}
+	if len(vs) != 3 || len(want) != 0 {
+		t.Errorf("violations %v", vs)
+	}
+	if vs = rule(Write{Item: &Item{Name: "o1", Attributes: []Attribute{{Name: "tag", Value: "c"}}}}); len(vs) != 0 {
+		t.Errorf("partial put: %v", vs)
+	}
+	if vs = rule(Write{Item: &Item{Name: "o1", Attributes: []Attribute{{Name: "status"}}}, Delete: true}); len(vs) != 1 {
+		t.Errorf("delete of a required attribute: %v", vs)
+	}
+}
+
+func TestSchemaRegistry(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: &itemTransport{}}
+	r := NewSchemaRegistry(c, "schemas")
+	if err := r.Put(ordersSchema); err != nil {
+		t.Fatal(err)
+	}
+	s, found, err := r.Get("orders")
+	if err != nil || !found || s.Version != 1 || len(s.Attributes) != 3 {
+		t.Fatalf("Get = %+v, %v, %v", s, found, err)
+	}
+
+	// the transport answers every Select with its one item
+	for n := 0; n < 2; n++ {
+		if err = c.UseSchemas(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.domains["orders"] == nil || c.domains["orders"].schema == nil {
+		t.Fatalf("rules not registered: %+v", c.domains)
+	}
+	_, err = c.PutAttributes("orders", &Item{Name: "o1", Attributes: []Attribute{{Name: "status", Value: "lost"}}})
+	var ve ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	if len(ve.Violations) != 1 {
+		t.Errorf("schema checked more than once: %v", ve.Violations)
+	}
+}
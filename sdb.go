@@ -29,12 +29,13 @@
 package sdb
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/xml"
 	"errors"
-	"io/ioutil"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -44,6 +45,8 @@ import (
 
 const (
 	SDBRegionEUWest1 string = "sdb.eu-west-1.amazonaws.com"
+
+	DefaultAPIVersion = "2009-04-15"
 )
 
 var (
@@ -59,11 +62,18 @@ type SimpleDBError struct {
 	Code      string `xml:"Error>Code"`
 	Message   string `xml:"Error>Message"`
 	RequestId string
+	// StatusCode, Attempts and Elapsed describe the HTTP exchange that
+	// produced the error, Elapsed includes time spent waiting between retries.
+	StatusCode int           `xml:"-"`
+	Attempts   int           `xml:"-"`
+	Elapsed    time.Duration `xml:"-"`
+	// RetryAfter is the delay the server asked for in a Retry-After header.
+	RetryAfter time.Duration `xml:"-"`
 }
 
 type Response struct {
 	Errors    []SimpleDBError
-	RequestId string
+	RequestId string `xml:"RequestID"`
 }
 
 type ResponseMetadata struct {
@@ -81,6 +91,7 @@ type CreateDomainResponse struct {
 
 type ListDomainsResponse struct {
 	DomainNames      []string `xml:"ListDomainsResult>DomainName"`
+	NextToken        string   `xml:"ListDomainsResult>NextToken"`
 	ResponseMetadata ResponseMetadata
 }
 
@@ -100,7 +111,8 @@ type PutAttributesResponse struct {
 }
 
 type GetAttributesResponse struct {
-	Attributes []Attribute `xml:"GetAttributesResult>Attribute"`
+	Attributes       []Attribute `xml:"GetAttributesResult>Attribute"`
+	ResponseMetadata ResponseMetadata
 }
 
 type DeleteAttributesResponse struct {
@@ -108,8 +120,9 @@ type DeleteAttributesResponse struct {
 }
 
 type SelectResponse struct {
-	Items     []Item `xml:"SelectResult>Item"`
-	NextToken string `xml:"SelectResult>NextToken"`
+	Items            []Item `xml:"SelectResult>Item"`
+	NextToken        string `xml:"SelectResult>NextToken"`
+	ResponseMetadata ResponseMetadata
 }
 
 type Attribute struct {
@@ -123,15 +136,141 @@ type Item struct {
 	Attributes []Attribute `xml:"Attribute"`
 }
 
-type SimpleDB struct {
-	RawResponse string
-	RawRequest  string
-	p           url.Values
-	accessKey   string
-	secretKey   string
-	region      string
+// Condition is the expected state of an attribute for a conditional write.
+// When Exists is false the attribute must not exist, otherwise it must have
+// Value.
+type Condition struct {
+	Name   string
+	Value  string
+	Exists bool
 }
 
+type SimpleDB struct {
+	RawResponse    string
+	RawRequest     string
+	ConsistentRead bool
+	// ValidateValues rejects values, item names and attribute names
+	// SimpleDB would refuse before sending.
+	ValidateValues bool
+	// NormalizeNFC converts every value written or deleted to Unicode
+	// normalization form C, so that equal text is stored as equal bytes.
+	NormalizeNFC bool
+	// NormalizeValue, when set, is applied to every value written or
+	// deleted, after NormalizeNFC.
+	NormalizeValue func(string) string
+	// SkipNameValidation turns off the domain and attribute name checks
+	// made by PutStruct and GetStruct.
+	SkipNameValidation bool
+	// OnDrift, when set, is called when GetStruct reads an item whose
+	// attributes do not match the struct, see SchemaDrift.
+	OnDrift func(SchemaDrift)
+	// Cache, when set, serves repeated Selects and is invalidated for a
+	// domain on every write this client makes to it.
+	Cache *SelectCache
+	// Policy restricts which attributes the client can read and write.
+	Policy AttributePolicy
+	// Masks transforms attribute values read through the client.
+	Masks Masks
+	// Encryption encrypts attributes on write and decrypts them on read.
+	Encryption *Encryptor
+	// Checksum names an attribute holding an HMAC of the item under
+	// ChecksumKey, written with every put and verified on reads of items
+	// that have it. Puts must then write whole items with Replace set, or
+	// the next read fails with an IntegrityError. DeleteAttributes and the
+	// partial writes of PatchAttributes, OptimisticStore and Migrator
+	// remove the checksum and recompute it from a consistent read.
+	Checksum    string
+	ChecksumKey []byte
+	// Unmarshalers replaces XML decoding of successful responses per action,
+	// for example "Select", letting callers decode into their own types.
+	Unmarshalers map[string]UnmarshalFunc
+	// MaxRetries is the number of times a request failing with a 5xx status
+	// or a network error is resent, see Retryable.
+	MaxRetries int
+	// Backoff chooses the delay between retries, nil means a jittered
+	// doubling of RetryBaseDelay. BackoffByCode overrides it for errors
+	// with the given SimpleDB error code or HTTP status, such as
+	// "RequestThrottled" or "503".
+	Backoff       Backoff
+	BackoffByCode map[string]Backoff
+	// OnRetry, when set, is called before every retry, so retries can be
+	// counted apart from failed requests.
+	OnRetry func(RetryEvent)
+	// ValidateSelects checks expressions with ValidateSelect before sending.
+	ValidateSelects bool
+	// PartialResults makes Select helpers reading several pages, such as
+	// SelectInto, GetByNames and the All of SelectPager, return the items
+	// read before a failing page or the end of the context together with a
+	// *PartialError, instead of no items.
+	PartialResults bool
+	// Quota, when set, checks domain limits before BatchPutAttributes.
+	Quota *QuotaCheck
+	// Throttle, when set, adapts the request rate to throttling errors and
+	// limits retries.
+	Throttle *AdaptiveThrottle
+	// NameGenerator names items put without a name, ULID if nil.
+	NameGenerator IDGenerator
+	// Repair, when set, rereads items consistently when an eventually
+	// consistent read misses a recent write of this client.
+	Repair *ReadRepair
+	// Views are refreshed after every write this client makes to their
+	// Source, see MaterializedView.
+	Views []*MaterializedView
+	// Meter, when set, adds up the BoxUsage of every call by the usage tags
+	// of the client's context, see WithUsageTags.
+	Meter *UsageMeter
+	// Clock supplies the Timestamp of requests, nil means the system clock.
+	Clock Clock
+	// HTTPClient sends the requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// Endpoint, when set, replaces the region given to NewSimpleDB, see
+	// NewSimpleDBEndpoint.
+	Endpoint *Endpoint
+	// Timeouts limits each attempt of a request by action, with the "*"
+	// entry used for actions not listed. Nil means no limit besides the
+	// client's context, see DefaultTimeouts.
+	Timeouts map[string]time.Duration
+	// MaxResponseBytes fails requests whose response body is larger with a
+	// *ResponseTooLargeError, 0 means no limit. SelectStream is not limited.
+	MaxResponseBytes int64
+	// APIVersion overrides the Version parameter, DefaultAPIVersion if empty.
+	APIVersion string
+	// ExtraParameters are set on every request after the action's own
+	// parameters, replacing any of the same name, for servers that expect
+	// vendor extensions. Use WithParameters to set them for one request.
+	// Requests fail with ErrReservedParameter if they include a parameter
+	// set by the signing process, such as Signature, Timestamp or Version.
+	ExtraParameters url.Values
+	p               url.Values
+	ctx             context.Context
+	attempts        int
+	elapsed         time.Duration
+	domains         map[string]*domainDefaults
+	requestId       string
+	stream          func(io.Reader) error
+	actions         []ActionPolicy
+	fullPut         bool
+	partialPut      bool
+	accessKey       string
+	secretKey       string
+	region          string
+}
+
+// Clock is the source of the time requests are signed with.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to the Clock interface.
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// UnmarshalFunc decodes the body of a successful response into v.
+type UnmarshalFunc func(body []byte, v interface{}) error
+
 func (err SimpleDBError) Error() string {
 	return err.Code + ": " + err.Message
 }
@@ -150,16 +289,23 @@ func (sdb *SimpleDB) resetParameters() {
 	sdb.p.Add("AWSAccessKeyId", sdb.accessKey)
 	sdb.p.Add("SignatureMethod", "HmacSHA256")
 	sdb.p.Add("SignatureVersion", "2")
-	sdb.p.Add("Version", "2009-04-15")
+	if sdb.APIVersion != "" {
+		sdb.p.Add("Version", sdb.APIVersion)
+	} else {
+		sdb.p.Add("Version", DefaultAPIVersion)
+	}
 
-	var t time.Time
-	t = time.Now().UTC()
+	t := time.Now()
+	if sdb.Clock != nil {
+		t = sdb.Clock.Now()
+	}
+	t = t.UTC()
 	sdb.p.Add("Timestamp", t.Format(dateFormat))
 }
 
 func (sdb *SimpleDB) unmarshal(r *http.Response, v interface{}) (err error) {
 	var b []byte
-	b, err = ioutil.ReadAll(r.Body)
+	b, err = sdb.readBody(r)
 	if err != nil {
 		return
 	}
@@ -169,32 +315,125 @@ func (sdb *SimpleDB) unmarshal(r *http.Response, v interface{}) (err error) {
 }
 
 func (sdb *SimpleDB) post(v interface{}) (err error) {
-	unsignedSignature := "POST\n" + sdb.region + "\n" + "/\n" + strings.Replace(sdb.p.Encode(), "+", "%20", -1)
+	if err = sdb.checkExtraParameters(); err != nil {
+		return
+	}
+	sdb.addExtraParameters()
+	if err = sdb.checkAction(); err != nil {
+		return
+	}
+	d := sdb.domainDefaults()
+	maxRetries := sdb.MaxRetries
+	if d != nil && d.MaxRetries != nil {
+		maxRetries = *d.MaxRetries
+	}
+	start := time.Now()
+	attempts := 0
+	var delay time.Duration
+	for {
+		attempts++
+		if werr := sdb.pace(d); werr != nil {
+			err = &RequestError{Err: werr}
+			break
+		}
+		err = sdb.send(v)
+		if sdb.Throttle != nil {
+			sdb.Throttle.observe(err)
+		}
+		if sdb.outcomeUnknown(err) {
+			break
+		}
+		if attempts > maxRetries || !Retryable(err) || sdb.Throttle != nil && !sdb.Throttle.retry() {
+			break
+		}
+		var werr error
+		if delay, werr = sdb.wait(attempts, delay, err); werr != nil {
+			break
+		}
+	}
 
-	sdb.p.Add("Signature", sdb.sign(unsignedSignature))
+	sdb.attempts, sdb.elapsed = attempts, time.Since(start)
+	sdb.recordRequestId(v, err)
+	sdb.recordUsage(v)
+	switch e := err.(type) {
+	case SimpleDBError:
+		e.Attempts, e.Elapsed = attempts, sdb.elapsed
+		err = e
+	case *RequestError:
+		e.Attempts, e.Elapsed = attempts, sdb.elapsed
+	}
+	return
+}
 
-	sdb.RawRequest = sdb.p.Encode()
-	sdb.RawRequest = strings.Replace(sdb.RawRequest, "+", "%20", -1)
+// addExtraParameters sets the ExtraParameters, leaving out reserved ones.
+func (sdb *SimpleDB) addExtraParameters() {
+	for k, vs := range sdb.ExtraParameters {
+		if !reservedParameters[k] {
+			sdb.p[k] = append([]string(nil), vs...)
+		}
+	}
+}
 
-	var r *http.Response
-	r, err = http.Post("https://"+sdb.region, "application/x-www-form-urlencoded; charset=utf-8", strings.NewReader(sdb.RawRequest))
+func (sdb *SimpleDB) send(v interface{}) (err error) {
+	sdb.RawRequest = sdb.signedBody()
+
+	var req *http.Request
+	req, err = http.NewRequest("POST", sdb.endpoint().URL(), strings.NewReader(sdb.RawRequest))
 	if err != nil {
 		return
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	ctx := sdb.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout := sdb.timeout()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req = req.WithContext(ctx)
+
+	client := sdb.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var r *http.Response
+	r, err = client.Do(req)
+	if err != nil {
+		if timeout > 0 && ctx.Err() == context.DeadlineExceeded && (sdb.ctx == nil || sdb.ctx.Err() == nil) {
+			err = timeoutError(sdb.p.Get("Action"), timeout)
+		}
+		return &RequestError{Err: err}
+	}
+	defer r.Body.Close()
 
 	if r.StatusCode != 200 {
+		retryAfter := parseRetryAfter(r.Header.Get("Retry-After"), time.Now())
 		var v Response
-		err = sdb.unmarshal(r, &v)
-		if err != nil {
-			return
+		if sdb.unmarshal(r, &v) != nil || len(v.Errors) == 0 {
+			return &RequestError{Err: errors.New(r.Status), StatusCode: r.StatusCode, RetryAfter: retryAfter}
 		}
-		if len(v.Errors) > 0 {
-			return SimpleDBError{Code: v.Errors[0].Code, Message: v.Errors[0].Message, RequestId: v.Errors[0].RequestId}
-		} else {
-			return errors.New(r.Status)
+		e := v.Errors[0]
+		e.StatusCode, e.RetryAfter = r.StatusCode, retryAfter
+		if e.RequestId == "" {
+			e.RequestId = v.RequestId
 		}
+		return e
 	}
 
+	if sdb.stream != nil {
+		return sdb.stream(r.Body)
+	}
+	if f := sdb.Unmarshalers[sdb.p.Get("Action")]; f != nil {
+		var b []byte
+		if b, err = sdb.readBody(r); err != nil {
+			return
+		}
+		sdb.RawResponse = string(b)
+		return f(b, v)
+	}
 	err = sdb.unmarshal(r, v)
 
 	return
@@ -216,6 +455,12 @@ func (i *Item) AddAttribute(name string, value string) *Attribute {
 	return a
 }
 
+// ReplaceAttribute adds an attribute that replaces all stored values of name
+// when the item is put.
+func (i *Item) ReplaceAttribute(name string, value string) {
+	i.Attributes = append(i.Attributes, Attribute{Name: name, Value: value, Replace: true})
+}
+
 func (i *Item) RemoveAttribute(a Attribute) Attribute {
 	var removedAttr Attribute
 	attrs := i.Attributes
@@ -230,6 +475,17 @@ func (i *Item) RemoveAttribute(a Attribute) Attribute {
 	return removedAttr
 }
 
+// Value returns the first value of the named attribute or "" if the item has
+// no such attribute.
+func (i Item) Value(name string) string {
+	for _, a := range i.Attributes {
+		if a.Name == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
 // Constructor
 func NewSimpleDB(a string, s string, r string) SimpleDB {
 	sdb := SimpleDB{accessKey: a, secretKey: s, region: r}
@@ -239,10 +495,37 @@ func NewSimpleDB(a string, s string, r string) SimpleDB {
 	return sdb
 }
 
+// WithContext returns a copy of the client whose requests are bound to ctx.
+func (sdb SimpleDB) WithContext(ctx context.Context) SimpleDB {
+	sdb.ctx = ctx
+	return sdb
+}
+
+// WithParameters returns a copy of the client that also sends p with every
+// request, in addition to and overriding its ExtraParameters.
+func (sdb SimpleDB) WithParameters(p url.Values) SimpleDB {
+	extra := make(url.Values)
+	for k, v := range sdb.ExtraParameters {
+		extra[k] = v
+	}
+	for k, v := range p {
+		extra[k] = v
+	}
+	sdb.ExtraParameters = extra
+	return sdb
+}
+
 func (sdb *SimpleDB) ListDomains() (r ListDomainsResponse, err error) {
+	return sdb.ListDomainsWithToken("")
+}
+
+func (sdb *SimpleDB) ListDomainsWithToken(nextToken string) (r ListDomainsResponse, err error) {
 	sdb.resetParameters()
 
 	sdb.p.Add("Action", "ListDomains")
+	if nextToken != "" {
+		sdb.p.Add("NextToken", nextToken)
+	}
 
 	err = sdb.post(&r)
 
@@ -278,72 +561,365 @@ func (sdb *SimpleDB) DeleteDomain(name string) (r DeleteDomainResponse, err erro
 	sdb.p.Add("DomainName", name)
 
 	err = sdb.post(&r)
+	sdb.invalidateCache(name)
 
 	return
 }
 
+func (sdb *SimpleDB) addCondition(c *Condition) {
+	if c == nil {
+		return
+	}
+	sdb.p.Add("Expected.1.Name", c.Name)
+	if c.Exists {
+		sdb.p.Add("Expected.1.Value", c.Value)
+	} else {
+		sdb.p.Add("Expected.1.Exists", "false")
+	}
+}
+
+func (sdb *SimpleDB) addConsistentRead() {
+	consistent := sdb.ConsistentRead
+	if d := sdb.domainDefaults(); d != nil && d.ConsistentRead != nil {
+		consistent = *d.ConsistentRead
+	}
+	if consistent {
+		sdb.p.Add("ConsistentRead", "true")
+	}
+}
+
+// IsConditionalCheckFailed reports whether err is the error returned when the
+// condition of a conditional write did not hold.
+func IsConditionalCheckFailed(err error) bool {
+	e, ok := err.(SimpleDBError)
+	return ok && (e.Code == "ConditionalCheckFailed" || e.Code == "AttributeDoesNotExist")
+}
+
 func (sdb *SimpleDB) PutAttributes(domain string, i *Item) (r PutAttributesResponse, err error) {
+	return sdb.putAttributes(domain, i, nil)
+}
+
+// PutAttributesIf puts the attributes of i only if c holds for the stored item.
+func (sdb *SimpleDB) PutAttributesIf(domain string, i *Item, c Condition) (r PutAttributesResponse, err error) {
+	return sdb.putAttributes(domain, i, &c)
+}
+
+func (sdb *SimpleDB) putAttributes(domain string, i *Item, c *Condition) (r PutAttributesResponse, err error) {
+	if err = sdb.validateNames(i); err != nil {
+		return
+	}
+	if err = sdb.checkRules(domain, false, i); err != nil {
+		return
+	}
+	if err = sdb.Policy.checkWrite("PutAttributes", i); err != nil {
+		return
+	}
+	groups, err := sdb.viewGroups(domain, i)
+	if err != nil {
+		return
+	}
+	if i, err = sdb.Encryption.indexItem(i); err != nil {
+		return
+	}
+	if i, err = sdb.addChecksum(i); err != nil {
+		return
+	}
 	sdb.resetParameters()
 
 	sdb.p.Add("Action", "PutAttributes")
 	sdb.p.Add("DomainName", domain)
 	sdb.p.Add("ItemName", i.Name)
 
-	for i, a := range i.Attributes {
-		o := strconv.Itoa(i + 1)
+	for j, a := range i.Attributes {
+		var v string
+		if v, err = sdb.prepareValue(i.Name, a); err != nil {
+			return
+		}
+		o := strconv.Itoa(j + 1)
 		sdb.p.Add("Attribute."+o+".Name", a.Name)
-		sdb.p.Add("Attribute."+o+".Value", a.Value)
+		sdb.p.Add("Attribute."+o+".Value", v)
+		if a.Replace {
+			sdb.p.Add("Attribute."+o+".Replace", "true")
+		}
 	}
+	sdb.addCondition(c)
 
 	err = sdb.post(&r)
+	sdb.invalidateCache(domain)
+	if err == nil && sdb.Repair != nil {
+		sdb.Repair.recordWrite(domain, i)
+	}
+	if err == nil && groups != nil {
+		err = sdb.refreshViews(groups)
+	}
 	return
 }
 
 func (sdb *SimpleDB) BatchPutAttributes(domain string, items []*Item) (r PutAttributesResponse, err error) {
+	if err = sdb.validateNames(items...); err != nil {
+		return
+	}
+	if err = sdb.checkRules(domain, false, items...); err != nil {
+		return
+	}
+	if err = sdb.Policy.checkWrite("BatchPutAttributes", items...); err != nil {
+		return
+	}
+	if err = sdb.checkQuota(domain, items); err != nil {
+		return
+	}
+	groups, err := sdb.viewGroups(domain, items...)
+	if err != nil {
+		return
+	}
 	sdb.resetParameters()
 
 	sdb.p.Add("Action", "BatchPutAttributes")
 	sdb.p.Add("DomainName", domain)
 
 	for i, item := range items {
+		if item, err = sdb.Encryption.indexItem(item); err != nil {
+			return
+		}
+		if item, err = sdb.addChecksum(item); err != nil {
+			return
+		}
 		itemNo := strconv.Itoa(i + 1)
 		sdb.p.Add("Item."+itemNo+".ItemName", item.Name)
 		for j, a := range item.Attributes {
+			var v string
+			if v, err = sdb.prepareValue(item.Name, a); err != nil {
+				return
+			}
 			o := strconv.Itoa(j + 1)
 			sdb.p.Add("Item."+itemNo+".Attribute."+o+".Name", a.Name)
-			sdb.p.Add("Item."+itemNo+".Attribute."+o+".Value", a.Value)
+			sdb.p.Add("Item."+itemNo+".Attribute."+o+".Value", v)
+			if a.Replace {
+				sdb.p.Add("Item."+itemNo+".Attribute."+o+".Replace", "true")
+			}
 		}
 	}
 
 	err = sdb.post(&r)
+	sdb.invalidateCache(domain)
+	if err == nil && sdb.Repair != nil {
+		sdb.Repair.recordWrite(domain, items...)
+	}
+	if err == nil && groups != nil {
+		err = sdb.refreshViews(groups)
+	}
+	return
+}
+
+// BatchDeleteAttributes deletes the attributes of up to 25 items in one
+// call. An item without attributes is deleted entirely.
+func (sdb *SimpleDB) BatchDeleteAttributes(domain string, items []*Item) (r DeleteAttributesResponse, err error) {
+	if err = sdb.validateNames(items...); err != nil {
+		return
+	}
+	if err = sdb.checkRules(domain, true, items...); err != nil {
+		return
+	}
+	if err = sdb.Policy.checkWrite("BatchDeleteAttributes", items...); err != nil {
+		return
+	}
+	groups, err := sdb.viewGroups(domain, items...)
+	if err != nil {
+		return
+	}
+	sdb.resetParameters()
+
+	sdb.p.Add("Action", "BatchDeleteAttributes")
+	sdb.p.Add("DomainName", domain)
+
+	var reseal []string
+	for i, item := range items {
+		if item, err = sdb.Encryption.indexItem(item); err != nil {
+			return
+		}
+		if dropped, ok := sdb.dropChecksum(item); ok {
+			item = dropped
+			reseal = append(reseal, item.Name)
+		}
+		itemNo := strconv.Itoa(i + 1)
+		sdb.p.Add("Item."+itemNo+".ItemName", item.Name)
+		for j, a := range item.Attributes {
+			var v string
+			if v, err = sdb.prepareDeleteValue(item.Name, a); err != nil {
+				return
+			}
+			o := strconv.Itoa(j + 1)
+			sdb.p.Add("Item."+itemNo+".Attribute."+o+".Name", a.Name)
+			if v != "" {
+				sdb.p.Add("Item."+itemNo+".Attribute."+o+".Value", v)
+			}
+		}
+	}
+
+	err = sdb.post(&r)
+	sdb.invalidateCache(domain)
+	for _, name := range reseal {
+		if err != nil {
+			break
+		}
+		err = sdb.resealChecksum(domain, name)
+	}
+	if err == nil && groups != nil {
+		err = sdb.refreshViews(groups)
+	}
 	return
 }
 
 func (sdb *SimpleDB) GetAttributes(domain string, itemName string) (r GetAttributesResponse, err error) {
+	if r, err = sdb.getAttributes(domain, itemName, false); err != nil {
+		return
+	}
+	return sdb.repair(domain, itemName, r)
+}
+
+func (sdb *SimpleDB) getAttributes(domain string, itemName string, consistent bool) (r GetAttributesResponse, err error) {
 	sdb.resetParameters()
 
 	sdb.p.Add("Action", "GetAttributes")
 	sdb.p.Add("DomainName", domain)
 	sdb.p.Add("ItemName", itemName)
+	if consistent {
+		sdb.p.Add("ConsistentRead", "true")
+	} else {
+		sdb.addConsistentRead()
+	}
 
-	err = sdb.post(&r)
+	if err = sdb.post(&r); err == nil {
+		r.Attributes, err = sdb.readAttributes(itemName, r.Attributes)
+	}
+	sdb.clearRawResponse()
 
 	return
 }
 
 func (sdb *SimpleDB) DeleteItem(domain string, itemName string) (r DeleteAttributesResponse, err error) {
+	return sdb.deleteAttributes(domain, &Item{Name: itemName}, nil)
+}
+
+// DeleteItemIf deletes the item only if c holds for the stored item.
+func (sdb *SimpleDB) DeleteItemIf(domain string, itemName string, c Condition) (r DeleteAttributesResponse, err error) {
+	return sdb.deleteAttributes(domain, &Item{Name: itemName}, &c)
+}
+
+// DeleteAttributes deletes the attributes of i from the stored item. An
+// attribute with an empty value deletes all values of that name.
+func (sdb *SimpleDB) DeleteAttributes(domain string, i *Item) (r DeleteAttributesResponse, err error) {
+	if len(i.Attributes) == 0 {
+		err = errors.New("no attributes to delete, use DeleteItem to delete the item")
+		return
+	}
+	return sdb.deleteAttributes(domain, i, nil)
+}
+
+func (sdb *SimpleDB) deleteAttributes(domain string, i *Item, c *Condition) (r DeleteAttributesResponse, err error) {
+	if err = sdb.validateNames(i); err != nil {
+		return
+	}
+	if err = sdb.checkRules(domain, true, i); err != nil {
+		return
+	}
+	if err = sdb.Policy.checkWrite("DeleteAttributes", i); err != nil {
+		return
+	}
+	groups, err := sdb.viewGroups(domain, i)
+	if err != nil {
+		return
+	}
+	if i, err = sdb.Encryption.indexItem(i); err != nil {
+		return
+	}
+	i, reseal := sdb.dropChecksum(i)
 	sdb.resetParameters()
 
 	sdb.p.Add("Action", "DeleteAttributes")
 	sdb.p.Add("DomainName", domain)
-	sdb.p.Add("ItemName", itemName)
+	sdb.p.Add("ItemName", i.Name)
+
+	for j, a := range i.Attributes {
+		var v string
+		if v, err = sdb.prepareDeleteValue(i.Name, a); err != nil {
+			return
+		}
+		o := strconv.Itoa(j + 1)
+		sdb.p.Add("Attribute."+o+".Name", a.Name)
+		if v != "" {
+			sdb.p.Add("Attribute."+o+".Value", v)
+		}
+	}
+	sdb.addCondition(c)
 
 	err = sdb.post(&r)
+	sdb.invalidateCache(domain)
+	if err == nil && reseal {
+		err = sdb.resealChecksum(domain, i.Name)
+	}
+	if err == nil && groups != nil {
+		err = sdb.refreshViews(groups)
+	}
 
 	return
 }
 
 func (sdb *SimpleDB) SelectWithToken(q, nextToken string) (r SelectResponse, err error) {
+	// checked before the cache as well as by post, cached responses must
+	// not reach clients whose policy refuses the select
+	if err = sdb.allowsSelect(q); err != nil {
+		return
+	}
+	if sdb.ValidateSelects {
+		if err = ValidateSelect(q); err != nil {
+			return
+		}
+	}
+	if err = sdb.checkSelect(q, sdb.Unmarshalers["Select"] == nil); err != nil {
+		return
+	}
+	sdb.selectParameters(q, nextToken)
+	var key string
+	if sdb.Cache != nil {
+		key = selectCacheKey(q, nextToken, sdb.p.Get("ConsistentRead") != "")
+		var ok bool
+		if r, ok = sdb.Cache.get(key); ok {
+			r.Items, err = sdb.readItems(r.Items)
+			return
+		}
+	}
+
+	err = sdb.post(&r)
+	if err == nil && sdb.Cache != nil {
+		sdb.Cache.put(key, q, r)
+	}
+	if err == nil {
+		r.Items, err = sdb.readItems(r.Items)
+	}
+	sdb.clearRawResponse()
+
+	return
+}
+
+// SelectDecode runs a Select and decodes the response into v instead of a
+// SelectResponse. v may be any type xml.Unmarshal accepts, such as a struct
+// with an `xml:"SelectResult>Item"` slice of the caller's own item type, or
+// a type implementing xml.Unmarshaler. The Cache is not used.
+func (sdb *SimpleDB) SelectDecode(q, nextToken string, v interface{}) (err error) {
+	if sdb.ValidateSelects {
+		if err = ValidateSelect(q); err != nil {
+			return
+		}
+	}
+	if err = sdb.checkSelect(q, false); err != nil {
+		return
+	}
+	sdb.selectParameters(q, nextToken)
+	return sdb.post(v)
+}
+
+func (sdb *SimpleDB) selectParameters(q, nextToken string) {
 	sdb.resetParameters()
 
 	sdb.p.Add("Action", "Select")
@@ -351,10 +927,7 @@ func (sdb *SimpleDB) SelectWithToken(q, nextToken string) (r SelectResponse, err
 	if nextToken != "" {
 		sdb.p.Add("NextToken", nextToken)
 	}
-
-	err = sdb.post(&r)
-
-	return
+	sdb.addConsistentRead()
 }
 
 func (sdb *SimpleDB) Select(q string) (r SelectResponse, err error) {
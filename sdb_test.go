@@ -1,12 +1,16 @@
 package sdb
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"testing"
+	"time"
 )
 
-const TestDomain = "testing"
+// TestDomain is unique per run so concurrent CI runs do not share a domain.
+var TestDomain = "testing-" + strconv.FormatInt(time.Now().UnixNano(), 36)
 
 var (
 	akey string
@@ -42,6 +46,11 @@ func TestCreateDomain(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err = db.WaitForDomain(ctx, TestDomain, true); err != nil {
+		t.Error(err)
+	}
 }
 
 func TestCreateDomainMissingDomainName(t *testing.T) {
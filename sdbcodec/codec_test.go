@@ -0,0 +1,51 @@
+package sdbcodec
+
+import (
+	"testing"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type settings struct {
+	Theme string
+	Sizes []int
+}
+
+type profile struct {
+	ID       string                  `sdb:",itemname"`
+	Settings settings                `sdb:"settings,codec=msgpack"`
+	Bio      *wrapperspb.StringValue `sdb:"bio,codec=protobuf"`
+}
+
+func TestCodecs(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	db.ConsistentRead = true
+	if _, err := db.CreateDomain("profiles"); err != nil {
+		t.Fatal(err)
+	}
+	p := profile{ID: "p1", Settings: settings{"dark", []int{1, 2}}, Bio: wrapperspb.String("hello")}
+	if err := db.PutStruct("profiles", &p); err != nil {
+		t.Fatal(err)
+	}
+	var got profile
+	if found, err := db.GetStruct("profiles", "p1", &got); err != nil || !found {
+		t.Fatalf("GetStruct = %v, %v", found, err)
+	}
+	if got.Settings.Theme != "dark" || len(got.Settings.Sizes) != 2 || got.Settings.Sizes[1] != 2 {
+		t.Fatalf("msgpack field = %+v", got.Settings)
+	}
+	if !proto.Equal(got.Bio, p.Bio) {
+		t.Fatalf("protobuf field = %v", got.Bio)
+	}
+
+	if _, err := Protobuf.Marshal(settings{}); err != ErrNotProtoMessage {
+		t.Fatalf("Protobuf.Marshal of a struct returned %v", err)
+	}
+	if c, ok := sdb.LookupCodec("msgpack"); !ok || c != Msgpack {
+		t.Fatal("msgpack is not registered")
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdbexport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/coopernurse/sdb"
+)
+
+var ErrBrokenChain = errors.New("sdbexport: broken manifest chain")
+
+// DeltaOverlap is how far before the Until of the previous export a delta
+// starts, so items stamped before that export but written after it are not
+// missed. It applies to attributes holding EncodeTime values, deltas of other
+// values start at Until.
+var DeltaOverlap = time.Minute
+
+// ExportDeltaFile exports to path the items of domain whose attr, an
+// updated_at style attribute holding sortable timestamps, is at least the
+// Until of the export at prev less DeltaOverlap. Items in the overlap are
+// exported again, Compact keeps the last copy of each. With an empty prev it
+// makes a full export that starts the chain. Deleted items are not seen by a
+// delta, only a new full export drops them.
+func ExportDeltaFile(ctx context.Context, db sdb.SimpleDB, domain string, attr string, prev string, path string) (m Manifest, err error) {
+	m = Manifest{Domain: domain, Attribute: attr}
+	if prev != "" {
+		var p Manifest
+		if p, err = ReadManifest(ManifestPath(prev)); err != nil {
+			return
+		}
+		if p.Domain != domain || p.Attribute != attr {
+			return m, fmt.Errorf("%w: %s exports %s by %s", ErrBrokenChain, prev, p.Domain, p.Attribute)
+		}
+		m.Since, m.Until, m.Previous = deltaSince(p.Until), p.Until, prev
+	}
+	return exportFile(ctx, db, m, path)
+}
+
+// deltaSince returns the lower bound of a delta following an export up to
+// until.
+func deltaSince(until string) string {
+	t, err := sdb.DecodeTime(until)
+	if err != nil {
+		return until
+	}
+	return sdb.EncodeTime(t.Add(-DeltaOverlap))
+}
+
+// Chain returns the manifests from the full export that starts the chain
+// ending at the export at path, oldest first.
+func Chain(path string) (ms []Manifest, err error) {
+	seen := make(map[string]bool)
+	for {
+		if seen[path] {
+			return nil, fmt.Errorf("%w: %s repeats", ErrBrokenChain, path)
+		}
+		seen[path] = true
+		var m Manifest
+		if m, err = ReadManifest(ManifestPath(path)); err != nil {
+			return
+		}
+		ms = append([]Manifest{m}, ms...)
+		if m.Previous == "" {
+			return
+		}
+		path = m.Previous
+	}
+}
+
+// Compact merges a chain of exports, a full export followed by its deltas,
+// into one full snapshot written to w. Later records replace earlier ones and
+// every file is checked against its manifest.
+func Compact(ms []Manifest, w io.Writer) (m Manifest, err error) {
+	if len(ms) == 0 || ms[0].Previous != "" {
+		return m, fmt.Errorf("%w: chain does not start with a full export", ErrBrokenChain)
+	}
+	items := make(map[string]sdb.Item)
+	for i, cur := range ms {
+		if i > 0 && (cur.Previous != ms[i-1].File || cur.Domain != ms[0].Domain) {
+			return m, fmt.Errorf("%w: %s does not follow %s", ErrBrokenChain, cur.File, ms[i-1].File)
+		}
+		if err = readInto(cur, items); err != nil {
+			return
+		}
+	}
+	names := make([]string, 0, len(items))
+	for n := range items {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	ew := NewWriter(w)
+	for _, n := range names {
+		if err = ew.Write(items[n]); err != nil {
+			return
+		}
+	}
+	last := ms[len(ms)-1]
+	m = Manifest{Domain: last.Domain, Created: time.Now().UTC(), Items: ew.Count(), SHA256: ew.Sum(), Attribute: last.Attribute, Until: last.Until}
+	return
+}
+
+func readInto(m Manifest, items map[string]sdb.Item) error {
+	f, err := os.Open(m.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := NewReader(f)
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", m.File, rec.Name, err)
+		}
+		items[rec.Name] = rec.Item()
+	}
+	if r.Sum() != m.SHA256 {
+		return fmt.Errorf("%s: %w", m.File, ErrChecksum)
+	}
+	return nil
+}
+
+// CompactFile compacts the chain ending at the export at latest into a full
+// snapshot at path, writing its manifest next to it. The snapshot can start
+// a new chain.
+func CompactFile(latest string, path string) (m Manifest, err error) {
+	ms, err := Chain(latest)
+	if err != nil {
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	m, err = Compact(ms, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return
+	}
+	m.File = path
+	err = WriteManifest(ManifestPath(path), m)
+	return
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+// Package sdbexport exports SimpleDB domains to JSON lines files and
+// verifies them against the live domain. ExportParquet writes Parquet files
+// for query engines such as Athena and Spark.
+//
+// Every line of an export is a Record carrying the SHA-256 of its item. The
+// Manifest written next to the export records the item count and the SHA-256
+// of the whole file, so a damaged or truncated export is detected on read.
+package sdbexport
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/coopernurse/sdb"
+)
+
+var ErrChecksum = errors.New("sdbexport: checksum mismatch")
+
+// Record is one exported item.
+type Record struct {
+	Name       string              `json:"name"`
+	Attributes map[string][]string `json:"attributes"`
+	Sum        string              `json:"sum"`
+}
+
+// Manifest describes an export file.
+type Manifest struct {
+	Domain  string    `json:"domain"`
+	File    string    `json:"file"`
+	Created time.Time `json:"created"`
+	Items   int       `json:"items"`
+	SHA256  string    `json:"sha256"`
+
+	// Attribute is the updated_at style attribute of a delta chain. Since
+	// is the inclusive lower bound of a delta export, empty for a full
+	// export or a delta of all items having Attribute, and Until the
+	// largest value exported so far in the chain. Previous is the file of
+	// the export this one follows.
+	Attribute string `json:"attribute,omitempty"`
+	Since     string `json:"since,omitempty"`
+	Until     string `json:"until,omitempty"`
+	Previous  string `json:"previous,omitempty"`
+}
+
+// ItemChecksum returns the hex SHA-256 of the item name and its attributes,
+// independent of attribute order.
+func ItemChecksum(i sdb.Item) string {
+	pairs := make([]string, len(i.Attributes))
+	for j, a := range i.Attributes {
+		pairs[j] = a.Name + "\x00" + a.Value
+	}
+	sort.Strings(pairs)
+	h := sha256.New()
+	io.WriteString(h, i.Name)
+	for _, p := range pairs {
+		io.WriteString(h, "\x01"+p)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func NewRecord(i sdb.Item) Record {
+	r := Record{Name: i.Name, Attributes: make(map[string][]string), Sum: ItemChecksum(i)}
+	for _, a := range i.Attributes {
+		r.Attributes[a.Name] = append(r.Attributes[a.Name], a.Value)
+	}
+	return r
+}
+
+func (r Record) Item() sdb.Item {
+	i := sdb.Item{Name: r.Name}
+	names := make([]string, 0, len(r.Attributes))
+	for n := range r.Attributes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		for _, v := range r.Attributes[n] {
+			i.Attributes = append(i.Attributes, sdb.Attribute{Name: n, Value: v})
+		}
+	}
+	return i
+}
+
+// Writer writes records and hashes everything written.
+type Writer struct {
+	enc   *json.Encoder
+	h     hash.Hash
+	count int
+}
+
+func NewWriter(w io.Writer) *Writer {
+	h := sha256.New()
+	return &Writer{enc: json.NewEncoder(io.MultiWriter(w, h)), h: h}
+}
+
+func (w *Writer) Write(i sdb.Item) error {
+	if err := w.enc.Encode(NewRecord(i)); err != nil {
+		return err
+	}
+	w.count++
+	return nil
+}
+
+func (w *Writer) Count() int {
+	return w.count
+}
+
+// Sum returns the hex SHA-256 of the records written so far.
+func (w *Writer) Sum() string {
+	return hex.EncodeToString(w.h.Sum(nil))
+}
+
+// Reader reads records, checking the checksum of each.
+type Reader struct {
+	dec *json.Decoder
+	h   hash.Hash
+}
+
+func NewReader(r io.Reader) *Reader {
+	h := sha256.New()
+	return &Reader{dec: json.NewDecoder(io.TeeReader(r, h)), h: h}
+}
+
+// Next returns the next record, io.EOF after the last and ErrChecksum for a
+// record whose content does not match its checksum.
+func (r *Reader) Next() (rec Record, err error) {
+	if err = r.dec.Decode(&rec); err != nil {
+		return
+	}
+	if ItemChecksum(rec.Item()) != rec.Sum {
+		return rec, ErrChecksum
+	}
+	return
+}
+
+// Sum returns the hex SHA-256 of the input read so far, the file checksum
+// once Next returned io.EOF.
+func (r *Reader) Sum() string {
+	return hex.EncodeToString(r.h.Sum(nil))
+}
+
+// Export writes every item of domain to w and returns its manifest, the
+// caller sets File.
+func Export(ctx context.Context, db sdb.SimpleDB, domain string, w io.Writer) (m Manifest, err error) {
+	return export(ctx, db, Manifest{Domain: domain}, w)
+}
+
+// export writes the items selected by the Domain, Attribute, Since and
+// Previous of m, each item once.
+func export(ctx context.Context, db sdb.SimpleDB, m Manifest, w io.Writer) (Manifest, error) {
+	q := sdb.NewQuery(m.Domain)
+	switch {
+	case m.Previous == "":
+	case m.Since == "":
+		q.WhereExpr(sdb.QuoteName(m.Attribute) + " is not null")
+	default:
+		q.Where(m.Attribute, ">=", m.Since)
+	}
+	m.Created = time.Now().UTC()
+	bw := bufio.NewWriter(w)
+	ew := NewWriter(bw)
+	seen := make(map[string]bool)
+	c := db.SelectCursor(q.String())
+	for c.Next(ctx) {
+		i := c.Item()
+		if seen[i.Name] {
+			continue
+		}
+		seen[i.Name] = true
+		if err := ew.Write(i); err != nil {
+			return m, err
+		}
+		if v := i.Value(m.Attribute); m.Attribute != "" && v > m.Until {
+			m.Until = v
+		}
+	}
+	if err := c.Err(); err != nil {
+		return m, err
+	}
+	if err := bw.Flush(); err != nil {
+		return m, err
+	}
+	m.Items, m.SHA256 = ew.Count(), ew.Sum()
+	return m, nil
+}
+
+// ExportFile exports domain to path and writes the manifest to
+// path.manifest.json.
+func ExportFile(ctx context.Context, db sdb.SimpleDB, domain string, path string) (m Manifest, err error) {
+	return exportFile(ctx, db, Manifest{Domain: domain}, path)
+}
+
+func exportFile(ctx context.Context, db sdb.SimpleDB, m Manifest, path string) (Manifest, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return m, err
+	}
+	m, err = export(ctx, db, m, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return m, err
+	}
+	m.File = path
+	return m, WriteManifest(ManifestPath(path), m)
+}
+
+func ManifestPath(path string) string {
+	return path + ".manifest.json"
+}
+
+func WriteManifest(path string, m Manifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
+
+func ReadManifest(path string) (m Manifest, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(b, &m)
+	return
+}
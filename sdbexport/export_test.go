@@ -0,0 +1,229 @@
+package sdbexport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestItemChecksumOrder(t *testing.T) {
+	a := sdb.Item{Name: "i1", Attributes: []sdb.Attribute{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}}}
+	b := sdb.Item{Name: "i1", Attributes: []sdb.Attribute{{Name: "b", Value: "2"}, {Name: "a", Value: "1"}}}
+	if ItemChecksum(a) != ItemChecksum(b) {
+		t.Error("checksum depends on attribute order")
+	}
+	b.Attributes[0].Value = "3"
+	if ItemChecksum(a) == ItemChecksum(b) {
+		t.Error("checksum ignores values")
+	}
+}
+
+func TestWriterReader(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	items := []sdb.Item{
+		{Name: "i1", Attributes: []sdb.Attribute{{Name: "tag", Value: "x"}, {Name: "tag", Value: "y"}}},
+		{Name: "i2", Attributes: []sdb.Attribute{{Name: "n", Value: "1"}}},
+	}
+	for _, i := range items {
+		if err := w.Write(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := NewReader(bytes.NewReader(buf.Bytes()))
+	for _, i := range items {
+		rec, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Sum != ItemChecksum(i) {
+			t.Errorf("%s: sum %s", i.Name, rec.Sum)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+	if r.Sum() != w.Sum() || w.Count() != 2 {
+		t.Errorf("file sum %s, written %s", r.Sum(), w.Sum())
+	}
+}
+
+func TestVerifyCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write(sdb.Item{Name: "i1", Attributes: []sdb.Attribute{{Name: "a", Value: "1"}}})
+	m := Manifest{Domain: "d", Items: 1, SHA256: w.Sum()}
+	damaged := strings.Replace(buf.String(), `["1"]`, `["2"]`, 1)
+	rep, err := Verify(context.Background(), sdb.SimpleDB{}, strings.NewReader(damaged), m, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.OK() || rep.FileOK || len(rep.Discrepancies) != 1 {
+		t.Errorf("unexpected report %+v", rep)
+	}
+}
+
+func writeExport(t *testing.T, path string, m Manifest, items ...sdb.Item) Manifest {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWriter(f)
+	for _, i := range items {
+		w.Write(i)
+	}
+	f.Close()
+	m.File, m.Items, m.SHA256 = path, w.Count(), w.Sum()
+	if err := WriteManifest(ManifestPath(path), m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestCompactFile(t *testing.T) {
+	dir := t.TempDir()
+	item := func(name, v string) sdb.Item {
+		return sdb.Item{Name: name, Attributes: []sdb.Attribute{{Name: "updated_at", Value: v}}}
+	}
+	full := filepath.Join(dir, "full.jsonl")
+	d1 := filepath.Join(dir, "d1.jsonl")
+	d2 := filepath.Join(dir, "d2.jsonl")
+	writeExport(t, full, Manifest{Domain: "d", Attribute: "updated_at", Until: "1"}, item("a", "1"), item("b", "1"))
+	writeExport(t, d1, Manifest{Domain: "d", Attribute: "updated_at", Since: "1", Until: "2", Previous: full}, item("b", "2"))
+	writeExport(t, d2, Manifest{Domain: "d", Attribute: "updated_at", Since: "2", Until: "3", Previous: d1}, item("c", "3"))
+
+	out := filepath.Join(dir, "snap.jsonl")
+	m, err := CompactFile(d2, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Items != 3 || m.Until != "3" || m.Previous != "" {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+	b, _ := os.ReadFile(out)
+	r := NewReader(bytes.NewReader(b))
+	want := map[string]string{"a": "1", "b": "2", "c": "3"}
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rec.Item().Value("updated_at"); got != want[rec.Name] {
+			t.Errorf("%s: updated_at %s, expected %s", rec.Name, got, want[rec.Name])
+		}
+	}
+
+	os.WriteFile(d1, []byte("{}\n"), 0644)
+	if _, err := CompactFile(d2, out); err == nil {
+		t.Error("expected error for damaged delta")
+	}
+}
+
+func TestParquetWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewParquetWriter(&buf, []ParquetColumn{{Name: "color"}, {Name: "tags", List: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(sdb.Item{Name: "i1", Attributes: []sdb.Attribute{{Name: "color", Value: "red"}, {Name: "tags", Value: "a"}, {Name: "tags", Value: "b"}}})
+	w.Write(sdb.Item{Name: "i2"})
+	if err := w.Write(sdb.Item{Name: "i3", Attributes: []sdb.Attribute{{Name: "size", Value: "1"}}}); err == nil {
+		t.Error("expected error for attribute without column")
+	}
+	if err := w.Write(sdb.Item{Name: "i4", Attributes: []sdb.Attribute{{Name: "color", Value: "red"}, {Name: "color", Value: "blue"}}}); err == nil {
+		t.Error("expected error for several values in a single column")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := parquet.NewReader(bytes.NewReader(buf.Bytes()))
+	if r.NumRows() != 2 {
+		t.Fatalf("expected 2 rows, got %d", r.NumRows())
+	}
+	row := map[string]any{}
+	if err := r.Read(&row); err != nil {
+		t.Fatal(err)
+	}
+	if row["itemName"] != "i1" || row["color"] != "red" || fmt.Sprint(row["tags"]) != "[a b]" {
+		t.Errorf("unexpected row %v", row)
+	}
+}
+
+func TestExportDeltaFile(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	if _, err := db.CreateDomain("d"); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	put := func(name string, attrs ...sdb.Attribute) {
+		t.Helper()
+		if _, err := db.PutAttributes("d", &sdb.Item{Name: name, Attributes: attrs}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stamp := func(t time.Time) sdb.Attribute { return sdb.Attribute{Name: "updated_at", Value: sdb.EncodeTime(t)} }
+	names := func(path string) (ns []string) {
+		t.Helper()
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := NewReader(bytes.NewReader(b))
+		for {
+			rec, err := r.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			ns = append(ns, rec.Name)
+		}
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	put("a", sdb.Attribute{Name: "color", Value: "red"})
+	full := filepath.Join(dir, "full.jsonl")
+	m, err := ExportDeltaFile(ctx, db, "d", "updated_at", "", full)
+	if err != nil || m.Until != "" {
+		t.Fatalf("full export: %+v %v", m, err)
+	}
+
+	put("b", stamp(now))
+	d1 := filepath.Join(dir, "d1.jsonl")
+	if m, err = ExportDeltaFile(ctx, db, "d", "updated_at", full, d1); err != nil || m.Since != "" || m.Until != sdb.EncodeTime(now) {
+		t.Fatalf("first delta: %+v %v", m, err)
+	}
+	if got := fmt.Sprint(names(d1)); got != "[b]" {
+		t.Errorf("first delta exported %s", got)
+	}
+
+	// c has the same timestamp as b, e was stamped before d1 was made
+	put("c", stamp(now))
+	put("e", stamp(now.Add(-DeltaOverlap/2)))
+	d2 := filepath.Join(dir, "d2.jsonl")
+	if m, err = ExportDeltaFile(ctx, db, "d", "updated_at", d1, d2); err != nil || m.Since != sdb.EncodeTime(now.Add(-DeltaOverlap)) {
+		t.Fatalf("second delta: %+v %v", m, err)
+	}
+	got := names(d2)
+	sort.Strings(got)
+	if fmt.Sprint(got) != "[b c e]" {
+		t.Errorf("second delta exported %v", got)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdbexport
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/coopernurse/sdb"
+	"github.com/parquet-go/parquet-go"
+)
+
+// ParquetNameColumn is the Parquet column holding the item name.
+const ParquetNameColumn = "itemName"
+
+// ParquetColumn is an attribute exported as an optional string column, or a
+// list of strings when List is set.
+type ParquetColumn struct {
+	Name string
+	List bool
+}
+
+// ParquetWriter writes items as Parquet rows with one column per attribute.
+type ParquetWriter struct {
+	w     *parquet.Writer
+	cols  map[string]ParquetColumn
+	count int
+}
+
+func NewParquetWriter(w io.Writer, cols []ParquetColumn) (*ParquetWriter, error) {
+	g := parquet.Group{ParquetNameColumn: parquet.String()}
+	pw := &ParquetWriter{cols: make(map[string]ParquetColumn)}
+	for _, c := range cols {
+		if _, ok := g[c.Name]; ok {
+			return nil, fmt.Errorf("sdbexport: duplicate parquet column %s", c.Name)
+		}
+		if c.List {
+			g[c.Name] = parquet.List(parquet.String())
+		} else {
+			g[c.Name] = parquet.Optional(parquet.String())
+		}
+		pw.cols[c.Name] = c
+	}
+	pw.w = parquet.NewWriter(w, parquet.NewSchema("item", g))
+	return pw, nil
+}
+
+// Write adds i as a row. An attribute without a column, or with several
+// values for a column that is not a list, is an error.
+func (w *ParquetWriter) Write(i sdb.Item) error {
+	row := map[string]any{ParquetNameColumn: i.Name}
+	for _, c := range w.cols {
+		if c.List {
+			row[c.Name] = []string{}
+		}
+	}
+	for _, a := range i.Attributes {
+		c, ok := w.cols[a.Name]
+		switch {
+		case !ok:
+			return fmt.Errorf("sdbexport: item %s: no parquet column for attribute %s", i.Name, a.Name)
+		case c.List:
+			row[a.Name] = append(row[a.Name].([]string), a.Value)
+		case row[a.Name] != nil:
+			return fmt.Errorf("sdbexport: item %s: attribute %s has several values but is not a list column", i.Name, a.Name)
+		default:
+			row[a.Name] = a.Value
+		}
+	}
+	if err := w.w.Write(row); err != nil {
+		return err
+	}
+	w.count++
+	return nil
+}
+
+func (w *ParquetWriter) Count() int {
+	return w.count
+}
+
+// Close flushes the remaining rows and writes the file footer.
+func (w *ParquetWriter) Close() error {
+	return w.w.Close()
+}
+
+// ParquetColumns scans domain and returns a column for every attribute,
+// as a list when any item has several values for it.
+func ParquetColumns(ctx context.Context, db sdb.SimpleDB, domain string) (cols []ParquetColumn, err error) {
+	list := make(map[string]bool)
+	c := db.SelectCursor(sdb.NewQuery(domain).String())
+	for c.Next(ctx) {
+		n := make(map[string]int)
+		for _, a := range c.Item().Attributes {
+			n[a.Name]++
+			list[a.Name] = list[a.Name] || n[a.Name] > 1
+		}
+	}
+	if err = c.Err(); err != nil {
+		return
+	}
+	for name, l := range list {
+		cols = append(cols, ParquetColumn{Name: name, List: l})
+	}
+	sort.Slice(cols, func(i, j int) bool { return cols[i].Name < cols[j].Name })
+	return
+}
+
+// ExportParquet writes every item of domain to w as a Parquet file. With nil
+// cols the columns are found with ParquetColumns first, which reads the
+// domain twice.
+func ExportParquet(ctx context.Context, db sdb.SimpleDB, domain string, cols []ParquetColumn, w io.Writer) (m Manifest, err error) {
+	if cols == nil {
+		if cols, err = ParquetColumns(ctx, db, domain); err != nil {
+			return
+		}
+	}
+	m = Manifest{Domain: domain, Created: time.Now().UTC()}
+	h := sha256.New()
+	pw, err := NewParquetWriter(io.MultiWriter(w, h), cols)
+	if err != nil {
+		return
+	}
+	c := db.SelectCursor(sdb.NewQuery(domain).String())
+	for c.Next(ctx) {
+		if err = pw.Write(c.Item()); err != nil {
+			return
+		}
+	}
+	if err = c.Err(); err != nil {
+		return
+	}
+	if err = pw.Close(); err != nil {
+		return
+	}
+	m.Items, m.SHA256 = pw.Count(), hex.EncodeToString(h.Sum(nil))
+	return
+}
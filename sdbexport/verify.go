@@ -0,0 +1,149 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdbexport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+
+	"github.com/coopernurse/sdb"
+)
+
+// Discrepancy is an item that differs between a backup and the live domain.
+type Discrepancy struct {
+	Item   string
+	Reason string
+}
+
+func (d Discrepancy) String() string {
+	return d.Item + ": " + d.Reason
+}
+
+// Report is the result of Verify. FileOK is false when the file checksum or
+// item count does not match the manifest.
+type Report struct {
+	Items         int
+	Checked       int
+	FileOK        bool
+	Discrepancies []Discrepancy
+}
+
+// OK reports whether the backup matched the manifest and the live domain.
+func (r Report) OK() bool {
+	return r.FileOK && len(r.Discrepancies) == 0
+}
+
+// Verify reads a backup described by m, checking every record and the file
+// checksum, and compares a fraction sample of the records against the live
+// domain using consistent reads. With sample 1 or more every record is
+// compared and the domain is also scanned for items missing from the backup.
+func Verify(ctx context.Context, db sdb.SimpleDB, backup io.Reader, m Manifest, sample float64) (rep Report, err error) {
+	db.ConsistentRead = true
+	full := sample >= 1
+	seen := make(map[string]bool)
+	r := NewReader(backup)
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		var rec Record
+		rec, err = r.Next()
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		if err == ErrChecksum {
+			rep.Items++
+			rep.Discrepancies = append(rep.Discrepancies, Discrepancy{rec.Name, "record checksum mismatch"})
+			continue
+		}
+		if err != nil {
+			return
+		}
+		rep.Items++
+		if full {
+			seen[rec.Name] = true
+		}
+		if !full && rand.Float64() >= sample {
+			continue
+		}
+		var d *Discrepancy
+		if d, err = compare(&db, m.Domain, rec); err != nil {
+			return
+		}
+		rep.Checked++
+		if d != nil {
+			rep.Discrepancies = append(rep.Discrepancies, *d)
+		}
+	}
+	rep.FileOK = r.Sum() == m.SHA256 && rep.Items == m.Items
+	if !full {
+		return
+	}
+	c := db.SelectCursor(sdb.NewQuery(m.Domain).Output("itemName()").String())
+	for c.Next(ctx) {
+		if name := c.Item().Name; !seen[name] {
+			rep.Discrepancies = append(rep.Discrepancies, Discrepancy{name, "not in backup"})
+		}
+	}
+	err = c.Err()
+	return
+}
+
+func compare(db *sdb.SimpleDB, domain string, rec Record) (d *Discrepancy, err error) {
+	r, err := db.GetAttributes(domain, rec.Name)
+	if err != nil {
+		return
+	}
+	if len(r.Attributes) == 0 {
+		return &Discrepancy{rec.Name, "missing from domain"}, nil
+	}
+	if sum := ItemChecksum(sdb.Item{Name: rec.Name, Attributes: r.Attributes}); sum != rec.Sum {
+		return &Discrepancy{rec.Name, fmt.Sprintf("changed, backup %.12s live %.12s", rec.Sum, sum)}, nil
+	}
+	return
+}
+
+// VerifyFile verifies the backup at path against the manifest written next
+// to it by ExportFile.
+func VerifyFile(ctx context.Context, db sdb.SimpleDB, path string, sample float64) (rep Report, err error) {
+	m, err := ReadManifest(ManifestPath(path))
+	if err != nil {
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return Verify(ctx, db, f, m, sample)
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+// Package sdbgrpc exposes the sdb client as a gRPC service defined in sdb.proto.
+package sdbgrpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/coopernurse/sdb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Server struct {
+	UnimplementedSimpleDBServer
+	// HTTPClient sends the SimpleDB requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+	accessKey  string
+	secretKey  string
+	region     string
+}
+
+func NewServer(a string, s string, r string) *Server {
+	return &Server{accessKey: a, secretKey: s, region: r}
+}
+
+// client returns a new SimpleDB client per call since a client keeps
+// per-request state and calls are served concurrently. It is bound to the
+// context of the call, so cancellations and deadlines reach SimpleDB.
+func (s *Server) client(ctx context.Context) sdb.SimpleDB {
+	db := sdb.NewSimpleDB(s.accessKey, s.secretKey, s.region)
+	db.HTTPClient = s.HTTPClient
+	return db.WithContext(ctx)
+}
+
+func (s *Server) Get(ctx context.Context, req *GetRequest) (*Item, error) {
+	db := s.client(ctx)
+	r, err := db.GetAttributes(req.Domain, req.ItemName)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if len(r.Attributes) == 0 {
+		return nil, status.Errorf(codes.NotFound, "item %s not found in %s", req.ItemName, req.Domain)
+	}
+	return toProto(sdb.Item{Name: req.ItemName, Attributes: r.Attributes}), nil
+}
+
+func (s *Server) Put(ctx context.Context, req *PutRequest) (*PutResponse, error) {
+	if req.Item == nil {
+		return nil, status.Error(codes.InvalidArgument, "item is required")
+	}
+	db := s.client(ctx)
+	r, err := db.PutAttributes(req.Domain, fromProto(req.Item))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &PutResponse{RequestId: r.ResponseMetadata.RequestId, BoxUsage: r.ResponseMetadata.BoxUsage}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, req *DeleteRequest) (*DeleteResponse, error) {
+	db := s.client(ctx)
+	r, err := db.DeleteItem(req.Domain, req.ItemName)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &DeleteResponse{RequestId: r.ResponseMetadata.RequestId, BoxUsage: r.ResponseMetadata.BoxUsage}, nil
+}
+
+func (s *Server) Select(ctx context.Context, req *SelectRequest) (*SelectResponse, error) {
+	db := s.client(ctx)
+	r, err := db.SelectWithToken(req.Expression, req.NextToken)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &SelectResponse{NextToken: r.NextToken}
+	for _, i := range r.Items {
+		resp.Items = append(resp.Items, toProto(i))
+	}
+	return resp, nil
+}
+
+func (s *Server) SelectStream(req *SelectRequest, stream SimpleDB_SelectStreamServer) error {
+	db := s.client(stream.Context())
+	token := req.NextToken
+	for {
+		if err := stream.Context().Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		r, err := db.SelectWithToken(req.Expression, token)
+		if err != nil {
+			return toStatus(err)
+		}
+		for _, i := range r.Items {
+			if err := stream.Send(toProto(i)); err != nil {
+				return err
+			}
+		}
+		if r.NextToken == "" {
+			return nil
+		}
+		token = r.NextToken
+	}
+}
+
+func toProto(i sdb.Item) *Item {
+	p := &Item{Name: i.Name}
+	for _, a := range i.Attributes {
+		p.Attributes = append(p.Attributes, &Attribute{Name: a.Name, Value: a.Value, Replace: a.Replace})
+	}
+	return p
+}
+
+func fromProto(p *Item) *sdb.Item {
+	i := sdb.NewItem(p.Name)
+	for _, a := range p.Attributes {
+		i.Attributes = append(i.Attributes, sdb.Attribute{Name: a.Name, Value: a.Value, Replace: a.Replace})
+	}
+	return i
+}
+
+// toStatus maps errors of the client to gRPC status codes.
+func toStatus(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	if errors.Is(err, sdb.ErrTimeout) {
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	var ae sdb.ActionError
+	var pe sdb.PolicyError
+	if errors.As(err, &ae) || errors.As(err, &pe) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	var e sdb.SimpleDBError
+	if !errors.As(err, &e) {
+		var re *sdb.RequestError
+		if errors.As(err, &re) {
+			return status.Error(httpCode(re.StatusCode), err.Error())
+		}
+		return status.Error(codes.Unknown, err.Error())
+	}
+	c := httpCode(e.StatusCode)
+	switch e.Code {
+	case "NoSuchDomain":
+		c = codes.NotFound
+	case "AuthFailure", "InvalidClientTokenId", "SignatureDoesNotMatch", "OptInRequired":
+		c = codes.PermissionDenied
+	case "ServiceUnavailable", "RequestThrottled":
+		c = codes.Unavailable
+	case "NumberDomainsExceeded", "NumberDomainAttributesExceeded", "NumberDomainBytesExceeded", "NumberItemAttributesExceeded":
+		c = codes.ResourceExhausted
+	case "ConditionalCheckFailed", "AttributeDoesNotExist":
+		c = codes.FailedPrecondition
+	case "InternalError":
+		c = codes.Internal
+	}
+	return status.Error(c, e.Error())
+}
+
+// httpCode maps the HTTP status of a failed request, 0 if none was
+// received.
+func httpCode(statusCode int) codes.Code {
+	switch {
+	case statusCode == 0:
+		return codes.Unavailable
+	case statusCode == http.StatusForbidden || statusCode == http.StatusUnauthorized:
+		return codes.PermissionDenied
+	case statusCode == http.StatusNotFound:
+		return codes.NotFound
+	case statusCode == http.StatusConflict:
+		return codes.FailedPrecondition
+	case statusCode >= 500:
+		return codes.Unavailable
+	}
+	return codes.InvalidArgument
+}
@@ -0,0 +1,89 @@
+package sdbgrpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/coopernurse/sdb/sdbtest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// ctxTransport fails requests whose context is done, as a network transport
+// would.
+type ctxTransport struct {
+	http.RoundTripper
+}
+
+func (t ctxTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
+
+func TestServer(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	if _, err := db.CreateDomain("users"); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer("a", "s", "sdb.fake")
+	s.HTTPClient = &http.Client{Transport: ctxTransport{f}}
+
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	RegisterSimpleDBServer(gs, s)
+	go gs.Serve(lis)
+	defer gs.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := NewSimpleDBClient(conn)
+	ctx := context.Background()
+
+	item := &Item{Name: "u1", Attributes: []*Attribute{{Name: "name", Value: "Ann"}}}
+	if _, err := c.Put(ctx, &PutRequest{Domain: "users", Item: item}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Get(ctx, &GetRequest{Domain: "users", ItemName: "u1"})
+	if err != nil || len(got.Attributes) != 1 || got.Attributes[0].Value != "Ann" {
+		t.Fatalf("Get = %v, %v", got, err)
+	}
+	sel, err := c.Select(ctx, &SelectRequest{Expression: "select * from users"})
+	if err != nil || len(sel.Items) != 1 {
+		t.Fatalf("Select = %v, %v", sel, err)
+	}
+	if _, err := c.Delete(ctx, &DeleteRequest{Domain: "users", ItemName: "u1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		err  error
+		code codes.Code
+	}{
+		{func() error { _, err := c.Get(ctx, &GetRequest{Domain: "users", ItemName: "u1"}); return err }(), codes.NotFound},
+		{func() error { _, err := c.Get(ctx, &GetRequest{Domain: "missing", ItemName: "u1"}); return err }(), codes.NotFound},
+		{func() error { _, err := c.Select(ctx, &SelectRequest{Expression: "select from"}); return err }(), codes.InvalidArgument},
+		{func() error { _, err := c.Put(ctx, &PutRequest{Domain: "users"}); return err }(), codes.InvalidArgument},
+	} {
+		if status.Code(tc.err) != tc.code {
+			t.Errorf("expected %v, got %v", tc.code, tc.err)
+		}
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := s.Get(canceled, &GetRequest{Domain: "users", ItemName: "u1"}); status.Code(err) != codes.Canceled {
+		t.Errorf("expected Canceled, got %v", err)
+	}
+}
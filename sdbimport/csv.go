@@ -0,0 +1,355 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+// Package sdbimport loads CSV files into SimpleDB domains.
+//
+// A Mapping names the CSV column holding the item name, or a generator for
+// it, and maps the other columns to attributes, encoding typed values so they
+// sort correctly in Select:
+//
+//	{
+//		"itemName": "id",
+//		"columns": [
+//			{"column": "Name", "attribute": "name"},
+//			{"column": "Age", "attribute": "age", "type": "int"},
+//			{"column": "Tags", "attribute": "tag", "split": ";"}
+//		]
+//	}
+package sdbimport
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coopernurse/sdb"
+)
+
+const maxBatchItems = 25
+
+// TypeCodec converts a CSV value to the attribute value stored.
+type TypeCodec func(string) (string, error)
+
+// Types are the codecs a Column can name in Type.
+var Types = map[string]TypeCodec{
+	"string": func(s string) (string, error) { return s, nil },
+	"int": func(s string) (string, error) {
+		n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		return sdb.EncodeInt(n), err
+	},
+	"float": func(s string) (string, error) {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		return sdb.EncodeFloat(f), err
+	},
+	"time": func(s string) (string, error) {
+		t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(s))
+		return sdb.EncodeTime(t), err
+	},
+	"bool": func(s string) (string, error) {
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		return strconv.FormatBool(b), err
+	},
+}
+
+// Generators are the item name generators a Mapping can name in Generator.
+var Generators = map[string]sdb.IDGenerator{
+	"uuid":  sdb.UUIDv4,
+	"ulid":  sdb.ULID,
+	"ksuid": sdb.KSUID,
+	"time":  sdb.TimePrefixed,
+}
+
+// Column maps a CSV column, by header, to an attribute. Attribute defaults to
+// the column and Type to string. With Split set a value is split into several
+// values of a multi-valued attribute. Empty values are skipped.
+type Column struct {
+	Column    string `json:"column"`
+	Attribute string `json:"attribute,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Split     string `json:"split,omitempty"`
+}
+
+// Mapping describes how CSV rows become items. ItemName is the column
+// holding the item name, when empty Generator names a generator in
+// Generators. Replace replaces existing attribute values instead of adding.
+type Mapping struct {
+	ItemName  string   `json:"itemName,omitempty"`
+	Generator string   `json:"generator,omitempty"`
+	Columns   []Column `json:"columns"`
+	Replace   bool     `json:"replace,omitempty"`
+}
+
+func LoadMapping(path string) (m Mapping, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(b, &m)
+	return
+}
+
+// RowError is a CSV row that could not be imported. Row is the line number,
+// the header being line 1.
+type RowError struct {
+	Row    int
+	Item   string
+	Record []string
+	Err    error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+}
+
+func (e RowError) Unwrap() error {
+	return e.Err
+}
+
+// Result counts the rows read and imported. In a dry run Imported counts the
+// rows that would be imported.
+type Result struct {
+	Rows     int
+	Imported int
+	Errors   []RowError
+}
+
+// Importer imports CSV rows into a domain. With DryRun set rows are only
+// converted and validated. Batches are written by Scheduler, one at a time
+// when it is nil.
+type Importer struct {
+	db        sdb.SimpleDB
+	domain    string
+	mapping   Mapping
+	DryRun    bool
+	Scheduler *Scheduler
+}
+
+func NewImporter(db sdb.SimpleDB, domain string, m Mapping) *Importer {
+	return &Importer{db: db, domain: domain, mapping: m}
+}
+
+type column struct {
+	Column
+	index int
+	codec TypeCodec
+}
+
+// compile resolves the mapping against the CSV header.
+func (im *Importer) compile(header []string) (cols []column, name int, gen sdb.IDGenerator, err error) {
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		index[strings.TrimSpace(h)] = i
+	}
+	name = -1
+	if im.mapping.ItemName != "" {
+		var ok bool
+		if name, ok = index[im.mapping.ItemName]; !ok {
+			return nil, 0, nil, fmt.Errorf("sdbimport: item name column %s not in header", im.mapping.ItemName)
+		}
+	} else if gen = Generators[im.mapping.Generator]; gen == nil {
+		return nil, 0, nil, fmt.Errorf("sdbimport: unknown generator %q", im.mapping.Generator)
+	}
+	for _, c := range im.mapping.Columns {
+		cc := column{Column: c}
+		var ok bool
+		if cc.index, ok = index[c.Column]; !ok {
+			return nil, 0, nil, fmt.Errorf("sdbimport: column %s not in header", c.Column)
+		}
+		if cc.Attribute == "" {
+			cc.Attribute = c.Column
+		}
+		typ := c.Type
+		if typ == "" {
+			typ = "string"
+		}
+		if cc.codec = Types[typ]; cc.codec == nil {
+			return nil, 0, nil, fmt.Errorf("sdbimport: column %s: unknown type %q", c.Column, typ)
+		}
+		cols = append(cols, cc)
+	}
+	return
+}
+
+// item converts one CSV record.
+func (im *Importer) item(rec []string, cols []column, name int, gen sdb.IDGenerator) (i *sdb.Item, err error) {
+	i = &sdb.Item{}
+	if name >= 0 {
+		i.Name = rec[name]
+	} else if i.Name, err = gen(); err != nil {
+		return
+	}
+	if err = sdb.ValidateAttributeName(i.Name); err != nil {
+		return
+	}
+	for _, c := range cols {
+		values := []string{rec[c.index]}
+		if c.Split != "" {
+			values = strings.Split(rec[c.index], c.Split)
+		}
+		for _, v := range values {
+			if v == "" {
+				continue
+			}
+			if v, err = c.codec(v); err != nil {
+				return i, fmt.Errorf("column %s: %w", c.Column, err)
+			}
+			if err = sdb.ValidateValue(v); err != nil {
+				return i, fmt.Errorf("column %s: %w", c.Column, err)
+			}
+			if im.mapping.Replace {
+				i.ReplaceAttribute(c.Attribute, v)
+			} else {
+				i.AddAttribute(c.Attribute, v)
+			}
+		}
+	}
+	return
+}
+
+// Import reads r, a CSV file with a header line, and writes its rows in
+// batches. Rows that fail to convert or whose batch fails are reported in
+// Result.Errors and the import goes on; the error returned is for the CSV
+// itself, the mapping or a cancelled ctx. Import waits for the batches it
+// started before returning.
+func (im *Importer) Import(ctx context.Context, r io.Reader) (res Result, err error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return
+	}
+	cols, name, gen, err := im.compile(header)
+	if err != nil {
+		return
+	}
+	db := im.db.WithContext(ctx)
+	sched := im.Scheduler
+	if sched == nil {
+		sched = NewScheduler(1, 0)
+	}
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		batch []*sdb.Item
+		rows  []RowError
+	)
+	fail := func(e RowError) {
+		mu.Lock()
+		res.Errors = append(res.Errors, e)
+		mu.Unlock()
+	}
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if im.DryRun {
+			res.Imported += len(batch)
+			batch, rows = nil, nil
+			return
+		}
+		if err = sched.acquire(ctx); err != nil {
+			return
+		}
+		wg.Add(1)
+		go func(batch []*sdb.Item, rows []RowError) {
+			defer wg.Done()
+			db := db
+			r, berr := db.BatchPutAttributes(im.domain, batch)
+			sched.done(r.ResponseMetadata.BoxUsage, berr)
+			mu.Lock()
+			defer mu.Unlock()
+			if berr == nil {
+				res.Imported += len(batch)
+				return
+			}
+			for _, row := range rows {
+				row.Err = berr
+				res.Errors = append(res.Errors, row)
+			}
+		}(batch, rows)
+		batch, rows = nil, nil
+	}
+	defer func() {
+		wg.Wait()
+		sort.Slice(res.Errors, func(i, j int) bool { return res.Errors[i].Row < res.Errors[j].Row })
+	}()
+	for line := 2; ; line++ {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		var rec []string
+		rec, err = cr.Read()
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		if err != nil {
+			return
+		}
+		res.Rows++
+		if len(rec) != len(header) {
+			fail(RowError{Row: line, Record: rec, Err: fmt.Errorf("%d fields, header has %d", len(rec), len(header))})
+			continue
+		}
+		i, ierr := im.item(rec, cols, name, gen)
+		if ierr != nil {
+			fail(RowError{Row: line, Item: i.Name, Record: rec, Err: ierr})
+			continue
+		}
+		batch = append(batch, i)
+		rows = append(rows, RowError{Row: line, Item: i.Name, Record: rec})
+		if len(batch) == maxBatchItems {
+			if flush(); err != nil {
+				return
+			}
+		}
+	}
+	flush()
+	return
+}
+
+// WriteErrors writes the failed rows of res as CSV with header, adding a
+// leading row number column and a trailing error column, so they can be
+// fixed and imported again.
+func WriteErrors(w io.Writer, header []string, res Result) error {
+	cw := csv.NewWriter(w)
+	cw.Write(append(append([]string{"row"}, header...), "error"))
+	for _, e := range res.Errors {
+		cw.Write(append(append([]string{strconv.Itoa(e.Row)}, e.Record...), e.Err.Error()))
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,103 @@
+package sdbimport
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coopernurse/sdb"
+)
+
+const people = `id,Name,Age,Tags
+p1,Ann,42,a;b
+p2,Bob,old,
+p3,Cid,7
+p4,Dee,-1,c
+`
+
+func TestImportDryRun(t *testing.T) {
+	im := NewImporter(sdb.SimpleDB{}, "people", Mapping{
+		ItemName: "id",
+		Columns: []Column{
+			{Column: "Name", Attribute: "name"},
+			{Column: "Age", Attribute: "age", Type: "int"},
+			{Column: "Tags", Attribute: "tag", Split: ";"},
+		},
+	})
+	im.DryRun = true
+	res, err := im.Import(context.Background(), strings.NewReader(people))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Rows != 4 || res.Imported != 2 || len(res.Errors) != 2 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if res.Errors[0].Row != 3 || res.Errors[0].Item != "p2" || res.Errors[1].Row != 4 {
+		t.Errorf("unexpected errors %v", res.Errors)
+	}
+	var buf bytes.Buffer
+	if err := WriteErrors(&buf, []string{"id", "Name", "Age", "Tags"}, res); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "row,id,Name,Age,Tags,error\n3,p2,Bob,old,,") {
+		t.Errorf("unexpected error rows %q", buf.String())
+	}
+}
+
+func TestImportItem(t *testing.T) {
+	im := NewImporter(sdb.SimpleDB{}, "people", Mapping{
+		Generator: "ulid",
+		Columns:   []Column{{Column: "Age", Type: "int"}, {Column: "Tags", Attribute: "tag", Split: ";"}},
+	})
+	cols, name, gen, err := im.compile([]string{"id", "Name", "Age", "Tags"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := im.item([]string{"p1", "Ann", "42", "a;b"}, cols, name, gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(i.Name) != 26 || i.Value("Age") != sdb.EncodeInt(42) || len(i.Attributes) != 3 {
+		t.Errorf("unexpected item %+v", i)
+	}
+}
+
+func TestImportMappingErrors(t *testing.T) {
+	for _, m := range []Mapping{
+		{ItemName: "missing"},
+		{Generator: "nope"},
+		{ItemName: "id", Columns: []Column{{Column: "Age", Type: "decimal"}}},
+	} {
+		if _, _, _, err := NewImporter(sdb.SimpleDB{}, "people", m).compile([]string{"id", "Age"}); err == nil {
+			t.Errorf("expected error for %+v", m)
+		}
+	}
+}
+
+func TestSchedulerAdapts(t *testing.T) {
+	s := NewScheduler(4, 0)
+	ctx := context.Background()
+	for j := 0; j < 10; j++ {
+		s.acquire(ctx)
+		s.done(0.001, nil)
+	}
+	if c := s.Concurrency(); c != 4 {
+		t.Fatalf("expected concurrency 4 after clean batches, got %d", c)
+	}
+	s.acquire(ctx)
+	s.done(0, sdb.SimpleDBError{Code: "ServiceUnavailable"})
+	if c := s.Concurrency(); c != 2 {
+		t.Errorf("expected concurrency 2 after throttling, got %d", c)
+	}
+}
+
+func TestSchedulerPacing(t *testing.T) {
+	s := NewScheduler(1, 0.01)
+	s.acquire(context.Background())
+	s.done(0.001, nil)
+	if d := time.Until(s.next); d < 50*time.Millisecond || d > 100*time.Millisecond {
+		t.Errorf("expected about 100ms until the next batch, got %v", d)
+	}
+}
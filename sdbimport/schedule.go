@@ -0,0 +1,134 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdbimport
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/coopernurse/sdb"
+)
+
+// Scheduler runs import batches concurrently, adapting to how SimpleDB
+// responds. A throttled batch halves the concurrency, as does an error rate
+// above MaxErrorRate, while a run of clean batches adds one more, up to
+// MaxConcurrency. With TargetBoxUsage set, batches are paced so the BoxUsage
+// they report averages that many machine hours per second.
+type Scheduler struct {
+	MaxConcurrency int
+	TargetBoxUsage float64
+	MaxErrorRate   float64
+
+	mu          sync.Mutex
+	cond        *sync.Cond
+	concurrency int
+	running     int
+	next        time.Time
+	clean       int
+	batches     int
+	errors      int
+}
+
+// NewScheduler returns a Scheduler starting at one batch at a time.
+func NewScheduler(maxConcurrency int, targetBoxUsage float64) *Scheduler {
+	s := &Scheduler{MaxConcurrency: maxConcurrency, TargetBoxUsage: targetBoxUsage, MaxErrorRate: 0.05, concurrency: 1}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Concurrency returns the number of batches currently allowed to run at once.
+func (s *Scheduler) Concurrency() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.concurrency
+}
+
+// acquire waits for a free slot and for the pacing delay.
+func (s *Scheduler) acquire(ctx context.Context) error {
+	s.mu.Lock()
+	for s.running >= s.concurrency {
+		if err := ctx.Err(); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		s.cond.Wait()
+	}
+	s.running++
+	wait := time.Until(s.next)
+	s.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		s.release()
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) release() {
+	s.mu.Lock()
+	s.running--
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+// done records the outcome of a batch and frees its slot.
+func (s *Scheduler) done(boxUsage float64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	defer s.cond.Broadcast()
+	if s.TargetBoxUsage > 0 && boxUsage > 0 {
+		now := time.Now()
+		if s.next.Before(now) {
+			s.next = now
+		}
+		s.next = s.next.Add(time.Duration(boxUsage / s.TargetBoxUsage * float64(time.Second)))
+	}
+	s.batches++
+	if err != nil {
+		s.errors++
+	}
+	switch {
+	case sdb.Throttled(err), s.batches >= 10 && float64(s.errors)/float64(s.batches) > s.MaxErrorRate:
+		s.concurrency = max(1, s.concurrency/2)
+		s.clean, s.batches, s.errors = 0, 0, 0
+	case err == nil:
+		if s.clean++; s.clean >= s.concurrency && s.concurrency < s.MaxConcurrency {
+			s.concurrency++
+			s.clean = 0
+		}
+	}
+}
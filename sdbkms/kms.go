@@ -0,0 +1,199 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+// Package sdbkms is an sdb.KeyProvider backed by AWS KMS: data keys are
+// generated and decrypted by KMS, so master keys never leave it. Requests
+// are signed with Signature Version 4 without depending on the AWS SDK.
+package sdbkms
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coopernurse/sdb"
+)
+
+// Provider generates data keys under the KMS key Key, given as key ID, ARN
+// or alias. Values are tagged with Key, so after pointing Key at a new KMS
+// key run RotateKeys to re-encrypt them; rotation KMS does itself is
+// transparent.
+type Provider struct {
+	Key          string
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// Endpoint replaces https://kms.<Region>.amazonaws.com/.
+	Endpoint   string
+	HTTPClient *http.Client
+}
+
+func New(key, region, accessKey, secretKey string) *Provider {
+	return &Provider{Key: key, Region: region, AccessKey: accessKey, SecretKey: secretKey}
+}
+
+// Error is an error response from KMS.
+type Error struct {
+	Type       string `json:"__type"`
+	Message    string `json:"message"`
+	StatusCode int    `json:"-"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("kms: %s: %s (status %d)", e.Type, e.Message, e.StatusCode)
+}
+
+func (p *Provider) KeyID() string {
+	return p.Key
+}
+
+func (p *Provider) GenerateKey(ctx context.Context) (k sdb.DataKey, err error) {
+	var r struct {
+		CiphertextBlob []byte
+		Plaintext      []byte
+	}
+	if err = p.call(ctx, "GenerateDataKey", map[string]string{"KeyId": p.Key, "KeySpec": "AES_256"}, &r); err != nil {
+		return
+	}
+	return sdb.DataKey{KeyID: p.Key, Plaintext: r.Plaintext, Encrypted: r.CiphertextBlob}, nil
+}
+
+func (p *Provider) DecryptKey(ctx context.Context, keyID string, encrypted []byte) ([]byte, error) {
+	var r struct{ Plaintext []byte }
+	err := p.call(ctx, "Decrypt", map[string]interface{}{"KeyId": keyID, "CiphertextBlob": encrypted}, &r)
+	return r.Plaintext, err
+}
+
+func (p *Provider) endpoint() string {
+	if p.Endpoint != "" {
+		return p.Endpoint
+	}
+	return "https://kms." + p.Region + ".amazonaws.com/"
+}
+
+// call makes a KMS JSON request. []byte fields are base64 encoded both
+// ways, as KMS expects.
+func (p *Provider) call(ctx context.Context, action string, in interface{}, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", p.endpoint(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	if p.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", p.SessionToken)
+	}
+	signV4(req, body, time.Now(), p.Region, "kms", p.AccessKey, p.SecretKey)
+
+	client := p.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := &Error{StatusCode: resp.StatusCode}
+		json.Unmarshal(b, e)
+		if i := strings.LastIndex(e.Type, "#"); i >= 0 {
+			e.Type = e.Type[i+1:]
+		}
+		return e
+	}
+	return json.Unmarshal(b, out)
+}
+
+// signV4 adds the Signature Version 4 date and authorization headers to
+// req, signing all its headers.
+func signV4(req *http.Request, body []byte, now time.Time, region, service, accessKey, secretKey string) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, vs := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(vs, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonical := strings.Join([]string{req.Method, path, req.URL.RawQuery, canonicalHeaders.String(), signed, hexSHA256(body)}, "\n")
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256([]byte(canonical))
+
+	key := []byte("AWS4" + secretKey)
+	for _, s := range []string{day, region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hexSHA256(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,90 @@
+package sdbkms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coopernurse/sdb"
+)
+
+// get-vanilla from the AWS Signature Version 4 test suite.
+func TestSignV4(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	signV4(req, nil, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC), "us-east-1", "service", "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %s", got)
+	}
+}
+
+// fakeKMS wraps data keys by xoring them, enough to check the round trip.
+type fakeKMS struct {
+	targets []string
+}
+
+func (f *fakeKMS) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.targets = append(f.targets, req.Header.Get("X-Amz-Target"))
+	var in struct {
+		KeyId          string
+		CiphertextBlob []byte
+	}
+	json.NewDecoder(req.Body).Decode(&in)
+	xor := func(b []byte) []byte {
+		out := make([]byte, len(b))
+		for j := range b {
+			out[j] = b[j] ^ 0x5a
+		}
+		return out
+	}
+	var out interface{}
+	status := 200
+	switch {
+	case !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/"):
+		status, out = 400, map[string]string{"__type": "com.amazon.coral.service#InvalidSignatureException", "message": "bad"}
+	case in.KeyId != "alias/app":
+		status, out = 400, map[string]string{"__type": "NotFoundException", "message": "no key " + in.KeyId}
+	case req.Header.Get("X-Amz-Target") == "TrentService.GenerateDataKey":
+		plain := bytes.Repeat([]byte{7}, 32)
+		out = map[string][]byte{"Plaintext": plain, "CiphertextBlob": xor(plain)}
+	default:
+		out = map[string][]byte{"Plaintext": xor(in.CiphertextBlob)}
+	}
+	b, _ := json.Marshal(out)
+	return &http.Response{StatusCode: status, Body: io.NopCloser(bytes.NewReader(b)), Request: req}, nil
+}
+
+func TestProvider(t *testing.T) {
+	f := &fakeKMS{}
+	p := New("alias/app", "eu-west-1", "key", "secret")
+	p.HTTPClient = &http.Client{Transport: f}
+
+	ctx := context.Background()
+	e := sdb.NewEncryptor(p, "ssn")
+	v, err := e.Encrypt(ctx, "ssn", "123-45")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := sdb.EncryptedKeyID(v); id != "alias/app" {
+		t.Errorf("key ID %q", id)
+	}
+	// a fresh Encryptor has no cached data keys and asks KMS
+	plain, err := sdb.NewEncryptor(p, "ssn").Decrypt(ctx, "ssn", v)
+	if err != nil || plain != "123-45" {
+		t.Fatalf("Decrypt = %q, %v", plain, err)
+	}
+	if len(f.targets) != 2 || f.targets[1] != "TrentService.Decrypt" {
+		t.Errorf("targets %v", f.targets)
+	}
+
+	p.Key = "alias/other"
+	_, err = p.GenerateKey(ctx)
+	if e, ok := err.(*Error); !ok || e.Type != "NotFoundException" {
+		t.Errorf("expected NotFoundException, got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+// Package sdbkv adapts a SimpleDB domain to a generic key-value store
+// interface in the style of gokv: one item per key holding the encoded value.
+package sdbkv
+
+import (
+	"errors"
+
+	"github.com/coopernurse/sdb"
+)
+
+const valueAttribute = "v"
+
+var ErrEmptyKey = errors.New("sdbkv: key must not be empty")
+
+type Store struct {
+	Domain string
+	Codec  sdb.Codec
+	db     sdb.SimpleDB
+}
+
+// NewStore returns a store keeping values in domain, encoded with codec. The
+// store copies db for every call so it is safe for concurrent use.
+func NewStore(db sdb.SimpleDB, domain string, codec sdb.Codec) *Store {
+	return &Store{Domain: domain, Codec: codec, db: db}
+}
+
+func (s *Store) Set(k string, v interface{}) error {
+	if k == "" {
+		return ErrEmptyKey
+	}
+	b, err := s.Codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	i := sdb.NewItem(k)
+	if err = i.SetBinary(valueAttribute, b, false); err != nil {
+		return err
+	}
+	db := s.db
+	_, err = db.PutAttributes(s.Domain, i)
+	return err
+}
+
+// Get decodes the value stored for k into v, found is false if k does not exist.
+func (s *Store) Get(k string, v interface{}) (found bool, err error) {
+	if k == "" {
+		return false, ErrEmptyKey
+	}
+	db := s.db
+	r, err := db.GetAttributes(s.Domain, k)
+	if err != nil {
+		return
+	}
+	return s.decode(sdb.Item{Name: k, Attributes: r.Attributes}, v)
+}
+
+func (s *Store) Delete(k string) error {
+	if k == "" {
+		return ErrEmptyKey
+	}
+	db := s.db
+	_, err := db.DeleteItem(s.Domain, k)
+	return err
+}
+
+// Iterate calls fn for every key in the store. The decode function passed to
+// fn unmarshals the value of that key. Iteration stops at the first error
+// returned by fn.
+func (s *Store) Iterate(fn func(k string, decode func(v interface{}) error) error) error {
+	db := s.db
+	q := "select * from " + sdb.QuoteName(s.Domain)
+	token := ""
+	for {
+		r, err := db.SelectWithToken(q, token)
+		if err != nil {
+			return err
+		}
+		for _, i := range r.Items {
+			item := i
+			err = fn(i.Name, func(v interface{}) error {
+				_, err := s.decode(item, v)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if r.NextToken == "" {
+			return nil
+		}
+		token = r.NextToken
+	}
+}
+
+// Close is a no-op, it exists for compatibility with gokv.Store.
+func (s *Store) Close() error {
+	return nil
+}
+
+func (s *Store) decode(i sdb.Item, v interface{}) (found bool, err error) {
+	b, found, err := i.Binary(valueAttribute)
+	if !found || err != nil {
+		return
+	}
+	err = s.Codec.Unmarshal(b, v)
+	return
+}
@@ -0,0 +1,77 @@
+package sdbkv
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+type value struct {
+	Name  string
+	Count int
+}
+
+func TestStore(t *testing.T) {
+	for name, codec := range map[string]sdb.Codec{"json": sdb.JSONCodec, "gob": sdb.GobCodec} {
+		t.Run(name, func(t *testing.T) {
+			f := sdbtest.NewFake()
+			db := f.Client()
+			// The domain name needs quoting in select expressions.
+			domain := "kv-store.v1"
+			if _, err := db.CreateDomain(domain); err != nil {
+				t.Fatal(err)
+			}
+			s := NewStore(db, domain, codec)
+
+			var v value
+			if found, err := s.Get("a", &v); err != nil || found {
+				t.Fatalf("Get of missing key: found %v, err %v", found, err)
+			}
+			if err := s.Set("a", value{"first", 1}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Set("a", value{"second", 2}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Set("b", value{strings.Repeat("x", 3000), 3}); err != nil {
+				t.Fatal(err)
+			}
+			if found, err := s.Get("a", &v); err != nil || !found || v != (value{"second", 2}) {
+				t.Fatalf("Get after overwrite: %+v, found %v, err %v", v, found, err)
+			}
+
+			var keys []string
+			err := s.Iterate(func(k string, decode func(interface{}) error) error {
+				var v value
+				if err := decode(&v); err != nil {
+					return err
+				}
+				if k == "b" && len(v.Name) != 3000 {
+					t.Errorf("chunked value has length %d", len(v.Name))
+				}
+				keys = append(keys, k)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(keys)
+			if strings.Join(keys, ",") != "a,b" {
+				t.Fatalf("Iterate returned keys %v", keys)
+			}
+
+			if err := s.Delete("a"); err != nil {
+				t.Fatal(err)
+			}
+			if found, err := s.Get("a", &v); err != nil || found {
+				t.Fatalf("Get after Delete: found %v, err %v", found, err)
+			}
+			if err := s.Set("", v); err != ErrEmptyKey {
+				t.Fatalf("Set with empty key returned %v", err)
+			}
+		})
+	}
+}
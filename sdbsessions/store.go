@@ -0,0 +1,241 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+// Package sdbsessions implements a gorilla/sessions Store that keeps session
+// values in a SimpleDB domain.
+//
+// Each session is one item named by a random session ID. Values are gob
+// encoded, base64 encoded and stored with Item.SetChunked to stay within the
+// 1024 byte attribute value limit. SimpleDB has no expiry so every item carries
+// an expires attribute, expired sessions are ignored on load and removed by
+// DeleteExpired.
+package sdbsessions
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coopernurse/sdb"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+var ErrSessionTooLarge = errors.New("sdbsessions: encoded session exceeds item size limit")
+
+type Store struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+	Domain  string
+	// DefaultMaxAge is the lifetime in seconds of sessions with MaxAge 0,
+	// which browsers keep until they are closed.
+	DefaultMaxAge int
+	db            sdb.SimpleDB
+}
+
+// NewStore returns a store saving sessions in domain. The store copies db for
+// every call so it is safe for concurrent use by HTTP handlers.
+func NewStore(db sdb.SimpleDB, domain string, keyPairs ...[]byte) *Store {
+	return &Store{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: 86400 * 30,
+		},
+		Domain:        domain,
+		DefaultMaxAge: 86400,
+		db:            db,
+	}
+}
+
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	err = securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...)
+	if err != nil {
+		return session, err
+	}
+	ok, err := s.load(session)
+	session.IsNew = !ok
+	return session, err
+}
+
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			db := s.db
+			if _, err := db.DeleteItem(s.Domain, session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(b), "=")
+	}
+	if err := s.save(session); err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// DeleteExpired removes every session whose expiry has passed.
+func (s *Store) DeleteExpired() error {
+	db := s.db
+	q := fmt.Sprintf("select itemName() from `%s` where expires < '%s'", s.Domain, expiresValue(time.Now()))
+	token := ""
+	for {
+		r, err := db.SelectWithToken(q, token)
+		if err != nil {
+			return err
+		}
+		for _, i := range r.Items {
+			if _, err := db.DeleteItem(s.Domain, i.Name); err != nil {
+				return err
+			}
+		}
+		if r.NextToken == "" {
+			return nil
+		}
+		token = r.NextToken
+	}
+}
+
+func (s *Store) save(session *sessions.Session) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(session.Values); err != nil {
+		return err
+	}
+	i := sdb.NewItem(session.ID)
+	if err := i.SetChunked("data", base64.StdEncoding.EncodeToString(buf.Bytes())); err != nil {
+		if errors.Is(err, sdb.ErrValueTooLarge) {
+			return ErrSessionTooLarge
+		}
+		return err
+	}
+	maxAge := session.Options.MaxAge
+	if maxAge == 0 {
+		maxAge = s.DefaultMaxAge
+	}
+	i.ReplaceAttribute("expires", expiresValue(time.Now().Add(time.Duration(maxAge)*time.Second)))
+
+	db := s.db
+	db.ConsistentRead = true
+	var stale *sdb.Item
+	if !session.IsNew {
+		r, err := db.GetAttributes(s.Domain, session.ID)
+		if err != nil {
+			return err
+		}
+		stale = staleChunks(r.Attributes, *i)
+	}
+	if _, err := db.PutAttributes(s.Domain, i); err != nil {
+		return err
+	}
+	if stale != nil {
+		_, err := db.DeleteAttributes(s.Domain, stale)
+		return err
+	}
+	return nil
+}
+
+// staleChunks returns the chunks of the stored session that the new one in
+// i does not overwrite, nil if there are none.
+func staleChunks(stored []sdb.Attribute, i sdb.Item) *sdb.Item {
+	written := make(map[string]bool)
+	for _, a := range i.Attributes {
+		written[a.Name] = true
+	}
+	var stale *sdb.Item
+	for _, a := range stored {
+		if strings.HasPrefix(a.Name, "data.") && !written[a.Name] {
+			if stale == nil {
+				stale = sdb.NewItem(i.Name)
+			}
+			stale.AddAttribute(a.Name, "")
+		}
+	}
+	return stale
+}
+
+func (s *Store) load(session *sessions.Session) (bool, error) {
+	db := s.db
+	r, err := db.GetAttributes(s.Domain, session.ID)
+	if err != nil {
+		return false, err
+	}
+	i := sdb.Item{Name: session.ID, Attributes: r.Attributes}
+	if len(i.Attributes) == 0 || i.Value("expires") < expiresValue(time.Now()) {
+		return false, nil
+	}
+	data, ok, err := i.Chunked("data")
+	if err != nil || !ok {
+		return false, err
+	}
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return false, err
+	}
+	err = gob.NewDecoder(bytes.NewReader(b)).Decode(&session.Values)
+	return err == nil, err
+}
+
+// expiresValue zero pads the Unix time so that string comparison in Select
+// matches numeric order.
+func expiresValue(t time.Time) string {
+	return fmt.Sprintf("%020d", t.Unix())
+}
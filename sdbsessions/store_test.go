@@ -0,0 +1,84 @@
+package sdbsessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestStore(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	if _, err := db.CreateDomain("sessions"); err != nil {
+		t.Fatal(err)
+	}
+	s := NewStore(db, "sessions", []byte("0123456789abcdef0123456789abcdef"))
+	s.Options.MaxAge = 0
+
+	// save stores the session values of a request carrying cookie and
+	// returns the cookie of the response.
+	save := func(cookie *http.Cookie, values map[interface{}]interface{}) *http.Cookie {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/", nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		session, err := s.New(r, "sid")
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.Values = values
+		w := httptest.NewRecorder()
+		if err := s.Save(r, w, session); err != nil {
+			t.Fatal(err)
+		}
+		return w.Result().Cookies()[0]
+	}
+	load := func(cookie *http.Cookie) (map[interface{}]interface{}, bool) {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(cookie)
+		session, err := s.New(r, "sid")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return session.Values, !session.IsNew
+	}
+	chunks := func() (n int) {
+		r, err := db.Select("select * from sessions")
+		if err != nil || len(r.Items) != 1 {
+			t.Fatalf("Select = %v, %v", r.Items, err)
+		}
+		for _, a := range r.Items[0].Attributes {
+			if strings.HasPrefix(a.Name, "data.") && a.Name != "data.chunks" {
+				n++
+			}
+		}
+		return
+	}
+
+	c := save(nil, map[interface{}]interface{}{"big": strings.Repeat("x", 3000)})
+	if v, ok := load(c); !ok || len(v["big"].(string)) != 3000 {
+		t.Fatalf("expected the browser session to load, got %v", v)
+	}
+	if n := chunks(); n != 4 {
+		t.Errorf("expected 4 chunks, got %d", n)
+	}
+
+	c = save(c, map[interface{}]interface{}{"small": "y"})
+	if v, ok := load(c); !ok || v["small"] != "y" || v["big"] != nil {
+		t.Fatalf("unexpected values after shrinking %v", v)
+	}
+	if n := chunks(); n != 1 {
+		t.Errorf("expected the stale chunks to be deleted, %d left", n)
+	}
+
+	s.Options.MaxAge = -1
+	save(c, nil)
+	if _, ok := load(c); ok {
+		t.Error("expected the session to be deleted")
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdbtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coopernurse/sdb"
+)
+
+// DomainTimeout bounds the wait for a new domain to appear and a deleted one
+// to go away.
+var DomainTimeout = 2 * time.Minute
+
+var (
+	runID     = newRunID()
+	domainSeq int64
+)
+
+func newRunID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// DomainName returns a domain name unique to this test run, made of prefix,
+// a random run id and a sequence number.
+func DomainName(prefix string) string {
+	var b strings.Builder
+	for _, r := range prefix {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	name := b.String()
+	if len(name) > 200 {
+		name = name[:200]
+	}
+	return name + "-" + runID + "-" + strconv.FormatInt(atomic.AddInt64(&domainSeq, 1), 10)
+}
+
+// Domain creates a domain named after the test, waits until it can be used
+// and deletes it when the test and its subtests finish.
+func Domain(t testing.TB, db sdb.SimpleDB) string {
+	t.Helper()
+	name := DomainName("test-" + t.Name())
+	if _, err := db.CreateDomain(name); err != nil {
+		t.Fatalf("create domain %s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		if _, err := db.DeleteDomain(name); err != nil {
+			t.Errorf("delete domain %s: %v", name, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), DomainTimeout)
+		defer cancel()
+		if err := db.WaitForDomain(ctx, name, false); err != nil {
+			t.Logf("domain %s still listed after delete: %v", name, err)
+		}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), DomainTimeout)
+	defer cancel()
+	if err := db.WaitForDomain(ctx, name, true); err != nil {
+		t.Fatalf("domain %s not ready: %v", name, err)
+	}
+	return name
+}
@@ -0,0 +1,503 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+// Package sdbtest helps testing code that uses SimpleDB.
+//
+// Fake keeps domains in memory and answers the SimpleDB protocol as an
+// http.RoundTripper, so a client from Fake.Client runs its real request
+// signing, retry and response handling. Stub answers with responses
+// programmed per action instead. Seed and Dump load and capture fixtures for
+// the fake or a real test domain.
+package sdbtest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/coopernurse/sdb"
+)
+
+const (
+	fakeBoxUsage     = 0.0000219907
+	defaultSelectMax = 100
+)
+
+// Fake is an in-memory SimpleDB. Reads are always consistent.
+type Fake struct {
+	mu       sync.Mutex
+	domains  map[string]map[string][]sdb.Attribute
+	requests int
+}
+
+func NewFake() *Fake {
+	return &Fake{domains: make(map[string]map[string][]sdb.Attribute)}
+}
+
+// Client returns a client whose requests are served by f.
+func (f *Fake) Client() sdb.SimpleDB {
+	db := sdb.NewSimpleDB("fake", "fake", "sdb.fake")
+	db.HTTPClient = &http.Client{Transport: f}
+	return db
+}
+
+type fakeError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (f *Fake) RoundTrip(req *http.Request) (*http.Response, error) {
+	p, err := requestParameters(req)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.requests++
+	id := fmt.Sprintf("fake-%d", f.requests)
+	meta := sdb.ResponseMetadata{RequestId: id, BoxUsage: fakeBoxUsage}
+	var v interface{}
+	var ferr *fakeError
+	switch p.Get("Action") {
+	case "CreateDomain":
+		if f.domains[p.Get("DomainName")] == nil {
+			f.domains[p.Get("DomainName")] = make(map[string][]sdb.Attribute)
+		}
+		v = sdb.CreateDomainResponse{ResponseMetadata: meta}
+	case "DeleteDomain":
+		delete(f.domains, p.Get("DomainName"))
+		v = sdb.DeleteDomainResponse{ResponseMetadata: meta}
+	case "ListDomains":
+		r := sdb.ListDomainsResponse{ResponseMetadata: meta}
+		for name := range f.domains {
+			r.DomainNames = append(r.DomainNames, name)
+		}
+		sort.Strings(r.DomainNames)
+		v = r
+	case "DomainMetadata":
+		var r sdb.DomainMetadataResponse
+		r, ferr = f.metadata(p.Get("DomainName"))
+		r.ResponseMetadata = meta
+		v = r
+	case "PutAttributes":
+		ferr = f.put(p.Get("DomainName"), p.Get("ItemName"), attributes(p, "Attribute."), condition(p))
+		v = sdb.PutAttributesResponse{ResponseMetadata: meta}
+	case "BatchPutAttributes":
+		for n := 1; p.Get("Item."+strconv.Itoa(n)+".ItemName") != "" && ferr == nil; n++ {
+			prefix := "Item." + strconv.Itoa(n) + "."
+			ferr = f.put(p.Get("DomainName"), p.Get(prefix+"ItemName"), attributes(p, prefix+"Attribute."), nil)
+		}
+		v = sdb.PutAttributesResponse{ResponseMetadata: meta}
+	case "GetAttributes":
+		r := sdb.GetAttributesResponse{ResponseMetadata: meta}
+		var d map[string][]sdb.Attribute
+		if d, ferr = f.domain(p.Get("DomainName")); ferr == nil {
+			r.Attributes = d[p.Get("ItemName")]
+		}
+		v = r
+	case "DeleteAttributes":
+		ferr = f.delete(p.Get("DomainName"), p.Get("ItemName"), attributes(p, "Attribute."), condition(p))
+		v = sdb.DeleteAttributesResponse{ResponseMetadata: meta}
+	case "BatchDeleteAttributes":
+		for n := 1; p.Get("Item."+strconv.Itoa(n)+".ItemName") != "" && ferr == nil; n++ {
+			prefix := "Item." + strconv.Itoa(n) + "."
+			ferr = f.delete(p.Get("DomainName"), p.Get(prefix+"ItemName"), attributes(p, prefix+"Attribute."), nil)
+		}
+		v = sdb.DeleteAttributesResponse{ResponseMetadata: meta}
+	case "Select":
+		var r sdb.SelectResponse
+		r, ferr = f.query(p.Get("SelectExpression"), p.Get("NextToken"))
+		r.ResponseMetadata = meta
+		v = r
+	default:
+		ferr = &fakeError{400, "InvalidAction", "unsupported action " + p.Get("Action")}
+	}
+	f.mu.Unlock()
+
+	if ferr != nil {
+		return errorResponse(req, ferr.status, sdb.SimpleDBError{Code: ferr.code, Message: ferr.message, RequestId: id})
+	}
+	return xmlResponse(req, http.StatusOK, v)
+}
+
+// ServeHTTP answers SimpleDB requests over HTTP, so the fake can stand in
+// for a SimpleDB-compatible server, see sdb.NewSimpleDBEndpoint.
+func (f *Fake) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r, err := f.RoundTrip(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	for k, vs := range r.Header {
+		w.Header()[k] = vs
+	}
+	w.WriteHeader(r.StatusCode)
+	io.Copy(w, r.Body)
+}
+
+func xmlResponse(req *http.Request, status int, v interface{}) (*http.Response, error) {
+	out, err := xml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:     http.Header{"Content-Type": {"text/xml"}},
+		Body:       io.NopCloser(bytes.NewReader(out)),
+		Request:    req,
+	}, nil
+}
+
+// errorResponse answers with e in the SimpleDB error document, and its
+// RetryAfter in a Retry-After header.
+func errorResponse(req *http.Request, status int, e sdb.SimpleDBError) (*http.Response, error) {
+	id := e.RequestId
+	e.RequestId = ""
+	r, err := xmlResponse(req, status, sdb.Response{Errors: []sdb.SimpleDBError{e}, RequestId: id})
+	if err == nil && e.RetryAfter > 0 {
+		r.Header.Set("Retry-After", strconv.Itoa(int(e.RetryAfter.Seconds())))
+	}
+	return r, err
+}
+
+// requestParameters reads the form encoded parameters of req.
+func requestParameters(req *http.Request) (url.Values, error) {
+	b, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	return url.ParseQuery(string(b))
+}
+
+// attributes reads the attributes sent as prefix.N.Name, Value and Replace.
+func attributes(p url.Values, prefix string) (attrs []sdb.Attribute) {
+	for n := 1; ; n++ {
+		o := prefix + strconv.Itoa(n) + "."
+		name, ok := p[o+"Name"]
+		if !ok {
+			return
+		}
+		attrs = append(attrs, sdb.Attribute{Name: name[0], Value: p.Get(o + "Value"), Replace: p.Get(o+"Replace") == "true"})
+	}
+}
+
+func condition(p url.Values) *sdb.Condition {
+	if p.Get("Expected.1.Name") == "" {
+		return nil
+	}
+	return &sdb.Condition{Name: p.Get("Expected.1.Name"), Value: p.Get("Expected.1.Value"), Exists: p.Get("Expected.1.Exists") != "false"}
+}
+
+func (f *Fake) domain(name string) (map[string][]sdb.Attribute, *fakeError) {
+	d := f.domains[name]
+	if d == nil {
+		return nil, &fakeError{400, "NoSuchDomain", "The specified domain does not exist."}
+	}
+	return d, nil
+}
+
+func (f *Fake) check(attrs []sdb.Attribute, c *sdb.Condition) *fakeError {
+	if c == nil {
+		return nil
+	}
+	var values []string
+	for _, a := range attrs {
+		if a.Name == c.Name {
+			values = append(values, a.Value)
+		}
+	}
+	switch {
+	case !c.Exists && len(values) > 0:
+		return &fakeError{409, "ConditionalCheckFailed", "Attribute (" + c.Name + ") value exists"}
+	case c.Exists && len(values) == 0:
+		return &fakeError{404, "AttributeDoesNotExist", "Attribute (" + c.Name + ") does not exist"}
+	case c.Exists && (len(values) > 1 || values[0] != c.Value):
+		return &fakeError{409, "ConditionalCheckFailed", "Conditional check failed. Attribute (" + c.Name + ") value is (" + values[0] + ") but was expected (" + c.Value + ")"}
+	}
+	return nil
+}
+
+func (f *Fake) put(domain string, item string, attrs []sdb.Attribute, c *sdb.Condition) *fakeError {
+	d, ferr := f.domain(domain)
+	if ferr != nil {
+		return ferr
+	}
+	if ferr = f.check(d[item], c); ferr != nil {
+		return ferr
+	}
+	replace := make(map[string]bool)
+	for _, a := range attrs {
+		replace[a.Name] = replace[a.Name] || a.Replace
+	}
+	var stored []sdb.Attribute
+	for _, a := range d[item] {
+		if !replace[a.Name] {
+			stored = append(stored, a)
+		}
+	}
+	for _, a := range attrs {
+		a.Replace = false
+		if !hasAttribute(stored, a) {
+			stored = append(stored, a)
+		}
+	}
+	d[item] = stored
+	return nil
+}
+
+func hasAttribute(attrs []sdb.Attribute, a sdb.Attribute) bool {
+	for _, s := range attrs {
+		if s.Name == a.Name && s.Value == a.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Fake) delete(domain string, item string, attrs []sdb.Attribute, c *sdb.Condition) *fakeError {
+	d, ferr := f.domain(domain)
+	if ferr != nil {
+		return ferr
+	}
+	if ferr = f.check(d[item], c); ferr != nil {
+		return ferr
+	}
+	if len(attrs) == 0 {
+		delete(d, item)
+		return nil
+	}
+	var kept []sdb.Attribute
+	for _, s := range d[item] {
+		drop := false
+		for _, a := range attrs {
+			drop = drop || a.Name == s.Name && (a.Value == "" || a.Value == s.Value)
+		}
+		if !drop {
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) == 0 {
+		delete(d, item)
+	} else {
+		d[item] = kept
+	}
+	return nil
+}
+
+func (f *Fake) metadata(domain string) (r sdb.DomainMetadataResponse, ferr *fakeError) {
+	d, ferr := f.domain(domain)
+	if ferr != nil {
+		return
+	}
+	names := make(map[string]bool)
+	for item, attrs := range d {
+		r.ItemCount++
+		r.ItemNamesSizeBytes += int64(len(item))
+		for _, a := range attrs {
+			if !names[a.Name] {
+				names[a.Name] = true
+				r.AttributeNameCount++
+				r.AttributeNamesSizeBytes += int64(len(a.Name))
+			}
+			r.AttributeValueCount++
+			r.AttributeValuesSizeBytes += int64(len(a.Value))
+		}
+	}
+	return
+}
+
+func (f *Fake) query(q string, token string) (r sdb.SelectResponse, ferr *fakeError) {
+	s, err := sdb.ParseSelect(q)
+	if err != nil {
+		return r, &fakeError{400, "InvalidQueryExpression", err.Error()}
+	}
+	d, ferr := f.domain(s.Domain)
+	if ferr != nil {
+		return
+	}
+	var items []sdb.Item
+	for name, attrs := range d {
+		i := sdb.Item{Name: name, Attributes: attrs}
+		if s.Where == nil || match(s.Where, i) {
+			items = append(items, i)
+		}
+	}
+	sort.Slice(items, func(a, b int) bool {
+		if s.OrderBy != "" {
+			va, vb := values(items[a], s.OrderBy), values(items[b], s.OrderBy)
+			if len(va) > 0 && len(vb) > 0 && va[0] != vb[0] {
+				return (va[0] < vb[0]) != s.Desc
+			}
+		}
+		return items[a].Name < items[b].Name
+	})
+	offset := 0
+	if token != "" {
+		if offset, err = strconv.Atoi(token); err != nil || offset < 0 || offset > len(items) {
+			return r, &fakeError{400, "InvalidNextToken", "The specified next token is not valid."}
+		}
+	}
+	items = items[offset:]
+	limit := s.Limit
+	if limit == 0 {
+		limit = defaultSelectMax
+	}
+	if len(items) > limit {
+		items = items[:limit]
+		r.NextToken = strconv.Itoa(offset + limit)
+	}
+	switch s.Output[0] {
+	case "count(*)":
+		r.Items = []sdb.Item{{Name: "Domain", Attributes: []sdb.Attribute{{Name: "Count", Value: strconv.Itoa(len(items))}}}}
+		return
+	case "*":
+		r.Items = items
+		return
+	}
+	for _, i := range items {
+		o := sdb.Item{Name: i.Name}
+		for _, a := range i.Attributes {
+			for _, name := range s.Output {
+				if a.Name == name {
+					o.Attributes = append(o.Attributes, a)
+				}
+			}
+		}
+		r.Items = append(r.Items, o)
+	}
+	return
+}
+
+func values(i sdb.Item, attr string) (vs []string) {
+	if attr == "itemName()" {
+		return []string{i.Name}
+	}
+	for _, a := range i.Attributes {
+		if a.Name == attr {
+			vs = append(vs, a.Value)
+		}
+	}
+	return
+}
+
+func match(e sdb.Expr, i sdb.Item) bool {
+	switch e := e.(type) {
+	case *sdb.BinaryExpr:
+		if e.Op == "or" {
+			return match(e.Left, i) || match(e.Right, i)
+		}
+		return match(e.Left, i) && match(e.Right, i)
+	case *sdb.NotExpr:
+		return !match(e.X, i)
+	case *sdb.Comparison:
+		vs := values(i, e.Attribute)
+		switch e.Op {
+		case "is null":
+			return len(vs) == 0
+		case "is not null":
+			return len(vs) > 0
+		}
+		if len(vs) == 0 {
+			return false
+		}
+		for _, v := range vs {
+			ok := compare(e, v)
+			if ok && !e.Every {
+				return true
+			}
+			if !ok && e.Every {
+				return false
+			}
+		}
+		return e.Every
+	}
+	return false
+}
+
+func compare(c *sdb.Comparison, v string) bool {
+	switch c.Op {
+	case "=":
+		return v == c.Values[0]
+	case "!=":
+		return v != c.Values[0]
+	case "<":
+		return v < c.Values[0]
+	case "<=":
+		return v <= c.Values[0]
+	case ">":
+		return v > c.Values[0]
+	case ">=":
+		return v >= c.Values[0]
+	case "between":
+		return v >= c.Values[0] && v <= c.Values[1]
+	case "in":
+		for _, x := range c.Values {
+			if v == x {
+				return true
+			}
+		}
+		return false
+	case "like":
+		return like(c.Values[0]).MatchString(v)
+	case "not like":
+		return !like(c.Values[0]).MatchString(v)
+	}
+	return false
+}
+
+// like converts a like pattern, where % matches any run of characters and
+// \% a literal %, to a regular expression.
+func like(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case pattern[i] == '%':
+			b.WriteString("(?s:.*)")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
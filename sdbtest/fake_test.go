@@ -0,0 +1,202 @@
+package sdbtest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coopernurse/sdb"
+)
+
+const usersYAML = `domains:
+  users:
+    u1:
+      name: Ann
+      age: "042"
+      role: [admin, dev]
+    u2:
+      name: Bob
+      age: "017"
+    u3:
+      name: Cid
+      age: "030"
+      role: dev
+`
+
+func seedUsers(t *testing.T) (*Fake, sdb.SimpleDB) {
+	path := filepath.Join(t.TempDir(), "users.yaml")
+	if err := os.WriteFile(path, []byte(usersYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := NewFake()
+	db := f.Client()
+	if err := Seed(db, path); err != nil {
+		t.Fatal(err)
+	}
+	return f, db
+}
+
+func TestFakeSelect(t *testing.T) {
+	_, db := seedUsers(t)
+	r, err := db.Select("select name from users where role = 'dev' and age > '020' order by age desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Items) != 2 || r.Items[0].Name != "u1" || r.Items[1].Name != "u3" || len(r.Items[0].Attributes) != 1 {
+		t.Fatalf("unexpected items %+v", r.Items)
+	}
+
+	r, err = db.Select("select itemName() from users where name like 'B%' or every(role) = 'dev' limit 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Items) != 1 || r.Items[0].Name != "u2" || r.NextToken == "" {
+		t.Fatalf("unexpected first page %+v", r)
+	}
+	r, err = db.SelectWithToken("select itemName() from users where name like 'B%' or every(role) = 'dev' limit 1", r.NextToken)
+	if err != nil || len(r.Items) != 1 || r.Items[0].Name != "u3" || r.NextToken != "" {
+		t.Fatalf("unexpected second page %+v %v", r, err)
+	}
+
+	r, err = db.Select("select count(*) from users where role is null")
+	if err != nil || r.Items[0].Value("Count") != "1" {
+		t.Fatalf("unexpected count %+v %v", r, err)
+	}
+}
+
+func TestFakeWrites(t *testing.T) {
+	_, db := seedUsers(t)
+	i := sdb.NewItem("u2")
+	i.ReplaceAttribute("age", "018")
+	if _, err := db.PutAttributesIf("users", i, sdb.Condition{Name: "age", Value: "016", Exists: true}); !sdb.IsConditionalCheckFailed(err) {
+		t.Fatalf("expected conditional check failure, got %v", err)
+	}
+	if _, err := db.PutAttributesIf("users", i, sdb.Condition{Name: "age", Value: "017", Exists: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DeleteAttributes("users", &sdb.Item{Name: "u1", Attributes: []sdb.Attribute{{Name: "role", Value: "dev"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DeleteItem("users", "u3"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := DumpFixture(db, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Attributes{
+		"u1": {"name": {"Ann"}, "age": {"042"}, "role": {"admin"}},
+		"u2": {"name": {"Bob"}, "age": {"018"}},
+	}
+	if !reflect.DeepEqual(f.Domains["users"], want) {
+		t.Errorf("unexpected dump %+v", f.Domains["users"])
+	}
+	if _, err := db.GetAttributes("missing", "u1"); err == nil {
+		t.Error("expected NoSuchDomain")
+	}
+}
+
+func TestDumpRoundTrip(t *testing.T) {
+	_, db := seedUsers(t)
+	path := filepath.Join(t.TempDir(), "users.json")
+	if err := Dump(db, path, "users"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := LoadFixture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Domains["users"]["u1"]["role"][1] != "dev" || f.Domains["users"]["u3"]["role"][0] != "dev" {
+		t.Errorf("unexpected fixture %+v", f)
+	}
+}
+
+func TestDomain(t *testing.T) {
+	f := NewFake()
+	db := f.Client()
+	var name string
+	t.Run("sub/test", func(t *testing.T) {
+		name = Domain(t, db)
+		if err := sdb.ValidateDomainName(name); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.DomainMetadata(name); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if _, err := db.DomainMetadata(name); err == nil {
+		t.Errorf("domain %s not deleted after the test", name)
+	}
+	if DomainName("x") == DomainName("x") {
+		t.Error("domain names repeat")
+	}
+}
+
+func TestStub(t *testing.T) {
+	s := NewStub()
+	s.Fail("PutAttributes", sdb.SimpleDBError{Code: "ServiceUnavailable", StatusCode: 503})
+	s.Respond("PutAttributes", sdb.PutAttributesResponse{})
+	s.Respond("Select", sdb.SelectResponse{Items: []sdb.Item{{Name: "i1", Attributes: []sdb.Attribute{{Name: "a", Value: "1"}}}}})
+	db := s.Client()
+
+	_, err := db.PutAttributes("d", &sdb.Item{Name: "i1", Attributes: []sdb.Attribute{{Name: "a", Value: "1"}}})
+	if e, ok := err.(sdb.SimpleDBError); !ok || e.Code != "ServiceUnavailable" || e.StatusCode != 503 {
+		t.Fatalf("expected ServiceUnavailable, got %v", err)
+	}
+	if _, err = db.PutAttributes("d", &sdb.Item{Name: "i1", Attributes: []sdb.Attribute{{Name: "a", Value: "1"}}}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := db.Select("select * from d")
+	if err != nil || len(r.Items) != 1 || r.Items[0].Value("a") != "1" {
+		t.Fatalf("unexpected select %+v %v", r, err)
+	}
+	if _, err = db.DeleteItem("d", "i1"); err == nil || err.(sdb.SimpleDBError).Code != "StubMissing" {
+		t.Errorf("expected StubMissing, got %v", err)
+	}
+	calls := s.Calls("PutAttributes")
+	if len(calls) != 2 || calls[1].Params.Get("Attribute.1.Name") != "a" {
+		t.Errorf("unexpected calls %+v", calls)
+	}
+}
+
+func TestFakeEndpoint(t *testing.T) {
+	f := NewFake()
+	var e sdb.Endpoint
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		p, _ := url.ParseQuery(string(b))
+		if r.URL.Path != "/sdb/" {
+			t.Errorf("request to %s", r.URL.Path)
+		}
+		// the client signs with its own timestamp, so re-sign the same parameters
+		if want := sdb.NewSimpleDBEndpoint("key", "secret", e).SignRequest(p); string(b) != want {
+			t.Errorf("signature mismatch:\n%s\n%s", b, want)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(b))
+		f.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	e = sdb.Endpoint{Scheme: "http", Host: strings.TrimPrefix(srv.URL, "http://"), Path: "/sdb/"}
+	db := sdb.NewSimpleDBEndpoint("key", "secret", e)
+	if _, err := db.CreateDomain("d"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.PutAttributes("d", &sdb.Item{Name: "i", Attributes: []sdb.Attribute{{Name: "a", Value: "1"}}}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := db.Select("select * from d where a = '1'")
+	if err != nil || len(r.Items) != 1 {
+		t.Fatalf("%+v %v", r, err)
+	}
+	if _, err := db.GetAttributes("missing", "i"); err == nil {
+		t.Error("expected NoSuchDomain")
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdbtest
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/coopernurse/sdb"
+	"gopkg.in/yaml.v3"
+)
+
+const maxBatchItems = 25
+
+// Fixture is the content of domains, by domain and item name:
+//
+//	domains:
+//	  users:
+//	    u1:
+//	      name: Ann
+//	      role: [admin, dev]
+type Fixture struct {
+	Domains map[string]map[string]Attributes `json:"domains" yaml:"domains"`
+}
+
+// Attributes are the values of an item by attribute name.
+type Attributes map[string]Values
+
+// Values are the values of one attribute. A single value is written as a
+// plain string and either form is read.
+type Values []string
+
+func (v Values) MarshalJSON() ([]byte, error) {
+	if len(v) == 1 {
+		return json.Marshal(v[0])
+	}
+	return json.Marshal([]string(v))
+}
+
+func (v *Values) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*v = Values{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(v))
+}
+
+func (v Values) MarshalYAML() (interface{}, error) {
+	if len(v) == 1 {
+		return v[0], nil
+	}
+	return []string(v), nil
+}
+
+func (v *Values) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*v = Values{n.Value}
+		return nil
+	}
+	return n.Decode((*[]string)(v))
+}
+
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// LoadFixture reads a YAML fixture from a .yaml or .yml file and a JSON
+// fixture from any other.
+func LoadFixture(path string) (f Fixture, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if isYAML(path) {
+		err = yaml.Unmarshal(b, &f)
+	} else {
+		err = json.Unmarshal(b, &f)
+	}
+	return
+}
+
+// WriteFixture writes f as YAML or JSON depending on the extension of path.
+func WriteFixture(path string, f Fixture) (err error) {
+	var b []byte
+	if isYAML(path) {
+		b, err = yaml.Marshal(f)
+	} else {
+		b, err = json.MarshalIndent(f, "", "  ")
+		b = append(b, '\n')
+	}
+	if err != nil {
+		return
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// Seed creates the domains of the fixture at path and puts its items,
+// replacing the values of attributes they already have. db may be a
+// Fake.Client or a client of a real test domain.
+func Seed(db sdb.SimpleDB, path string) error {
+	f, err := LoadFixture(path)
+	if err != nil {
+		return err
+	}
+	return SeedFixture(db, f)
+}
+
+func SeedFixture(db sdb.SimpleDB, f Fixture) error {
+	for domain, items := range f.Domains {
+		if _, err := db.CreateDomain(domain); err != nil {
+			return err
+		}
+		names := make([]string, 0, len(items))
+		for name := range items {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var batch []*sdb.Item
+		for _, name := range names {
+			i := &sdb.Item{Name: name}
+			for attr, values := range items[name] {
+				for _, v := range values {
+					i.ReplaceAttribute(attr, v)
+				}
+			}
+			if batch = append(batch, i); len(batch) == maxBatchItems {
+				if _, err := db.BatchPutAttributes(domain, batch); err != nil {
+					return err
+				}
+				batch = nil
+			}
+		}
+		if len(batch) > 0 {
+			if _, err := db.BatchPutAttributes(domain, batch); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Dump writes the current items of domains to a fixture at path, reading
+// consistently.
+func Dump(db sdb.SimpleDB, path string, domains ...string) error {
+	f, err := DumpFixture(db, domains...)
+	if err != nil {
+		return err
+	}
+	return WriteFixture(path, f)
+}
+
+func DumpFixture(db sdb.SimpleDB, domains ...string) (f Fixture, err error) {
+	db.ConsistentRead = true
+	f.Domains = make(map[string]map[string]Attributes)
+	for _, domain := range domains {
+		items := make(map[string]Attributes)
+		c := db.SelectCursor(sdb.NewQuery(domain).String())
+		for c.Next(context.Background()) {
+			i := c.Item()
+			attrs := make(Attributes)
+			for _, a := range i.Attributes {
+				attrs[a.Name] = append(attrs[a.Name], a.Value)
+			}
+			items[i.Name] = attrs
+		}
+		if err = c.Err(); err != nil {
+			return
+		}
+		f.Domains[domain] = items
+	}
+	return
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdbtest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/coopernurse/sdb"
+)
+
+// StubFunc answers one request from its parameters. The response is a value
+// such as sdb.SelectResponse, sent as XML. A sdb.SimpleDBError is sent as a
+// SimpleDB error, with its StatusCode or 400, any other error fails the
+// request as a network error would.
+type StubFunc func(p url.Values) (interface{}, error)
+
+// Stub answers requests with programmed responses per action, for unit tests
+// that need exact responses or failures rather than Fake's behavior:
+//
+//	s := sdbtest.NewStub()
+//	s.Fail("PutAttributes", sdb.SimpleDBError{Code: "ServiceUnavailable", StatusCode: 503})
+//	s.Respond("PutAttributes", sdb.PutAttributesResponse{})
+//	db := s.Client()
+//
+// Responses queued for an action are used in order and the last one repeats.
+// A request for an action without responses fails with code StubMissing.
+type Stub struct {
+	mu        sync.Mutex
+	responses map[string][]StubFunc
+	calls     []Call
+}
+
+// Call is a request the stub received.
+type Call struct {
+	Action string
+	Params url.Values
+}
+
+func NewStub() *Stub {
+	return &Stub{responses: make(map[string][]StubFunc)}
+}
+
+// Client returns a client whose requests are answered by s.
+func (s *Stub) Client() sdb.SimpleDB {
+	db := sdb.NewSimpleDB("stub", "stub", "sdb.stub")
+	db.HTTPClient = &http.Client{Transport: s}
+	return db
+}
+
+// On queues fn to answer the next request for action.
+func (s *Stub) On(action string, fn StubFunc) *Stub {
+	s.mu.Lock()
+	s.responses[action] = append(s.responses[action], fn)
+	s.mu.Unlock()
+	return s
+}
+
+// Respond queues v as the response to the next request for action.
+func (s *Stub) Respond(action string, v interface{}) *Stub {
+	return s.On(action, func(url.Values) (interface{}, error) { return v, nil })
+}
+
+// Fail queues e as the error for the next request for action.
+func (s *Stub) Fail(action string, e sdb.SimpleDBError) *Stub {
+	return s.On(action, func(url.Values) (interface{}, error) { return nil, e })
+}
+
+// Calls returns the requests received so far, for every action when action
+// is empty.
+func (s *Stub) Calls(action string) (calls []Call) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.calls {
+		if action == "" || c.Action == action {
+			calls = append(calls, c)
+		}
+	}
+	return
+}
+
+func (s *Stub) RoundTrip(req *http.Request) (*http.Response, error) {
+	p, err := requestParameters(req)
+	if err != nil {
+		return nil, err
+	}
+	action := p.Get("Action")
+	s.mu.Lock()
+	s.calls = append(s.calls, Call{Action: action, Params: p})
+	id := fmt.Sprintf("stub-%d", len(s.calls))
+	var fn StubFunc
+	if q := s.responses[action]; len(q) > 0 {
+		fn = q[0]
+		if len(q) > 1 {
+			s.responses[action] = q[1:]
+		}
+	}
+	s.mu.Unlock()
+
+	if fn == nil {
+		return errorResponse(req, http.StatusBadRequest, sdb.SimpleDBError{Code: "StubMissing", Message: "no response for " + action, RequestId: id})
+	}
+	v, err := fn(p)
+	if e, ok := err.(sdb.SimpleDBError); ok {
+		status := e.StatusCode
+		if status == 0 {
+			status = http.StatusBadRequest
+		}
+		if e.RequestId == "" {
+			e.RequestId = id
+		}
+		return errorResponse(req, status, e)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return xmlResponse(req, http.StatusOK, v)
+}
@@ -0,0 +1,60 @@
+package sdb_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestSearch(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	if _, err := db.CreateDomain("docs"); err != nil {
+		t.Fatal(err)
+	}
+	index := func(name string, text ...string) {
+		t.Helper()
+		i := sdb.NewItem(name)
+		if err := i.IndexText("tokens", text...); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.PutAttributes("docs", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	search := func(text string, all bool) string {
+		t.Helper()
+		r, err := db.Select(sdb.SearchQuery("docs", "tokens", text, all).String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, i := range r.Items {
+			names = append(names, i.Name)
+		}
+		sort.Strings(names)
+		return strings.Join(names, ",")
+	}
+	index("a", "Go library for Amazon SimpleDB")
+	index("b", "SimpleDB", "in Python")
+	index("c", "An old go library")
+
+	if got := search("simpledb LIBRARY", true); got != "a" {
+		t.Fatalf("search all = %s", got)
+	}
+	if got := search("simpledb library", false); got != "a,b,c" {
+		t.Fatalf("search any = %s", got)
+	}
+
+	// Indexing new text replaces the tokens of the old text.
+	index("c", "Python")
+	if got := search("library", false); got != "a" {
+		t.Fatalf("search after reindexing = %s", got)
+	}
+	if got := search("python", false); got != "b,c" {
+		t.Fatalf("search after reindexing = %s", got)
+	}
+}
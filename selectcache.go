@@ -0,0 +1,178 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SelectCache caches Select responses keyed by the normalized expression,
+// NextToken and read consistency. Entries expire after TTL and the least
+// recently used entries are evicted beyond MaxEntries. Set it as the Cache of a
+// client to use it, the client then invalidates a domain's entries whenever it
+// writes to that domain. Writes made by other clients are only seen after TTL.
+type SelectCache struct {
+	TTL        time.Duration
+	MaxEntries int
+	mu         sync.Mutex
+	lru        *list.List
+	entries    map[string]*list.Element
+}
+
+type selectCacheEntry struct {
+	key     string
+	domain  string
+	r       SelectResponse
+	expires time.Time
+}
+
+func NewSelectCache(ttl time.Duration, maxEntries int) *SelectCache {
+	return &SelectCache{TTL: ttl, MaxEntries: maxEntries, lru: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// normalizeExpression collapses whitespace outside quoted strings and names.
+func normalizeExpression(q string) string {
+	var b strings.Builder
+	var quote rune
+	space := false
+	for _, r := range strings.TrimSpace(q) {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// selectDomain returns the domain of q, empty if q does not parse.
+func selectDomain(q string) string {
+	s, err := ParseSelect(q)
+	if err != nil {
+		return ""
+	}
+	return s.Domain
+}
+
+func selectCacheKey(q string, token string, consistent bool) string {
+	k := normalizeExpression(q) + "\x00" + token
+	if consistent {
+		k += "\x00consistent"
+	}
+	return k
+}
+
+func (c *SelectCache) get(key string) (r SelectResponse, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	entry := e.Value.(*selectCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(e)
+		return r, false
+	}
+	c.lru.MoveToFront(e)
+	r = entry.r
+	r.Items = copyItems(r.Items)
+	return r, true
+}
+
+func (c *SelectCache) put(key string, q string, r SelectResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	r.Items = copyItems(r.Items)
+	c.entries[key] = c.lru.PushFront(&selectCacheEntry{key: key, domain: selectDomain(q), r: r, expires: time.Now().Add(c.TTL)})
+	for c.MaxEntries > 0 && c.lru.Len() > c.MaxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// copyItems copies items and their attributes, so that callers changing a
+// response do not change the cached one.
+func copyItems(items []Item) []Item {
+	if items == nil {
+		return nil
+	}
+	c := make([]Item, len(items))
+	for n, i := range items {
+		c[n] = Item{Name: i.Name, Attributes: append([]Attribute(nil), i.Attributes...)}
+	}
+	return c
+}
+
+func (c *SelectCache) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.entries, e.Value.(*selectCacheEntry).key)
+}
+
+// InvalidateDomain drops every cached response of a query on domain.
+func (c *SelectCache) InvalidateDomain(domain string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for e := c.lru.Front(); e != nil; {
+		next := e.Next()
+		if e.Value.(*selectCacheEntry).domain == domain {
+			c.remove(e)
+		}
+		e = next
+	}
+}
+
+func (c *SelectCache) Purge() {
+	c.mu.Lock()
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.mu.Unlock()
+}
+
+func (sdb *SimpleDB) invalidateCache(domain string) {
+	if sdb.Cache != nil {
+		sdb.Cache.InvalidateDomain(domain)
+	}
+}
@@ -0,0 +1,63 @@
+package sdb
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSelectCache(t *testing.T) {
+	if s := normalizeExpression("  select *\n from  `a  b`  where x = 'two  spaces' "); s != "select * from `a  b` where x = 'two  spaces'" {
+		t.Error(s)
+	}
+	if d := selectDomain("select * from `my``domain` where a = 'b'"); d != "my`domain" {
+		t.Error(d)
+	}
+
+	c := NewSelectCache(time.Minute, 2)
+	q1 := "select * from users"
+	q2 := "select * from orders"
+	c.put(selectCacheKey(q1, "", false), q1, SelectResponse{NextToken: "1"})
+	c.put(selectCacheKey(q2, "", false), q2, SelectResponse{NextToken: "2"})
+	if r, ok := c.get(selectCacheKey("select *  from users", "", false)); !ok || r.NextToken != "1" {
+		t.Error("Expected cached response for normalized query")
+	}
+	if _, ok := c.get(selectCacheKey(q1, "", true)); ok {
+		t.Error("Consistent reads must not share entries with eventual reads")
+	}
+
+	c.InvalidateDomain("users")
+	if _, ok := c.get(selectCacheKey(q1, "", false)); ok {
+		t.Error("Expected users entries to be invalidated")
+	}
+	q3 := "select * from items"
+	c.put(selectCacheKey(q1, "", false), q1, SelectResponse{})
+	c.put(selectCacheKey(q3, "", false), q3, SelectResponse{})
+	if _, ok := c.get(selectCacheKey(q2, "", false)); ok {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+}
+
+func TestSelectCacheClient(t *testing.T) {
+	it := &itemTransport{attrs: []Attribute{{Name: "name", Value: "Ann"}}}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: it}
+	c.Cache = NewSelectCache(time.Minute, 0)
+	q := "select * from `users`"
+
+	r, err := c.Select(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Changing a response must not change the cached one.
+	r.Items[0].Name = "changed"
+	r.Items[0].Attributes[0].Value = "changed"
+	if r, err = c.Select(q); err != nil || r.Items[0].Name != "u1" || r.Items[0].Attributes[0].Value != "Ann" {
+		t.Fatalf("cached response %+v, %v", r.Items, err)
+	}
+
+	denied := c.WithActionPolicy(ActionPolicy{Deny: []ActionRule{{Actions: []string{"Select"}, Domains: []string{"users"}}}})
+	if _, err = denied.Select(q); err == nil {
+		t.Fatal("Expected the action policy to refuse a cached select")
+	}
+}
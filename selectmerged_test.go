@@ -0,0 +1,48 @@
+package sdb_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestSelectMerged(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	scores := map[string]map[string]int64{
+		"scores-a": {"a1": 9, "a2": 3, "a3": -4},
+		"scores-b": {"b1": 7, "b2": 5},
+	}
+	for domain, items := range scores {
+		if _, err := db.CreateDomain(domain); err != nil {
+			t.Fatal(err)
+		}
+		for name, score := range items {
+			i := sdb.NewItem(name)
+			i.AddAttribute("score", sdb.EncodeInt(score))
+			if _, err := db.PutAttributes(domain, i); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	names := func(limit int) string {
+		t.Helper()
+		items, err := db.SelectMerged([]string{"scores-a", "scores-b"}, sdb.NewQuery(""), "score", true, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, i := range items {
+			names = append(names, i.Name)
+		}
+		return strings.Join(names, ",")
+	}
+	if got := names(3); got != "a1,b1,b2" {
+		t.Errorf("SelectMerged with limit 3 = %s", got)
+	}
+	if got := names(0); got != "a1,b1,b2,a2,a3" {
+		t.Errorf("SelectMerged without a limit = %s", got)
+	}
+}
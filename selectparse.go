@@ -0,0 +1,589 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxSelectLength is the longest Select expression ValidateSelect accepts.
+	MaxSelectLength = 2500
+	// MaxSelectComparisons is the most comparisons allowed in a where clause.
+	MaxSelectComparisons = 20
+	// MaxSelectLimit is the largest value allowed in a limit clause.
+	MaxSelectLimit = 2500
+)
+
+// SelectSyntaxError reports a malformed or disallowed Select expression.
+// Offset is the byte offset in the expression where the problem starts.
+type SelectSyntaxError struct {
+	Offset int
+	Reason string
+}
+
+func (e SelectSyntaxError) Error() string {
+	return fmt.Sprintf("select expression at byte %d: %s", e.Offset, e.Reason)
+}
+
+// SelectStatement is a parsed Select expression. Output holds attribute names,
+// or a single "*", "itemName()" or "count(*)". Where is nil without a where
+// clause and Limit is 0 without a limit clause.
+type SelectStatement struct {
+	Output  []string
+	Domain  string
+	Where   Expr
+	OrderBy string
+	Desc    bool
+	Limit   int
+}
+
+// Expr is a node of a where clause, one of *BinaryExpr, *NotExpr or
+// *Comparison.
+type Expr interface {
+	Offset() int
+}
+
+// BinaryExpr joins two expressions with "and", "or" or "intersection".
+type BinaryExpr struct {
+	Op          string
+	Left, Right Expr
+	offset      int
+}
+
+type NotExpr struct {
+	X      Expr
+	offset int
+}
+
+// Comparison compares an attribute with literal values. Op is one of "=",
+// "!=", "<", "<=", ">", ">=", "like", "not like", "between", "in", "is null"
+// and "is not null". Every is set for every(attr) comparisons.
+type Comparison struct {
+	Attribute string
+	Every     bool
+	Op        string
+	Values    []string
+	offset    int
+}
+
+func (e *BinaryExpr) Offset() int { return e.offset }
+func (e *NotExpr) Offset() int    { return e.offset }
+func (e *Comparison) Offset() int { return e.offset }
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokName
+	tokString
+	tokNumber
+	tokPunct
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	offset int
+}
+
+var comparisonOps = map[string]bool{"=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+var selectKeywords = map[string]bool{
+	"select": true, "from": true, "where": true, "and": true, "or": true,
+	"not": true, "like": true, "between": true, "in": true, "is": true,
+	"null": true, "every": true, "intersection": true, "order": true,
+	"by": true, "asc": true, "desc": true, "limit": true,
+}
+
+func lexSelect(q string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(q); {
+		c := q[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'' || c == '"' || c == '`':
+			start := i
+			var b strings.Builder
+			for i++; ; i++ {
+				if i >= len(q) {
+					return nil, SelectSyntaxError{start, "unterminated quote"}
+				}
+				if q[i] == c {
+					if i+1 < len(q) && q[i+1] == c {
+						b.WriteByte(c)
+						i++
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteByte(q[i])
+			}
+			kind := tokString
+			if c == '`' {
+				kind = tokName
+			}
+			toks = append(toks, token{kind, b.String(), start})
+		case isWordByte(c):
+			start := i
+			for i < len(q) && isWordByte(q[i]) {
+				i++
+			}
+			kind := tokWord
+			if _, err := strconv.Atoi(q[start:i]); err == nil {
+				kind = tokNumber
+			}
+			toks = append(toks, token{kind, q[start:i], start})
+		case c == '!' || c == '<' || c == '>':
+			start := i
+			i++
+			if i < len(q) && q[i] == '=' {
+				i++
+			} else if c == '!' {
+				return nil, SelectSyntaxError{start, "expected != operator"}
+			}
+			toks = append(toks, token{tokPunct, q[start:i], start})
+		case c == '=' || c == '(' || c == ')' || c == ',' || c == '*':
+			toks = append(toks, token{tokPunct, q[i : i+1], i})
+			i++
+		default:
+			return nil, SelectSyntaxError{i, fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+	return append(toks, token{tokEOF, "", len(q)}), nil
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$' || c == '.' || c == '-'
+}
+
+type selectParser struct {
+	toks []token
+	pos  int
+}
+
+// ParseSelect parses a Select expression into a SelectStatement.
+func ParseSelect(q string) (*SelectStatement, error) {
+	toks, err := lexSelect(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &selectParser{toks: toks}
+	return p.statement()
+}
+
+// ValidateSelect parses q and checks the limits SimpleDB enforces: the
+// expression length, the number of comparisons, the limit value and that the
+// sort attribute is constrained by the where clause.
+func ValidateSelect(q string) error {
+	if len(q) > MaxSelectLength {
+		return SelectSyntaxError{MaxSelectLength, fmt.Sprintf("expression is %d bytes, the limit is %d", len(q), MaxSelectLength)}
+	}
+	toks, err := lexSelect(q)
+	if err != nil {
+		return err
+	}
+	p := &selectParser{toks: toks}
+	s, err := p.statement()
+	if err != nil {
+		return err
+	}
+	if cs := comparisons(s.Where, nil); len(cs) > MaxSelectComparisons {
+		return SelectSyntaxError{cs[MaxSelectComparisons].offset, fmt.Sprintf("more than %d comparisons", MaxSelectComparisons)}
+	}
+	if s.OrderBy != "" && s.OrderBy != "itemName()" && !constrains(s.Where, s.OrderBy) {
+		return SelectSyntaxError{p.find("order"), fmt.Sprintf("sort attribute %s must be used in a where predicate", s.OrderBy)}
+	}
+	return nil
+}
+
+// comparisons appends the comparisons of e to cs in expression order.
+func comparisons(e Expr, cs []*Comparison) []*Comparison {
+	switch e := e.(type) {
+	case *BinaryExpr:
+		return comparisons(e.Right, comparisons(e.Left, cs))
+	case *NotExpr:
+		return comparisons(e.X, cs)
+	case *Comparison:
+		return append(cs, e)
+	}
+	return cs
+}
+
+func constrains(e Expr, attr string) bool {
+	switch e := e.(type) {
+	case *BinaryExpr:
+		return constrains(e.Left, attr) || constrains(e.Right, attr)
+	case *NotExpr:
+		return constrains(e.X, attr)
+	case *Comparison:
+		return e.Attribute == attr && e.Op != "is null"
+	}
+	return false
+}
+
+func (p *selectParser) find(keyword string) int {
+	for _, t := range p.toks {
+		if t.kind == tokWord && strings.EqualFold(t.text, keyword) {
+			return t.offset
+		}
+	}
+	return 0
+}
+
+func (p *selectParser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *selectParser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *selectParser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokWord && strings.EqualFold(t.text, keyword)
+}
+
+func (p *selectParser) acceptKeyword(keyword string) bool {
+	if p.isKeyword(keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *selectParser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return p.errorf("expected %s", keyword)
+	}
+	return nil
+}
+
+func (p *selectParser) acceptPunct(s string) bool {
+	t := p.peek()
+	if t.kind == tokPunct && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *selectParser) expectPunct(s string) error {
+	if !p.acceptPunct(s) {
+		return p.errorf("expected %s", s)
+	}
+	return nil
+}
+
+func (p *selectParser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	found := "end of expression"
+	if t.kind != tokEOF {
+		found = strconv.Quote(t.text)
+	}
+	return SelectSyntaxError{t.offset, fmt.Sprintf(format, args...) + ", found " + found}
+}
+
+func (p *selectParser) statement() (s *SelectStatement, err error) {
+	s = &SelectStatement{}
+	if err = p.expectKeyword("select"); err != nil {
+		return nil, err
+	}
+	if s.Output, err = p.output(); err != nil {
+		return nil, err
+	}
+	if err = p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	t := p.next()
+	if t.kind != tokName && (t.kind != tokWord || selectKeywords[strings.ToLower(t.text)]) {
+		return nil, SelectSyntaxError{t.offset, "expected domain name"}
+	}
+	s.Domain = t.text
+	if p.acceptKeyword("where") {
+		if s.Where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("order") {
+		if err = p.expectKeyword("by"); err != nil {
+			return nil, err
+		}
+		if s.OrderBy, err = p.attribute(); err != nil {
+			return nil, err
+		}
+		if p.acceptKeyword("desc") {
+			s.Desc = true
+		} else {
+			p.acceptKeyword("asc")
+		}
+	}
+	if p.acceptKeyword("limit") {
+		t := p.next()
+		n, convErr := strconv.Atoi(t.text)
+		if t.kind != tokNumber || convErr != nil || n < 1 || n > MaxSelectLimit {
+			return nil, SelectSyntaxError{t.offset, fmt.Sprintf("limit must be a number from 1 to %d", MaxSelectLimit)}
+		}
+		s.Limit = n
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf("unexpected input")
+	}
+	return s, nil
+}
+
+func (p *selectParser) output() ([]string, error) {
+	if p.acceptPunct("*") {
+		return []string{"*"}, nil
+	}
+	if p.isKeyword("count") && p.toks[p.pos+1].text == "(" {
+		p.pos++
+		p.next()
+		if err := p.expectPunct("*"); err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return []string{"count(*)"}, nil
+	}
+	var attrs []string
+	for {
+		a, err := p.attribute()
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, a)
+		if !p.acceptPunct(",") {
+			return attrs, nil
+		}
+	}
+}
+
+// attribute parses an attribute name. Bare names may not be keywords and
+// must start with a letter, '_' or '$'; anything else needs backticks.
+func (p *selectParser) attribute() (string, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokName:
+		p.pos++
+		return t.text, nil
+	case tokWord:
+		if strings.EqualFold(t.text, "itemName") {
+			p.pos++
+			if err := p.expectPunct("("); err != nil {
+				return "", err
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return "", err
+			}
+			return "itemName()", nil
+		}
+		if selectKeywords[strings.ToLower(t.text)] {
+			return "", SelectSyntaxError{t.offset, fmt.Sprintf("%s is a reserved word, quote the attribute name with backticks", t.text)}
+		}
+		for i := 0; i < len(t.text); i++ {
+			c := t.text[i]
+			if c == '.' || c == '-' || i == 0 && c >= '0' && c <= '9' {
+				return "", SelectSyntaxError{t.offset + i, fmt.Sprintf("attribute name %s must be quoted with backticks", t.text)}
+			}
+		}
+		p.pos++
+		return t.text, nil
+	case tokNumber:
+		return "", SelectSyntaxError{t.offset, fmt.Sprintf("attribute name %s must be quoted with backticks", t.text)}
+	case tokString:
+		return "", SelectSyntaxError{t.offset, "attribute names are quoted with backticks, not quotes"}
+	}
+	return "", p.errorf("expected attribute name")
+}
+
+func (p *selectParser) expr() (Expr, error) {
+	left, err := p.orExpr()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !p.acceptKeyword("intersection") {
+			return left, nil
+		}
+		right, err := p.orExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{"intersection", left, right, t.offset}
+	}
+}
+
+func (p *selectParser) orExpr() (Expr, error) {
+	left, err := p.andExpr()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !p.acceptKeyword("or") {
+			return left, nil
+		}
+		right, err := p.andExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{"or", left, right, t.offset}
+	}
+}
+
+func (p *selectParser) andExpr() (Expr, error) {
+	left, err := p.notExpr()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !p.acceptKeyword("and") {
+			return left, nil
+		}
+		right, err := p.notExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{"and", left, right, t.offset}
+	}
+}
+
+func (p *selectParser) notExpr() (Expr, error) {
+	t := p.peek()
+	if p.acceptKeyword("not") {
+		x, err := p.notExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpr{x, t.offset}, nil
+	}
+	if p.acceptPunct("(") {
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return x, nil
+	}
+	return p.comparison()
+}
+
+func (p *selectParser) comparison() (Expr, error) {
+	c := &Comparison{offset: p.peek().offset}
+	var err error
+	if p.isKeyword("every") && p.toks[p.pos+1].text == "(" {
+		p.pos += 2
+		c.Every = true
+		if c.Attribute, err = p.attribute(); err != nil {
+			return nil, err
+		}
+		if err = p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+	} else if c.Attribute, err = p.attribute(); err != nil {
+		return nil, err
+	}
+
+	op := p.peek()
+	switch {
+	case op.kind == tokPunct && comparisonOps[op.text]:
+		p.pos++
+		c.Op = op.text
+		err = p.value(c)
+	case p.acceptKeyword("like"):
+		c.Op = "like"
+		err = p.value(c)
+	case p.isKeyword("not") && strings.EqualFold(p.toks[p.pos+1].text, "like"):
+		p.pos += 2
+		c.Op = "not like"
+		err = p.value(c)
+	case p.acceptKeyword("between"):
+		c.Op = "between"
+		if err = p.value(c); err == nil {
+			if err = p.expectKeyword("and"); err == nil {
+				err = p.value(c)
+			}
+		}
+	case p.acceptKeyword("in"):
+		c.Op = "in"
+		if err = p.expectPunct("("); err != nil {
+			return nil, err
+		}
+		for {
+			if err = p.value(c); err != nil {
+				return nil, err
+			}
+			if !p.acceptPunct(",") {
+				break
+			}
+		}
+		err = p.expectPunct(")")
+	case p.acceptKeyword("is"):
+		c.Op = "is null"
+		if p.acceptKeyword("not") {
+			c.Op = "is not null"
+		}
+		err = p.expectKeyword("null")
+	default:
+		return nil, p.errorf("expected comparison operator")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// value appends a quoted value to c.
+func (p *selectParser) value(c *Comparison) error {
+	t := p.peek()
+	if t.kind != tokString {
+		if t.kind == tokNumber {
+			return SelectSyntaxError{t.offset, fmt.Sprintf("value %s must be quoted", t.text)}
+		}
+		return p.errorf("expected quoted value")
+	}
+	p.pos++
+	c.Values = append(c.Values, t.text)
+	return nil
+}
@@ -0,0 +1,74 @@
+package sdb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSelect(t *testing.T) {
+	q := NewQuery("users").Output("itemName()", "score").
+		Where("board", "=", "it's").
+		WhereIn("itemName()", "a", "b").
+		WhereAll("tag", "x", "y").
+		OrderBy("score", true).Limit(10).String()
+	s, err := ParseSelect(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Domain != "users" || s.OrderBy != "score" || !s.Desc || s.Limit != 10 || len(s.Output) != 2 || s.Output[0] != "itemName()" {
+		t.Errorf("%+v", s)
+	}
+	cs := comparisons(s.Where, nil)
+	if len(cs) != 4 || cs[0].Values[0] != "it's" || cs[1].Op != "in" || len(cs[1].Values) != 2 {
+		t.Errorf("%+v", cs)
+	}
+
+	s, err = ParseSelect("SELECT count(*) FROM d WHERE not (a is not null or every(b) between '1' and '2') and c not like 'x%'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Output[0] != "count(*)" {
+		t.Error(s.Output)
+	}
+	if b, ok := s.Where.(*BinaryExpr); !ok || b.Op != "and" {
+		t.Errorf("%#v", s.Where)
+	}
+}
+
+func TestValidateSelect(t *testing.T) {
+	tests := []struct {
+		q      string
+		offset int
+		reason string
+	}{
+		{"select * from d where a = '1' order by a", -1, ""},
+		{"select * from d order by itemName()", -1, ""},
+		{"select * from d where `first name` = 'x'", -1, ""},
+		{"select * from d where first-name = 'x'", 27, "quoted with backticks"},
+		{"select * from d where order = 'x'", 22, "reserved word"},
+		{"select * from d where 'a' = 'x'", 22, "not quotes"},
+		{"select * from d where a = 1", 26, "must be quoted"},
+		{"select * from d where a == 'x'", 25, "expected quoted value"},
+		{"select * from d where a ~ 'x'", 24, "unexpected character"},
+		{"select * from d where a = 'x", 26, "unterminated"},
+		{"select * from d where a in ('1', '2'", 36, "expected )"},
+		{"select * from d order by a", 16, "must be used in a where predicate"},
+		{"select * from d limit 2501", 22, "limit"},
+		{"select * from d where a = '1' b", 30, "unexpected input"},
+		{"select * from d where a = '" + strings.Repeat("x", MaxSelectLength) + "'", MaxSelectLength, "the limit is"},
+		{"select * from d where " + strings.Repeat("a = '1' or ", MaxSelectComparisons) + "a = '1'", 22 + 11*MaxSelectComparisons, "comparisons"},
+	}
+	for _, tt := range tests {
+		err := ValidateSelect(tt.q)
+		if tt.offset < 0 {
+			if err != nil {
+				t.Errorf("%s: %v", tt.q, err)
+			}
+			continue
+		}
+		e, ok := err.(SelectSyntaxError)
+		if !ok || e.Offset != tt.offset || !strings.Contains(e.Reason, tt.reason) {
+			t.Errorf("%.60s: got %v, want offset %d %q", tt.q, err, tt.offset, tt.reason)
+		}
+	}
+}
@@ -0,0 +1,517 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Shard is a domain holding the item names from Start up to the Start of
+// the next shard.
+type Shard struct {
+	Domain string
+	Start  string
+}
+
+// ShardedDomain spreads items over several domains by item name range, or
+// with a consistent hash Ring, to get past the size and request rate limits
+// of one domain. The shard table is kept in memory, persist Shards after a
+// Split or AddShard.
+//
+// The shard table and the state of a migration are only known to the
+// ShardedDomain, so it must be the only writer of its domains: writes made
+// by other clients during a Split or AddShard may be lost. Split and
+// AddShard hold Lease while they run, so clients sharing the lease domain
+// never migrate at once.
+type ShardedDomain struct {
+	// Lease must be set for Split and AddShard, see NewLease.
+	Lease     *Lease
+	db        SimpleDB
+	mu        sync.RWMutex
+	shards    []Shard
+	ring      *Ring
+	splitting bool
+	migration *shardMigration
+	// writes is held by Put and Delete for reading and by a starting
+	// migration, so writes routed before it have finished when it copies.
+	writes sync.RWMutex
+}
+
+// shardMigration is a set of items being moved to a new shard. Reads of
+// moving items try the new shard first and fall back to the old one, writes
+// go to the new shard after copying the item there. The copy of an item and
+// the writes of moving items hold mu, so a copy never brings back a deleted
+// item or overwrites a newer write.
+type shardMigration struct {
+	to     string
+	from   func(name string) string
+	moving func(name string) bool
+	mu     sync.Mutex
+}
+
+// NewShardedDomain needs a shard with an empty Start. Reads are consistent
+// so items are not missed while being moved.
+func NewShardedDomain(db SimpleDB, shards ...Shard) (*ShardedDomain, error) {
+	shards = append([]Shard(nil), shards...)
+	sort.Slice(shards, func(a, b int) bool { return shards[a].Start < shards[b].Start })
+	if len(shards) == 0 || shards[0].Start != "" {
+		return nil, errors.New("sdb: a sharded domain needs a shard starting at the empty name")
+	}
+	db.ConsistentRead = true
+	return &ShardedDomain{db: db, shards: shards}, nil
+}
+
+// NewRingShardedDomain places items on the domains of ring by the hash of
+// their name. A copy of ring is kept, so later changes to ring do not move
+// items, only AddShard changes the copy after migrating the items.
+func NewRingShardedDomain(db SimpleDB, ring *Ring) *ShardedDomain {
+	db.ConsistentRead = true
+	return &ShardedDomain{db: db, ring: ring.clone()}
+}
+
+// Shards returns the shard table ordered by Start, or the domains of the
+// ring in the order they were added.
+func (s *ShardedDomain) Shards() []Shard {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.ring != nil {
+		var shards []Shard
+		for _, n := range s.ring.Nodes() {
+			shards = append(shards, Shard{Domain: n})
+		}
+		return shards
+	}
+	return append([]Shard(nil), s.shards...)
+}
+
+// Ring returns a copy of the ring of a ShardedDomain made by
+// NewRingShardedDomain, for monitoring with Ring.State. Changing the copy
+// does not change the routing, add shards with AddShard.
+func (s *ShardedDomain) Ring() *Ring {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.ring == nil {
+		return nil
+	}
+	return s.ring.clone()
+}
+
+// route returns the domain holding name, leaving out migrations. The
+// caller holds mu.
+func (s *ShardedDomain) route(name string) string {
+	if s.ring != nil {
+		return s.ring.Get(name)
+	}
+	return s.shards[s.shard(name)].Domain
+}
+
+// shard returns the index of the shard holding name.
+func (s *ShardedDomain) shard(name string) int {
+	return sort.Search(len(s.shards), func(n int) bool { return s.shards[n].Start > name }) - 1
+}
+
+// Domain returns the domain holding name.
+func (s *ShardedDomain) Domain(name string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if m := s.migrating(name); m != nil {
+		return m.to
+	}
+	return s.route(name)
+}
+
+// migrating returns the migration moving name, if any. The caller holds mu.
+func (s *ShardedDomain) migrating(name string) *shardMigration {
+	if m := s.migration; m != nil && m.moving(name) {
+		return m
+	}
+	return nil
+}
+
+// Put puts the attributes of i in the shard holding its name.
+func (s *ShardedDomain) Put(ctx context.Context, i *Item) error {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+	s.mu.RLock()
+	m := s.migrating(i.Name)
+	domain := s.route(i.Name)
+	s.mu.RUnlock()
+	db := s.db.WithContext(ctx)
+	if m != nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if err := s.move(&db, m, i.Name); err != nil {
+			return err
+		}
+		domain = m.to
+	}
+	_, err := db.PutAttributes(domain, i)
+	return err
+}
+
+// Get reads the named item from its shard.
+func (s *ShardedDomain) Get(ctx context.Context, name string) ([]Attribute, error) {
+	s.mu.RLock()
+	m := s.migrating(name)
+	domain := s.route(name)
+	s.mu.RUnlock()
+	db := s.db.WithContext(ctx)
+	if m != nil {
+		r, err := db.GetAttributes(m.to, name)
+		if err != nil || len(r.Attributes) > 0 {
+			return r.Attributes, err
+		}
+		domain = m.from(name)
+	}
+	r, err := db.GetAttributes(domain, name)
+	return r.Attributes, err
+}
+
+// Delete deletes the named item, from both shards while it is being moved.
+func (s *ShardedDomain) Delete(ctx context.Context, name string) error {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+	s.mu.RLock()
+	m := s.migrating(name)
+	domain := s.route(name)
+	s.mu.RUnlock()
+	db := s.db.WithContext(ctx)
+	if m != nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, err := db.DeleteItem(m.to, name); err != nil {
+			return err
+		}
+		domain = m.from(name)
+	}
+	_, err := db.DeleteItem(domain, name)
+	return err
+}
+
+// move copies the named item to the new shard of m unless it is there
+// already. The caller holds m.mu.
+func (s *ShardedDomain) move(db *SimpleDB, m *shardMigration, name string) error {
+	r, err := db.GetAttributes(m.from(name), name)
+	if err != nil || len(r.Attributes) == 0 {
+		return err
+	}
+	err = copyItem(db, m.to, &Item{Name: name, Attributes: r.Attributes})
+	if IsConditionalCheckFailed(err) {
+		err = nil
+	}
+	return err
+}
+
+// startMigration marks a migration as running and acquires Lease, which is
+// renewed until endMigration. Loss of the lease is sent on lost.
+func (s *ShardedDomain) startMigration() (lost <-chan error, err error) {
+	if s.Lease == nil {
+		return nil, errors.New("sdb: a sharded domain needs a Lease to migrate items")
+	}
+	if err = checkInterval(s.Lease.TTL / 3); err != nil {
+		return
+	}
+	s.mu.Lock()
+	if s.splitting {
+		s.mu.Unlock()
+		return nil, errors.New("sdb: a split is already running")
+	}
+	s.splitting = true
+	s.mu.Unlock()
+	ok, err := s.Lease.Acquire()
+	if err == nil && !ok {
+		err = ErrLeaseLost
+	}
+	if err != nil {
+		s.mu.Lock()
+		s.splitting = false
+		s.mu.Unlock()
+		return nil, err
+	}
+	return s.Lease.KeepAlive(s.Lease.TTL / 3)
+}
+
+func (s *ShardedDomain) endMigration() {
+	s.Lease.Release()
+	s.mu.Lock()
+	s.splitting, s.migration = false, nil
+	s.mu.Unlock()
+}
+
+// setMigration starts routing the items of m once the writes routed without
+// it have finished.
+func (s *ShardedDomain) setMigration(m *shardMigration) {
+	s.writes.Lock()
+	s.mu.Lock()
+	s.migration = m
+	s.mu.Unlock()
+	s.writes.Unlock()
+}
+
+// copyMoving copies the named item to the new shard of m as it is stored
+// now, unless the lease of the migration is lost.
+func (s *ShardedDomain) copyMoving(db *SimpleDB, m *shardMigration, lost <-chan error, name string) error {
+	if err := leaseLost(lost); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return s.move(db, m, name)
+}
+
+// leaseLost returns the error sent on lost, if any.
+func leaseLost(lost <-chan error) error {
+	select {
+	case err := <-lost:
+		if err == nil {
+			err = ErrLeaseLost
+		}
+		return err
+	default:
+		return nil
+	}
+}
+
+// copyItem puts i in domain unless it was copied there already. Items reach
+// a new shard only by being copied with all their attributes, Put moves an
+// item before writing it, so the first attribute exists for every item
+// already there.
+func copyItem(db *SimpleDB, domain string, i *Item) error {
+	if len(i.Attributes) == 0 {
+		return nil
+	}
+	_, err := db.PutAttributesIf(domain, i, Condition{Name: i.Attributes[0].Name, Exists: false})
+	return err
+}
+
+// ShardUsage is the item count of a shard from DomainMetadata.
+type ShardUsage struct {
+	Shard
+	Items int64
+}
+
+// Skewed returns the shards holding more than factor times the mean number
+// of items, by DomainMetadata, along with the usage of all shards.
+func (s *ShardedDomain) Skewed(ctx context.Context, factor float64) (hot []Shard, usage []ShardUsage, err error) {
+	db := s.db.WithContext(ctx)
+	var total int64
+	for _, sh := range s.Shards() {
+		var r DomainMetadataResponse
+		if r, err = db.DomainMetadata(sh.Domain); err != nil {
+			return
+		}
+		usage = append(usage, ShardUsage{sh, r.ItemCount})
+		total += r.ItemCount
+	}
+	mean := float64(total) / float64(len(usage))
+	for _, u := range usage {
+		if u.Items > 1 && float64(u.Items) > factor*mean {
+			hot = append(hot, u.Shard)
+		}
+	}
+	return
+}
+
+// Split moves the upper half of the items of shard to the new domain. The
+// domain is created, the items from the median name up are copied while
+// reads of the range try both shards, then the shard table is updated and
+// the copied items deleted from the old shard. Only one split runs at a
+// time, Lease is held meanwhile. The new shard is returned.
+func (s *ShardedDomain) Split(ctx context.Context, shard Shard, domain string) (added Shard, err error) {
+	db := s.db.WithContext(ctx)
+	if s.Ring() != nil {
+		return added, errors.New("sdb: ring sharded domains grow with AddShard")
+	}
+	lost, err := s.startMigration()
+	if err != nil {
+		return
+	}
+	defer s.endMigration()
+	s.mu.RLock()
+	n := s.shard(shard.Start)
+	known := n >= 0 && s.shards[n] == shard
+	end := ""
+	if known && n+1 < len(s.shards) {
+		end = s.shards[n+1].Start
+	}
+	s.mu.RUnlock()
+	if !known {
+		return added, errors.New("sdb: unknown shard " + shard.Domain)
+	}
+
+	md, err := db.DomainMetadata(shard.Domain)
+	if err != nil {
+		return
+	}
+	q := NewQuery(shard.Domain).Output("itemName()").Where("itemName()", ">=", shard.Start).OrderBy("itemName()", false)
+	page, err := db.SelectOffset(q, int(md.ItemCount/2), 1)
+	if err != nil {
+		return
+	}
+	if len(page.Items) == 0 || page.Items[0].Name == shard.Start {
+		return added, errors.New("sdb: shard " + shard.Domain + " is too small to split")
+	}
+	mid := page.Items[0].Name
+	if _, err = db.CreateDomain(domain); err != nil {
+		return
+	}
+	if err = db.WaitForDomain(ctx, domain, true); err != nil {
+		return
+	}
+
+	m := &shardMigration{
+		to:   domain,
+		from: func(string) string { return shard.Domain },
+		moving: func(name string) bool {
+			return name >= mid && (end == "" || name < end)
+		},
+	}
+	s.setMigration(m)
+
+	var moved []*Item
+	rq := NewQuery(shard.Domain).Output("itemName()").Where("itemName()", ">=", mid)
+	if end != "" {
+		rq.Where("itemName()", "<", end)
+	}
+	err = db.SelectStream(ctx, rq.String(), func(i Item) error {
+		if err := s.copyMoving(&db, m, lost, i.Name); err != nil {
+			return err
+		}
+		moved = append(moved, &Item{Name: i.Name})
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	if err = leaseLost(lost); err != nil {
+		return
+	}
+	added = Shard{Domain: domain, Start: mid}
+	s.mu.Lock()
+	s.shards = append(s.shards[:n+1], append([]Shard{added}, s.shards[n+1:]...)...)
+	s.mu.Unlock()
+	err = runBatches(ctx, "Split", batches(moved), func(ctx context.Context, k int, batch []*Item) error {
+		db := s.db.WithContext(ctx)
+		_, err := db.BatchDeleteAttributes(shard.Domain, batch)
+		return err
+	})
+	return
+}
+
+// Rebalance splits every shard Skewed finds with factor into a new domain
+// named by name, returning the shards added.
+func (s *ShardedDomain) Rebalance(ctx context.Context, factor float64, name func(Shard) string) (added []Shard, err error) {
+	hot, _, err := s.Skewed(ctx, factor)
+	if err != nil {
+		return
+	}
+	for _, sh := range hot {
+		var n Shard
+		if n, err = s.Split(ctx, sh, name(sh)); err != nil {
+			return
+		}
+		added = append(added, n)
+	}
+	return
+}
+
+// AddShard adds domain to the ring of a ShardedDomain made by
+// NewRingShardedDomain. The domain is created, the items the new ring
+// places on it are copied from the other shards while reads of them try
+// both, then the ring is updated and the copied items deleted from their
+// old shards.
+func (s *ShardedDomain) AddShard(ctx context.Context, domain string) (err error) {
+	db := s.db.WithContext(ctx)
+	s.mu.Lock()
+	if s.ring == nil {
+		s.mu.Unlock()
+		return errors.New("sdb: range sharded domains grow with Split")
+	}
+	old := s.ring
+	s.mu.Unlock()
+	lost, err := s.startMigration()
+	if err != nil {
+		return
+	}
+	defer s.endMigration()
+
+	if _, err = db.CreateDomain(domain); err != nil {
+		return
+	}
+	if err = db.WaitForDomain(ctx, domain, true); err != nil {
+		return
+	}
+	ring := old.clone()
+	ring.Add(domain)
+	m := &shardMigration{
+		to:     domain,
+		from:   old.Get,
+		moving: func(name string) bool { return ring.Get(name) == domain },
+	}
+	s.setMigration(m)
+
+	moved := make(map[string][]*Item)
+	for _, from := range old.Nodes() {
+		err = db.SelectStream(ctx, NewQuery(from).Output("itemName()").String(), func(i Item) error {
+			if ring.Get(i.Name) != domain {
+				return nil
+			}
+			if err := s.copyMoving(&db, m, lost, i.Name); err != nil {
+				return err
+			}
+			moved[from] = append(moved[from], &Item{Name: i.Name})
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	if err = leaseLost(lost); err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.ring = ring
+	s.mu.Unlock()
+	for _, from := range old.Nodes() {
+		err = runBatches(ctx, "AddShard", batches(moved[from]), func(ctx context.Context, k int, batch []*Item) error {
+			db := s.db.WithContext(ctx)
+			_, err := db.BatchDeleteAttributes(from, batch)
+			return err
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,154 @@
+package sdb_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestShardedDomainSplit(t *testing.T) {
+	f := sdbtest.NewFake()
+	rt := &racingTransport{RoundTripper: f}
+	db := f.Client()
+	db.HTTPClient = &http.Client{Transport: rt}
+	ctx := context.Background()
+	for _, d := range []string{"s0", "s1", "leases"} {
+		if _, err := db.CreateDomain(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := sdb.NewShardedDomain(db, sdb.Shard{Domain: "s1", Start: "m"}, sdb.Shard{Domain: "s0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for j := 0; j < 10; j++ {
+		for _, prefix := range []string{"a", "z"} {
+			i := sdb.NewItem(fmt.Sprintf("%s%02d", prefix, j))
+			i.AddAttribute("n", "v")
+			if err = s.Put(ctx, i); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err = s.Put(ctx, &sdb.Item{Name: "a99", Attributes: []sdb.Attribute{{Name: "n", Value: "v"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if s.Domain("a05") != "s0" || s.Domain("z05") != "s1" {
+		t.Errorf("Unexpected routing %s %s", s.Domain("a05"), s.Domain("z05"))
+	}
+
+	hot, usage, err := s.Skewed(ctx, 1.01)
+	if err != nil || len(hot) != 1 || hot[0].Domain != "s0" || usage[0].Items != 11 {
+		t.Fatalf("Unexpected skew %v %v %v", hot, usage, err)
+	}
+	name := func(sh sdb.Shard) string { return sh.Domain + "b" }
+	if _, err = s.Rebalance(ctx, 1.01, name); err == nil {
+		t.Fatal("Expected Split to need a Lease")
+	}
+	other := sdb.NewLease(db, "leases", "shards", "other", time.Minute)
+	if ok, err := other.Acquire(); !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	s.Lease = sdb.NewLease(db, "leases", "shards", "test", time.Minute)
+	if _, err = s.Rebalance(ctx, 1.01, name); err != sdb.ErrLeaseLost {
+		t.Fatalf("Expected Split to refuse a lease held by another client, got %v", err)
+	}
+	if err = other.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a07 is deleted after the copy has listed it
+	rt.match = func(p url.Values) bool {
+		return p.Get("Action") == "Select" && strings.Contains(p.Get("SelectExpression"), "'a05'")
+	}
+	rt.race = func() {
+		if err := s.Delete(ctx, "a07"); err != nil {
+			t.Error(err)
+		}
+	}
+	added, err := s.Rebalance(ctx, 1.01, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.race != nil {
+		t.Fatal("the copy was not raced")
+	}
+	if attrs, err := s.Get(ctx, "a07"); err != nil || len(attrs) != 0 {
+		t.Errorf("deleted item copied: %v %v", attrs, err)
+	}
+	expected := []sdb.Shard{{Domain: "s0"}, {Domain: "s0b", Start: "a05"}, {Domain: "s1", Start: "m"}}
+	if len(added) != 1 || !reflect.DeepEqual(s.Shards(), expected) {
+		t.Errorf("Unexpected shards %v, added %v", s.Shards(), added)
+	}
+	for _, name := range []string{"a00", "a04", "a05", "a08", "a99", "z09"} {
+		attrs, err := s.Get(ctx, name)
+		if err != nil || len(attrs) != 1 {
+			t.Errorf("%s: %v %v", name, attrs, err)
+		}
+	}
+	r, err := db.DomainMetadata("s0")
+	if err != nil || r.ItemCount != 5 {
+		t.Errorf("Expected moved items to be deleted, %d left", r.ItemCount)
+	}
+}
+
+func TestRingShardedDomain(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	ctx := context.Background()
+	for _, d := range []string{"r0", "r1", "leases"} {
+		if _, err := db.CreateDomain(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ring := sdb.NewRing(50, nil, "r0", "r1")
+	s := sdb.NewRingShardedDomain(db, ring)
+	// changes to the rings passed in and returned do not re-route items
+	ring.Add("r9")
+	s.Ring().Remove("r1")
+	if nodes := s.Ring().Nodes(); !reflect.DeepEqual(nodes, []string{"r0", "r1"}) {
+		t.Errorf("Ring changed outside AddShard: %v", nodes)
+	}
+	s.Lease = sdb.NewLease(db, "leases", "shards", "test", time.Minute)
+	for j := 0; j < 60; j++ {
+		i := sdb.NewItem(fmt.Sprintf("item%02d", j))
+		i.AddAttribute("n", "v")
+		if err := s.Put(ctx, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddShard(ctx, "r2"); err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	for _, sh := range s.Shards() {
+		r, err := db.DomainMetadata(sh.Domain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sh.Domain == "r2" && r.ItemCount == 0 {
+			t.Error("Expected items on the new shard")
+		}
+		total += r.ItemCount
+	}
+	if total != 60 || len(s.Ring().State()) != 3 {
+		t.Errorf("Expected 60 items on 3 shards, got %d on %v", total, s.Shards())
+	}
+	for j := 0; j < 60; j++ {
+		name := fmt.Sprintf("item%02d", j)
+		if attrs, err := s.Get(ctx, name); err != nil || len(attrs) != 1 {
+			t.Errorf("%s: %v %v", name, attrs, err)
+		}
+	}
+	if _, err := s.Split(ctx, sdb.Shard{Domain: "r0"}, "r3"); err == nil {
+		t.Error("Expected Split to refuse a ring sharded domain")
+	}
+}
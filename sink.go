@@ -0,0 +1,92 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Sink receives the changes of a Watcher, for example with
+// w.Run(ctx, time.Minute, sink.Send). Webhook is a Sink.
+type Sink interface {
+	Send(ctx context.Context, c Change) error
+}
+
+// Producer publishes a keyed message to a topic, as Kafka producers do.
+// Callers implement it with the client of their message bus.
+type Producer interface {
+	Produce(ctx context.Context, topic string, key []byte, value []byte) error
+}
+
+// ProducerSink publishes every change to Topic as a JSON WebhookPayload
+// keyed by the item name, so the changes of an item keep their order on
+// partitioned topics.
+type ProducerSink struct {
+	Producer Producer
+	Topic    string
+}
+
+func (s ProducerSink) Send(ctx context.Context, c Change) error {
+	body, err := changeJSON(c)
+	if err != nil {
+		return err
+	}
+	return s.Producer.Produce(ctx, s.Topic, []byte(c.Item.Name), body)
+}
+
+// Publisher publishes a message with string attributes to a topic, as SNS
+// Publish does. Callers implement it with the client of their message bus.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, message string, attributes map[string]string) error
+}
+
+// PublisherSink publishes every change to Topic as a JSON WebhookPayload
+// with the domain and item name as the domain and item attributes, for
+// subscription filters.
+type PublisherSink struct {
+	Publisher Publisher
+	Topic     string
+}
+
+func (s PublisherSink) Send(ctx context.Context, c Change) error {
+	body, err := changeJSON(c)
+	if err != nil {
+		return err
+	}
+	return s.Publisher.Publish(ctx, s.Topic, string(body), map[string]string{"domain": c.Domain, "item": c.Item.Name})
+}
+
+func changeJSON(c Change) ([]byte, error) {
+	p := WebhookPayload{Domain: c.Domain, Item: c.Item.Name, Mark: c.Mark, Attributes: make(map[string][]string)}
+	for _, a := range c.Item.Attributes {
+		p.Attributes[a.Name] = append(p.Attributes[a.Name], a.Value)
+	}
+	return json.Marshal(p)
+}
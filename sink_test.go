@@ -0,0 +1,45 @@
+package sdb
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+type testProducer struct {
+	topic, key string
+	value      []byte
+}
+
+func (p *testProducer) Produce(ctx context.Context, topic string, key []byte, value []byte) error {
+	p.topic, p.key, p.value = topic, string(key), value
+	return nil
+}
+
+type testPublisher struct {
+	topic, message string
+	attrs          map[string]string
+}
+
+func (p *testPublisher) Publish(ctx context.Context, topic string, message string, attrs map[string]string) error {
+	p.topic, p.message, p.attrs = topic, message, attrs
+	return nil
+}
+
+func TestSinks(t *testing.T) {
+	c := Change{Domain: "users", Mark: "002", Item: Item{Name: "u1", Attributes: []Attribute{{Name: "role", Value: "a"}, {Name: "role", Value: "b"}}}}
+	pr := &testProducer{}
+	pb := &testPublisher{}
+	for _, s := range []Sink{ProducerSink{Producer: pr, Topic: "changes"}, PublisherSink{Publisher: pb, Topic: "arn"}} {
+		if err := s.Send(context.Background(), c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var p WebhookPayload
+	if err := json.Unmarshal(pr.value, &p); err != nil || pr.topic != "changes" || pr.key != "u1" || p.Mark != "002" || len(p.Attributes["role"]) != 2 {
+		t.Errorf("unexpected produce %q %q %+v, %v", pr.topic, pr.key, p, err)
+	}
+	if pb.topic != "arn" || pb.message != string(pr.value) || pb.attrs["domain"] != "users" || pb.attrs["item"] != "u1" {
+		t.Errorf("unexpected publish %q %q %v", pb.topic, pb.message, pb.attrs)
+	}
+}
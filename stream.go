@@ -0,0 +1,133 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ResponseTooLargeError is returned when a response body is larger than
+// MaxResponseBytes.
+type ResponseTooLargeError struct {
+	Action string
+	Limit  int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("%s response is larger than %d bytes", e.Action, e.Limit)
+}
+
+// readBody reads the response body, at most MaxResponseBytes of it.
+func (sdb *SimpleDB) readBody(r *http.Response) ([]byte, error) {
+	if sdb.MaxResponseBytes <= 0 {
+		return io.ReadAll(r.Body)
+	}
+	if r.ContentLength > sdb.MaxResponseBytes {
+		return nil, &ResponseTooLargeError{Action: sdb.p.Get("Action"), Limit: sdb.MaxResponseBytes}
+	}
+	b, err := io.ReadAll(io.LimitReader(r.Body, sdb.MaxResponseBytes+1))
+	if err == nil && int64(len(b)) > sdb.MaxResponseBytes {
+		return nil, &ResponseTooLargeError{Action: sdb.p.Get("Action"), Limit: sdb.MaxResponseBytes}
+	}
+	return b, err
+}
+
+// SelectStream calls fn for every item matching q, following all pages.
+// Items are decoded from the response as they arrive instead of reading whole
+// pages, so a page of large items does not have to fit in memory and
+// MaxResponseBytes does not apply. The Cache is not used and RawResponse is
+// not set. An error from fn stops the Select and is returned.
+func (sdb *SimpleDB) SelectStream(ctx context.Context, q string, fn func(Item) error) error {
+	db := sdb.WithContext(ctx)
+	token := ""
+	for {
+		next, err := db.selectStreamPage(q, token, fn)
+		if err != nil || next == "" {
+			return err
+		}
+		token = next
+	}
+}
+
+func (sdb *SimpleDB) selectStreamPage(q string, token string, fn func(Item) error) (next string, err error) {
+	if sdb.ValidateSelects {
+		if err = ValidateSelect(q); err != nil {
+			return
+		}
+	}
+	if err = sdb.checkSelect(q, true); err != nil {
+		return
+	}
+	sdb.selectParameters(q, token)
+	var r struct{ ResponseMetadata ResponseMetadata }
+	sdb.stream = func(body io.Reader) error {
+		d := xml.NewDecoder(body)
+		for {
+			t, err := d.Token()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			start, ok := t.(xml.StartElement)
+			if !ok {
+				continue
+			}
+			switch start.Name.Local {
+			case "Item":
+				var i Item
+				if err = d.DecodeElement(&i, &start); err != nil {
+					return err
+				}
+				if i.Attributes, err = sdb.readAttributes(i.Name, i.Attributes); err != nil {
+					return err
+				}
+				if err = fn(i); err != nil {
+					return err
+				}
+			case "NextToken":
+				if err = d.DecodeElement(&next, &start); err != nil {
+					return err
+				}
+			case "ResponseMetadata":
+				if err = d.DecodeElement(&r.ResponseMetadata, &start); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	defer func() { sdb.stream = nil }()
+	err = sdb.post(&r)
+	return
+}
@@ -0,0 +1,58 @@
+package sdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+// pagesTransport answers Selects with the pages in order.
+type pagesTransport struct {
+	pages []string
+}
+
+func (p *pagesTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := p.pages[0]
+	p.pages = p.pages[1:]
+	return &http.Response{StatusCode: 200, Status: "200 OK", ContentLength: int64(len(body)),
+		Body: io.NopCloser(bytes.NewBufferString(body)), Request: req}, nil
+}
+
+const (
+	streamPage1 = `<SelectResponse><SelectResult><Item><Name>i1</Name><Attribute><Name>a</Name><Value>1</Value></Attribute></Item><Item><Name>i2</Name></Item><NextToken>t1</NextToken></SelectResult><ResponseMetadata><RequestId>r1</RequestId><BoxUsage>0.1</BoxUsage></ResponseMetadata></SelectResponse>`
+	streamPage2 = `<SelectResponse><SelectResult><Item><Name>i3</Name></Item></SelectResult><ResponseMetadata><RequestId>r2</RequestId><BoxUsage>0.1</BoxUsage></ResponseMetadata></SelectResponse>`
+)
+
+func TestMaxResponseBytes(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: &pagesTransport{pages: []string{streamPage1}}}
+	c.MaxResponseBytes = 100
+	_, err := c.Select("select * from d")
+	var tooLarge *ResponseTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Action != "Select" {
+		t.Fatalf("expected ResponseTooLargeError, got %v", err)
+	}
+}
+
+func TestSelectStream(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: &pagesTransport{pages: []string{streamPage1, streamPage2}}}
+	c.MaxResponseBytes = 100
+	var names []string
+	err := c.SelectStream(context.Background(), "select * from d", func(i Item) error {
+		names = append(names, i.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 3 || names[0] != "i1" || names[2] != "i3" {
+		t.Errorf("unexpected items %v", names)
+	}
+	if c.LastRequestId() != "" {
+		t.Errorf("SelectStream changed the caller's client")
+	}
+}
@@ -0,0 +1,68 @@
+package sdb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+type sliceLine struct {
+	SKU string `sdb:"sku"`
+}
+
+type sliceOrder struct {
+	ID    string      `sdb:",itemname"`
+	Lines []sliceLine `sdb:"lines"`
+}
+
+func TestPutStructRemovedElements(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	if _, err := db.CreateDomain("orders"); err != nil {
+		t.Fatal(err)
+	}
+	stored := func(name string) sdb.Item {
+		t.Helper()
+		r, err := db.GetAttributes("orders", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sdb.Item{Name: name, Attributes: r.Attributes}
+	}
+
+	o := sliceOrder{ID: "o1", Lines: []sliceLine{{"a"}, {"b"}, {"c"}}}
+	if err := db.PutStruct("orders", &o); err != nil {
+		t.Fatal(err)
+	}
+	o.Lines = o.Lines[:1]
+	if err := db.PutStruct("orders", &o); err != nil {
+		t.Fatal(err)
+	}
+	if i := stored("o1"); len(i.Attributes) != 2 || i.Value("lines.0.sku") != "a" || i.Value("lines.len") != "1" {
+		t.Errorf("after shrinking %+v", i.Attributes)
+	}
+	o.Lines = nil
+	if err := db.PutStruct("orders", &o); err != nil {
+		t.Fatal(err)
+	}
+	if i := stored("o1"); len(i.Attributes) != 0 {
+		t.Errorf("after removing %+v", i.Attributes)
+	}
+
+	r := sdb.NewRepository[sliceOrder](db, "orders")
+	ctx := context.Background()
+	if err := r.PutAll(ctx, []*sliceOrder{{ID: "o2", Lines: []sliceLine{{"a"}, {"b"}}}, {ID: "o3", Lines: []sliceLine{{"c"}}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.PutAll(ctx, []*sliceOrder{{ID: "o2", Lines: []sliceLine{}}, {ID: "o3", Lines: []sliceLine{{"d"}}}}); err != nil {
+		t.Fatal(err)
+	}
+	if i := stored("o2"); len(i.Attributes) != 1 || i.Value("lines.len") != "0" {
+		t.Errorf("o2 after emptying %+v", i.Attributes)
+	}
+	if i := stored("o3"); len(i.Attributes) != 2 || i.Value("lines.0.sku") != "d" {
+		t.Errorf("o3 after replacing %+v", i.Attributes)
+	}
+}
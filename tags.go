@@ -0,0 +1,78 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+// Tags are stored as the values of one multi-valued attribute, attr below.
+
+// AddTag adds tags to the stored item, keeping the tags it already has.
+func (sdb *SimpleDB) AddTag(domain string, itemName string, attr string, tags ...string) (err error) {
+	i := NewItem(itemName)
+	for _, t := range tags {
+		i.AddAttribute(attr, t)
+	}
+	_, err = sdb.PutAttributes(domain, i)
+	return
+}
+
+func (sdb *SimpleDB) RemoveTag(domain string, itemName string, attr string, tags ...string) (err error) {
+	i := NewItem(itemName)
+	for _, t := range tags {
+		i.AddAttribute(attr, t)
+	}
+	_, err = sdb.DeleteAttributes(domain, i)
+	return
+}
+
+func (i Item) HasTag(attr string, tag string) bool {
+	for _, a := range i.Attributes {
+		if a.Name == attr && a.Value == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (i Item) Tags(attr string) (tags []string) {
+	for _, a := range i.Attributes {
+		if a.Name == attr {
+			tags = append(tags, a.Value)
+		}
+	}
+	return
+}
+
+// TaggedAll returns a query for items having every one of tags.
+func TaggedAll(domain string, attr string, tags ...string) *Query {
+	return NewQuery(domain).WhereAll(attr, tags...)
+}
+
+// TaggedAny returns a query for items having at least one of tags.
+func TaggedAny(domain string, attr string, tags ...string) *Query {
+	return NewQuery(domain).WhereIn(attr, tags...)
+}
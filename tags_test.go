@@ -0,0 +1,65 @@
+package sdb_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestTags(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	if _, err := db.CreateDomain("photos"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddTag("photos", "p1", "tag", "beach", "sunset"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddTag("photos", "p1", "tag", "family"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddTag("photos", "p2", "tag", "beach", "dog"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RemoveTag("photos", "p2", "tag", "dog"); err != nil {
+		t.Fatal(err)
+	}
+
+	db.ConsistentRead = true
+	r, err := db.GetAttributes("photos", "p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p1 := sdb.Item{Name: "p1", Attributes: r.Attributes}
+	tags := p1.Tags("tag")
+	sort.Strings(tags)
+	if strings.Join(tags, ",") != "beach,family,sunset" || !p1.HasTag("tag", "family") || p1.HasTag("tag", "dog") {
+		t.Fatalf("p1 has tags %v", tags)
+	}
+
+	names := func(q *sdb.Query) string {
+		t.Helper()
+		r, err := db.Select(q.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, i := range r.Items {
+			names = append(names, i.Name)
+		}
+		sort.Strings(names)
+		return strings.Join(names, ",")
+	}
+	if got := names(sdb.TaggedAll("photos", "tag", "beach", "sunset")); got != "p1" {
+		t.Fatalf("TaggedAll = %s", got)
+	}
+	if got := names(sdb.TaggedAny("photos", "tag", "sunset", "beach")); got != "p1,p2" {
+		t.Fatalf("TaggedAny = %s", got)
+	}
+	if got := names(sdb.TaggedAny("photos", "tag", "dog")); got != "" {
+		t.Fatalf("TaggedAny for a removed tag = %s", got)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// QueryTemplate is a Select expression with named parameters written as
+// :name. Parameters are only recognized outside quotes and are replaced by
+// quoted values, so a template can not be used to inject expressions.
+type QueryTemplate struct {
+	text   string
+	parts  []string
+	params []string
+}
+
+var (
+	templatesMu sync.RWMutex
+	templates   = make(map[string]*QueryTemplate)
+)
+
+// ParseQueryTemplate splits text into literal parts and parameters.
+func ParseQueryTemplate(text string) (*QueryTemplate, error) {
+	t := &QueryTemplate{text: text}
+	var quote byte
+	start := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == ':':
+			j := i + 1
+			for j < len(text) && isParamByte(text[j], j == i+1) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("query template: empty parameter name at byte %d", i)
+			}
+			t.parts = append(t.parts, text[start:i])
+			t.params = append(t.params, text[i+1:j])
+			start = j
+			i = j - 1
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("query template: unterminated %c quote", quote)
+	}
+	t.parts = append(t.parts, text[start:])
+	return t, nil
+}
+
+func isParamByte(c byte, first bool) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || !first && c >= '0' && c <= '9'
+}
+
+// Expand returns the expression with every parameter replaced by its value.
+// A string becomes a quoted literal and a []string a comma separated list of
+// quoted literals for use in "in (...)". Missing and unused values are
+// errors.
+func (t *QueryTemplate) Expand(values map[string]interface{}) (string, error) {
+	var b strings.Builder
+	used := make(map[string]bool)
+	for j, p := range t.params {
+		b.WriteString(t.parts[j])
+		v, ok := values[p]
+		if !ok {
+			return "", fmt.Errorf("query template: missing value for :%s", p)
+		}
+		switch v := v.(type) {
+		case string:
+			b.WriteString(Quote(v))
+		case []string:
+			if len(v) == 0 {
+				return "", fmt.Errorf("query template: empty list for :%s", p)
+			}
+			for k, s := range v {
+				if k > 0 {
+					b.WriteString(", ")
+				}
+				b.WriteString(Quote(s))
+			}
+		default:
+			return "", fmt.Errorf("query template: unsupported value %T for :%s", v, p)
+		}
+		used[p] = true
+	}
+	b.WriteString(t.parts[len(t.parts)-1])
+	for p := range values {
+		if !used[p] {
+			return "", fmt.Errorf("query template: unused value for :%s", p)
+		}
+	}
+	return b.String(), nil
+}
+
+func (t *QueryTemplate) String() string {
+	return t.text
+}
+
+// RegisterQuery parses text and registers it under name for SelectQuery.
+func RegisterQuery(name string, text string) error {
+	t, err := ParseQueryTemplate(text)
+	if err != nil {
+		return err
+	}
+	templatesMu.Lock()
+	templates[name] = t
+	templatesMu.Unlock()
+	return nil
+}
+
+func LookupQuery(name string) (t *QueryTemplate, ok bool) {
+	templatesMu.RLock()
+	t, ok = templates[name]
+	templatesMu.RUnlock()
+	return
+}
+
+// SelectQuery runs the query registered under name with values.
+func (sdb *SimpleDB) SelectQuery(name string, values map[string]interface{}, nextToken string) (r SelectResponse, err error) {
+	t, ok := LookupQuery(name)
+	if !ok {
+		err = fmt.Errorf("query template: %s is not registered", name)
+		return
+	}
+	q, err := t.Expand(values)
+	if err != nil {
+		return
+	}
+	return sdb.SelectWithToken(q, nextToken)
+}
@@ -0,0 +1,37 @@
+package sdb
+
+import (
+	"testing"
+)
+
+func TestQueryTemplate(t *testing.T) {
+	if err := RegisterQuery("users.byStatus", "select * from users where status = :status and `a:b` = ':x' and itemName() in (:ids)"); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, _ := LookupQuery("users.byStatus")
+	q, err := tmpl.Expand(map[string]interface{}{"status": "it's", "ids": []string{"u1", "u2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "select * from users where status = 'it''s' and `a:b` = ':x' and itemName() in ('u1', 'u2')"
+	if q != expected {
+		t.Errorf("Expected %s, got %s", expected, q)
+	}
+
+	for _, values := range []map[string]interface{}{
+		{"status": "a"},
+		{"status": "a", "ids": []string{}},
+		{"status": 1, "ids": []string{"u1"}},
+		{"status": "a", "ids": []string{"u1"}, "other": "x"},
+	} {
+		if _, err := tmpl.Expand(values); err == nil {
+			t.Errorf("Expected error expanding %v", values)
+		}
+	}
+
+	for _, text := range []string{"select * from d where a = :", "select * from d where a = ':x"} {
+		if _, err := ParseQueryTemplate(text); err == nil {
+			t.Errorf("Expected error parsing %s", text)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// TenantStrategy decides where a tenant's items of a logical domain are
+// stored: the physical domain and a prefix added to their item names.
+type TenantStrategy interface {
+	Route(tenant string, domain string) (physical string, prefix string)
+}
+
+// TenantStrategyFunc adapts a function to the TenantStrategy interface.
+type TenantStrategyFunc func(tenant string, domain string) (string, string)
+
+func (f TenantStrategyFunc) Route(tenant string, domain string) (string, string) {
+	return f(tenant, domain)
+}
+
+// DomainPerTenant stores each tenant in its own domain named domain_tenant.
+var DomainPerTenant TenantStrategy = TenantStrategyFunc(func(tenant, domain string) (string, string) {
+	return domain + "_" + tenant, ""
+})
+
+// ItemPrefix stores all tenants in the logical domain, prefixing item names
+// with tenant/.
+var ItemPrefix TenantStrategy = TenantStrategyFunc(func(tenant, domain string) (string, string) {
+	return domain, tenant + "/"
+})
+
+// HashedPools spreads tenants over n domains named domain_0 to domain_n-1 by
+// a hash of the tenant, prefixing item names with tenant/. n must be at
+// least 1.
+func HashedPools(n int) (TenantStrategy, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("sdb: HashedPools needs at least one domain, got %d", n)
+	}
+	return TenantStrategyFunc(func(tenant, domain string) (string, string) {
+		h := fnv.New32a()
+		h.Write([]byte(tenant))
+		return fmt.Sprintf("%s_%d", domain, h.Sum32()%uint32(n)), tenant + "/"
+	}), nil
+}
+
+// TenantRouter gives each tenant a view of the logical domains, routed by
+// Strategy.
+type TenantRouter struct {
+	Strategy TenantStrategy
+	db       SimpleDB
+}
+
+func NewTenantRouter(db SimpleDB, s TenantStrategy) *TenantRouter {
+	return &TenantRouter{Strategy: s, db: db}
+}
+
+// Tenant is the client facade for one tenant. Item names passed to and
+// returned from its methods never include the tenant prefix.
+type Tenant struct {
+	ID     string
+	router *TenantRouter
+}
+
+// For returns the facade for tenant. Tenant IDs are 1 to 64 characters of
+// a-z, A-Z, 0-9, '_', '-' and '.', so they are safe in domain names and
+// item name prefixes.
+func (r *TenantRouter) For(tenant string) (t Tenant, err error) {
+	if len(tenant) == 0 || len(tenant) > 64 {
+		return t, InvalidNameError{Kind: "tenant", Name: tenant, Reason: "must be 1 to 64 characters"}
+	}
+	for _, c := range tenant {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.') {
+			return t, InvalidNameError{Kind: "tenant", Name: tenant, Reason: fmt.Sprintf("character %q is not allowed", c)}
+		}
+	}
+	return Tenant{ID: tenant, router: r}, nil
+}
+
+func (t Tenant) route(domain string) (string, string) {
+	return t.router.Strategy.Route(t.ID, domain)
+}
+
+func (t Tenant) PutAttributes(domain string, i *Item) (r PutAttributesResponse, err error) {
+	d, prefix := t.route(domain)
+	c := *i
+	c.Name = prefix + i.Name
+	db := t.router.db
+	return db.PutAttributes(d, &c)
+}
+
+func (t Tenant) GetAttributes(domain string, itemName string) (r GetAttributesResponse, err error) {
+	d, prefix := t.route(domain)
+	db := t.router.db
+	return db.GetAttributes(d, prefix+itemName)
+}
+
+func (t Tenant) DeleteItem(domain string, itemName string) (r DeleteAttributesResponse, err error) {
+	d, prefix := t.route(domain)
+	db := t.router.db
+	return db.DeleteItem(d, prefix+itemName)
+}
+
+// Select runs q, which names the logical domain, restricted to the tenant's
+// items. The predicates of q are put in parentheses before the tenant's
+// restriction is added, so an or in them can not match other tenants' items.
+func (t Tenant) Select(q *Query, nextToken string) (r SelectResponse, err error) {
+	d, prefix := t.route(q.domain)
+	rq := q.ForDomain(d)
+	if prefix != "" {
+		if len(rq.where) > 0 {
+			rq.where = []string{"(" + strings.Join(rq.where, " and ") + ")"}
+		}
+		rq.WhereExpr("itemName() like " + Quote(prefix+"%"))
+	}
+	db := t.router.db
+	if r, err = db.SelectWithToken(rq.String(), nextToken); err != nil {
+		return
+	}
+	for j := range r.Items {
+		r.Items[j].Name = strings.TrimPrefix(r.Items[j].Name, prefix)
+	}
+	return
+}
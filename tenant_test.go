@@ -0,0 +1,63 @@
+package sdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTenantRouting(t *testing.T) {
+	pools, err := HashedPools(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = HashedPools(0); err == nil {
+		t.Error("Expected HashedPools(0) to be rejected")
+	}
+	tests := []struct {
+		s      TenantStrategy
+		domain string
+		prefix string
+	}{
+		{DomainPerTenant, "users_acme", ""},
+		{ItemPrefix, "users", "acme/"},
+		{pools, "users_3", "acme/"},
+	}
+	for _, tt := range tests {
+		d, p := tt.s.Route("acme", "users")
+		if d != tt.domain || p != tt.prefix {
+			t.Errorf("Route = %s %s, want %s %s", d, p, tt.domain, tt.prefix)
+		}
+	}
+
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.Cache = NewSelectCache(time.Minute, 10)
+	q := "select * from `users` where (`plan` = 'pro') and itemName() like 'acme/%'"
+	c.Cache.put(selectCacheKey(q, "", false), q, SelectResponse{Items: []Item{{Name: "acme/u1"}}})
+	tenant, err := NewTenantRouter(c, ItemPrefix).For("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := tenant.Select(NewQuery("users").Where("plan", "=", "pro"), "")
+	if err != nil || len(r.Items) != 1 || r.Items[0].Name != "u1" {
+		t.Error(r, err)
+	}
+
+	if _, err = NewTenantRouter(c, ItemPrefix).For("a/b"); err == nil {
+		t.Error("Expected invalid tenant error")
+	}
+}
+
+func TestTenantSelectOr(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.Cache = NewSelectCache(time.Minute, 10)
+	q := "select * from `users` where (`plan` = 'pro' or `plan` = 'free') and itemName() like 'acme/%'"
+	c.Cache.put(selectCacheKey(q, "", false), q, SelectResponse{Items: []Item{{Name: "acme/u1"}}})
+	tenant, err := NewTenantRouter(c, ItemPrefix).For("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := tenant.Select(NewQuery("users").WhereExpr("`plan` = 'pro' or `plan` = 'free'"), "")
+	if err != nil || len(r.Items) != 1 || r.Items[0].Name != "u1" {
+		t.Error(r, err)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"sync"
+	"time"
+)
+
+// AdaptiveThrottle slows a client down when SimpleDB throttles it. Retries
+// are paid for from a token bucket that successful calls refill, so a client
+// stops retrying once most calls fail. Throttling errors cut the request rate
+// by 30%, every success raises it again by about one request per second per
+// second. Share one throttle between the copies of a client.
+type AdaptiveThrottle struct {
+	// Capacity is the size of the retry bucket, RetryCost the tokens one
+	// retry takes and a success gives back one token.
+	Capacity  int
+	RetryCost int
+	// MinRate is the lowest request rate per second the throttle slows to.
+	MinRate float64
+
+	mu       sync.Mutex
+	tokens   int
+	rate     float64
+	next     time.Time
+	window   time.Time
+	count    int
+	lastRate float64
+}
+
+func NewAdaptiveThrottle() *AdaptiveThrottle {
+	return &AdaptiveThrottle{Capacity: 500, RetryCost: 5, MinRate: 1, tokens: 500}
+}
+
+// Throttled reports whether err is SimpleDB asking the client to slow down.
+func Throttled(err error) bool {
+	e, ok := err.(SimpleDBError)
+	return ok && (e.Code == "RequestThrottled" || e.Code == "ServiceUnavailable" || e.StatusCode == 503)
+}
+
+// reserve returns how long to wait before sending the next request.
+func (t *AdaptiveThrottle) reserve() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if now.Sub(t.window) >= time.Second {
+		t.lastRate = float64(t.count) / now.Sub(t.window).Seconds()
+		t.window, t.count = now, 0
+	}
+	t.count++
+	if t.rate == 0 {
+		return 0
+	}
+	if t.next.Before(now) {
+		t.next = now
+	}
+	wait := t.next.Sub(now)
+	t.next = t.next.Add(time.Duration(float64(time.Second) / t.rate))
+	return wait
+}
+
+// observe adjusts the rate and the retry bucket after a request.
+func (t *AdaptiveThrottle) observe(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case Throttled(err):
+		r := t.rate
+		if r == 0 {
+			r = t.lastRate
+			if c := float64(t.count); c > r {
+				r = c
+			}
+		}
+		t.rate = r * 0.7
+		if t.rate < t.MinRate {
+			t.rate = t.MinRate
+		}
+	case err == nil:
+		if t.tokens < t.Capacity {
+			t.tokens++
+		}
+		if t.rate > 0 {
+			t.rate += 1 / t.rate
+		}
+	}
+}
+
+// retry takes the cost of a retry from the bucket, reporting false if the
+// bucket is too low.
+func (t *AdaptiveThrottle) retry() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tokens < t.RetryCost {
+		return false
+	}
+	t.tokens -= t.RetryCost
+	return true
+}
+
+// Rate returns the current request rate limit per second, 0 if unlimited.
+func (t *AdaptiveThrottle) Rate() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rate
+}
+
+// pace waits for the domain rate limit and the adaptive throttle.
+func (sdb *SimpleDB) pace(d *domainDefaults) error {
+	var wait time.Duration
+	if d != nil {
+		wait = d.reserve()
+	}
+	if sdb.Throttle != nil {
+		if w := sdb.Throttle.reserve(); w > wait {
+			wait = w
+		}
+	}
+	return sdb.sleep(wait)
+}
@@ -0,0 +1,40 @@
+package sdb
+
+import (
+	"testing"
+)
+
+func TestAdaptiveThrottle(t *testing.T) {
+	th := NewAdaptiveThrottle()
+	th.lastRate = 100
+	th.observe(SimpleDBError{Code: "RequestThrottled", StatusCode: 503})
+	if r := th.Rate(); r != 70 {
+		t.Errorf("Rate after throttle = %v, want 70", r)
+	}
+	th.observe(SimpleDBError{Code: "ServiceUnavailable", StatusCode: 503})
+	if r := th.Rate(); r != 49 {
+		t.Errorf("Rate after second throttle = %v, want 49", r)
+	}
+	th.observe(nil)
+	if r := th.Rate(); r <= 49 {
+		t.Errorf("Rate should increase after success, got %v", r)
+	}
+	th.observe(SimpleDBError{Code: "AuthFailure", StatusCode: 403})
+	if r := th.Rate(); r <= 49 {
+		t.Errorf("Non-throttling errors should not change the rate, got %v", r)
+	}
+
+	th = NewAdaptiveThrottle()
+	th.Capacity, th.tokens = 10, 10
+	if !th.retry() || !th.retry() || th.retry() {
+		t.Error("Expected two retries from a bucket of 10")
+	}
+	th.observe(nil)
+	th.observe(nil)
+	th.observe(nil)
+	th.observe(nil)
+	th.observe(nil)
+	if !th.retry() {
+		t.Error("Expected successes to refill the bucket")
+	}
+}
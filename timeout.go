@@ -0,0 +1,71 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTimeout is wrapped by the RequestError of an attempt that ran out of
+// its per-action timeout. Unlike a cancelled context it is retried, except
+// for conditional writes, see ErrOutcomeUnknown.
+var ErrTimeout = errors.New("request timed out")
+
+// DefaultTimeouts are per attempt timeouts suited to the cost of each
+// action: short for single item reads and writes, longer for Select and
+// DomainMetadata, which scan the domain. Assign them, or a modified copy, to
+// Timeouts to use them.
+var DefaultTimeouts = map[string]time.Duration{
+	"GetAttributes":      2 * time.Second,
+	"PutAttributes":      2 * time.Second,
+	"DeleteAttributes":   2 * time.Second,
+	"BatchPutAttributes": 5 * time.Second,
+	"Select":             20 * time.Second,
+	"DomainMetadata":     20 * time.Second,
+	"CreateDomain":       20 * time.Second,
+	"DeleteDomain":       20 * time.Second,
+	"*":                  10 * time.Second,
+}
+
+// timeout returns the limit for an attempt of the current action, 0 for none.
+func (sdb *SimpleDB) timeout() time.Duration {
+	if sdb.Timeouts == nil {
+		return 0
+	}
+	if d, ok := sdb.Timeouts[sdb.p.Get("Action")]; ok {
+		return d
+	}
+	return sdb.Timeouts["*"]
+}
+
+func timeoutError(action string, d time.Duration) error {
+	return fmt.Errorf("%w: %s after %v", ErrTimeout, action, d)
+}
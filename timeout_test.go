@@ -0,0 +1,59 @@
+package sdb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// slowTransport answers after delay unless the request is cancelled first.
+type slowTransport struct {
+	delay time.Duration
+	calls int
+}
+
+func (s *slowTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.calls++
+	select {
+	case <-time.After(s.delay):
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	return &http.Response{StatusCode: 200, Status: "200 OK", Body: io.NopCloser(bytes.NewBufferString("<GetAttributesResponse/>")), Request: req}, nil
+}
+
+func TestTimeouts(t *testing.T) {
+	st := &slowTransport{delay: 50 * time.Millisecond}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: st}
+	c.Timeouts = map[string]time.Duration{"GetAttributes": 10 * time.Millisecond, "*": time.Second}
+	c.MaxRetries = 1
+
+	_, err := c.GetAttributes("d", "i")
+	if !errors.Is(err, ErrTimeout) || !Retryable(err) || st.calls != 2 {
+		t.Fatalf("expected a retried timeout, got %v after %d calls", err, st.calls)
+	}
+	if _, err = c.Select("select * from d"); err != nil {
+		t.Errorf("Select used the GetAttributes timeout: %v", err)
+	}
+}
+
+func TestConditionalWriteTimeout(t *testing.T) {
+	st := &slowTransport{delay: 50 * time.Millisecond}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: st}
+	c.Timeouts = map[string]time.Duration{"*": 10 * time.Millisecond}
+	c.MaxRetries = 1
+
+	_, err := c.PutAttributesIf("d", &Item{Name: "i", Attributes: []Attribute{{Name: "a", Value: "1"}}}, Condition{Name: "a"})
+	if !errors.Is(err, ErrOutcomeUnknown) || !errors.Is(err, ErrTimeout) || st.calls != 1 {
+		t.Fatalf("expected an unknown outcome without retry, got %v after %d calls", err, st.calls)
+	}
+	st.calls = 0
+	if _, err = c.PutAttributes("d", &Item{Name: "i", Attributes: []Attribute{{Name: "a", Value: "1"}}}); errors.Is(err, ErrOutcomeUnknown) || st.calls != 2 {
+		t.Fatalf("expected an unconditional put to be retried, got %v after %d calls", err, st.calls)
+	}
+}
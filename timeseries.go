@@ -0,0 +1,178 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Aggregate reduces the values of one downsampling window to a single value.
+type Aggregate func(values []float64) float64
+
+var (
+	Mean Aggregate = func(v []float64) float64 { return Sum(v) / float64(len(v)) }
+	Sum  Aggregate = func(v []float64) (s float64) {
+		for _, x := range v {
+			s += x
+		}
+		return
+	}
+	Min Aggregate = func(v []float64) float64 {
+		m := v[0]
+		for _, x := range v[1:] {
+			if x < m {
+				m = x
+			}
+		}
+		return m
+	}
+	Max Aggregate = func(v []float64) float64 {
+		m := v[0]
+		for _, x := range v[1:] {
+			if x > m {
+				m = x
+			}
+		}
+		return m
+	}
+	Count Aggregate = func(v []float64) float64 { return float64(len(v)) }
+)
+
+// TimeSeries stores the points of one metric, one item per point. Item names
+// start with the metric and the time bucket of the point, for example
+// cpu#2014-06-01T12 for hourly buckets, so a whole bucket can be selected or
+// deleted by prefix. The ts attribute holds the sortable time of the point.
+type TimeSeries struct {
+	Domain string
+	Metric string
+	Bucket time.Duration
+	db     SimpleDB
+}
+
+func NewTimeSeries(db SimpleDB, domain string, metric string, bucket time.Duration) *TimeSeries {
+	return &TimeSeries{Domain: domain, Metric: metric, Bucket: bucket, db: db}
+}
+
+// BucketName returns the item name prefix of the bucket containing t. The
+// time is printed with the precision of the bucket size.
+func (ts *TimeSeries) BucketName(t time.Time) string {
+	layout := "2006-01-02T15:04:05"
+	switch {
+	case ts.Bucket >= 24*time.Hour:
+		layout = "2006-01-02"
+	case ts.Bucket >= time.Hour:
+		layout = "2006-01-02T15"
+	case ts.Bucket >= time.Minute:
+		layout = "2006-01-02T15:04"
+	}
+	return ts.Metric + "#" + t.UTC().Truncate(ts.Bucket).Format(layout)
+}
+
+// BucketQuery returns a select expression for all points in the bucket
+// containing t.
+func (ts *TimeSeries) BucketQuery(t time.Time) string {
+	return NewQuery(ts.Domain).Where("itemName()", "like", ts.BucketName(t)+"#%").String()
+}
+
+// Write puts points with BatchPutAttributes. The batches share the time left
+// before the deadline of the client's context, see PartialError.
+func (ts *TimeSeries) Write(points ...Point) error {
+	var items []*Item
+	for _, p := range points {
+		i := NewItem(ts.BucketName(p.Time) + "#" + EncodeInt(p.Time.UnixNano()))
+		i.ReplaceAttribute("metric", ts.Metric)
+		i.ReplaceAttribute("ts", EncodeTime(p.Time))
+		i.ReplaceAttribute("value", strconv.FormatFloat(p.Value, 'g', -1, 64))
+		items = append(items, i)
+	}
+	return runBatches(ts.db.context(), "Write", batches(items), func(ctx context.Context, k int, batch []*Item) (err error) {
+		db := ts.db.WithContext(ctx)
+		_, err = db.BatchPutAttributes(ts.Domain, batch)
+		return
+	})
+}
+
+// Range returns the points with from <= time < to ordered by time.
+func (ts *TimeSeries) Range(from time.Time, to time.Time) (points []Point, err error) {
+	db := ts.db
+	q := NewQuery(ts.Domain).Output("ts", "value").
+		Where("metric", "=", ts.Metric).
+		Where("ts", ">=", EncodeTime(from)).
+		Where("ts", "<", EncodeTime(to)).
+		OrderBy("ts", false).String()
+	token := ""
+	for {
+		var r SelectResponse
+		r, err = db.SelectWithToken(q, token)
+		if err != nil {
+			return
+		}
+		for _, i := range r.Items {
+			var p Point
+			if p.Time, err = DecodeTime(i.Value("ts")); err != nil {
+				return
+			}
+			if p.Value, err = strconv.ParseFloat(i.Value("value"), 64); err != nil {
+				return
+			}
+			points = append(points, p)
+		}
+		if r.NextToken == "" {
+			return
+		}
+		token = r.NextToken
+	}
+}
+
+// Downsample reads the points in [from, to) and reduces every step long
+// window to one point with agg. Windows without points are left out.
+func (ts *TimeSeries) Downsample(from time.Time, to time.Time, step time.Duration, agg Aggregate) (points []Point, err error) {
+	raw, err := ts.Range(from, to)
+	if err != nil {
+		return
+	}
+	windows := make(map[int64][]float64)
+	for _, p := range raw {
+		w := int64(p.Time.Sub(from) / step)
+		windows[w] = append(windows[w], p.Value)
+	}
+	for w, values := range windows {
+		points = append(points, Point{Time: from.Add(time.Duration(w) * step), Value: agg(values)})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	return
+}
@@ -0,0 +1,62 @@
+package sdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestTimeSeries(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	if _, err := db.CreateDomain("metrics"); err != nil {
+		t.Fatal(err)
+	}
+	ts := sdb.NewTimeSeries(db, "metrics", "cpu", time.Hour)
+	other := sdb.NewTimeSeries(db, "metrics", "mem", time.Hour)
+
+	start := time.Date(2014, 6, 1, 12, 0, 0, 0, time.UTC)
+	// More points than fit in one batch put.
+	var points []sdb.Point
+	for n := 0; n < 60; n++ {
+		points = append(points, sdb.Point{Time: start.Add(time.Duration(n) * time.Minute), Value: float64(n)})
+	}
+	if err := ts.Write(points...); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Write(sdb.Point{Time: start, Value: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if name := ts.BucketName(start.Add(30 * time.Minute)); name != "cpu#2014-06-01T12" {
+		t.Fatalf("BucketName = %s", name)
+	}
+
+	got, err := ts.Range(start.Add(10*time.Minute), start.Add(40*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 30 || !got[0].Time.Equal(start.Add(10*time.Minute)) || got[0].Value != 10 || got[29].Value != 39 {
+		t.Fatalf("Range returned %d points: %v", len(got), got)
+	}
+
+	got, err = ts.Downsample(start, start.Add(time.Hour), 20*time.Minute, sdb.Mean)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []sdb.Point{{start, 9.5}, {start.Add(20 * time.Minute), 29.5}, {start.Add(40 * time.Minute), 49.5}}
+	if len(got) != len(want) {
+		t.Fatalf("Downsample = %v", got)
+	}
+	for n := range want {
+		if !got[n].Time.Equal(want[n].Time) || got[n].Value != want[n].Value {
+			t.Fatalf("Downsample = %v, want %v", got, want)
+		}
+	}
+
+	r, err := db.Select(ts.BucketQuery(start))
+	if err != nil || len(r.Items) != 60 {
+		t.Fatalf("BucketQuery returned %d items, %v", len(r.Items), err)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrTxAborted = errors.New("transaction aborted")
+
+const txLockAttribute = "sdb.txlock"
+
+// Transactions runs best-effort multi-item transactions. A transaction is
+// recorded in the staging domain, every target item is locked with a
+// conditional put of a lock attribute, then the staging record is marked
+// committed. That write is the commit point: before it the transaction rolls
+// back by releasing the locks, after it the changes are applied and the locks
+// removed. Recover finishes transactions left behind by crashed writers.
+//
+// Writers that do not use Transactions ignore the locks, so concurrent plain
+// writes to the same items are not isolated.
+type Transactions struct {
+	StagingDomain string
+	db            SimpleDB
+}
+
+type Tx struct {
+	ID  string
+	m   *Transactions
+	ops []txOp
+}
+
+type txOp struct {
+	Domain     string              `json:"domain"`
+	Item       string              `json:"item"`
+	Delete     bool                `json:"delete,omitempty"`
+	Attributes map[string][]string `json:"attributes,omitempty"`
+}
+
+type txKey struct {
+	domain, item string
+}
+
+func (op txOp) key() txKey {
+	return txKey{op.Domain, op.Item}
+}
+
+func NewTransactions(db SimpleDB, stagingDomain string) *Transactions {
+	db.ConsistentRead = true
+	return &Transactions{StagingDomain: stagingDomain, db: db}
+}
+
+func (m *Transactions) Begin() (tx *Tx, err error) {
+	id, err := TimePrefixed()
+	return &Tx{ID: id, m: m}, err
+}
+
+// Put sets the attributes of the item in changes to exactly the given values,
+// as PatchAttributes does.
+func (tx *Tx) Put(domain string, itemName string, changes map[string][]string) {
+	tx.ops = append(tx.ops, txOp{Domain: domain, Item: itemName, Attributes: changes})
+}
+
+func (tx *Tx) Delete(domain string, itemName string) {
+	tx.ops = append(tx.ops, txOp{Domain: domain, Item: itemName, Delete: true})
+}
+
+// Commit applies all changes or none. ErrTxAborted is returned if an item is
+// locked by another transaction, in which case nothing was changed. Any other
+// error leaves the outcome to Recover.
+func (tx *Tx) Commit() error {
+	b, err := json.Marshal(tx.ops)
+	if err != nil {
+		return err
+	}
+	staged := NewItem(tx.ID)
+	staged.ReplaceAttribute("state", "pending")
+	staged.ReplaceAttribute("created", EncodeTime(time.Now()))
+	if err = staged.SetChunked("ops", string(b)); err != nil {
+		return err
+	}
+	db := tx.m.db
+	if _, err = db.PutAttributesIf(tx.m.StagingDomain, staged, Condition{Name: "state"}); err != nil {
+		return err
+	}
+
+	locked := make(map[txKey]bool)
+	for n, op := range tx.ops {
+		if locked[op.key()] {
+			continue
+		}
+		locked[op.key()] = true
+		lock := NewItem(op.Item)
+		lock.AddAttribute(txLockAttribute, tx.ID)
+		_, err = db.PutAttributesIf(op.Domain, lock, Condition{Name: txLockAttribute})
+		if err != nil {
+			tx.m.release(tx.ID, tx.ops[:n])
+			tx.m.setState(tx.ID, "pending", "aborted")
+			if IsConditionalCheckFailed(err) {
+				return ErrTxAborted
+			}
+			return err
+		}
+	}
+
+	if err = tx.m.setState(tx.ID, "pending", "committed"); err != nil {
+		return err
+	}
+	return tx.m.apply(tx.ID, tx.ops)
+}
+
+// Abort discards a transaction that has not been committed.
+func (tx *Tx) Abort() {
+	tx.ops = nil
+}
+
+// Recover finishes transactions whose staging record is older than age:
+// pending ones are rolled back and committed ones are applied.
+func (m *Transactions) Recover(age time.Duration) error {
+	db := m.db
+	q := NewQuery(m.StagingDomain).
+		WhereIn("state", "pending", "committed").
+		Where("created", "<", EncodeTime(time.Now().Add(-age))).String()
+	token := ""
+	for {
+		r, err := db.SelectWithToken(q, token)
+		if err != nil {
+			return err
+		}
+		for _, i := range r.Items {
+			data, _, err := i.Chunked("ops")
+			if err != nil {
+				return err
+			}
+			var ops []txOp
+			if err = json.Unmarshal([]byte(data), &ops); err != nil {
+				return err
+			}
+			if i.Value("state") == "committed" {
+				err = m.apply(i.Name, ops)
+			} else {
+				m.release(i.Name, ops)
+				err = m.setState(i.Name, "pending", "aborted")
+			}
+			if err != nil && !IsConditionalCheckFailed(err) {
+				return err
+			}
+		}
+		if r.NextToken == "" {
+			return nil
+		}
+		token = r.NextToken
+	}
+}
+
+// apply makes the changes of a committed transaction. Items that no longer
+// carry the lock of the transaction were already applied. An item changed by
+// several operations keeps the lock until its last operation, so that
+// applying again after a crash repeats all of them.
+func (m *Transactions) apply(id string, ops []txOp) error {
+	db := m.db
+	locked := Condition{Name: txLockAttribute, Value: id, Exists: true}
+	last := make(map[txKey]int)
+	for n, op := range ops {
+		last[op.key()] = n
+	}
+	for n, op := range ops {
+		var err error
+		if op.Delete && last[op.key()] == n {
+			_, err = db.DeleteItemIf(op.Domain, op.Item, locked)
+		} else {
+			var r GetAttributesResponse
+			if r, err = db.GetAttributes(op.Domain, op.Item); err != nil {
+				return err
+			}
+			current := Item{Name: op.Item, Attributes: r.Attributes}
+			desired := Item{Name: op.Item}
+			for _, a := range r.Attributes {
+				if _, ok := op.Attributes[a.Name]; !ok && !op.Delete && a.Name != txLockAttribute {
+					desired.Attributes = append(desired.Attributes, a)
+				}
+			}
+			for name, values := range op.Attributes {
+				for _, v := range values {
+					desired.AddAttribute(name, v)
+				}
+			}
+			if last[op.key()] != n {
+				desired.AddAttribute(txLockAttribute, id)
+			}
+			err = db.writeDiff(op.Domain, current, desired, &locked)
+		}
+		if err != nil && !IsConditionalCheckFailed(err) {
+			return err
+		}
+	}
+	return m.setState(id, "committed", "done")
+}
+
+// release removes the locks of a transaction that did not commit.
+func (m *Transactions) release(id string, ops []txOp) {
+	db := m.db
+	for _, op := range ops {
+		lock := NewItem(op.Item)
+		lock.AddAttribute(txLockAttribute, id)
+		db.deleteAttributes(op.Domain, lock, &Condition{Name: txLockAttribute, Value: id, Exists: true})
+	}
+}
+
+func (m *Transactions) setState(id string, from string, to string) error {
+	i := NewItem(id)
+	i.ReplaceAttribute("state", to)
+	db := m.db
+	_, err := db.PutAttributesIf(m.StagingDomain, i, Condition{Name: "state", Value: from, Exists: true})
+	return err
+}
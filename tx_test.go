@@ -0,0 +1,81 @@
+package sdb_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestTransactions(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	db.ConsistentRead = true
+	for _, d := range []string{"tx", "accounts"} {
+		if _, err := db.CreateDomain(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stored := func(name string) string {
+		t.Helper()
+		r, err := db.GetAttributes("accounts", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s []string
+		for _, a := range r.Attributes {
+			s = append(s, a.Name+"="+a.Value)
+		}
+		sort.Strings(s)
+		return strings.Join(s, ",")
+	}
+	m := sdb.NewTransactions(db, "tx")
+
+	tx, err := m.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Put("accounts", "a", map[string][]string{"balance": {"10"}, "owner": {"ann"}})
+	tx.Put("accounts", "b", map[string][]string{"balance": {"5"}})
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if a, b := stored("a"), stored("b"); a != "balance=10,owner=ann" || b != "balance=5" {
+		t.Fatalf("stored a: %s, b: %s", a, b)
+	}
+
+	// The same item may appear more than once, the operations apply in order.
+	if tx, err = m.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	tx.Put("accounts", "a", map[string][]string{"balance": {"7"}})
+	tx.Put("accounts", "a", map[string][]string{"owner": {"bob"}})
+	tx.Delete("accounts", "b")
+	tx.Put("accounts", "b", map[string][]string{"note": {"reopened"}})
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if a, b := stored("a"), stored("b"); a != "balance=7,owner=bob" || b != "note=reopened" {
+		t.Fatalf("stored a: %s, b: %s", a, b)
+	}
+
+	// An item locked by another transaction aborts without changes.
+	lock := sdb.NewItem("b")
+	lock.AddAttribute("sdb.txlock", "other")
+	if _, err = db.PutAttributes("accounts", lock); err != nil {
+		t.Fatal(err)
+	}
+	if tx, err = m.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	tx.Put("accounts", "a", map[string][]string{"balance": {"0"}})
+	tx.Put("accounts", "b", map[string][]string{"balance": {"0"}})
+	if err = tx.Commit(); err != sdb.ErrTxAborted {
+		t.Fatalf("Commit of a locked item returned %v", err)
+	}
+	if a := stored("a"); a != "balance=7,owner=bob" {
+		t.Fatalf("stored a after abort: %s", a)
+	}
+}
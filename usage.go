@@ -0,0 +1,202 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+type usageTagsKey struct{}
+
+// WithUsageTags returns a context that charges the calls of clients bound
+// to it with WithContext to tags, such as {"feature": "search"}, in
+// addition to the tags of ctx. See UsageMeter.
+func WithUsageTags(ctx context.Context, tags map[string]string) context.Context {
+	merged := make(map[string]string)
+	for k, v := range UsageTags(ctx) {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, usageTagsKey{}, merged)
+}
+
+// UsageTags returns the tags of ctx.
+func UsageTags(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(usageTagsKey{}).(map[string]string)
+	return tags
+}
+
+// TagUsage is the usage charged to the tag Key=Value.
+type TagUsage struct {
+	Key      string
+	Value    string
+	Requests int64
+	BoxUsage float64
+}
+
+// UsageMeter adds up the requests and BoxUsage of the calls made by clients
+// it is set on as SimpleDB.Meter, by the tags of their context. A call is
+// charged to each of its tags, so usage adds up per key, not across keys.
+// Calls without a tag for a key are charged to its empty value, also those
+// made before the key was first seen, and every call to the empty key, which
+// holds the totals. The values of every key add up to the totals. Tags with
+// an empty key are ignored.
+//
+// Every value is kept until Reset, so tags with many values, such as
+// request or job IDs, should be avoided or bounded with MaxValues.
+type UsageMeter struct {
+	// MaxValues, when set, bounds the values kept per key. Calls with
+	// further values are charged to UsageOverflow.
+	MaxValues int
+	mu        sync.Mutex
+	usage     map[[2]string]*TagUsage
+	// keys counts the values kept per key seen
+	keys map[string]int
+}
+
+// UsageOverflow is the value charged with the calls of a key beyond its
+// MaxValues.
+const UsageOverflow = "*"
+
+func NewUsageMeter() *UsageMeter {
+	return &UsageMeter{usage: make(map[[2]string]*TagUsage), keys: make(map[string]int)}
+}
+
+func (m *UsageMeter) record(tags map[string]string, boxUsage float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.usage == nil {
+		m.usage, m.keys = make(map[[2]string]*TagUsage), make(map[string]int)
+	}
+	total := m.usage[[2]string{"", ""}]
+	for k := range tags {
+		if _, seen := m.keys[k]; seen || k == "" {
+			continue
+		}
+		m.keys[k] = 0
+		if total != nil {
+			// the calls before the key was seen had no value for it
+			m.usage[[2]string{k, ""}] = &TagUsage{Key: k, Requests: total.Requests, BoxUsage: total.BoxUsage}
+			m.keys[k] = 1
+		}
+	}
+	m.charge("", "", boxUsage)
+	for k := range m.keys {
+		m.charge(k, tags[k], boxUsage)
+	}
+}
+
+// charge adds a call to the usage of k=v. The caller holds mu.
+func (m *UsageMeter) charge(k string, v string, boxUsage float64) {
+	u := m.usage[[2]string{k, v}]
+	if u == nil {
+		if v != "" && m.MaxValues > 0 && m.keys[k] >= m.MaxValues {
+			v = UsageOverflow
+			u = m.usage[[2]string{k, v}]
+		}
+		if u == nil {
+			u = &TagUsage{Key: k, Value: v}
+			m.usage[[2]string{k, v}] = u
+			if k != "" {
+				m.keys[k]++
+			}
+		}
+	}
+	u.Requests++
+	u.BoxUsage += boxUsage
+}
+
+// Usage returns the usage by tag, ordered by key and value.
+func (m *UsageMeter) Usage() []TagUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := make([]TagUsage, 0, len(m.usage))
+	for _, u := range m.usage {
+		usage = append(usage, *u)
+	}
+	sort.Slice(usage, func(a, b int) bool {
+		if usage[a].Key != usage[b].Key {
+			return usage[a].Key < usage[b].Key
+		}
+		return usage[a].Value < usage[b].Value
+	})
+	return usage
+}
+
+// ByKey returns the usage of the values of key.
+func (m *UsageMeter) ByKey(key string) map[string]TagUsage {
+	usage := make(map[string]TagUsage)
+	for _, u := range m.Usage() {
+		if u.Key == key {
+			usage[u.Value] = u
+		}
+	}
+	return usage
+}
+
+// Reset clears the usage, for example after reporting it.
+func (m *UsageMeter) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage, m.keys = make(map[[2]string]*TagUsage), make(map[string]int)
+}
+
+// recordUsage charges the call that returned v to the tags of the client's
+// context.
+func (sdb *SimpleDB) recordUsage(v interface{}) {
+	if sdb.Meter == nil {
+		return
+	}
+	var tags map[string]string
+	if sdb.ctx != nil {
+		tags = UsageTags(sdb.ctx)
+	}
+	sdb.Meter.record(tags, boxUsage(v))
+}
+
+// boxUsage returns the BoxUsage of a response, 0 if it has none.
+func boxUsage(v interface{}) float64 {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return 0
+	}
+	m := rv.FieldByName("ResponseMetadata")
+	if !m.IsValid() {
+		return 0
+	}
+	if md, ok := m.Interface().(ResponseMetadata); ok {
+		return md.BoxUsage
+	}
+	return 0
+}
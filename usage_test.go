@@ -0,0 +1,68 @@
+package sdb
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestUsageMeter(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.Meter = NewUsageMeter()
+	select1 := func(ctx context.Context) {
+		c.HTTPClient = &http.Client{Transport: &pagesTransport{pages: []string{streamPage2}}}
+		db := c.WithContext(ctx)
+		if _, err := db.Select("select * from d"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select1(context.Background())
+	search := WithUsageTags(context.Background(), map[string]string{"feature": "search", "team": "core"})
+	select1(search)
+	select1(WithUsageTags(search, map[string]string{"feature": "export"}))
+	select1(context.Background())
+
+	features := c.Meter.ByKey("feature")
+	if u := features["search"]; u.Requests != 1 || u.BoxUsage != 0.1 {
+		t.Errorf("unexpected search usage %+v", u)
+	}
+	if u := features[""]; u.Requests != 2 {
+		t.Errorf("unexpected untagged usage %+v", u)
+	}
+	if u := c.Meter.ByKey("team")["core"]; u.Requests != 2 {
+		t.Errorf("unexpected team usage %+v", u)
+	}
+	total := c.Meter.ByKey("")[""]
+	if total.Requests != 4 || total.BoxUsage < 0.39 {
+		t.Errorf("unexpected total %+v", total)
+	}
+	// calls made before a key was first seen are charged to its empty value
+	for _, key := range []string{"feature", "team"} {
+		var n int64
+		for _, u := range c.Meter.ByKey(key) {
+			n += u.Requests
+		}
+		if n != total.Requests {
+			t.Errorf("%s adds up to %d requests, the total is %d", key, n, total.Requests)
+		}
+	}
+	// an empty key does not reach the totals
+	select1(WithUsageTags(context.Background(), map[string]string{"": "x"}))
+	if u := c.Meter.ByKey("")[""]; u.Requests != 5 || len(c.Meter.ByKey("")) != 1 {
+		t.Errorf("unexpected totals %v", c.Meter.ByKey(""))
+	}
+
+	c.Meter.Reset()
+	c.Meter.MaxValues = 2
+	for _, job := range []string{"j1", "j2", "j3", "j4"} {
+		select1(WithUsageTags(context.Background(), map[string]string{"job": job}))
+	}
+	jobs := c.Meter.ByKey("job")
+	if len(jobs) != 3 || jobs["j1"].Requests != 1 || jobs[UsageOverflow].Requests != 2 {
+		t.Errorf("unexpected bounded usage %v", jobs)
+	}
+	c.Meter.Reset()
+	if len(c.Meter.Usage()) != 0 {
+		t.Errorf("Reset kept %v", c.Meter.Usage())
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// InvalidValueError is returned before sending a write with a value SimpleDB
+// would reject. Offset is the byte offset of the offending character.
+type InvalidValueError struct {
+	Item      string
+	Attribute string
+	Offset    int
+	Reason    string
+}
+
+func (e InvalidValueError) Error() string {
+	return fmt.Sprintf("invalid value for attribute %s of item %s at byte %d: %s", e.Attribute, e.Item, e.Offset, e.Reason)
+}
+
+// ValidateValue checks that value is valid UTF-8, at most
+// MaxAttributeValueLength bytes and only contains characters allowed in XML
+// 1.0, which excludes most control characters.
+func ValidateValue(value string) error {
+	if len(value) > MaxAttributeValueLength {
+		return InvalidValueError{Offset: MaxAttributeValueLength, Reason: fmt.Sprintf("value is %d bytes, the limit is %d", len(value), MaxAttributeValueLength)}
+	}
+	for i, r := range value {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(value[i:]); size == 1 {
+				return InvalidValueError{Offset: i, Reason: "invalid UTF-8"}
+			}
+		}
+		if !validXMLChar(r) {
+			return InvalidValueError{Offset: i, Reason: fmt.Sprintf("character %U is not allowed", r)}
+		}
+	}
+	return nil
+}
+
+func validXMLChar(r rune) bool {
+	return r == 0x09 || r == 0x0A || r == 0x0D ||
+		(r >= 0x20 && r <= 0xD7FF) ||
+		(r >= 0xE000 && r <= 0xFFFD) ||
+		(r >= 0x10000 && r <= 0x10FFFF)
+}
+
+// prepareValue applies NormalizeNFC, NormalizeValue, Encryption and
+// ValidateValues to a value about to be written.
+func (sdb *SimpleDB) prepareValue(item string, a Attribute) (string, error) {
+	v := sdb.normalize(a.Value)
+	if e := sdb.Encryption; e != nil && e.Attributes[a.Name] {
+		var err error
+		if v, err = e.Encrypt(sdb.context(), a.Name, v); err != nil {
+			return v, err
+		}
+	}
+	return v, sdb.validateValue(item, a.Name, v)
+}
+
+// prepareDeleteValue normalizes and validates a value about to be deleted so
+// that it matches the value as it was written. An empty value, which deletes
+// all values of the attribute, is returned as is.
+func (sdb *SimpleDB) prepareDeleteValue(item string, a Attribute) (string, error) {
+	if a.Value == "" {
+		return "", nil
+	}
+	v := sdb.normalize(a.Value)
+	return v, sdb.validateValue(item, a.Name, v)
+}
+
+func (sdb *SimpleDB) normalize(v string) string {
+	if sdb.NormalizeNFC {
+		v = norm.NFC.String(v)
+	}
+	if sdb.NormalizeValue != nil {
+		v = sdb.NormalizeValue(v)
+	}
+	return v
+}
+
+func (sdb *SimpleDB) validateValue(item string, attr string, v string) error {
+	if !sdb.ValidateValues {
+		return nil
+	}
+	if err := ValidateValue(v); err != nil {
+		e := err.(InvalidValueError)
+		e.Item, e.Attribute = item, attr
+		return e
+	}
+	return nil
+}
+
+// validateNames checks the item and attribute names of a write when
+// ValidateValues is set.
+func (sdb *SimpleDB) validateNames(items ...*Item) error {
+	if !sdb.ValidateValues {
+		return nil
+	}
+	for _, i := range items {
+		if err := ValidateAttributeName(i.Name); err != nil {
+			e := err.(InvalidNameError)
+			e.Kind = "item"
+			return e
+		}
+		for _, a := range i.Attributes {
+			if err := ValidateAttributeName(a.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// InvalidNameError is returned for a domain, attribute or item name that
+// breaks the SimpleDB naming rules.
+type InvalidNameError struct {
+	Kind   string
+	Name   string
+	Reason string
+}
+
+func (e InvalidNameError) Error() string {
+	return fmt.Sprintf("invalid %s name %q: %s", e.Kind, e.Name, e.Reason)
+}
+
+// ValidateDomainName checks that name is 3 to 255 characters of a-z, A-Z,
+// 0-9, '_', '-' and '.'.
+func ValidateDomainName(name string) error {
+	if len(name) < 3 || len(name) > 255 {
+		return InvalidNameError{Kind: "domain", Name: name, Reason: "must be 3 to 255 characters"}
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.') {
+			return InvalidNameError{Kind: "domain", Name: name, Reason: fmt.Sprintf("character %q is not allowed", r)}
+		}
+	}
+	return nil
+}
+
+// ValidateAttributeName checks that name is 1 to 1024 bytes of valid UTF-8
+// using only characters allowed in XML. Item names follow the same rules.
+func ValidateAttributeName(name string) error {
+	if name == "" {
+		return InvalidNameError{Kind: "attribute", Name: name, Reason: "must not be empty"}
+	}
+	if err := ValidateValue(name); err != nil {
+		return InvalidNameError{Kind: "attribute", Name: name, Reason: err.(InvalidValueError).Reason}
+	}
+	return nil
+}
+
+// validateItemNames checks the names used by a typed call unless
+// SkipNameValidation is set.
+func (sdb *SimpleDB) validateItemNames(domain string, i *Item) error {
+	if sdb.SkipNameValidation {
+		return nil
+	}
+	if err := ValidateDomainName(domain); err != nil {
+		return err
+	}
+	if err := ValidateAttributeName(i.Name); err != nil {
+		e := err.(InvalidNameError)
+		e.Kind = "item"
+		return e
+	}
+	for _, a := range i.Attributes {
+		if err := ValidateAttributeName(a.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package sdb
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidateValue(t *testing.T) {
+	valid := []string{"", "plain", "åäö", "tab\tnewline\n", "\U0001F600"}
+	for _, v := range valid {
+		if err := ValidateValue(v); err != nil {
+			t.Errorf("%q: %v", v, err)
+		}
+	}
+	invalid := map[string]int{
+		"bell\x07":    4,
+		"bad\xffutf8": 3,
+		"\uFFFE":      0,
+		strings.Repeat("x", MaxAttributeValueLength+1): MaxAttributeValueLength,
+	}
+	for v, offset := range invalid {
+		err, ok := ValidateValue(v).(InvalidValueError)
+		if !ok || err.Offset != offset {
+			t.Errorf("%q: expected error at %d, got %v", v, offset, err)
+		}
+	}
+}
+
+func TestValidateNames(t *testing.T) {
+	for _, n := range []string{"abc", "my_domain-1.0", strings.Repeat("d", 255)} {
+		if err := ValidateDomainName(n); err != nil {
+			t.Error(err)
+		}
+	}
+	for _, n := range []string{"ab", "with space", "åäö", strings.Repeat("d", 256)} {
+		if err := ValidateDomainName(n); err == nil {
+			t.Errorf("Expected %q to be invalid", n)
+		}
+	}
+	if err := ValidateAttributeName("address.city"); err != nil {
+		t.Error(err)
+	}
+	for _, n := range []string{"", "ctrl\x01"} {
+		if err := ValidateAttributeName(n); err == nil {
+			t.Errorf("Expected %q to be invalid", n)
+		}
+	}
+}
+
+func TestValidateWrites(t *testing.T) {
+	it := &itemTransport{}
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.HTTPClient = &http.Client{Transport: it}
+	c.ValidateValues = true
+	c.NormalizeNFC = true
+
+	// e followed by a combining acute accent is stored as a single é.
+	if _, err := c.PutAttributes("users", &Item{Name: "u1", Attributes: []Attribute{{Name: "name", Value: "Rene\u0301"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if it.attrs[0].Value != "Ren\u00e9" {
+		t.Fatalf("stored %q", it.attrs[0].Value)
+	}
+
+	if _, err := c.PutAttributes("users", &Item{Name: "bad\x01", Attributes: []Attribute{{Name: "name", Value: "x"}}}); err == nil || err.(InvalidNameError).Kind != "item" {
+		t.Fatalf("Expected an invalid item name, got %v", err)
+	}
+	if _, err := c.BatchPutAttributes("users", []*Item{{Name: "u1", Attributes: []Attribute{{Name: "", Value: "x"}}}}); err == nil {
+		t.Fatal("Expected an invalid attribute name")
+	}
+	if _, err := c.DeleteAttributes("users", &Item{Name: "u1", Attributes: []Attribute{{Name: "name", Value: "bell\x07"}}}); err == nil {
+		t.Fatal("Expected an invalid value in a delete")
+	}
+	if _, err := c.BatchDeleteAttributes("users", []*Item{{Name: "bad\x01"}}); err == nil {
+		t.Fatal("Expected an invalid item name in a batch delete")
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// MaterializedView keeps one item per group of the items of Source in
+// Domain, such as the number of orders of every customer. The items of a
+// group share a value of the GroupBy attribute, which names the summary
+// item. Set on SimpleDB.Views, a view is refreshed for the groups touched by
+// every write the client makes to Source, including the groups the items
+// were in before the write. Writes made elsewhere are picked up by
+// RebuildView.
+type MaterializedView struct {
+	Source  string
+	Domain  string
+	GroupBy string
+	// Summarize computes the attributes of the summary item of group, which
+	// replace the stored ones. A nil item deletes the summary item.
+	Summarize func(db SimpleDB, group string) (*Item, error)
+	// OnError, if set, is called when refreshing the view after a write
+	// fails, instead of the write returning a *ViewError.
+	OnError func(err *ViewError)
+}
+
+// ViewError reports a view that could not be refreshed after a write. The
+// write itself succeeded, so it must not be retried, the view is stale
+// until the group is refreshed again.
+type ViewError struct {
+	View  string
+	Group string
+	Err   error
+}
+
+func (e *ViewError) Error() string {
+	return fmt.Sprintf("sdb: refreshing group %s of view %s: %v", e.Group, e.View, e.Err)
+}
+
+func (e *ViewError) Unwrap() error {
+	return e.Err
+}
+
+// CountView summarizes a group by its number of items, stored in the count
+// attribute with EncodeInt so views can be sorted by it.
+func CountView(source string, domain string, groupBy string) *MaterializedView {
+	return &MaterializedView{Source: source, Domain: domain, GroupBy: groupBy,
+		Summarize: func(db SimpleDB, group string) (*Item, error) {
+			q := NewQuery(source).Count().Where(groupBy, "=", group).String()
+			var n int64
+			token := ""
+			for {
+				r, err := db.SelectWithToken(q, token)
+				if err != nil {
+					return nil, err
+				}
+				for _, i := range r.Items {
+					c, err := strconv.ParseInt(i.Value("Count"), 10, 64)
+					if err != nil {
+						return nil, err
+					}
+					n += c
+				}
+				if token = r.NextToken; token == "" {
+					break
+				}
+			}
+			if n == 0 {
+				return nil, nil
+			}
+			return &Item{Attributes: []Attribute{{Name: "count", Value: EncodeInt(n)}}}, nil
+		}}
+}
+
+// LatestView points to the item of a group with the greatest value of
+// orderBy, storing its name in the latest attribute and its value in
+// orderBy.
+func LatestView(source string, domain string, groupBy string, orderBy string) *MaterializedView {
+	return &MaterializedView{Source: source, Domain: domain, GroupBy: groupBy,
+		Summarize: func(db SimpleDB, group string) (*Item, error) {
+			q := NewQuery(source).Output(orderBy).Where(groupBy, "=", group).
+				WhereExpr(quoteAttribute(orderBy)+" is not null").OrderBy(orderBy, true).Limit(1)
+			r, err := db.Select(q.String())
+			if err != nil || len(r.Items) == 0 {
+				return nil, err
+			}
+			latest := r.Items[0]
+			return &Item{Attributes: []Attribute{{Name: "latest", Value: latest.Name}, {Name: orderBy, Value: latest.Value(orderBy)}}}, nil
+		}}
+}
+
+// RefreshView recomputes the summary item of group with consistent reads,
+// so a refresh right after a write sees it.
+func (sdb *SimpleDB) RefreshView(ctx context.Context, v *MaterializedView, group string) error {
+	db := sdb.WithContext(ctx)
+	db.Views = nil
+	db.ConsistentRead = true
+	i, err := v.Summarize(db, group)
+	if err != nil {
+		return err
+	}
+	if i == nil {
+		_, err = db.DeleteItem(v.Domain, group)
+		return err
+	}
+	s := Item{Name: group}
+	for _, a := range i.Attributes {
+		a.Replace = true
+		s.Attributes = append(s.Attributes, a)
+	}
+	_, err = db.PutAttributes(v.Domain, &s)
+	return err
+}
+
+// RebuildView refreshes every group of Source and deletes the summary items
+// of groups that no longer have items, to recover from missed updates. Only
+// the group names are kept in memory.
+func (sdb *SimpleDB) RebuildView(ctx context.Context, v *MaterializedView) error {
+	groups := make(map[string]bool)
+	q := NewQuery(v.Source).Output(v.GroupBy).WhereExpr(quoteAttribute(v.GroupBy) + " is not null")
+	err := sdb.SelectStream(ctx, q.String(), func(i Item) error {
+		for _, a := range i.Attributes {
+			if a.Name == v.GroupBy {
+				groups[a.Value] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, g := range sortedGroups(groups) {
+		if err = sdb.RefreshView(ctx, v, g); err != nil {
+			return err
+		}
+	}
+
+	var stale []*Item
+	err = sdb.SelectStream(ctx, NewQuery(v.Domain).Output("itemName()").String(), func(i Item) error {
+		if !groups[i.Name] {
+			stale = append(stale, &Item{Name: i.Name})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return runBatches(ctx, "RebuildView", batches(stale), func(ctx context.Context, k int, batch []*Item) (err error) {
+		db := sdb.WithContext(ctx)
+		_, err = db.BatchDeleteAttributes(v.Domain, batch)
+		return
+	})
+}
+
+// viewGroups returns the groups of the views of domain that a write of
+// items touches, before and after the write.
+func (sdb *SimpleDB) viewGroups(domain string, items ...*Item) (groups map[*MaterializedView]map[string]bool, err error) {
+	var views []*MaterializedView
+	for _, v := range sdb.Views {
+		if v.Source == domain {
+			views = append(views, v)
+		}
+	}
+	if len(views) == 0 {
+		return
+	}
+	names := make([]string, len(items))
+	for j, i := range items {
+		names[j] = i.Name
+	}
+	db := *sdb
+	db.Views = nil
+	db.ConsistentRead = true
+	db.PartialResults = false
+	old, err := db.GetByNames(domain, names)
+	if err != nil {
+		return
+	}
+	groups = make(map[*MaterializedView]map[string]bool, len(views))
+	for _, v := range views {
+		g := make(map[string]bool)
+		add := func(attrs []Attribute) {
+			for _, a := range attrs {
+				if a.Name == v.GroupBy && a.Value != "" {
+					g[a.Value] = true
+				}
+			}
+		}
+		for _, i := range old {
+			add(i.Attributes)
+		}
+		for _, i := range items {
+			add(i.Attributes)
+		}
+		groups[v] = g
+	}
+	return
+}
+
+// refreshViews refreshes the groups from viewGroups after a write. An error
+// leaves the write in place and the view stale until the next refresh, it
+// is passed to OnError or returned as the first *ViewError.
+func (sdb *SimpleDB) refreshViews(groups map[*MaterializedView]map[string]bool) (err error) {
+	for v, g := range groups {
+		for _, name := range sortedGroups(g) {
+			rerr := sdb.RefreshView(sdb.context(), v, name)
+			if rerr == nil {
+				continue
+			}
+			ve := &ViewError{View: v.Domain, Group: name, Err: rerr}
+			if v.OnError != nil {
+				v.OnError(ve)
+			} else if err == nil {
+				err = ve
+			}
+		}
+	}
+	return
+}
+
+func sortedGroups(groups map[string]bool) []string {
+	names := make([]string, 0, len(groups))
+	for g := range groups {
+		names = append(names, g)
+	}
+	sort.Strings(names)
+	return names
+}
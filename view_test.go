@@ -0,0 +1,102 @@
+package sdb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestMaterializedView(t *testing.T) {
+	f := sdbtest.NewFake()
+	db := f.Client()
+	for _, d := range []string{"orders", "counts", "latest"} {
+		if _, err := db.CreateDomain(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	counts := sdb.CountView("orders", "counts", "customer")
+	latest := sdb.LatestView("orders", "latest", "customer", "placed")
+	db.Views = []*sdb.MaterializedView{counts, latest}
+	put := func(name, customer, placed string) {
+		i := sdb.NewItem(name)
+		i.ReplaceAttribute("customer", customer)
+		i.ReplaceAttribute("placed", placed)
+		if _, err := db.PutAttributes("orders", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(domain, name, attr, want string) {
+		t.Helper()
+		r, err := db.GetAttributes(domain, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := (sdb.Item{Attributes: r.Attributes}).Value(attr); got != want {
+			t.Errorf("%s %s %s = %q, want %q", domain, name, attr, got, want)
+		}
+	}
+
+	put("o1", "c1", "2014-01-01")
+	put("o2", "c1", "2014-02-01")
+	put("o3", "c2", "2014-01-15")
+	check("counts", "c1", "count", sdb.EncodeInt(2))
+	check("latest", "c1", "latest", "o2")
+
+	// Moving an order refreshes the group it left.
+	put("o2", "c2", "2014-02-01")
+	check("counts", "c1", "count", sdb.EncodeInt(1))
+	check("counts", "c2", "count", sdb.EncodeInt(2))
+	check("latest", "c1", "latest", "o1")
+
+	if _, err := db.DeleteItem("orders", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	check("counts", "c1", "count", "")
+	check("latest", "c1", "latest", "")
+
+	// Writes made without the views are repaired by a rebuild.
+	plain := db
+	plain.Views = nil
+	i := sdb.NewItem("o4")
+	i.AddAttribute("customer", "c3")
+	if _, err := plain.PutAttributes("orders", i); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.DeleteItem("orders", "o3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.PutAttributes("counts", &sdb.Item{Name: "gone", Attributes: []sdb.Attribute{{Name: "count", Value: "x"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RebuildView(context.Background(), counts); err != nil {
+		t.Fatal(err)
+	}
+	check("counts", "c2", "count", sdb.EncodeInt(1))
+	check("counts", "c3", "count", sdb.EncodeInt(1))
+	check("counts", "gone", "count", "")
+
+	// a failed refresh does not fail the write
+	failed := errors.New("failed")
+	broken := &sdb.MaterializedView{Source: "orders", Domain: "counts", GroupBy: "customer",
+		Summarize: func(db sdb.SimpleDB, group string) (*sdb.Item, error) {
+			if !db.ConsistentRead {
+				t.Error("Expected the refresh to read consistently")
+			}
+			return nil, failed
+		}}
+	db.Views = []*sdb.MaterializedView{broken}
+	_, err := db.PutAttributes("orders", &sdb.Item{Name: "o5", Attributes: []sdb.Attribute{{Name: "customer", Value: "c4"}}})
+	var ve *sdb.ViewError
+	if !errors.As(err, &ve) || !errors.Is(err, failed) || ve.Group != "c4" {
+		t.Fatalf("Expected a ViewError, got %v", err)
+	}
+	check("orders", "o5", "customer", "c4")
+	var reported []string
+	broken.OnError = func(err *sdb.ViewError) { reported = append(reported, err.Group) }
+	if _, err = db.DeleteItem("orders", "o5"); err != nil || len(reported) != 1 || reported[0] != "c4" {
+		t.Errorf("Expected the failure to go to OnError, got %v %v", err, reported)
+	}
+}
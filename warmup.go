@@ -0,0 +1,102 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// Warmup prepares the client for its first requests: it resolves the
+// endpoint, opens that many TLS connections, which stay in the HTTP client's
+// idle pool, and with validate set makes a ListDomains call so bad
+// credentials are reported now rather than on the first real request. The
+// default transport keeps at most 2 idle connections per host, raise its
+// MaxIdleConnsPerHost to keep more.
+func (sdb *SimpleDB) Warmup(ctx context.Context, connections int, validate bool) error {
+	client := sdb.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if _, ok := client.Transport.(*http.Transport); ok || client.Transport == nil {
+		// a custom RoundTripper may not use DNS at all
+		if _, err := net.DefaultResolver.LookupHost(ctx, sdb.endpoint().hostname()); err != nil {
+			return &RequestError{Err: err}
+		}
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for j := 0; j < connections; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := warmConnection(ctx, client, sdb.endpoint().URL()); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+
+	if validate {
+		db := sdb.WithContext(ctx)
+		_, err := db.ListDomains()
+		return err
+	}
+	return nil
+}
+
+// warmConnection makes an unsigned request and drains the response, leaving
+// its connection in the idle pool. The error status SimpleDB answers with is
+// expected.
+func warmConnection(ctx context.Context, client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	r, err := client.Do(req)
+	if err != nil {
+		return &RequestError{Err: err}
+	}
+	io.Copy(io.Discard, r.Body)
+	return r.Body.Close()
+}
@@ -0,0 +1,42 @@
+package sdb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+type countingTransport struct {
+	mu      sync.Mutex
+	actions map[string]int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	action := "GET"
+	if req.Method == "POST" {
+		b, _ := io.ReadAll(req.Body)
+		action = string(b)
+		if bytes.Contains(b, []byte("Action=ListDomains")) {
+			action = "ListDomains"
+		}
+	}
+	c.mu.Lock()
+	c.actions[action]++
+	c.mu.Unlock()
+	return &http.Response{StatusCode: 200, Status: "200 OK", Body: io.NopCloser(bytes.NewBufferString("<ListDomainsResponse/>")), Request: req}, nil
+}
+
+func TestWarmup(t *testing.T) {
+	ct := &countingTransport{actions: make(map[string]int)}
+	c := NewSimpleDB("a", "s", "sdb.invalid")
+	c.HTTPClient = &http.Client{Transport: ct}
+	if err := c.Warmup(context.Background(), 3, true); err != nil {
+		t.Fatal(err)
+	}
+	if ct.actions["GET"] != 3 || ct.actions["ListDomains"] != 1 {
+		t.Errorf("unexpected requests %v", ct.actions)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Change is an item of a watched domain that was written after the last
+// Poll. Mark is its value of the watched attribute.
+type Change struct {
+	Domain string
+	Item   Item
+	Mark   string
+}
+
+// Watcher polls a domain for items whose Attribute, an updated_at style
+// attribute holding sortable timestamps, is at or past the last value seen.
+// Deleted items are not seen. Since is the greatest value passed so far.
+//
+// Items may be written after a Poll with an earlier value, because of clock
+// skew between writers or a slow write, so when Attribute holds EncodeTime
+// values a Poll starts Overlap before Since. The items passed in that window
+// are remembered with their value, an item is passed again only when its
+// value changes. Set StateDomain to keep Since and those items across
+// restarts.
+type Watcher struct {
+	Domain    string
+	Attribute string
+	Since     string
+	Overlap   time.Duration
+	// StateDomain, if set, is the domain holding the state of the Watcher
+	// in an item named by StateName. The first Poll loads it and every
+	// Poll that passes items saves it.
+	StateDomain string
+	// seen holds the value of every item passed from the start of the
+	// overlap.
+	seen   map[string]string
+	loaded bool
+	db     SimpleDB
+}
+
+// NewWatcher returns a Watcher of attr in domain, starting from the beginning.
+func NewWatcher(db SimpleDB, domain string, attr string) *Watcher {
+	db.ConsistentRead = true
+	return &Watcher{Domain: domain, Attribute: attr, Overlap: time.Minute, seen: make(map[string]string), db: db}
+}
+
+// StateName is the name of the item in StateDomain holding the state.
+func (w *Watcher) StateName() string {
+	return w.Domain + "/" + w.Attribute
+}
+
+// Poll passes the items changed since the last Poll to fn in the order of
+// Attribute. Since advances past every item fn accepts, the first error of
+// fn stops the Poll and is returned, so the item is passed again by the
+// next Poll.
+func (w *Watcher) Poll(ctx context.Context, fn func(context.Context, Change) error) (n int, err error) {
+	db := w.db.WithContext(ctx)
+	if err = w.load(db); err != nil {
+		return
+	}
+	q := NewQuery(w.Domain).OrderBy(w.Attribute, false)
+	if w.Since == "" {
+		q.WhereExpr(quoteAttribute(w.Attribute) + " is not null")
+	} else {
+		q.Where(w.Attribute, ">=", w.start())
+	}
+	err = db.SelectStream(ctx, q.String(), func(i Item) error {
+		mark := i.Value(w.Attribute)
+		if m, ok := w.seen[i.Name]; ok && m == mark {
+			return nil
+		}
+		if err := fn(ctx, Change{Domain: w.Domain, Item: i, Mark: mark}); err != nil {
+			return err
+		}
+		w.seen[i.Name] = mark
+		if mark > w.Since {
+			w.Since = mark
+		}
+		n++
+		return nil
+	})
+	if n > 0 {
+		start := w.start()
+		for name, mark := range w.seen {
+			if mark < start {
+				delete(w.seen, name)
+			}
+		}
+		if serr := w.save(db); err == nil {
+			err = serr
+		}
+	}
+	return
+}
+
+// start returns the lowest value a Poll reads, Since less Overlap.
+func (w *Watcher) start() string {
+	t, err := DecodeTime(w.Since)
+	if err != nil || w.Overlap <= 0 {
+		return w.Since
+	}
+	return EncodeTime(t.Add(-w.Overlap))
+}
+
+// load reads the state from StateDomain once.
+func (w *Watcher) load(db SimpleDB) error {
+	if w.seen == nil {
+		w.seen = make(map[string]string)
+	}
+	if w.StateDomain == "" || w.loaded {
+		return nil
+	}
+	r, err := db.GetAttributes(w.StateDomain, w.StateName())
+	if err != nil {
+		return err
+	}
+	i := Item{Name: w.StateName(), Attributes: r.Attributes}
+	if v, found, err := i.Chunked("seen"); err != nil {
+		return err
+	} else if found {
+		seen := make(map[string]string)
+		if err = json.Unmarshal([]byte(v), &seen); err != nil {
+			return err
+		}
+		w.Since, w.seen = i.Value("since"), seen
+	}
+	w.loaded = true
+	return nil
+}
+
+// save writes the state to StateDomain.
+func (w *Watcher) save(db SimpleDB) error {
+	if w.StateDomain == "" {
+		return nil
+	}
+	b, err := json.Marshal(w.seen)
+	if err != nil {
+		return err
+	}
+	i := NewItem(w.StateName())
+	i.ReplaceAttribute("since", w.Since)
+	if err = i.SetChunked("seen", string(b)); err != nil {
+		return err
+	}
+	_, err = db.PutAttributes(w.StateDomain, i)
+	return err
+}
+
+// Run calls Poll every interval until ctx is done or fn fails.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration, fn func(context.Context, Change) error) error {
+	if err := checkInterval(interval); err != nil {
+		return err
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if _, err := w.Poll(ctx, fn); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
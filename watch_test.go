@@ -0,0 +1,67 @@
+package sdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestWatcherOverlap(t *testing.T) {
+	ctx := context.Background()
+	f := sdbtest.NewFake()
+	db := f.Client()
+	for _, d := range []string{"users", "watch"} {
+		if _, err := db.CreateDomain(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Date(2014, 6, 1, 12, 0, 0, 0, time.UTC)
+	put := func(name string, updated time.Time) {
+		t.Helper()
+		i := sdb.NewItem(name)
+		i.ReplaceAttribute("updated", sdb.EncodeTime(updated))
+		if _, err := db.PutAttributes("users", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	poll := func(w *sdb.Watcher) (names []string) {
+		t.Helper()
+		if _, err := w.Poll(ctx, func(_ context.Context, c sdb.Change) error {
+			names = append(names, c.Item.Name)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	w := sdb.NewWatcher(db, "users", "updated")
+	w.StateDomain = "watch"
+	put("u1", now)
+	if got := poll(w); len(got) != 1 || got[0] != "u1" {
+		t.Fatalf("first Poll passed %v", got)
+	}
+	// u2 is stamped before u1 by a writer with a slow clock
+	put("u2", now.Add(-30*time.Second))
+	if got := poll(w); len(got) != 1 || got[0] != "u2" {
+		t.Fatalf("Poll after a late write passed %v", got)
+	}
+
+	// a new Watcher resumes from the saved state
+	w = sdb.NewWatcher(db, "users", "updated")
+	w.StateDomain = "watch"
+	if got := poll(w); len(got) != 0 || w.Since != sdb.EncodeTime(now) {
+		t.Fatalf("Poll after a restart passed %v from %q", got, w.Since)
+	}
+	put("u2", now.Add(time.Second))
+	if got := poll(w); len(got) != 1 || got[0] != "u2" {
+		t.Fatalf("Poll after an update passed %v", got)
+	}
+
+	if err := w.Run(ctx, 0, nil); err == nil {
+		t.Error("expected Run to refuse a zero interval")
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WebhookSignatureHeader carries the hex HMAC-SHA256 of the body under the
+// Webhook Secret, prefixed with sha256=.
+const WebhookSignatureHeader = "X-Sdb-Signature"
+
+// WebhookPayload is the JSON body a Webhook posts for a Change, also used
+// by ProducerSink and PublisherSink.
+type WebhookPayload struct {
+	Domain     string              `json:"domain"`
+	Item       string              `json:"item"`
+	Mark       string              `json:"mark"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+// Webhook posts changes from a Watcher as JSON to URLs, for example with
+// w.Run(ctx, time.Minute, h.Send). A post is retried MaxAttempts times on
+// network errors and statuses other than 2xx, then recorded in the
+// DeadLetters domain, if set, and given up.
+type Webhook struct {
+	URLs        []string
+	Secret      []byte
+	MaxAttempts int
+	Backoff     Backoff
+	DeadLetters string
+	// HTTPClient sends the posts, http.DefaultClient if nil.
+	HTTPClient *http.Client
+	db         SimpleDB
+}
+
+// NewWebhook returns a Webhook posting to urls and recording failed posts in deadLetters.
+func NewWebhook(db SimpleDB, deadLetters string, urls ...string) *Webhook {
+	return &Webhook{URLs: urls, MaxAttempts: 5, Backoff: ExponentialBackoff{Base: time.Second, Max: time.Minute}, DeadLetters: deadLetters, db: db}
+}
+
+// Send posts c to every URL. It only fails when ctx is done or a failed
+// post can not be recorded as a dead letter, so a Watcher keeps going past
+// unreachable receivers.
+func (h *Webhook) Send(ctx context.Context, c Change) error {
+	body, err := changeJSON(c)
+	if err != nil {
+		return err
+	}
+	for _, u := range h.URLs {
+		perr := h.post(ctx, u, body)
+		if perr == nil {
+			continue
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if err = h.deadLetter(ctx, u, c, body, perr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Webhook) post(ctx context.Context, url string, body []byte) (err error) {
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		if err = h.postOnce(ctx, url, body); err == nil || attempt >= h.MaxAttempts {
+			return
+		}
+		if h.Backoff != nil {
+			delay = h.Backoff.Delay(attempt, delay)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (h *Webhook) postOnce(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.Secret != nil {
+		mac := hmac.New(sha256.New, h.Secret)
+		mac.Write(body)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	client := h.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("sdb: webhook %s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+func (h *Webhook) deadLetter(ctx context.Context, url string, c Change, body []byte, perr error) error {
+	if h.DeadLetters == "" {
+		return nil
+	}
+	id, err := TimePrefixed()
+	if err != nil {
+		return err
+	}
+	i := NewItem(id)
+	i.AddAttribute("url", url)
+	i.AddAttribute("domain", c.Domain)
+	i.AddAttribute("item", c.Item.Name)
+	msg := perr.Error()
+	if len(msg) > 1024 {
+		msg = msg[:1024]
+	}
+	i.AddAttribute("error", msg)
+	if err = i.SetChunked("body", string(body)); err != nil {
+		return err
+	}
+	db := h.db.WithContext(ctx)
+	_, err = db.PutAttributes(h.DeadLetters, i)
+	return err
+}
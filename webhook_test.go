@@ -0,0 +1,83 @@
+package sdb_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coopernurse/sdb"
+	"github.com/coopernurse/sdb/sdbtest"
+)
+
+func TestWebhook(t *testing.T) {
+	ctx := context.Background()
+	f := sdbtest.NewFake()
+	db := f.Client()
+	for _, d := range []string{"users", "dead"} {
+		if _, err := db.CreateDomain(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put := func(name, updated string) {
+		i := sdb.NewItem(name)
+		i.ReplaceAttribute("updated", updated)
+		if _, err := db.PutAttributes("users", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("u1", "001")
+	put("u2", "002")
+
+	var got []sdb.WebhookPayload
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("k"))
+		mac.Write(body)
+		if r.Header.Get(sdb.WebhookSignatureHeader) != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("bad signature %q", r.Header.Get(sdb.WebhookSignatureHeader))
+		}
+		var p sdb.WebhookPayload
+		json.Unmarshal(body, &p)
+		got = append(got, p)
+	}))
+	defer ok.Close()
+	failures := 0
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failures++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	h := sdb.NewWebhook(db, "dead", ok.URL, down.URL)
+	h.Secret = []byte("k")
+	h.Backoff = nil
+	h.MaxAttempts = 2
+	w := sdb.NewWatcher(db, "users", "updated")
+	if n, err := w.Poll(ctx, h.Send); err != nil || n != 2 {
+		t.Fatalf("Poll = %d, %v", n, err)
+	}
+	if len(got) != 2 || got[0].Item != "u1" || got[1].Attributes["updated"][0] != "002" || w.Since != "002" {
+		t.Errorf("unexpected posts %+v, since %q", got, w.Since)
+	}
+	if failures != 4 {
+		t.Errorf("expected 2 attempts per change, got %d", failures)
+	}
+	r, err := db.Select("select * from dead")
+	if err != nil || len(r.Items) != 2 || r.Items[0].Value("url") != down.URL {
+		t.Errorf("unexpected dead letters %+v, %v", r.Items, err)
+	}
+
+	// Only items written after the last Poll are sent again.
+	put("u3", "002")
+	put("u1", "003")
+	got = nil
+	if n, err := w.Poll(ctx, h.Send); err != nil || n != 2 || got[0].Item != "u3" || got[1].Item != "u1" {
+		t.Errorf("Poll = %d, %v, %+v", n, err, got)
+	}
+}
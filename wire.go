@@ -0,0 +1,140 @@
+// Copyright (c) 2014, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package sdb
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const upperhex = "0123456789ABCDEF"
+
+var ErrReservedParameter = errors.New("reserved parameter")
+
+// reservedParameters are set by the client when signing a request and can
+// not be given in ExtraParameters.
+var reservedParameters = map[string]bool{
+	"AWSAccessKeyId":   true,
+	"Signature":        true,
+	"SignatureMethod":  true,
+	"SignatureVersion": true,
+	"Timestamp":        true,
+	"Version":          true,
+}
+
+// checkExtraParameters returns ErrReservedParameter if ExtraParameters
+// include a reserved parameter.
+func (sdb *SimpleDB) checkExtraParameters() error {
+	for k := range sdb.ExtraParameters {
+		if reservedParameters[k] {
+			return fmt.Errorf("%w %s in ExtraParameters, use APIVersion to set the Version", ErrReservedParameter, k)
+		}
+	}
+	return nil
+}
+
+// percentEncode encodes s as required by Signature Version 2: every byte
+// except the RFC 3986 unreserved characters A-Z, a-z, 0-9, '-', '_', '.' and
+// '~' is written as %XX with upper case hex digits. Spaces become %20, never
+// '+', and '*' is always encoded.
+func percentEncode(s string) string {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if !unreserved(s[i]) {
+			n++
+		}
+	}
+	if n == 0 {
+		return s
+	}
+	b := make([]byte, 0, len(s)+2*n)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if unreserved(c) {
+			b = append(b, c)
+		} else {
+			b = append(b, '%', upperhex[c>>4], upperhex[c&15])
+		}
+	}
+	return string(b)
+}
+
+func unreserved(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '_' || c == '.' || c == '~'
+}
+
+// encodeParameters returns p as a query string sorted by byte order of the
+// parameter names, the form used both on the wire and in the string to sign.
+func encodeParameters(p url.Values) string {
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		for _, v := range p[k] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(percentEncode(k))
+			b.WriteByte('=')
+			b.WriteString(percentEncode(v))
+		}
+	}
+	return b.String()
+}
+
+func canonicalString(e Endpoint, p url.Values) string {
+	return "POST\n" + e.signHost() + "\n" + e.path() + "\n" + encodeParameters(p)
+}
+
+// SignRequest returns the body of a request with the action parameters p,
+// signed and encoded exactly as the client sends it given its Clock,
+// APIVersion and ExtraParameters. Reserved ExtraParameters are left out. No
+// request is made.
+func (sdb SimpleDB) SignRequest(p url.Values) string {
+	sdb.resetParameters()
+	for k, vs := range p {
+		sdb.p[k] = append([]string(nil), vs...)
+	}
+	sdb.addExtraParameters()
+	return sdb.signedBody()
+}
+
+// signedBody replaces the Signature of the parameters and encodes them.
+func (sdb *SimpleDB) signedBody() string {
+	sdb.p.Del("Signature")
+	sdb.p.Set("Signature", sdb.sign(canonicalString(sdb.endpoint(), sdb.p)))
+	return encodeParameters(sdb.p)
+}
@@ -0,0 +1,75 @@
+package sdb
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPercentEncode(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"", ""},
+		{"abcXYZ019", "abcXYZ019"},
+		{"-_.~", "-_.~"},
+		{" ", "%20"},
+		{"*", "%2A"},
+		{"+", "%2B"},
+		{"a b+c", "a%20b%2Bc"},
+		{"/?#[]@", "%2F%3F%23%5B%5D%40"},
+		{"!$&'()", "%21%24%26%27%28%29"},
+		{",;=:%", "%2C%3B%3D%3A%25"},
+		{"`\"<>\\^{|}", "%60%22%3C%3E%5C%5E%7B%7C%7D"},
+		{"\n\t", "%0A%09"},
+		{"å", "%C3%A5"},
+		{"日本", "%E6%97%A5%E6%9C%AC"},
+		{"\xff", "%FF"},
+	}
+	for _, tt := range tests {
+		if got := percentEncode(tt.in); got != tt.out {
+			t.Errorf("percentEncode(%q) = %s, want %s", tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestEncodeParameters(t *testing.T) {
+	p := url.Values{}
+	p.Add("b", "2")
+	p.Add("Attribute.1.Value", "x y*~")
+	p.Add("a", "1")
+	p.Add("a", "0")
+	want := "Attribute.1.Value=x%20y%2A~&a=1&a=0&b=2"
+	if got := encodeParameters(p); got != want {
+		t.Errorf("encodeParameters = %s, want %s", got, want)
+	}
+}
+
+func TestParameterOverrides(t *testing.T) {
+	c := NewSimpleDB("a", "s", SDBRegionEUWest1)
+	c.APIVersion = "2007-11-07"
+	c.ExtraParameters = url.Values{"Vendor.Flag": {"1"}}
+	w := c.WithParameters(url.Values{"Vendor.Flag": {"2"}})
+	if c.ExtraParameters.Get("Vendor.Flag") != "1" {
+		t.Error("WithParameters modified the original client")
+	}
+	w.resetParameters()
+	if v := w.p.Get("Version"); v != "2007-11-07" {
+		t.Errorf("Version = %s", v)
+	}
+	w.addExtraParameters()
+	if v := w.p.Get("Vendor.Flag"); v != "2" {
+		t.Errorf("Vendor.Flag after overrides = %s", v)
+	}
+
+	for _, k := range []string{"Signature", "AWSAccessKeyId", "Timestamp", "Version", "SignatureMethod"} {
+		r := c.WithParameters(url.Values{k: {"x"}})
+		if _, err := r.ListDomains(); !errors.Is(err, ErrReservedParameter) {
+			t.Errorf("%s: expected ErrReservedParameter, got %v", k, err)
+		}
+		if body := r.SignRequest(url.Values{"Action": {"ListDomains"}}); strings.Contains(body, k+"=x") {
+			t.Errorf("%s: SignRequest included the reserved parameter: %s", k, body)
+		}
+	}
+}